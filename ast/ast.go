@@ -2,8 +2,8 @@ package ast
 
 import (
 	"bytes"
-	"fmt"
 	"mokey-type/token"
+	"sort"
 	"strings"
 )
 
@@ -26,10 +26,21 @@ type Program struct {
 	Statements []Statement
 }
 
+// String prints the program as source that parses back to the same tree.
 func (p *Program) String() string {
+	return joinStatements(p.Statements)
+}
+
+// joinStatements puts a semicolon after every expression statement but the
+// last, without it the next statement could read as a call or an index of
+// the expression.
+func joinStatements(statements []Statement) string {
 	var out bytes.Buffer
-	for _, s := range p.Statements {
+	for i, s := range statements {
 		out.WriteString(s.String())
+		if _, ok := s.(*ExpressionStatement); ok && i < len(statements)-1 {
+			out.WriteString(";")
+		}
 	}
 	return out.String()
 }
@@ -45,6 +56,7 @@ func (p *Program) TokenLiteral() string {
 type LetStatement struct {
 	Token token.Token
 	Name  *Identifier
+	Type  *TypeAnnotation
 	Value Expression
 }
 
@@ -57,6 +69,9 @@ func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 	out.WriteString(ls.TokenLiteral() + " ")
 	out.WriteString(ls.Name.String())
+	if ls.Type != nil {
+		out.WriteString(": " + ls.Type.String())
+	}
 	out.WriteString(" = ")
 	if ls.Value != nil {
 		out.WriteString(ls.Value.String())
@@ -170,15 +185,15 @@ func (b *Boolean) String() string       { return b.Token.Literal }
 type BlockStatement struct {
 	Token      token.Token
 	Statements []Statement
+	// Close is the closing brace, it marks where the block ends
+	Close token.Token
 }
 
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+
+// String prints the statements without the braces.
 func (bs *BlockStatement) String() string {
-	var out bytes.Buffer
-	for _, s := range bs.Statements {
-		out.WriteString(s.String())
-	}
-	return out.String()
+	return joinStatements(bs.Statements)
 }
 
 type IfExpression struct {
@@ -192,13 +207,15 @@ func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
-	out.WriteString("if")
+	out.WriteString("if (")
 	out.WriteString(ie.Condition.String())
-	out.WriteString(" ")
+	out.WriteString(") {")
 	out.WriteString(ie.Consequence.String())
+	out.WriteString("}")
 	if ie.Alternative != nil {
-		out.WriteString("else ")
+		out.WriteString(" else {")
 		out.WriteString(ie.Alternative.String())
+		out.WriteString("}")
 	}
 	return out.String()
 }
@@ -208,6 +225,10 @@ type FunctionLiteral struct {
 	Parameters []*Identifier
 	Body       *BlockStatement
 	Name       string
+	// ParameterTypes has an entry for every parameter, nil when it has no
+	// annotation
+	ParameterTypes []*TypeAnnotation
+	ReturnType     *TypeAnnotation
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -216,19 +237,25 @@ func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	params := []string{}
 
-	for _, value := range fl.Parameters {
+	for i, value := range fl.Parameters {
 		if value != nil {
-			params = append(params, value.String())
+			param := value.String()
+			if i < len(fl.ParameterTypes) && fl.ParameterTypes[i] != nil {
+				param += ": " + fl.ParameterTypes[i].String()
+			}
+			params = append(params, param)
 		}
 	}
 	out.WriteString(fl.TokenLiteral())
-	if fl.Name != "" {
-		out.WriteString(fmt.Sprintf("<%s>", fl.Name))
-	}
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(")")
+	if fl.ReturnType != nil {
+		out.WriteString(" -> " + fl.ReturnType.String())
+	}
+	out.WriteString(" {")
 	out.WriteString(fl.Body.String())
+	out.WriteString("}")
 
 	return out.String()
 }
@@ -264,7 +291,18 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
-func (sl *StringLiteral) String() string       { return sl.Token.Literal }
+func (sl *StringLiteral) String() string       { return `"` + sl.Value + `"` }
+
+// ImportExpression evaluates to the exported bindings of the module at
+// Path.
+type ImportExpression struct {
+	Token token.Token
+	Path  *StringLiteral
+}
+
+func (ie *ImportExpression) expressionNode()      {}
+func (ie *ImportExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *ImportExpression) String() string       { return "import " + ie.Path.String() }
 
 type ArrayLiteral struct {
 	Token    token.Token
@@ -306,6 +344,22 @@ func (ie *IndexExpression) String() string {
 type HashLiteral struct {
 	Token token.Token
 	Pairs map[Expression]Expression
+	// Keys holds the keys of Pairs in source order when the parser built it
+	Keys []Expression
+}
+
+// OrderedKeys returns the keys in source order, or sorted by their text
+// for literals that were built without Keys.
+func (hl *HashLiteral) OrderedKeys() []Expression {
+	if len(hl.Keys) == len(hl.Pairs) {
+		return hl.Keys
+	}
+	keys := []Expression{}
+	for key := range hl.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	return keys
 }
 
 func (hl *HashLiteral) expressionNode()      {}
@@ -313,8 +367,8 @@ func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
 func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.OrderedKeys() {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
@@ -335,13 +389,48 @@ func (fr *ForLoop) TokenLiteral() string { return fr.Token.Literal }
 func (fr *ForLoop) String() string {
 	var out bytes.Buffer
 
-	out.WriteString("for")
-	out.WriteString("(")
+	out.WriteString("for (")
 	out.WriteString(fr.Declaration.String())
+	out.WriteString(" ")
 	out.WriteString(fr.Condition.String())
-	out.WriteString(";")
+	out.WriteString("; ")
 	out.WriteString(fr.Consequence.String())
-	out.WriteString(")")
+	out.WriteString(") {")
 	out.WriteString(fr.Body.String())
+	out.WriteString("}")
 	return out.String()
 }
+
+// TypeAnnotation is a type written in the source. The token tells which
+// kind it is: a name like int, an array [Element], a hash {Key: Value} or a
+// function fn(Parameters) -> Return, where the return type is optional.
+type TypeAnnotation struct {
+	Token      token.Token
+	Name       string
+	Element    *TypeAnnotation
+	Key        *TypeAnnotation
+	Value      *TypeAnnotation
+	Parameters []*TypeAnnotation
+	Return     *TypeAnnotation
+}
+
+func (ta *TypeAnnotation) TokenLiteral() string { return ta.Token.Literal }
+func (ta *TypeAnnotation) String() string {
+	switch ta.Token.Type {
+	case token.LBRACKET:
+		return "[" + ta.Element.String() + "]"
+	case token.LBRACE:
+		return "{" + ta.Key.String() + ": " + ta.Value.String() + "}"
+	case token.FUNCTION:
+		params := []string{}
+		for _, p := range ta.Parameters {
+			params = append(params, p.String())
+		}
+		out := "fn(" + strings.Join(params, ", ") + ")"
+		if ta.Return != nil {
+			out += " -> " + ta.Return.String()
+		}
+		return out
+	}
+	return ta.Name
+}
@@ -0,0 +1,149 @@
+package ast
+
+import (
+	"mokey-type/token"
+	"reflect"
+)
+
+// Inspect walks the tree in source order calling f for every node. When f
+// returns false the children of that node are skipped. Nil children, which
+// the parser leaves behind on errors, are never passed to f.
+func Inspect(node Node, f func(Node) bool) {
+	if isNil(node) || !f(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for _, s := range node.Statements {
+			Inspect(s, f)
+		}
+	case *LetStatement:
+		if node.Name != nil {
+			Inspect(node.Name, f)
+		}
+		Inspect(node.Value, f)
+	case *ReturnStatement:
+		Inspect(node.ReturnValue, f)
+	case *ExpressionStatement:
+		Inspect(node.Expression, f)
+	case *BlockStatement:
+		for _, s := range node.Statements {
+			Inspect(s, f)
+		}
+	case *PrefixExpression:
+		Inspect(node.Right, f)
+	case *InfixExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Right, f)
+	case *IfExpression:
+		Inspect(node.Condition, f)
+		if node.Consequence != nil {
+			Inspect(node.Consequence, f)
+		}
+		if node.Alternative != nil {
+			Inspect(node.Alternative, f)
+		}
+	case *FunctionLiteral:
+		for _, p := range node.Parameters {
+			Inspect(p, f)
+		}
+		if node.Body != nil {
+			Inspect(node.Body, f)
+		}
+	case *CallExpression:
+		Inspect(node.Function, f)
+		for _, a := range node.Arguments {
+			Inspect(a, f)
+		}
+	case *ImportExpression:
+		Inspect(node.Path, f)
+	case *ArrayLiteral:
+		for _, e := range node.Elements {
+			Inspect(e, f)
+		}
+	case *IndexExpression:
+		Inspect(node.Left, f)
+		Inspect(node.Index, f)
+	case *HashLiteral:
+		for _, key := range node.OrderedKeys() {
+			Inspect(key, f)
+			Inspect(node.Pairs[key], f)
+		}
+	case *ForLoop:
+		Inspect(&node.Declaration, f)
+		Inspect(node.Condition, f)
+		Inspect(node.Consequence, f)
+		if node.Body != nil {
+			Inspect(node.Body, f)
+		}
+	}
+}
+
+func isNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+	v := reflect.ValueOf(node)
+	return v.Kind() == reflect.Ptr && v.IsNil()
+}
+
+// Start returns the first token of node. Infix, call and index expressions
+// keep their operator in Token, so they start at their left operand.
+func Start(node Node) token.Token {
+	switch node := node.(type) {
+	case *Program:
+		if len(node.Statements) > 0 {
+			return Start(node.Statements[0])
+		}
+	case *ExpressionStatement:
+		if !isNil(node.Expression) {
+			return Start(node.Expression)
+		}
+		return node.Token
+	case *InfixExpression:
+		if !isNil(node.Left) {
+			return Start(node.Left)
+		}
+		return node.Token
+	case *CallExpression:
+		if !isNil(node.Function) {
+			return Start(node.Function)
+		}
+		return node.Token
+	case *IndexExpression:
+		if !isNil(node.Left) {
+			return Start(node.Left)
+		}
+		return node.Token
+	case *LetStatement:
+		return node.Token
+	case *ReturnStatement:
+		return node.Token
+	case *BlockStatement:
+		return node.Token
+	case *Identifier:
+		return node.Token
+	case *IntegerLiteral:
+		return node.Token
+	case *StringLiteral:
+		return node.Token
+	case *Boolean:
+		return node.Token
+	case *PrefixExpression:
+		return node.Token
+	case *IfExpression:
+		return node.Token
+	case *FunctionLiteral:
+		return node.Token
+	case *ArrayLiteral:
+		return node.Token
+	case *HashLiteral:
+		return node.Token
+	case *ForLoop:
+		return node.Token
+	case *ImportExpression:
+		return node.Token
+	}
+	return token.Token{}
+}
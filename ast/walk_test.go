@@ -0,0 +1,72 @@
+package ast
+
+import (
+	"mokey-type/token"
+	"testing"
+)
+
+func ident(name string) *Identifier {
+	return &Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+}
+
+func TestInspect(t *testing.T) {
+	// let f = fn(x) { x + y }; f({"k": z})
+	key := &StringLiteral{Token: token.Token{Type: token.STRING, Literal: "k"}, Value: "k"}
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let"},
+				Name:  ident("f"),
+				Value: &FunctionLiteral{
+					Parameters: []*Identifier{ident("x")},
+					Body: &BlockStatement{Statements: []Statement{
+						&ExpressionStatement{Expression: &InfixExpression{
+							Left: ident("x"), Operator: "+", Right: ident("y"),
+						}},
+					}},
+				},
+			},
+			&ExpressionStatement{Expression: &CallExpression{
+				Function: ident("f"),
+				Arguments: []Expression{&HashLiteral{
+					Pairs: map[Expression]Expression{key: ident("z")},
+					Keys:  []Expression{key},
+				}},
+			}},
+			// the parser leaves nil behind after an error
+			&ExpressionStatement{Expression: nil},
+			&ReturnStatement{ReturnValue: (*Identifier)(nil)},
+		},
+	}
+
+	names := []string{}
+	Inspect(program, func(node Node) bool {
+		if id, ok := node.(*Identifier); ok {
+			names = append(names, id.Value)
+		}
+		_, isFunction := node.(*FunctionLiteral)
+		return !isFunction || len(names) == 1
+	})
+
+	expected := []string{"f", "x", "x", "y", "f", "z"}
+	if len(names) != len(expected) {
+		t.Fatalf("wrong identifiers. want=%v, got=%v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("wrong identifiers. want=%v, got=%v", expected, names)
+		}
+	}
+
+	skipped := []string{}
+	Inspect(program, func(node Node) bool {
+		if id, ok := node.(*Identifier); ok {
+			skipped = append(skipped, id.Value)
+		}
+		_, isFunction := node.(*FunctionLiteral)
+		return !isFunction
+	})
+	if len(skipped) != 3 {
+		t.Errorf("function body was not skipped. got=%v", skipped)
+	}
+}
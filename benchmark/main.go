@@ -1,19 +1,24 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"os"
 	"time"
 
+	"mokey-type/closure"
 	"mokey-type/compiler"
 	"mokey-type/evaluator"
 	"mokey-type/lexer"
 	"mokey-type/object"
 	"mokey-type/parser"
+	"mokey-type/regvm"
 	"mokey-type/vm"
 )
 
-var engine = flag.String("engine", "vm", "use 'vm' or 'eval'")
+var engine = flag.String("engine", "vm", "use 'vm', 'regvm', 'closure' or 'eval'")
+var profile = flag.String("profile", "", "write a pprof profile of the vm to this file and print where the time went")
 
 var input = `
 let fibonacci = fn(x) {
@@ -32,6 +37,10 @@ fibonacci(35);
 
 func main() {
 	flag.Parse()
+	if *profile != "" && *engine != "vm" {
+		fmt.Printf("-profile only works with -engine=vm\n")
+		return
+	}
 	var duration time.Duration
 	var result object.Object
 
@@ -39,7 +48,8 @@ func main() {
 	p := parser.New(l)
 	program := p.ParseProgram()
 
-	if *engine == "vm" {
+	switch *engine {
+	case "vm":
 		comp := compiler.New()
 		err := comp.Compile(program)
 		if err != nil {
@@ -47,6 +57,11 @@ func main() {
 			return
 		}
 		machine := vm.New(comp.Bytecode())
+		var profiler *vm.Profiler
+		if *profile != "" {
+			profiler = vm.NewProfiler(time.Millisecond)
+			machine.SetProfiler(profiler)
+		}
 
 		start := time.Now()
 
@@ -58,7 +73,47 @@ func main() {
 
 		duration = time.Since(start)
 		result = machine.LastPopedStackElement()
-	} else {
+
+		if profiler != nil {
+			profiler.Report(os.Stdout)
+			if err := writeProfile(*profile, profiler); err != nil {
+				fmt.Printf("profile error: %s\n", err)
+				return
+			}
+		}
+
+	case "regvm":
+		comp := regvm.NewCompiler()
+		err := comp.Compile(program)
+		if err != nil {
+			fmt.Printf("compiler error: %s\n", err)
+			return
+		}
+		machine := regvm.New(comp.Bytecode())
+
+		start := time.Now()
+
+		err = machine.Run()
+		if err != nil {
+			fmt.Printf("vm error: %s\n", err)
+			return
+		}
+
+		duration = time.Since(start)
+		result = machine.LastPopedStackElement()
+
+	case "closure":
+		compiled, err := closure.New().Compile(program)
+		if err != nil {
+			fmt.Printf("compiler error: %s\n", err)
+			return
+		}
+
+		start := time.Now()
+		result = compiled.Run()
+		duration = time.Since(start)
+
+	default:
 		env := object.NewEnviroment()
 		start := time.Now()
 		result = evaluator.Eval(program, env)
@@ -67,3 +122,11 @@ func main() {
 
 	fmt.Printf("engine=%s, result=%s, duration=%s\n", *engine, result.Inspect(), duration)
 }
+
+func writeProfile(path string, profiler *vm.Profiler) error {
+	var buf bytes.Buffer
+	if err := profiler.Profile("benchmark.mk").Write(&buf); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"mokey-type/ast"
+	"mokey-type/compiler"
+	"mokey-type/lexer"
+	"mokey-type/module"
+	"mokey-type/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// build compiles a source file and writes its bytecode as a .mkc file.
+func build(args []string) error {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	output := flags.String("o", "", "output file, defaults to the input with a .mkc extension")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: mokey-type build [-o out.mkc] file.mk")
+	}
+	path := flags.Arg(0)
+
+	bytecode, err := compileFile(path)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		*output = strings.TrimSuffix(path, filepath.Ext(path)) + ".mkc"
+	}
+
+	var buf bytes.Buffer
+	err = bytecode.Encode(&buf)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(*output, buf.Bytes(), 0644)
+}
+
+func compileFile(path string) (*compiler.Bytecode, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return compileSource(path, string(source))
+}
+
+func compileSource(path, source string) (*compiler.Bytecode, error) {
+	program, err := parseSource(path, source)
+	if err != nil {
+		return nil, err
+	}
+
+	comp := compiler.New()
+	comp.EnableImports(path, module.NewLoader(module.SearchPath()))
+	err = comp.Compile(program)
+	if err != nil {
+		return nil, fmt.Errorf("%s: compiling bytecode failed: %s", path, err)
+	}
+	return comp.Bytecode(), nil
+}
+
+func parseFile(path string) (*ast.Program, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseSource(path, string(source))
+}
+
+func parseSource(path, source string) (*ast.Program, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s: parser errors:\n\t%s", path, strings.Join(p.Errors(), "\n\t"))
+	}
+	return program, nil
+}
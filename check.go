@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mokey-type/types"
+	"os"
+)
+
+const checkUsage = "mokey-type check file.mk..."
+
+const checkDoc = `Checks the files against their optional type annotations, like
+let x: int = 5 and fn(a: string, b: [int]) -> bool. What is not annotated
+is inferred where it can be and is any where it can't, any is accepted
+wherever a type is expected, so code without annotations checks like it
+runs.`
+
+// checkFiles type checks source files against their annotations.
+func checkFiles(args []string) error {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	usage(flags, checkUsage, checkDoc)
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: %s", checkUsage)
+	}
+
+	failed := 0
+	for _, path := range flags.Args() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		program, err := parseSource(path, string(source))
+		if err != nil {
+			return err
+		}
+		for _, err := range types.Check(program) {
+			fmt.Printf("%s:%d:%d: %s\n", path, err.Token.Line, err.Token.Column, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("check: %d error(s)", failed)
+	}
+	return nil
+}
@@ -0,0 +1,595 @@
+// Package closure runs programs by compiling the ast once into a tree of Go
+// closures. It follows the evaluator's semantics, errors are *object.Error
+// values, but every variable is resolved to a slot before the program runs.
+package closure
+
+import (
+	"fmt"
+	"mokey-type/ast"
+	"mokey-type/object"
+	"sort"
+)
+
+var (
+	TRUE  = &object.Boolean{Value: true}
+	FALSE = &object.Boolean{Value: false}
+	NULL  = &object.NullValue{}
+)
+
+type evalFn func(*env) object.Object
+
+// scope maps the names of one function body to their slot in the env.
+type scope struct {
+	slots map[string]int
+	outer *scope
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{slots: make(map[string]int), outer: outer}
+}
+
+func (s *scope) declare(name string) int {
+	if index, ok := s.slots[name]; ok {
+		return index
+	}
+	index := len(s.slots)
+	s.slots[name] = index
+	return index
+}
+
+type Engine struct {
+	globals *globals
+}
+
+func New() *Engine {
+	return &Engine{globals: &globals{names: make(map[string]int)}}
+}
+
+type Program struct {
+	statements []evalFn
+}
+
+func (e *Engine) Compile(program *ast.Program) (*Program, error) {
+	c := &compiler{globals: e.globals}
+	compiled := &Program{}
+	for _, s := range program.Statements {
+		fn, err := c.compileStatement(s)
+		if err != nil {
+			return nil, err
+		}
+		compiled.statements = append(compiled.statements, fn)
+	}
+	return compiled, nil
+}
+
+func (p *Program) Run() object.Object {
+	var result object.Object = NULL
+	for _, statement := range p.statements {
+		result = statement(nil)
+		switch result := result.(type) {
+		case *object.ReturnValue:
+			return result.Value
+		case *object.Error:
+			return result
+		}
+	}
+	return result
+}
+
+// RunProgram compiles program on a new engine and runs it, errors are
+// returned as *object.Error values like Run does.
+func RunProgram(program *ast.Program) (object.Object, error) {
+	compiled, err := New().Compile(program)
+	if err != nil {
+		return nil, err
+	}
+	return compiled.Run(), nil
+}
+
+type compiler struct {
+	globals *globals
+	// scope is nil at the top level, where every binding is a global
+	scope *scope
+}
+
+func (c *compiler) compileStatement(node ast.Statement) (evalFn, error) {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		return c.compileExpression(node.Expression)
+
+	case *ast.LetStatement:
+		value, err := c.compileExpression(node.Value)
+		if err != nil {
+			return nil, err
+		}
+		set := c.setter(node.Name.Value)
+		return func(e *env) object.Object {
+			v := value(e)
+			if abrupt(v) {
+				return v
+			}
+			set(e, v)
+			return NULL
+		}, nil
+
+	case *ast.ReturnStatement:
+		value, err := c.compileExpression(node.ReturnValue)
+		if err != nil {
+			return nil, err
+		}
+		return func(e *env) object.Object {
+			v := value(e)
+			if abrupt(v) {
+				return v
+			}
+			return &object.ReturnValue{Value: v}
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported statement %T", node)
+}
+
+func (c *compiler) compileBlock(block *ast.BlockStatement) (evalFn, error) {
+	statements := make([]evalFn, 0, len(block.Statements))
+	for _, s := range block.Statements {
+		fn, err := c.compileStatement(s)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, fn)
+	}
+
+	switch len(statements) {
+	case 0:
+		return func(*env) object.Object { return NULL }, nil
+	case 1:
+		return statements[0], nil
+	}
+	return func(e *env) object.Object {
+		var result object.Object
+		for _, statement := range statements {
+			result = statement(e)
+			if abrupt(result) {
+				return result
+			}
+		}
+		return result
+	}, nil
+}
+
+func (c *compiler) compileExpression(node ast.Expression) (evalFn, error) {
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		return func(*env) object.Object { return integer }, nil
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		return func(*env) object.Object { return str }, nil
+
+	case *ast.Boolean:
+		boolean := nativeBoolToBooleanObject(node.Value)
+		return func(*env) object.Object { return boolean }, nil
+
+	case *ast.Identifier:
+		return c.resolve(c.scope, 0, node.Value), nil
+
+	case *ast.PrefixExpression:
+		return c.compilePrefix(node)
+
+	case *ast.InfixExpression:
+		return c.compileInfix(node)
+
+	case *ast.IfExpression:
+		return c.compileIf(node)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node)
+
+	case *ast.CallExpression:
+		return c.compileCall(node)
+
+	case *ast.ArrayLiteral:
+		elements, err := c.compileExpressions(node.Elements)
+		if err != nil {
+			return nil, err
+		}
+		return func(e *env) object.Object {
+			values := make([]object.Object, len(elements))
+			for i, element := range elements {
+				v := element(e)
+				if abrupt(v) {
+					return v
+				}
+				values[i] = v
+			}
+			return &object.Array{Elements: values}
+		}, nil
+
+	case *ast.HashLiteral:
+		return c.compileHash(node)
+
+	case *ast.IndexExpression:
+		left, err := c.compileExpression(node.Left)
+		if err != nil {
+			return nil, err
+		}
+		index, err := c.compileExpression(node.Index)
+		if err != nil {
+			return nil, err
+		}
+		return func(e *env) object.Object {
+			l := left(e)
+			if abrupt(l) {
+				return l
+			}
+			i := index(e)
+			if abrupt(i) {
+				return i
+			}
+			return evalIndexExpression(l, i)
+		}, nil
+
+	case *ast.ForLoop:
+		return c.compileForLoop(node)
+	}
+	return nil, fmt.Errorf("unsupported expression %T", node)
+}
+
+func (c *compiler) compileExpressions(nodes []ast.Expression) ([]evalFn, error) {
+	fns := make([]evalFn, 0, len(nodes))
+	for _, node := range nodes {
+		fn, err := c.compileExpression(node)
+		if err != nil {
+			return nil, err
+		}
+		fns = append(fns, fn)
+	}
+	return fns, nil
+}
+
+// resolve looks the name up from the innermost scope outwards. A slot that
+// was declared but not assigned yet falls back to the outer scopes, the same
+// way the evaluator's environment lookup does.
+func (c *compiler) resolve(s *scope, depth int, name string) evalFn {
+	for ; s != nil; s = s.outer {
+		if index, ok := s.slots[name]; ok {
+			outer := c.resolve(s.outer, depth+1, name)
+			if depth == 0 {
+				return func(e *env) object.Object {
+					if v := e.slots[index]; v != nil {
+						return v
+					}
+					return outer(e)
+				}
+			}
+			return func(e *env) object.Object {
+				if v := e.up(depth).slots[index]; v != nil {
+					return v
+				}
+				return outer(e)
+			}
+		}
+		depth++
+	}
+
+	g := c.globals
+	index := g.slot(name)
+	builtin := object.GetBuiltinByName(name)
+	return func(*env) object.Object {
+		if v := g.values[index]; v != nil {
+			return v
+		}
+		if builtin != nil {
+			return builtin
+		}
+		return newError("identifier not found: " + name)
+	}
+}
+
+func (c *compiler) setter(name string) func(*env, object.Object) {
+	if c.scope == nil {
+		g := c.globals
+		index := g.slot(name)
+		return func(_ *env, v object.Object) { g.values[index] = v }
+	}
+	index := c.scope.declare(name)
+	return func(e *env, v object.Object) { e.slots[index] = v }
+}
+
+func (c *compiler) compilePrefix(node *ast.PrefixExpression) (evalFn, error) {
+	right, err := c.compileExpression(node.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	var operator func(object.Object) object.Object
+	switch node.Operator {
+	case "!":
+		operator = func(v object.Object) object.Object {
+			return nativeBoolToBooleanObject(!isTruthy(v))
+		}
+	case "-":
+		operator = integerPrefix("-", func(v int64) int64 { return -v })
+	case "++":
+		operator = integerPrefix("++", func(v int64) int64 { return v + 1 })
+	case "--":
+		operator = integerPrefix("--", func(v int64) int64 { return v - 1 })
+	default:
+		return nil, fmt.Errorf("unknown operator %s", node.Operator)
+	}
+
+	return func(e *env) object.Object {
+		v := right(e)
+		if abrupt(v) {
+			return v
+		}
+		return operator(v)
+	}, nil
+}
+
+func integerPrefix(operator string, fn func(int64) int64) func(object.Object) object.Object {
+	return func(v object.Object) object.Object {
+		integer, ok := v.(*object.Integer)
+		if !ok {
+			return newError("unknown operator: %s%s", operator, v.Type())
+		}
+		return &object.Integer{Value: fn(integer.Value)}
+	}
+}
+
+var integerOperators = map[string]func(a, b int64) object.Object{
+	"+": func(a, b int64) object.Object { return &object.Integer{Value: a + b} },
+	"-": func(a, b int64) object.Object { return &object.Integer{Value: a - b} },
+	"*": func(a, b int64) object.Object { return &object.Integer{Value: a * b} },
+	"/": func(a, b int64) object.Object {
+		if b == 0 {
+			return newError("division by zero")
+		}
+		return &object.Integer{Value: a / b}
+	},
+	"==": func(a, b int64) object.Object { return nativeBoolToBooleanObject(a == b) },
+	"!=": func(a, b int64) object.Object { return nativeBoolToBooleanObject(a != b) },
+	">":  func(a, b int64) object.Object { return nativeBoolToBooleanObject(a > b) },
+	"<":  func(a, b int64) object.Object { return nativeBoolToBooleanObject(a < b) },
+}
+
+func (c *compiler) compileInfix(node *ast.InfixExpression) (evalFn, error) {
+	operator := node.Operator
+	integerOperator, ok := integerOperators[operator]
+	if !ok {
+		return nil, fmt.Errorf("unknown operator %s", operator)
+	}
+	left, err := c.compileExpression(node.Left)
+	if err != nil {
+		return nil, err
+	}
+	right, err := c.compileExpression(node.Right)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(e *env) object.Object {
+		l := left(e)
+		if abrupt(l) {
+			return l
+		}
+		r := right(e)
+		if abrupt(r) {
+			return r
+		}
+		if li, ok := l.(*object.Integer); ok {
+			if ri, ok := r.(*object.Integer); ok {
+				return integerOperator(li.Value, ri.Value)
+			}
+		}
+		return evalInfixExpression(operator, l, r)
+	}, nil
+}
+
+func (c *compiler) compileIf(node *ast.IfExpression) (evalFn, error) {
+	condition, err := c.compileExpression(node.Condition)
+	if err != nil {
+		return nil, err
+	}
+	consequence, err := c.compileBlock(node.Consequence)
+	if err != nil {
+		return nil, err
+	}
+	alternative := func(*env) object.Object { return NULL }
+	if node.Alternative != nil {
+		alternative, err = c.compileBlock(node.Alternative)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func(e *env) object.Object {
+		v := condition(e)
+		if abrupt(v) {
+			return v
+		}
+		if isTruthy(v) {
+			return consequence(e)
+		}
+		return alternative(e)
+	}, nil
+}
+
+func (c *compiler) compileFunction(node *ast.FunctionLiteral) (evalFn, error) {
+	s := newScope(c.scope)
+	params := make([]int, len(node.Parameters))
+	for i, p := range node.Parameters {
+		params[i] = s.declare(p.Value)
+	}
+	// declaring the lets up front lets nested functions refer to bindings
+	// that are defined later in the body
+	declareLets(s, node.Body.Statements)
+
+	c.scope = s
+	body, err := c.compileBlock(node.Body)
+	c.scope = s.outer
+	if err != nil {
+		return nil, err
+	}
+
+	size := len(s.slots)
+	return func(e *env) object.Object {
+		return &Function{Literal: node, params: params, size: size, body: body, env: e}
+	}, nil
+}
+
+func declareLets(s *scope, statements []ast.Statement) {
+	for _, statement := range statements {
+		switch statement := statement.(type) {
+		case *ast.LetStatement:
+			s.declare(statement.Name.Value)
+		case *ast.ExpressionStatement:
+			switch expression := statement.Expression.(type) {
+			case *ast.IfExpression:
+				declareLets(s, expression.Consequence.Statements)
+				if expression.Alternative != nil {
+					declareLets(s, expression.Alternative.Statements)
+				}
+			case *ast.ForLoop:
+				s.declare(expression.Declaration.Name.Value)
+				declareLets(s, expression.Body.Statements)
+			}
+		}
+	}
+}
+
+func (c *compiler) compileCall(node *ast.CallExpression) (evalFn, error) {
+	function, err := c.compileExpression(node.Function)
+	if err != nil {
+		return nil, err
+	}
+	args, err := c.compileExpressions(node.Arguments)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(e *env) object.Object {
+		callee := function(e)
+		if abrupt(callee) {
+			return callee
+		}
+
+		switch callee := callee.(type) {
+		case *Function:
+			if len(args) != len(callee.params) {
+				return newError("wrong number of arguments: want=%d, got=%d", len(callee.params), len(args))
+			}
+			frame := &env{slots: make([]object.Object, callee.size), outer: callee.env}
+			for i, arg := range args {
+				v := arg(e)
+				if abrupt(v) {
+					return v
+				}
+				frame.slots[callee.params[i]] = v
+			}
+			return callee.run(frame)
+
+		case *object.Builtin:
+			values := make([]object.Object, len(args))
+			for i, arg := range args {
+				v := arg(e)
+				if abrupt(v) {
+					return v
+				}
+				values[i] = v
+			}
+			return callBuiltin(callee, values)
+
+		default:
+			return newError("not a function: %s", callee.Type())
+		}
+	}, nil
+}
+
+func (c *compiler) compileHash(node *ast.HashLiteral) (evalFn, error) {
+	keys := []ast.Expression{}
+	for k := range node.Pairs {
+		keys = append(keys, k)
+	}
+	// the pairs are a map, sort them so the evaluation order is stable
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+
+	type pair struct{ key, value evalFn }
+	pairs := make([]pair, 0, len(keys))
+	for _, k := range keys {
+		key, err := c.compileExpression(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := c.compileExpression(node.Pairs[k])
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair{key, value})
+	}
+
+	return func(e *env) object.Object {
+		hash := make(map[object.HashKey]object.HashPair, len(pairs))
+		for _, p := range pairs {
+			key := p.key(e)
+			if abrupt(key) {
+				return key
+			}
+			hashKey, ok := key.(object.Hashable)
+			if !ok {
+				return newError("unusable as hash key: %s", key.Type())
+			}
+			value := p.value(e)
+			if abrupt(value) {
+				return value
+			}
+			hash[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return &object.Hash{Pairs: hash}
+	}, nil
+}
+
+func (c *compiler) compileForLoop(node *ast.ForLoop) (evalFn, error) {
+	declaration, err := c.compileStatement(&node.Declaration)
+	if err != nil {
+		return nil, err
+	}
+	condition, err := c.compileExpression(node.Condition)
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.compileBlock(node.Body)
+	if err != nil {
+		return nil, err
+	}
+	consequence, err := c.compileExpression(node.Consequence)
+	if err != nil {
+		return nil, err
+	}
+	set := c.setter(node.Declaration.Name.Value)
+
+	return func(e *env) object.Object {
+		if v := declaration(e); abrupt(v) {
+			return v
+		}
+		for {
+			v := condition(e)
+			if abrupt(v) {
+				return v
+			}
+			if !isTruthy(v) {
+				return NULL
+			}
+			if v := body(e); abrupt(v) {
+				return v
+			}
+			v = consequence(e)
+			if abrupt(v) {
+				return v
+			}
+			set(e, v)
+		}
+	}, nil
+}
@@ -0,0 +1,45 @@
+package closure
+
+import (
+	"mokey-type/conformance"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	for _, suite := range conformance.Suites {
+		t.Run(suite.Name, func(t *testing.T) {
+			conformance.Run(t, RunProgram, suite.Cases)
+		})
+	}
+}
+
+func TestEvaluatorConformance(t *testing.T) {
+	for _, suite := range conformance.EvaluatorSuites {
+		t.Run(suite.Name, func(t *testing.T) {
+			conformance.Run(t, RunProgram, suite.Cases)
+		})
+	}
+}
+
+func TestAssertErrors(t *testing.T) {
+	conformance.Run(t, RunProgram, conformance.AssertErrors)
+}
+
+func TestGlobalsPersistAcrossPrograms(t *testing.T) {
+	engine := New()
+	for _, input := range []string{"let a = 2;", "let double = fn(x) { x * a };"} {
+		compiled, err := engine.Compile(conformance.Parse(input))
+		if err != nil {
+			t.Fatalf("compile error: %s", err)
+		}
+		compiled.Run()
+	}
+
+	compiled, err := engine.Compile(conformance.Parse("double(21)"))
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	if err := conformance.CheckIntegerObject(42, compiled.Run()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,75 @@
+package closure
+
+import (
+	"bytes"
+	"mokey-type/ast"
+	"mokey-type/object"
+	"strings"
+)
+
+// env holds the slots of one function call. Slots are resolved at compile
+// time, so a variable is found by walking a known number of outer links.
+type env struct {
+	slots []object.Object
+	outer *env
+}
+
+func (e *env) up(depth int) *env {
+	for ; depth > 0; depth-- {
+		e = e.outer
+	}
+	return e
+}
+
+// globals is shared by every program compiled by the same Engine, which is
+// what keeps the bindings alive between repl lines.
+type globals struct {
+	names  map[string]int
+	values []object.Object
+}
+
+// Globals returns the value of every global the programs of e have set.
+func (e *Engine) Globals() map[string]object.Object {
+	globals := map[string]object.Object{}
+	for name, index := range e.globals.names {
+		if value := e.globals.values[index]; value != nil {
+			globals[name] = value
+		}
+	}
+	return globals
+}
+
+func (g *globals) slot(name string) int {
+	if index, ok := g.names[name]; ok {
+		return index
+	}
+	index := len(g.values)
+	g.names[name] = index
+	g.values = append(g.values, nil)
+	return index
+}
+
+type Function struct {
+	Literal *ast.FunctionLiteral
+
+	params []int
+	size   int
+	body   evalFn
+	env    *env
+}
+
+func (f *Function) Type() object.ObjectType { return object.FUNCTION_OBJ }
+func (f *Function) Inspect() string {
+	var out bytes.Buffer
+	params := []string{}
+	for _, p := range f.Literal.Parameters {
+		params = append(params, p.String())
+	}
+	out.WriteString("fn")
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") {\n")
+	out.WriteString(f.Literal.Body.String())
+	out.WriteString("\n}")
+	return out.String()
+}
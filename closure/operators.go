@@ -0,0 +1,131 @@
+package closure
+
+import (
+	"fmt"
+	"mokey-type/object"
+)
+
+func nativeBoolToBooleanObject(input bool) *object.Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.NullValue:
+		return false
+	default:
+		return true
+	}
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
+
+// abrupt reports whether obj stops the evaluation of the enclosing block,
+// either an error or a return value on its way out of the function.
+func abrupt(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Error, *object.ReturnValue:
+		return true
+	}
+	return false
+}
+
+// evalInfixExpression handles everything but two integers, which the
+// compiled infix closure does itself.
+func evalInfixExpression(operator string, left, right object.Object) object.Object {
+	switch {
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		leftValue, rightValue := left.(*object.String).Value, right.(*object.String).Value
+		switch operator {
+		case "+":
+			return &object.String{Value: leftValue + rightValue}
+		case "==":
+			return nativeBoolToBooleanObject(leftValue == rightValue)
+		case "!=":
+			return nativeBoolToBooleanObject(leftValue != rightValue)
+		}
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	case operator == "==":
+		return nativeBoolToBooleanObject(left == right)
+	case operator == "!=":
+		return nativeBoolToBooleanObject(left != right)
+	case left.Type() != right.Type():
+		return newError("type mismatch: %s %s %s", left.Type(), operator, right.Type())
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+		i := index.(*object.Integer).Value
+		if i < 0 || i > int64(len(elements)-1) {
+			return NULL
+		}
+		return elements[i]
+
+	case left.Type() == object.HASH_OBJ:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		pair, ok := left.(*object.Hash).Pairs[key.HashKey()]
+		if !ok {
+			return NULL
+		}
+		return pair.Value
+
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+// run executes the body of f in frame, its parameters already set.
+func (f *Function) run(frame *env) object.Object {
+	result := f.body(frame)
+	if returnValue, ok := result.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+	return result
+}
+
+// apply lets builtins call the functions they are given.
+func apply(fn object.Object, args ...object.Object) object.Object {
+	switch fn := fn.(type) {
+	case *Function:
+		if len(args) != len(fn.params) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(fn.params), len(args))
+		}
+		frame := &env{slots: make([]object.Object, fn.size), outer: fn.env}
+		for i, arg := range args {
+			frame.slots[fn.params[i]] = arg
+		}
+		return fn.run(frame)
+
+	case *object.Builtin:
+		return callBuiltin(fn, args)
+
+	default:
+		return newError("not a function: %s", fn.Type())
+	}
+}
+
+func callBuiltin(fn *object.Builtin, args []object.Object) object.Object {
+	switch result := fn.Call(apply, args...).(type) {
+	case nil:
+		return NULL
+	case *object.Boolean:
+		return nativeBoolToBooleanObject(result.Value)
+	default:
+		return result
+	}
+}
@@ -43,6 +43,12 @@ const (
 	OpGetFree
 	OpCurrentClosure
 	OpLoadInt
+	// OpCoverage counts a hit of the coverage counter in its operand
+	OpCoverage
+	// OpImport pushes the exports of the module whose function is the
+	// constant in its operand, the function runs the first time only
+	OpImport
+	OpLessThan
 )
 
 var definitions = map[Opcode]*Definition{
@@ -77,13 +83,25 @@ var definitions = map[Opcode]*Definition{
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
 	OpLoadInt:        {"OpLoadInt", []int{4}},
+	OpCoverage:       {"OpCoverage", []int{2}},
+	OpImport:         {"OpImport", []int{2}},
+	OpLessThan:       {"OpLessThan", []int{}},
+}
+
+// OperandsWidth is the number of bytes the operands take after the opcode.
+func (def *Definition) OperandsWidth() int {
+	width := 0
+	for _, w := range def.OperandWidths {
+		width += w
+	}
+	return width
 }
 
 func Lookup(op byte) (*Definition, error) {
 	def, ok := definitions[Opcode(op)]
 
 	if !ok {
-		return nil, fmt.Errorf("opcode %d undefined\n", op)
+		return nil, fmt.Errorf("opcode %d undefined", op)
 	}
 	return def, nil
 }
@@ -115,9 +133,14 @@ func (ins Instructions) String() string {
 	for i < len(ins) {
 		def, err := Lookup(ins[i])
 		if err != nil {
-			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			fmt.Fprintf(&out, "%04d ERROR: %s\n", i, err)
+			i++
 			continue
 		}
+		if i+1+def.OperandsWidth() > len(ins) {
+			fmt.Fprintf(&out, "%04d ERROR: %s is missing operands\n", i, def.Name)
+			break
+		}
 		operands, read := ReadOperands(def, ins[i+1:])
 		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
 		i += 1 + read
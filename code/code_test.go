@@ -53,6 +53,18 @@ func TestInstuctionString(t *testing.T) {
 	}
 }
 
+func TestInstructionStringInvalid(t *testing.T) {
+	concatted := Instructions{255, byte(OpAdd), byte(OpConstant), 1}
+	expected := `0000 ERROR: opcode 255 undefined
+0001 OpAdd
+0002 ERROR: OpConstant is missing operands
+`
+	if concatted.String() != expected {
+		t.Errorf("instructions wrongly formatted.\nwant=%q\n got=%q",
+			expected, concatted.String())
+	}
+}
+
 func TestReadOperands(t *testing.T) {
 	tests := []struct {
 		op        Opcode
@@ -0,0 +1,33 @@
+package code
+
+import "sort"
+
+// Position is the line and column, both 1-based, of the source an
+// instruction was compiled from, Offset is where the instruction starts.
+// Statement is set when the instruction is the first of a statement, that
+// is where debuggers stop.
+type Position struct {
+	Offset    int
+	Line      int
+	Column    int
+	Statement bool
+}
+
+// SourceMap has a Position for every instruction that starts a new line or
+// column, sorted by Offset. The instructions after one belong to it.
+type SourceMap []Position
+
+// Lookup returns the position of the instruction that contains offset.
+func (m SourceMap) Lookup(offset int) (Position, bool) {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Offset > offset })
+	if i == 0 {
+		return Position{}, false
+	}
+	return m[i-1], true
+}
+
+// Truncate drops the positions of the instructions from offset on.
+func (m SourceMap) Truncate(offset int) SourceMap {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Offset >= offset })
+	return m[:i]
+}
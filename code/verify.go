@@ -0,0 +1,312 @@
+package code
+
+import (
+	"fmt"
+)
+
+// Constant describes one entry of the constant pool for Verify, the code
+// package can't see the objects themselves. Instructions, NumLocals and
+// NumParameters only matter when Function is set.
+type Constant struct {
+	Function      bool
+	Instructions  Instructions
+	NumLocals     int
+	NumParameters int
+}
+
+// Program is everything Verify needs to know about a bytecode file.
+type Program struct {
+	Instructions Instructions
+	Constants    []Constant
+	NumBuiltins  int
+	NumCounters  int
+	// StackSize is how many values the stack of the vm holds, a function
+	// whose locals and operands need more is rejected
+	StackSize int
+}
+
+type VerifyError struct {
+	// Function is the constant index of the function, -1 for the main program
+	Function int
+	Offset   int
+	Message  string
+}
+
+func (e *VerifyError) Error() string {
+	if e.Function < 0 {
+		return fmt.Sprintf("main: offset %04d: %s", e.Offset, e.Message)
+	}
+	return fmt.Sprintf("function %d: offset %04d: %s", e.Function, e.Offset, e.Message)
+}
+
+// Verify checks the main program and every function in the constant pool
+// without running them: opcodes and operands must be complete and in
+// bounds, jumps must land on an instruction and the stack depth must be
+// the same on every path that reaches an instruction and fit the stack.
+func Verify(program *Program) error {
+	// a function can only read the free variables every closure made from
+	// it captures, a module function runs without any and -1 means it never
+	// runs
+	numFree := make([]int, len(program.Constants))
+	for i := range numFree {
+		numFree[i] = -1
+	}
+
+	main := &verifier{program: program, function: -1, ins: program.Instructions, numFree: -1}
+	err := main.decode()
+	if err != nil {
+		return err
+	}
+	verifiers := []*verifier{main}
+
+	for i, constant := range program.Constants {
+		if !constant.Function {
+			continue
+		}
+		v := &verifier{
+			program:   program,
+			function:  i,
+			ins:       constant.Instructions,
+			numLocals: constant.NumLocals,
+		}
+		if constant.NumParameters > constant.NumLocals {
+			return v.errorf(0, "%d parameters but only %d locals", constant.NumParameters, constant.NumLocals)
+		}
+		err := v.decode()
+		if err != nil {
+			return err
+		}
+		verifiers = append(verifiers, v)
+	}
+
+	for _, v := range verifiers {
+		for _, offset := range v.offsets {
+			var index, free int
+			switch Opcode(v.ins[offset]) {
+			case OpClosure:
+				index, free = v.operands[offset][0], v.operands[offset][1]
+			case OpImport:
+				index = v.operands[offset][0]
+			default:
+				continue
+			}
+			if numFree[index] == -1 || free < numFree[index] {
+				numFree[index] = free
+			}
+		}
+	}
+
+	for _, v := range verifiers {
+		if v.function >= 0 {
+			v.numFree = numFree[v.function]
+		}
+		err := v.checkOperands()
+		if err != nil {
+			return err
+		}
+		err = v.checkStack()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type verifier struct {
+	program   *Program
+	function  int
+	ins       Instructions
+	numLocals int
+	numFree   int
+
+	offsets  []int
+	operands map[int][]int
+}
+
+func (v *verifier) errorf(offset int, format string, a ...interface{}) error {
+	return &VerifyError{Function: v.function, Offset: offset, Message: fmt.Sprintf(format, a...)}
+}
+
+// decode splits the instructions and makes sure every opcode is defined
+// and has all of its operand bytes.
+func (v *verifier) decode() error {
+	v.operands = make(map[int][]int)
+	for offset := 0; offset < len(v.ins); {
+		def, err := Lookup(v.ins[offset])
+		if err != nil {
+			return v.errorf(offset, "opcode %d undefined", v.ins[offset])
+		}
+		width := def.OperandsWidth()
+		if offset+1+width > len(v.ins) {
+			return v.errorf(offset, "%s needs %d operand bytes, only %d left", def.Name, width, len(v.ins)-offset-1)
+		}
+		operands, read := ReadOperands(def, v.ins[offset+1:])
+		v.offsets = append(v.offsets, offset)
+		v.operands[offset] = operands
+		offset += 1 + read
+	}
+	return nil
+}
+
+func (v *verifier) checkOperands() error {
+	constants := v.program.Constants
+	for _, offset := range v.offsets {
+		op := Opcode(v.ins[offset])
+		operands := v.operands[offset]
+		name := definitions[op].Name
+
+		switch op {
+		case OpConstant:
+			if operands[0] >= len(constants) {
+				return v.errorf(offset, "%s %d out of range, the pool has %d constants", name, operands[0], len(constants))
+			}
+
+		case OpClosure, OpImport:
+			if operands[0] >= len(constants) {
+				return v.errorf(offset, "%s %d out of range, the pool has %d constants", name, operands[0], len(constants))
+			}
+			if !constants[operands[0]].Function {
+				return v.errorf(offset, "%s %d is not a function", name, operands[0])
+			}
+
+		case OpGetLocal, OpSetLocal:
+			if operands[0] >= v.numLocals {
+				return v.errorf(offset, "%s %d out of range, the frame has %d locals", name, operands[0], v.numLocals)
+			}
+
+		case OpGetFree:
+			if v.function < 0 {
+				return v.errorf(offset, "%s outside of a function", name)
+			}
+			if v.numFree != -1 && operands[0] >= v.numFree {
+				return v.errorf(offset, "%s %d out of range, the closure has %d free variables", name, operands[0], v.numFree)
+			}
+
+		case OpCurrentClosure:
+			if v.function < 0 {
+				return v.errorf(offset, "%s outside of a function", name)
+			}
+
+		case OpGetBuiltin:
+			if operands[0] >= v.program.NumBuiltins {
+				return v.errorf(offset, "%s %d out of range, there are %d builtins", name, operands[0], v.program.NumBuiltins)
+			}
+
+		case OpCoverage:
+			if operands[0] >= v.program.NumCounters {
+				return v.errorf(offset, "%s %d out of range, there are %d counters", name, operands[0], v.program.NumCounters)
+			}
+
+		case OpHash:
+			if operands[0]%2 != 0 {
+				return v.errorf(offset, "%s needs an even number of elements, got %d", name, operands[0])
+			}
+
+		case OpJump, OpJumpNotTruthy:
+			target := operands[0]
+			if _, ok := v.operands[target]; !ok && target != len(v.ins) {
+				return v.errorf(offset, "%s target %d is not the start of an instruction", name, target)
+			}
+		}
+	}
+	return nil
+}
+
+// stackEffect returns how many values op pops and pushes.
+func stackEffect(op Opcode, operands []int) (int, int) {
+	switch op {
+	case OpConstant, OpTrue, OpFalse, OpNull, OpGetGlobal, OpGetLocal,
+		OpGetBuiltin, OpGetFree, OpCurrentClosure, OpLoadInt, OpImport:
+		return 0, 1
+	case OpAdd, OpSub, OpMul, OpDiv, OpEqual, OpNotEqual, OpGreaterThan, OpLessThan, OpIndex:
+		return 2, 1
+	case OpMinus, OpBang:
+		return 1, 1
+	case OpPop, OpSetGlobal, OpSetLocal, OpJumpNotTruthy, OpReturnValue:
+		return 1, 0
+	case OpArray, OpHash:
+		return operands[0], 1
+	case OpCall:
+		return operands[0] + 1, 1
+	case OpClosure:
+		return operands[1], 1
+	}
+	return 0, 0
+}
+
+// checkStack follows every path through the instructions and records the
+// stack depth on entry to each instruction, the deepest one and the locals
+// must fit the stack.
+func (v *verifier) checkStack() error {
+	depths := make(map[int]int)
+	work := []int{0}
+	depths[0] = 0
+	deepest, deepestOffset := 0, 0
+
+	next := func(from, target, depth int) error {
+		if target == len(v.ins) {
+			if v.function >= 0 {
+				return v.errorf(from, "the function can end without returning")
+			}
+			return nil
+		}
+		if seen, ok := depths[target]; ok {
+			if seen != depth {
+				return v.errorf(target, "stack depth %d on one path and %d on another", seen, depth)
+			}
+			return nil
+		}
+		depths[target] = depth
+		work = append(work, target)
+		return nil
+	}
+
+	if len(v.ins) == 0 {
+		return next(0, 0, 0)
+	}
+
+	for len(work) > 0 {
+		offset := work[len(work)-1]
+		work = work[:len(work)-1]
+
+		op := Opcode(v.ins[offset])
+		operands := v.operands[offset]
+		depth := depths[offset]
+
+		pop, push := stackEffect(op, operands)
+		if pop > depth {
+			return v.errorf(offset, "%s pops %d values, the stack has %d", definitions[op].Name, pop, depth)
+		}
+		depth = depth - pop + push
+		if depth > deepest {
+			deepest, deepestOffset = depth, offset
+		}
+
+		following := offset + 1 + definitions[op].OperandsWidth()
+
+		var err error
+		switch op {
+		case OpReturnValue, OpReturn:
+			if v.function < 0 {
+				return v.errorf(offset, "%s outside of a function", definitions[op].Name)
+			}
+		case OpJump:
+			err = next(offset, operands[0], depth)
+		case OpJumpNotTruthy:
+			err = next(offset, operands[0], depth)
+			if err == nil {
+				err = next(offset, following, depth)
+			}
+		default:
+			err = next(offset, following, depth)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if v.numLocals+deepest > v.program.StackSize {
+		return v.errorf(deepestOffset, "needs %d stack slots for %d locals and %d values, the stack has %d",
+			v.numLocals+deepest, v.numLocals, deepest, v.program.StackSize)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package code
+
+import "testing"
+
+func concat(instructions ...[]byte) Instructions {
+	out := Instructions{}
+	for _, ins := range instructions {
+		out = append(out, ins...)
+	}
+	return out
+}
+
+func TestVerifyValidProgram(t *testing.T) {
+	// let add = fn(a, b) { let c = a + b; c }; add(1, 2) with a closure
+	// reading its free variable
+	program := &Program{
+		Instructions: concat(
+			Make(OpClosure, 1, 0),
+			Make(OpSetGlobal, 0),
+			Make(OpGetGlobal, 0),
+			Make(OpConstant, 0),
+			Make(OpConstant, 0),
+			Make(OpCall, 2),
+			Make(OpPop),
+			Make(OpTrue),
+			Make(OpJumpNotTruthy, 29),
+			Make(OpConstant, 0),
+			Make(OpJump, 30),
+			Make(OpNull),
+			Make(OpPop),
+		),
+		Constants: []Constant{
+			{},
+			{
+				Function: true,
+				Instructions: concat(
+					Make(OpGetLocal, 0),
+					Make(OpGetLocal, 1),
+					Make(OpAdd),
+					Make(OpSetLocal, 2),
+					Make(OpGetLocal, 2),
+					Make(OpClosure, 2, 1),
+					Make(OpReturnValue),
+				),
+				NumLocals:     3,
+				NumParameters: 2,
+			},
+			{
+				Function:     true,
+				Instructions: concat(Make(OpGetFree, 0), Make(OpCurrentClosure), Make(OpPop), Make(OpReturnValue)),
+			},
+		},
+		NumBuiltins: 1,
+		StackSize:   5,
+	}
+
+	if err := Verify(program); err != nil {
+		t.Fatalf("valid program failed to verify: %s", err)
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	function := func(ins Instructions, numLocals int) Constant {
+		return Constant{Function: true, Instructions: ins, NumLocals: numLocals}
+	}
+
+	tests := []struct {
+		program  *Program
+		expected string
+	}{
+		{
+			&Program{Instructions: Instructions{255}},
+			"main: offset 0000: opcode 255 undefined",
+		},
+		{
+			&Program{Instructions: concat(Make(OpTrue), Make(OpConstant, 1)[:2])},
+			"main: offset 0001: OpConstant needs 2 operand bytes, only 1 left",
+		},
+		{
+			&Program{Instructions: Make(OpConstant, 3), Constants: []Constant{{}}},
+			"main: offset 0000: OpConstant 3 out of range, the pool has 1 constants",
+		},
+		{
+			&Program{Instructions: concat(Make(OpClosure, 0, 0), Make(OpPop)), Constants: []Constant{{}}},
+			"main: offset 0000: OpClosure 0 is not a function",
+		},
+		{
+			&Program{Instructions: concat(Make(OpTrue), Make(OpJump, 2))},
+			"main: offset 0001: OpJump target 2 is not the start of an instruction",
+		},
+		{
+			&Program{Instructions: concat(Make(OpGetLocal, 0), Make(OpPop))},
+			"main: offset 0000: OpGetLocal 0 out of range, the frame has 0 locals",
+		},
+		{
+			&Program{Instructions: concat(Make(OpGetBuiltin, 4), Make(OpPop)), NumBuiltins: 4},
+			"main: offset 0000: OpGetBuiltin 4 out of range, there are 4 builtins",
+		},
+		{
+			// .mkc files have no counters, coverage is only for compiled source
+			&Program{Instructions: Make(OpCoverage, 0)},
+			"main: offset 0000: OpCoverage 0 out of range, there are 0 counters",
+		},
+		{
+			&Program{Instructions: Make(OpPop)},
+			"main: offset 0000: OpPop pops 1 values, the stack has 0",
+		},
+		{
+			&Program{Instructions: concat(Make(OpTrue), Make(OpHash, 1))},
+			"main: offset 0001: OpHash needs an even number of elements, got 1",
+		},
+		{
+			&Program{Instructions: concat(Make(OpTrue), Make(OpReturnValue))},
+			"main: offset 0001: OpReturnValue outside of a function",
+		},
+		{
+			// the true branch leaves an extra value on the stack
+			&Program{Instructions: concat(
+				Make(OpTrue),
+				Make(OpJumpNotTruthy, 7),
+				Make(OpTrue),
+				Make(OpTrue),
+				Make(OpPop),
+				Make(OpNull),
+			)},
+			"main: offset 0007: stack depth 0 on one path and 1 on another",
+		},
+		{
+			&Program{
+				Instructions: concat(Make(OpClosure, 0, 0), Make(OpPop)),
+				Constants:    []Constant{function(concat(Make(OpNull), Make(OpPop)), 0)},
+			},
+			"function 0: offset 0001: the function can end without returning",
+		},
+		{
+			&Program{
+				Instructions: concat(Make(OpClosure, 0, 0), Make(OpPop)),
+				Constants:    []Constant{function(concat(Make(OpGetLocal, 1), Make(OpReturnValue)), 1)},
+			},
+			"function 0: offset 0000: OpGetLocal 1 out of range, the frame has 1 locals",
+		},
+		{
+			&Program{
+				Instructions: concat(Make(OpNull), Make(OpClosure, 0, 1), Make(OpPop)),
+				Constants:    []Constant{function(concat(Make(OpGetFree, 1), Make(OpReturnValue)), 0)},
+			},
+			"function 0: offset 0000: OpGetFree 1 out of range, the closure has 1 free variables",
+		},
+		{
+			&Program{
+				Instructions: concat(Make(OpClosure, 0, 2), Make(OpPop)),
+				Constants:    []Constant{function(Make(OpReturn), 0)},
+			},
+			"main: offset 0000: OpClosure pops 2 values, the stack has 0",
+		},
+		{
+			&Program{
+				Instructions: concat(Make(OpImport, 0), Make(OpPop)),
+				Constants:    []Constant{function(concat(Make(OpGetFree, 0), Make(OpReturnValue)), 0)},
+			},
+			"function 0: offset 0000: OpGetFree 0 out of range, the closure has 0 free variables",
+		},
+		{
+			&Program{
+				Instructions: concat(Make(OpTrue), Make(OpTrue), Make(OpTrue), Make(OpArray, 3), Make(OpPop)),
+				StackSize:    2,
+			},
+			"main: offset 0002: needs 3 stack slots for 0 locals and 3 values, the stack has 2",
+		},
+		{
+			&Program{
+				Instructions: concat(Make(OpClosure, 0, 0), Make(OpPop)),
+				Constants:    []Constant{function(concat(Make(OpTrue), Make(OpReturnValue)), 2)},
+				StackSize:    2,
+			},
+			"function 0: offset 0000: needs 3 stack slots for 2 locals and 1 values, the stack has 2",
+		},
+	}
+
+	for _, tt := range tests {
+		if tt.program.StackSize == 0 {
+			tt.program.StackSize = 16
+		}
+		err := Verify(tt.program)
+		if err == nil {
+			t.Errorf("expected %q, got no error", tt.expected)
+			continue
+		}
+		if err.Error() != tt.expected {
+			t.Errorf("wrong error.\nwant=%q\n got=%q", tt.expected, err)
+		}
+	}
+}
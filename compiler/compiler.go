@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"mokey-type/ast"
 	"mokey-type/code"
+	"mokey-type/module"
 	"mokey-type/object"
+	"mokey-type/token"
 	"sort"
 )
 
@@ -17,6 +19,9 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	sourceMap           code.SourceMap
+	// statement is set until the first instruction of a statement is mapped
+	statement bool
 }
 
 type Compiler struct {
@@ -25,11 +30,55 @@ type Compiler struct {
 
 	scopes     []CompilationScope
 	scopeIndex int
+
+	// position is the start of the innermost node being compiled, the
+	// instructions emitted are mapped to it
+	position token.Token
+
+	// counters is nil unless coverage is enabled
+	counters []Counter
+
+	// loader is nil unless imports are enabled, file is the file being
+	// compiled, module is it too while compiling a module, and modules
+	// are the constant indexes of the compiled modules
+	loader  *module.Loader
+	file    string
+	module  string
+	modules map[string]int
+}
+
+// Counter is a coverage counter, the compiler puts one before every
+// statement and at the start of both arms of every if. Line and Column are
+// where the statement or the arm starts, an if without an else has its
+// else counter at the if.
+type Counter struct {
+	Kind   string // "statement", "then" or "else"
+	Line   int
+	Column int
+}
+
+// Error is a compile error and the token of the node that caused it.
+type Error struct {
+	Message string
+	Token   token.Token
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func newError(tok token.Token, format string, a ...interface{}) *Error {
+	return &Error{Message: fmt.Sprintf(format, a...), Token: tok}
 }
 
 type Bytecode struct {
 	Instructions code.Instructions
 	Constanst    []object.Object
+	// SourceMap is empty for bytecode read from a .mkc file
+	SourceMap code.SourceMap
+	// Counters are the coverage counters, OpCoverage operands index them.
+	// They are not written to .mkc files.
+	Counters []Counter
+	// GlobalNames names the globals by index
+	GlobalNames []string
 }
 
 func New() *Compiler {
@@ -61,11 +110,37 @@ func NewWithState(symbols *SymbolTable, constants []object.Object) *Compiler {
 	return compiler
 }
 
+// EnableCoverage makes the compiler count how often every statement and
+// every arm of an if runs, see Bytecode.Counters.
+func (c *Compiler) EnableCoverage() {
+	if c.counters == nil {
+		c.counters = []Counter{}
+	}
+}
+
+// count emits a coverage counter for the code at tok, nodes the compiler
+// made up have no position and are not counted.
+func (c *Compiler) count(kind string, tok token.Token) {
+	if c.counters == nil || tok.Line == 0 {
+		return
+	}
+	c.counters = append(c.counters, Counter{Kind: kind, Line: tok.Line, Column: tok.Column})
+	c.emit(code.OpCoverage, len(c.counters)-1)
+}
+
 func (c *Compiler) Compile(node ast.Node) error {
+	if tok := ast.Start(node); tok.Line > 0 {
+		outer := c.position
+		c.position = tok
+		defer func() { c.position = outer }()
+	}
+
 	switch node := node.(type) {
 
 	case *ast.Program:
 		for _, s := range node.Statements {
+			c.count("statement", ast.Start(s))
+			c.scopes[c.scopeIndex].statement = true
 			err := c.Compile(s)
 			if err != nil {
 				return err
@@ -80,19 +155,6 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.emit(code.OpPop)
 
 	case *ast.InfixExpression:
-		if node.Operator == "<" {
-			err := c.Compile(node.Right)
-			if err != nil {
-				return err
-			}
-
-			err = c.Compile(node.Left)
-			if err != nil {
-				return err
-			}
-			c.emit(code.OpGreaterThan)
-			return nil
-		}
 		err := c.Compile(node.Left)
 		if err != nil {
 			return err
@@ -117,6 +179,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 		case ">":
 			c.emit(code.OpGreaterThan)
 
+		case "<":
+			c.emit(code.OpLessThan)
+
 		case "==":
 			c.emit(code.OpEqual)
 
@@ -124,7 +189,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpNotEqual)
 
 		default:
-			return fmt.Errorf("unknow operator %s", node.Operator)
+			return newError(node.Token, "unknow operator %s", node.Operator)
 		}
 
 	case *ast.IntegerLiteral:
@@ -159,7 +224,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpSub)
 
 		default:
-			return fmt.Errorf("unknown operato %s", node.Operator)
+			return newError(node.Token, "unknown operato %s", node.Operator)
 		}
 
 	case *ast.IfExpression:
@@ -170,6 +235,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 		//Bogus value for jump
 		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 999)
 
+		c.count("then", node.Consequence.Token)
 		err = c.Compile(node.Consequence)
 		if err != nil {
 			return err
@@ -185,8 +251,10 @@ func (c *Compiler) Compile(node ast.Node) error {
 		c.changeOperand(jumpNotTruthyPos, posAfterConsequence)
 
 		if node.Alternative == nil {
+			c.count("else", node.Token)
 			c.emit(code.OpNull)
 		} else {
+			c.count("else", node.Alternative.Token)
 			err = c.Compile(node.Alternative)
 			if err != nil {
 				return err
@@ -201,6 +269,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 	case *ast.BlockStatement:
 		for _, s := range node.Statements {
+			c.count("statement", ast.Start(s))
+			c.scopes[c.scopeIndex].statement = true
 			err := c.Compile(s)
 			if err != nil {
 				return err
@@ -208,11 +278,13 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 	case *ast.LetStatement:
-		symbol := c.symbolTable.Define(node.Name.Value)
+		// the value is compiled first, in let x = x + 1 the x on the right
+		// is the one defined before
 		err := c.Compile(node.Value)
 		if err != nil {
 			return err
 		}
+		symbol := c.symbolTable.Define(node.Name.Value)
 		if symbol.Scope == GlobalScope {
 			c.emit(code.OpSetGlobal, symbol.Index)
 		} else {
@@ -222,7 +294,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 	case *ast.Identifier:
 		symbol, ok := c.symbolTable.Resolve(node.Value)
 		if !ok {
-			return fmt.Errorf("undefined variable: %s", node.Value)
+			return newError(node.Token, "undefined variable: %s", node.Value)
 		}
 		c.loadSymbol(symbol)
 
@@ -298,6 +370,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions
+		localNames := c.symbolTable.DefinedNames()
+		sourceMap := c.scopes[c.scopeIndex].sourceMap
 		instructions := c.leaveScope()
 
 		for _, s := range freeSymbols {
@@ -308,6 +382,13 @@ func (c *Compiler) Compile(node ast.Node) error {
 			Instructions:  instructions,
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			SourceMap:     sourceMap,
+			Name:          node.Name,
+			LocalNames:    localNames,
+			File:          c.module,
+		}
+		for _, s := range freeSymbols {
+			compiledFunc.FreeNames = append(compiledFunc.FreeNames, s.Name)
 		}
 
 		c.emit(code.OpClosure, c.addConstant(compiledFunc), len(freeSymbols))
@@ -333,6 +414,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpCall, len(node.Arguments))
 
+	case *ast.ImportExpression:
+		return c.compileImport(node)
+
 	case *ast.ForLoop:
 
 		err := c.Compile(&node.Declaration)
@@ -357,10 +441,6 @@ func (c *Compiler) Compile(node ast.Node) error {
 			return err
 		}
 
-		if c.lastInstructionIs(code.OpPop) {
-			c.removeLastPop()
-		}
-
 		err = c.Compile(node.Consequence)
 		if err != nil {
 			return err
@@ -376,6 +456,9 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		posAfterConsequence := len(c.currentInstructions())
 		c.changeOperand(jumpNotTruthyPos, posAfterConsequence)
+
+		// the loop is an expression too, it evaluates to null
+		c.emit(code.OpNull)
 	}
 	return nil
 }
@@ -390,10 +473,32 @@ func (c *Compiler) addInstruction(ins []byte) int {
 	updatedInstructions := append(c.currentInstructions(), ins...)
 
 	c.scopes[c.scopeIndex].instructions = updatedInstructions
+	c.mapInstruction(posNewInstructions)
 
 	return posNewInstructions
 }
 
+func (c *Compiler) mapInstruction(offset int) {
+	scope := &c.scopes[c.scopeIndex]
+	statement := scope.statement
+	scope.statement = false
+	if c.position.Line == 0 {
+		return
+	}
+	if n := len(scope.sourceMap); n > 0 && !statement {
+		last := scope.sourceMap[n-1]
+		if last.Line == c.position.Line && last.Column == c.position.Column {
+			return
+		}
+	}
+	scope.sourceMap = append(scope.sourceMap, code.Position{
+		Offset:    offset,
+		Line:      c.position.Line,
+		Column:    c.position.Column,
+		Statement: statement,
+	})
+}
+
 func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	ins := code.Make(op, operands...)
 	pos := c.addInstruction(ins)
@@ -412,6 +517,9 @@ func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constanst:    c.constanst,
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
+		Counters:     c.counters,
+		GlobalNames:  c.symbolTable.DefinedNames(),
 	}
 }
 
@@ -423,6 +531,7 @@ func (c *Compiler) removeLastPop() {
 
 	c.scopes[c.scopeIndex].instructions = newIns
 	c.scopes[c.scopeIndex].lastInstruction = previous
+	c.scopes[c.scopeIndex].sourceMap = c.scopes[c.scopeIndex].sourceMap.Truncate(last.Position)
 }
 
 func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
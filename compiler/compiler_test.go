@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"mokey-type/ast"
 	"mokey-type/code"
+	"mokey-type/fuzz"
 	"mokey-type/lexer"
 	"mokey-type/object"
 	"mokey-type/parser"
+	"reflect"
 	"testing"
 )
 
@@ -245,11 +247,11 @@ func TestBooleanExpressions(t *testing.T) {
 		},
 		{
 			input:             "1 < 2",
-			expectedConstants: []interface{}{2, 1},
+			expectedConstants: []interface{}{1, 2},
 			expectedInstructions: []code.Instructions{
 				code.Make(code.OpConstant, 0),
 				code.Make(code.OpConstant, 1),
-				code.Make(code.OpGreaterThan),
+				code.Make(code.OpLessThan),
 				code.Make(code.OpPop),
 			},
 		},
@@ -1059,33 +1061,179 @@ func TestForLoop(t *testing.T) {
 				// 0003
 				code.Make(code.OpSetGlobal, 0),
 				// 0006
-				code.Make(code.OpConstant, 1),
-				// 0009
 				code.Make(code.OpGetGlobal, 0),
+				// 0009
+				code.Make(code.OpConstant, 1),
 				// 0012
-				code.Make(code.OpGreaterThan),
+				code.Make(code.OpLessThan),
 				// 0013
-				code.Make(code.OpJumpNotTruthy, 34),
+				code.Make(code.OpJumpNotTruthy, 35),
 				// 0016
 				code.Make(code.OpGetGlobal, 0),
 				// 0019
+				code.Make(code.OpPop),
+				// 0020
 				code.Make(code.OpGetGlobal, 0),
-				// 0022
+				// 0023
 				code.Make(code.OpLoadInt, 1),
-				// 0027
-				code.Make(code.OpAdd),
 				// 0028
+				code.Make(code.OpAdd),
+				// 0029
 				code.Make(code.OpSetGlobal, 0),
-				// 0031
+				// 0032
 				code.Make(code.OpJump, 6),
-				// 0034
-				code.Make(code.OpPop),
 				// 0035
+				code.Make(code.OpNull),
+				// 0036
+				code.Make(code.OpPop),
+				// 0037
 				code.Make(code.OpConstant, 2),
-				// 0038
+				// 0040
 				code.Make(code.OpPop),
 			},
 		},
 	}
 	runCompilerTests(t, tests)
 }
+
+func TestSourceMap(t *testing.T) {
+	input := "let x = 1;\nlet f = fn(a) {\n  a + x\n};\nf(2)"
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	main := compiler.Bytecode().SourceMap
+	fn := compiler.Bytecode().Constanst[1].(*object.CompiledFunction).SourceMap
+
+	tests := []struct {
+		sourceMap    code.SourceMap
+		offset       int
+		line, column int
+	}{
+		// OpSetGlobal of the first let
+		{main, 3, 1, 1},
+		// OpClosure of the function literal
+		{main, 6, 2, 9},
+		// the argument of f(2) and the call itself
+		{main, 16, 5, 3},
+		{main, 19, 5, 1},
+		// OpGetLocal a
+		{fn, 0, 3, 3},
+		// OpAdd belongs to the infix expression, which starts at a
+		{fn, 5, 3, 3},
+	}
+
+	for i, tt := range tests {
+		pos, ok := tt.sourceMap.Lookup(tt.offset)
+		if !ok {
+			t.Errorf("test %d: no position for offset %d", i, tt.offset)
+			continue
+		}
+		if pos.Line != tt.line || pos.Column != tt.column {
+			t.Errorf("test %d: wrong position for offset %d. got=%d:%d, want=%d:%d",
+				i, tt.offset, pos.Line, pos.Column, tt.line, tt.column)
+		}
+	}
+}
+
+func TestDebugInfo(t *testing.T) {
+	input := "let x = 1;\nlet x = 2;\nlet f = fn(a) {\n  let b = fn() { a };\n  b()\n};"
+	compiler := New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+	// defining x again reuses its index
+	if want := []string{"x", "f"}; !reflect.DeepEqual(bytecode.GlobalNames, want) {
+		t.Errorf("wrong global names. want=%q, got=%q", want, bytecode.GlobalNames)
+	}
+	inner := bytecode.Constanst[2].(*object.CompiledFunction)
+	if inner.LocalNames != nil || !reflect.DeepEqual(inner.FreeNames, []string{"a"}) {
+		t.Errorf("wrong names of the inner function. locals=%q, free=%q", inner.LocalNames, inner.FreeNames)
+	}
+	outer := bytecode.Constanst[3].(*object.CompiledFunction)
+	if !reflect.DeepEqual(outer.LocalNames, []string{"a", "b"}) || outer.FreeNames != nil {
+		t.Errorf("wrong names of f. locals=%q, free=%q", outer.LocalNames, outer.FreeNames)
+	}
+
+	statements := func(m code.SourceMap) []int {
+		lines := []int{}
+		for _, pos := range m {
+			if pos.Statement {
+				lines = append(lines, pos.Line)
+			}
+		}
+		return lines
+	}
+	if got := statements(bytecode.SourceMap); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Errorf("wrong statements of main %v", got)
+	}
+	if got := statements(outer.SourceMap); !reflect.DeepEqual(got, []int{4, 5}) {
+		t.Errorf("wrong statements of f %v", got)
+	}
+	if got := statements(inner.SourceMap); !reflect.DeepEqual(got, []int{4}) {
+		t.Errorf("wrong statements of the inner function %v", got)
+	}
+}
+
+func TestCoverage(t *testing.T) {
+	input := "let x = 1;\nif (x > 0) { x }"
+	compiler := New()
+	compiler.EnableCoverage()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := compiler.Bytecode()
+
+	err := testInstructions([]code.Instructions{
+		code.Make(code.OpCoverage, 0),
+		code.Make(code.OpConstant, 0),
+		code.Make(code.OpSetGlobal, 0),
+		code.Make(code.OpCoverage, 1),
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpConstant, 1),
+		code.Make(code.OpGreaterThan),
+		code.Make(code.OpJumpNotTruthy, 34),
+		code.Make(code.OpCoverage, 2),
+		code.Make(code.OpCoverage, 3),
+		code.Make(code.OpGetGlobal, 0),
+		code.Make(code.OpJump, 38),
+		code.Make(code.OpCoverage, 4),
+		code.Make(code.OpNull),
+		code.Make(code.OpPop),
+	}, bytecode.Instructions)
+	if err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+
+	expected := []Counter{
+		{"statement", 1, 1},
+		{"statement", 2, 1},
+		{"then", 2, 12},
+		{"statement", 2, 14},
+		// an if without an else counts the implicit one at the if
+		{"else", 2, 1},
+	}
+	if fmt.Sprint(bytecode.Counters) != fmt.Sprint(expected) {
+		t.Errorf("wrong counters.\nwant=%v\n got=%v", expected, bytecode.Counters)
+	}
+
+	plain := New()
+	if err := plain.Compile(parse(input)); err != nil || len(plain.Bytecode().Counters) != 0 {
+		t.Errorf("coverage should be off by default")
+	}
+}
+
+// FuzzCompiler checks that the compiler reports errors instead of panicking
+// on any program the parser accepts.
+func FuzzCompiler(f *testing.F) {
+	fuzz.Seeds(f, "*_test.go", "../conformance/*.go")
+	f.Fuzz(func(t *testing.T, input string) {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return
+		}
+		New().Compile(program)
+	})
+}
@@ -0,0 +1,122 @@
+package compiler
+
+import (
+	"bytes"
+	"fmt"
+	"mokey-type/code"
+	"mokey-type/object"
+)
+
+// Disassemble lists the main program, the constant pool and every function
+// in it. Constant, closure, builtin and jump operands are annotated with the
+// value or offset they refer to.
+func (b *Bytecode) Disassemble() string {
+	var out bytes.Buffer
+	numFree := b.freeVariables()
+
+	out.WriteString("== main ==\n")
+	b.disassemble(&out, b.Instructions)
+
+	out.WriteString("\n== constants ==\n")
+	for i, constant := range b.Constanst {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			fmt.Fprintf(&out, "%d FUNCTION locals=%d parameters=%d free=%d\n",
+				i, fn.NumLocals, fn.NumParameters, numFree[i])
+			continue
+		}
+		fmt.Fprintf(&out, "%d %s\n", i, b.describe(i))
+	}
+
+	for i, constant := range b.Constanst {
+		fn, ok := constant.(*object.CompiledFunction)
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(&out, "\n== fn %d: locals=%d parameters=%d free=%d ==\n",
+			i, fn.NumLocals, fn.NumParameters, numFree[i])
+		b.disassemble(&out, fn.Instructions)
+	}
+	return out.String()
+}
+
+// freeVariables finds how many free variables each function captures by
+// looking at the OpClosure instructions that create it.
+func (b *Bytecode) freeVariables() map[int]int {
+	numFree := make(map[int]int)
+	collect := func(ins code.Instructions) {
+		for i := 0; i < len(ins); {
+			def, err := code.Lookup(ins[i])
+			if err != nil || i+1+def.OperandsWidth() > len(ins) {
+				return
+			}
+			operands, read := code.ReadOperands(def, ins[i+1:])
+			if code.Opcode(ins[i]) == code.OpClosure {
+				numFree[operands[0]] = operands[1]
+			}
+			i += 1 + read
+		}
+	}
+
+	collect(b.Instructions)
+	for _, constant := range b.Constanst {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			collect(fn.Instructions)
+		}
+	}
+	return numFree
+}
+
+func (b *Bytecode) describe(index int) string {
+	if index >= len(b.Constanst) {
+		return "out of range"
+	}
+	switch constant := b.Constanst[index].(type) {
+	case *object.String:
+		return fmt.Sprintf("STRING %q", constant.Value)
+	case *object.CompiledFunction:
+		return fmt.Sprintf("fn %d", index)
+	default:
+		return fmt.Sprintf("%s %s", constant.Type(), constant.Inspect())
+	}
+}
+
+func (b *Bytecode) disassemble(out *bytes.Buffer, ins code.Instructions) {
+	for i := 0; i < len(ins); {
+		def, err := code.Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(out, "%04d ERROR: %s\n", i, err)
+			i++
+			continue
+		}
+		if i+1+def.OperandsWidth() > len(ins) {
+			fmt.Fprintf(out, "%04d ERROR: %s is missing operands\n", i, def.Name)
+			return
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+
+		var line bytes.Buffer
+		fmt.Fprintf(&line, "%04d %s", i, def.Name)
+		for _, o := range operands {
+			fmt.Fprintf(&line, " %d", o)
+		}
+
+		note := ""
+		switch code.Opcode(ins[i]) {
+		case code.OpConstant, code.OpClosure:
+			note = b.describe(operands[0])
+		case code.OpJump, code.OpJumpNotTruthy:
+			note = fmt.Sprintf("-> %04d", operands[0])
+		case code.OpGetBuiltin:
+			if operands[0] < len(object.Builtins) {
+				note = object.Builtins[operands[0]].Name
+			}
+		}
+
+		if note == "" {
+			fmt.Fprintf(out, "%s\n", line.String())
+		} else {
+			fmt.Fprintf(out, "%-28s ; %s\n", line.String(), note)
+		}
+		i += 1 + read
+	}
+}
@@ -0,0 +1,61 @@
+package compiler
+
+import (
+	"mokey-type/code"
+	"mokey-type/object"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	comp := New()
+	err := comp.Compile(parse(`let f = fn(a) { fn() { a } }; if (true) { len("ab") }`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	expected := `== main ==
+0000 OpClosure 1 0           ; fn 1
+0004 OpSetGlobal 0
+0007 OpTrue
+0008 OpJumpNotTruthy 21      ; -> 0021
+0011 OpGetBuiltin 2          ; len
+0013 OpConstant 2            ; STRING "ab"
+0016 OpCall 1
+0018 OpJump 22               ; -> 0022
+0021 OpNull
+0022 OpPop
+
+== constants ==
+0 FUNCTION locals=0 parameters=0 free=1
+1 FUNCTION locals=1 parameters=1 free=0
+2 STRING "ab"
+
+== fn 0: locals=0 parameters=0 free=1 ==
+0000 OpGetFree 0
+0002 OpReturnValue
+
+== fn 1: locals=1 parameters=1 free=0 ==
+0000 OpGetLocal 0
+0002 OpClosure 0 1           ; fn 0
+0006 OpReturnValue
+`
+	if got := comp.Bytecode().Disassemble(); got != expected {
+		t.Errorf("wrong listing.\nwant=%q\n got=%q", expected, got)
+	}
+}
+
+func TestDisassembleInvalid(t *testing.T) {
+	bytecode := &Bytecode{
+		Instructions: code.Instructions{255, byte(code.OpConstant), 9, 0},
+		Constanst:    []object.Object{},
+	}
+	expected := `== main ==
+0000 ERROR: opcode 255 undefined
+0001 OpConstant 2304         ; out of range
+
+== constants ==
+`
+	if got := bytecode.Disassemble(); got != expected {
+		t.Errorf("wrong listing.\nwant=%q\n got=%q", expected, got)
+	}
+}
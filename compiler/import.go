@@ -0,0 +1,103 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"mokey-type/ast"
+	"mokey-type/code"
+	"mokey-type/module"
+	"mokey-type/object"
+	"mokey-type/token"
+)
+
+// EnableImports makes import expressions load their modules with loader,
+// file is the file being compiled, empty when there is none and imports
+// are relative to the working directory.
+func (c *Compiler) EnableImports(file string, loader *module.Loader) {
+	c.file = file
+	c.loader = loader
+	c.modules = map[string]int{}
+}
+
+func (c *Compiler) compileImport(node *ast.ImportExpression) error {
+	if c.loader == nil {
+		return newError(node.Token, "imports are not enabled")
+	}
+	file, program, err := c.loader.Load(c.file, node.Path.Value)
+	if err != nil {
+		return newError(node.Token, "%s", err)
+	}
+
+	index, ok := c.modules[file]
+	if !ok {
+		index, err = c.compileModule(file, program)
+		if err != nil {
+			var compileErr *Error
+			if errors.As(err, &compileErr) {
+				err = fmt.Errorf("%s:%d:%d: %s", file, compileErr.Token.Line, compileErr.Token.Column, compileErr.Message)
+			}
+			return newError(node.Token, "%s", err)
+		}
+		c.modules[file] = index
+	}
+	c.emit(code.OpImport, index)
+	return nil
+}
+
+// compileModule compiles a module into a function that runs its
+// statements and returns a hash of its exports. The top-level bindings
+// of the module are the locals of the function, it sees the builtins and
+// nothing of the file that imports it.
+func (c *Compiler) compileModule(file string, program *ast.Program) (int, error) {
+	symbolTable, outerFile, outerModule, counters := c.symbolTable, c.file, c.module, c.counters
+	defer func() {
+		c.symbolTable, c.file, c.module, c.counters = symbolTable, outerFile, outerModule, counters
+	}()
+	// the counters are for the lines of the file being covered
+	c.counters = nil
+	c.file, c.module = file, file
+
+	builtins := NewSymbolTable()
+	for i, v := range object.Builtins {
+		builtins.DefineBuiltin(i, v.Name)
+	}
+	c.scopes = append(c.scopes, CompilationScope{instructions: code.Instructions{}})
+	c.scopeIndex++
+	c.symbolTable = NewEnclosedSymbolTable(builtins)
+
+	for _, s := range program.Statements {
+		c.scopes[c.scopeIndex].statement = true
+		err := c.Compile(s)
+		if err != nil {
+			c.leaveScope()
+			return 0, err
+		}
+	}
+
+	// the hash is not in the source
+	position := c.position
+	c.position = token.Token{}
+	exports := module.Exports(program)
+	for _, name := range exports {
+		c.emit(code.OpConstant, c.addConstant(&object.String{Value: name}))
+		symbol, _ := c.symbolTable.Resolve(name)
+		c.loadSymbol(symbol)
+	}
+	c.emit(code.OpHash, len(exports)*2)
+	c.emit(code.OpReturnValue)
+	c.position = position
+
+	numLocals := c.symbolTable.numDefinitions
+	localNames := c.symbolTable.DefinedNames()
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	instructions := c.leaveScope()
+
+	return c.addConstant(&object.CompiledFunction{
+		Instructions: instructions,
+		NumLocals:    numLocals,
+		SourceMap:    sourceMap,
+		Name:         file,
+		LocalNames:   localNames,
+		File:         file,
+	}), nil
+}
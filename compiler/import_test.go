@@ -0,0 +1,98 @@
+package compiler
+
+import (
+	"bytes"
+	"mokey-type/code"
+	"mokey-type/conformance"
+	"mokey-type/module"
+	"mokey-type/object"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestImports(t *testing.T) {
+	dir := conformance.WriteModules(t, map[string]string{
+		"math.mk": `let add = fn(a, b) { a + b }; let _private = 1;`,
+		"lib.mk":  `let math = import "math"; let two = math["add"](1, 1);`,
+	})
+	comp := New()
+	comp.EnableImports(filepath.Join(dir, "main.mk"), module.NewLoader(nil))
+	err := comp.Compile(parse(`import "math"; import "lib"; import "./math.mk";`))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	// every module is compiled once, the imports of it share its function
+	modules := map[string]int{}
+	for i, constant := range bytecode.Constanst {
+		if fn, ok := constant.(*object.CompiledFunction); ok && fn.File != "" && fn.Name == fn.File {
+			if _, ok := modules[fn.File]; ok {
+				t.Errorf("module %s compiled twice", fn.File)
+			}
+			modules[fn.File] = i
+		}
+	}
+	math, lib := modules[filepath.Join(dir, "math.mk")], modules[filepath.Join(dir, "lib.mk")]
+	if len(modules) != 2 {
+		t.Fatalf("wrong modules. got=%v", modules)
+	}
+	expected := concatInstructions([]code.Instructions{
+		code.Make(code.OpImport, math),
+		code.Make(code.OpPop),
+		code.Make(code.OpImport, lib),
+		code.Make(code.OpPop),
+		code.Make(code.OpImport, math),
+		code.Make(code.OpPop),
+	})
+	if err := testInstructions([]code.Instructions{expected}, bytecode.Instructions); err != nil {
+		t.Fatalf("testInstructions failed: %s", err)
+	}
+	if err := bytecode.Verify(2048); err != nil {
+		t.Fatalf("verify error: %s", err)
+	}
+
+	var buf bytes.Buffer
+	if err := bytecode.Encode(&buf); err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+	if !reflect.DeepEqual(decoded.Constanst, bytecode.Constanst) {
+		t.Errorf("wrong constants.\nwant=%+v\n got=%+v", bytecode.Constanst, decoded.Constanst)
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	dir := conformance.WriteModules(t, map[string]string{
+		"undefined.mk": "let x = 1;\nlet y = z;",
+		"a.mk":         `let b = import "b";`,
+		"b.mk":         `let a = import "a";`,
+	})
+	file := filepath.Join(dir, "main.mk")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "nope"`, `module "nope" not found`},
+		{`let f = fn() { import "undefined" }`, filepath.Join(dir, "undefined.mk") + ":2:9: undefined variable: z"},
+		{`import "a"`, "import cycle: " + filepath.Join(dir, "a.mk") + " -> " + filepath.Join(dir, "b.mk") + " -> " + filepath.Join(dir, "a.mk")},
+	}
+	for _, tt := range tests {
+		comp := New()
+		comp.EnableImports(file, module.NewLoader(nil))
+		err := comp.Compile(parse(tt.input))
+		if err == nil || err.Error() != tt.expected {
+			t.Errorf("wrong error. input=%s want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	err := New().Compile(parse(`import "a"`))
+	if err == nil || err.Error() != "imports are not enabled" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}
@@ -0,0 +1,277 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"mokey-type/code"
+	"mokey-type/object"
+)
+
+// A .mkc file is the magic number, a version and then the bytecode:
+//
+//	magic     4 bytes "MKC\x00"
+//	version   uint16
+//	main      instructions, source map, global names
+//	constants uint32 count, then one tagged constant each
+//
+// instructions are an uint32 length followed by the bytes, a source map an
+// uint32 count followed by the offset, line and column of each position as
+// uint32s and a byte that is 1 for the start of a statement. A function is
+// its number of locals and parameters as uint32s, its instructions, its
+// source map, its name, an uint32 length followed by the bytes, the names
+// of its locals and free variables and its file, stored like its name.
+// Lists of names are an uint32 count followed by the names. Every number
+// is big endian like the operands in the instructions themselves.
+var Magic = []byte("MKC\x00")
+
+const FormatVersion = 6
+
+const (
+	constantInteger  byte = 1
+	constantString   byte = 2
+	constantFunction byte = 3
+)
+
+func (b *Bytecode) Encode(w io.Writer) error {
+	var out bytes.Buffer
+	out.Write(Magic)
+	writeUint16(&out, FormatVersion)
+	writeBytes(&out, b.Instructions)
+	writeSourceMap(&out, b.SourceMap)
+	writeNames(&out, b.GlobalNames)
+	writeUint32(&out, len(b.Constanst))
+
+	for i, constant := range b.Constanst {
+		switch constant := constant.(type) {
+		case *object.Integer:
+			out.WriteByte(constantInteger)
+			var buf [8]byte
+			binary.BigEndian.PutUint64(buf[:], uint64(constant.Value))
+			out.Write(buf[:])
+
+		case *object.String:
+			out.WriteByte(constantString)
+			writeBytes(&out, []byte(constant.Value))
+
+		case *object.CompiledFunction:
+			out.WriteByte(constantFunction)
+			writeUint32(&out, constant.NumLocals)
+			writeUint32(&out, constant.NumParameters)
+			writeBytes(&out, constant.Instructions)
+			writeSourceMap(&out, constant.SourceMap)
+			writeBytes(&out, []byte(constant.Name))
+			writeNames(&out, constant.LocalNames)
+			writeNames(&out, constant.FreeNames)
+			writeBytes(&out, []byte(constant.File))
+
+		default:
+			return fmt.Errorf("unsupported constant %d of type %s", i, constant.Type())
+		}
+	}
+
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+func Decode(r io.Reader) (*Bytecode, error) {
+	magic := make([]byte, len(Magic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, Magic) {
+		return nil, fmt.Errorf("not a .mkc file")
+	}
+
+	d := &decoder{r: r}
+	version := d.uint16()
+	if d.err == nil && version != FormatVersion {
+		return nil, fmt.Errorf("unsupported .mkc version %d, want %d", version, FormatVersion)
+	}
+
+	bytecode := &Bytecode{
+		Instructions: code.Instructions(d.bytes()),
+		SourceMap:    d.sourceMap(),
+		GlobalNames:  d.names(),
+		Constanst:    []object.Object{},
+	}
+
+	count := d.uint32()
+	for i := 0; i < count && d.err == nil; i++ {
+		switch tag := d.byte(); tag {
+		case constantInteger:
+			bytecode.Constanst = append(bytecode.Constanst, &object.Integer{Value: int64(d.uint64())})
+
+		case constantString:
+			bytecode.Constanst = append(bytecode.Constanst, &object.String{Value: string(d.bytes())})
+
+		case constantFunction:
+			fn := &object.CompiledFunction{}
+			fn.NumLocals = d.uint32()
+			fn.NumParameters = d.uint32()
+			fn.Instructions = d.bytes()
+			fn.SourceMap = d.sourceMap()
+			fn.Name = string(d.bytes())
+			fn.LocalNames = d.names()
+			fn.FreeNames = d.names()
+			fn.File = string(d.bytes())
+			bytecode.Constanst = append(bytecode.Constanst, fn)
+
+		default:
+			if d.err == nil {
+				return nil, fmt.Errorf("unknown constant tag %d", tag)
+			}
+		}
+	}
+
+	if d.err != nil {
+		if errors.Is(d.err, io.EOF) {
+			d.err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("corrupt .mkc file: %w", d.err)
+	}
+	return bytecode, nil
+}
+
+func writeSourceMap(out *bytes.Buffer, m code.SourceMap) {
+	writeUint32(out, len(m))
+	for _, p := range m {
+		writeUint32(out, p.Offset)
+		writeUint32(out, p.Line)
+		writeUint32(out, p.Column)
+		if p.Statement {
+			out.WriteByte(1)
+		} else {
+			out.WriteByte(0)
+		}
+	}
+}
+
+func writeNames(out *bytes.Buffer, names []string) {
+	writeUint32(out, len(names))
+	for _, name := range names {
+		writeBytes(out, []byte(name))
+	}
+}
+
+func writeUint16(out *bytes.Buffer, n int) {
+	var buf [2]byte
+	binary.BigEndian.PutUint16(buf[:], uint16(n))
+	out.Write(buf[:])
+}
+
+func writeUint32(out *bytes.Buffer, n int) {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(n))
+	out.Write(buf[:])
+}
+
+func writeBytes(out *bytes.Buffer, b []byte) {
+	writeUint32(out, len(b))
+	out.Write(b)
+}
+
+// decoder keeps the first error so Decode can read a whole section and
+// check once at the end.
+type decoder struct {
+	r   io.Reader
+	err error
+}
+
+func (d *decoder) read(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	// grow with the data instead of trusting the length in the file
+	var buf bytes.Buffer
+	_, d.err = io.CopyN(&buf, d.r, int64(n))
+	return buf.Bytes()
+}
+
+func (d *decoder) byte() byte {
+	b := d.read(1)
+	if d.err != nil {
+		return 0
+	}
+	return b[0]
+}
+
+func (d *decoder) uint16() int {
+	b := d.read(2)
+	if d.err != nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(b))
+}
+
+func (d *decoder) uint32() int {
+	b := d.read(4)
+	if d.err != nil {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(b))
+}
+
+func (d *decoder) uint64() uint64 {
+	b := d.read(8)
+	if d.err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uint32()
+	b := d.read(n)
+	if b == nil {
+		return []byte{}
+	}
+	return b
+}
+
+func (d *decoder) sourceMap() code.SourceMap {
+	var m code.SourceMap
+	n := d.uint32()
+	for i := 0; i < n && d.err == nil; i++ {
+		p := code.Position{Offset: d.uint32(), Line: d.uint32(), Column: d.uint32(), Statement: d.byte() == 1}
+		if d.err == nil {
+			m = append(m, p)
+		}
+	}
+	return m
+}
+
+func (d *decoder) names() []string {
+	var names []string
+	n := d.uint32()
+	for i := 0; i < n && d.err == nil; i++ {
+		name := string(d.bytes())
+		if d.err == nil {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Verify runs code.Verify over the bytecode for a vm whose stack holds
+// stackSize values, it is meant for programs that were loaded from a file
+// instead of compiled in this process.
+func (b *Bytecode) Verify(stackSize int) error {
+	program := &code.Program{
+		Instructions: b.Instructions,
+		Constants:    make([]code.Constant, len(b.Constanst)),
+		NumBuiltins:  len(object.Builtins),
+		NumCounters:  len(b.Counters),
+		StackSize:    stackSize,
+	}
+	for i, constant := range b.Constanst {
+		if fn, ok := constant.(*object.CompiledFunction); ok {
+			program.Constants[i] = code.Constant{
+				Function:      true,
+				Instructions:  fn.Instructions,
+				NumLocals:     fn.NumLocals,
+				NumParameters: fn.NumParameters,
+			}
+		}
+	}
+	return code.Verify(program)
+}
@@ -0,0 +1,95 @@
+package compiler
+
+import (
+	"bytes"
+	"mokey-type/object"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	input := `
+	let greeting = "hello";
+	let add = fn(a, b) { let c = a + b; c };
+	let outer = fn(x) { fn(y) { x - y } };
+	[add(1, -2), outer(10)(3), greeting];
+	`
+	comp := New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	var buf bytes.Buffer
+	if err := bytecode.Encode(&buf); err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), Magic) {
+		t.Fatalf("encoded file does not start with the magic number. got=%q", buf.Bytes()[:4])
+	}
+
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode error: %s", err)
+	}
+	if !bytes.Equal(decoded.Instructions, bytecode.Instructions) {
+		t.Errorf("wrong instructions.\nwant=%q\n got=%q", bytecode.Instructions, decoded.Instructions)
+	}
+	if !reflect.DeepEqual(decoded.SourceMap, bytecode.SourceMap) {
+		t.Errorf("wrong source map.\nwant=%+v\n got=%+v", bytecode.SourceMap, decoded.SourceMap)
+	}
+	if !reflect.DeepEqual(decoded.Constanst, bytecode.Constanst) {
+		t.Errorf("wrong constants.\nwant=%+v\n got=%+v", bytecode.Constanst, decoded.Constanst)
+	}
+}
+
+func TestEncodeUnsupportedConstant(t *testing.T) {
+	bytecode := &Bytecode{Constanst: []object.Object{&object.Boolean{Value: true}}}
+	err := bytecode.Encode(&bytes.Buffer{})
+	if err == nil || err.Error() != "unsupported constant 0 of type BOOLEAN" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	comp := New()
+	if err := comp.Compile(parse(`fn(x) { x * 2 }("ignored")`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := comp.Bytecode().Encode(&buf); err != nil {
+		t.Fatalf("encode error: %s", err)
+	}
+	valid := buf.Bytes()
+
+	wrongVersion := append([]byte{}, valid...)
+	wrongVersion[len(Magic)+1] = 9
+
+	unknownTag := append([]byte{}, Magic...)
+	// no instructions, an empty source map, no globals and one constant
+	unknownTag = append(unknownTag, 0, FormatVersion, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 42)
+
+	tests := []struct {
+		input    []byte
+		expected string
+	}{
+		{[]byte("let x = 1;"), "not a .mkc file"},
+		{[]byte{}, "not a .mkc file"},
+		{wrongVersion, "unsupported .mkc version 9, want 6"},
+		{valid[:len(valid)-3], "corrupt .mkc file: unexpected EOF"},
+		{valid[:len(Magic)+1], "corrupt .mkc file: unexpected EOF"},
+		{unknownTag, "unknown constant tag 42"},
+	}
+
+	for i, tt := range tests {
+		_, err := Decode(bytes.NewReader(tt.input))
+		if err == nil {
+			t.Errorf("test %d: expected an error", i)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("test %d: wrong error. want=%q, got=%q", i, tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package compiler
+
+import (
+	"fmt"
+	"mokey-type/ast"
+	"mokey-type/lexer"
+	"mokey-type/object"
+	"mokey-type/token"
+	"sort"
+)
+
+// Index maps every identifier of a program to the identifier that declared
+// it: the name of a let, a function parameter, or the let name a function
+// uses to call itself. It is built with the same symbol tables the compiler
+// uses, so it agrees with the compiler about shadowing.
+type Index struct {
+	identifiers []*ast.Identifier
+	definitions map[*ast.Identifier]*ast.Identifier
+	symbols     map[*ast.Identifier]Symbol
+}
+
+type declarations struct {
+	names map[string]*ast.Identifier
+	outer *declarations
+}
+
+func (d *declarations) lookup(name string) *ast.Identifier {
+	for ; d != nil; d = d.outer {
+		if ident, ok := d.names[name]; ok {
+			return ident
+		}
+	}
+	return nil
+}
+
+type resolver struct {
+	index        *Index
+	symbolTable  *SymbolTable
+	declarations *declarations
+}
+
+// Resolve builds the index of program. Identifiers that don't resolve, which
+// the compiler would report as undefined, have no definition and no symbol.
+func Resolve(program *ast.Program) *Index {
+	symbolTable := NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	r := &resolver{
+		index: &Index{
+			definitions: make(map[*ast.Identifier]*ast.Identifier),
+			symbols:     make(map[*ast.Identifier]Symbol),
+		},
+		symbolTable:  symbolTable,
+		declarations: &declarations{names: make(map[string]*ast.Identifier)},
+	}
+	r.resolve(program)
+
+	sort.SliceStable(r.index.identifiers, func(i, j int) bool {
+		a, b := r.index.identifiers[i].Token, r.index.identifiers[j].Token
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return r.index
+}
+
+// resolve visits node in the order the compiler compiles it.
+func (r *resolver) resolve(node ast.Node) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			if n.Name == nil {
+				return false
+			}
+			if fn, ok := n.Value.(*ast.FunctionLiteral); ok && fn != nil && fn.Name != "" {
+				r.function(fn, n.Name)
+			} else {
+				r.resolve(n.Value)
+			}
+			r.define(n.Name, r.symbolTable.Define(n.Name.Value))
+			return false
+
+		case *ast.FunctionLiteral:
+			r.function(n, nil)
+			return false
+
+		case *ast.ForLoop:
+			r.resolve(&n.Declaration)
+			r.resolve(n.Condition)
+			if n.Body != nil {
+				r.resolve(n.Body)
+			}
+			r.resolve(n.Consequence)
+			return false
+
+		case *ast.Identifier:
+			r.index.identifiers = append(r.index.identifiers, n)
+			symbol, ok := r.symbolTable.Resolve(n.Value)
+			if !ok {
+				return false
+			}
+			r.index.symbols[n] = symbol
+			if decl := r.declarations.lookup(n.Value); decl != nil && symbol.Scope != BuiltinScope {
+				r.index.definitions[n] = decl
+			}
+		}
+		return true
+	})
+}
+
+// function resolves fn in a new scope, name is the let that named it.
+func (r *resolver) function(fn *ast.FunctionLiteral, name *ast.Identifier) {
+	r.symbolTable = NewEnclosedSymbolTable(r.symbolTable)
+	r.declarations = &declarations{names: make(map[string]*ast.Identifier), outer: r.declarations}
+
+	if name != nil {
+		r.symbolTable.DefineFunctionName(name.Value)
+		r.declarations.names[name.Value] = name
+	}
+	for _, param := range fn.Parameters {
+		r.define(param, r.symbolTable.Define(param.Value))
+	}
+	if fn.Body != nil {
+		r.resolve(fn.Body)
+	}
+
+	r.symbolTable = r.symbolTable.Outer
+	r.declarations = r.declarations.outer
+}
+
+func (r *resolver) define(ident *ast.Identifier, symbol Symbol) {
+	r.index.identifiers = append(r.index.identifiers, ident)
+	r.index.symbols[ident] = symbol
+	r.index.definitions[ident] = ident
+	r.declarations.names[ident.Value] = ident
+}
+
+// Identifiers returns every identifier of the program in source order.
+func (ix *Index) Identifiers() []*ast.Identifier {
+	return ix.identifiers
+}
+
+// At returns the identifier under the 1-based line and byte column.
+func (ix *Index) At(line, column int) *ast.Identifier {
+	for _, ident := range ix.identifiers {
+		tok := ident.Token
+		if tok.Line == line && tok.Column <= column && column < tok.Column+len(tok.Literal) {
+			return ident
+		}
+	}
+	return nil
+}
+
+// Definition returns the identifier that declared ident. A declaration is
+// its own definition.
+func (ix *Index) Definition(ident *ast.Identifier) (*ast.Identifier, bool) {
+	decl, ok := ix.definitions[ident]
+	return decl, ok
+}
+
+// Symbol returns what the symbol table resolved ident to.
+func (ix *Index) Symbol(ident *ast.Identifier) (Symbol, bool) {
+	symbol, ok := ix.symbols[ident]
+	return symbol, ok
+}
+
+// References returns the declaration decl and all its uses in source order.
+func (ix *Index) References(decl *ast.Identifier) []*ast.Identifier {
+	references := []*ast.Identifier{}
+	for _, ident := range ix.identifiers {
+		if ix.definitions[ident] == decl {
+			references = append(references, ident)
+		}
+	}
+	return references
+}
+
+// Rename returns the identifiers to rewrite so the declaration of ident is
+// called name. It fails when a use would end up bound to a different
+// declaration, either because the new name is shadowed where the variable
+// is used or because it shadows something that was already called name.
+func Rename(program *ast.Program, ident *ast.Identifier, name string) ([]*ast.Identifier, error) {
+	if !IsIdentifier(name) {
+		return nil, fmt.Errorf("%q is not a valid identifier", name)
+	}
+	before := Resolve(program)
+	decl, ok := before.Definition(ident)
+	if !ok {
+		if symbol, ok := before.Symbol(ident); ok && symbol.Scope == BuiltinScope {
+			return nil, fmt.Errorf("cannot rename builtin %s", ident.Value)
+		}
+		return nil, fmt.Errorf("undefined variable: %s", ident.Value)
+	}
+
+	references := before.References(decl)
+	old := decl.Value
+	for _, ref := range references {
+		ref.Value = name
+	}
+	after := Resolve(program)
+	for _, ref := range references {
+		ref.Value = old
+	}
+
+	for _, other := range before.identifiers {
+		if before.definitions[other] != after.definitions[other] {
+			tok := other.Token
+			return nil, fmt.Errorf("renaming %s to %s changes what %s at %d:%d refers to",
+				old, name, tok.Literal, tok.Line, tok.Column)
+		}
+	}
+	return references, nil
+}
+
+// IsIdentifier reports whether name lexes as a single identifier.
+func IsIdentifier(name string) bool {
+	l := lexer.New(name)
+	tok := l.NextToken()
+	return tok.Type == token.IDENT && tok.Literal == name && l.NextToken().Type == token.EOF
+}
@@ -0,0 +1,226 @@
+package compiler
+
+import (
+	"fmt"
+	"mokey-type/ast"
+	"strings"
+	"testing"
+)
+
+func position(ident *ast.Identifier) string {
+	return fmt.Sprintf("%d:%d", ident.Token.Line, ident.Token.Column)
+}
+
+// bindings lists every identifier with the position of its declaration.
+func bindings(index *Index) string {
+	out := []string{}
+	for _, ident := range index.Identifiers() {
+		decl, ok := index.Definition(ident)
+		target := "?"
+		if ok {
+			target = position(decl)
+		} else if symbol, ok := index.Symbol(ident); ok {
+			target = string(symbol.Scope)
+		}
+		out = append(out, fmt.Sprintf("%s@%s->%s", ident.Value, position(ident), target))
+	}
+	return strings.Join(out, " ")
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			"let x = 1; x + y",
+			"x@1:5->1:5 x@1:12->1:5 y@1:16->?",
+		},
+		{
+			"let x = 1; let f = fn(x) { x }; x",
+			"x@1:5->1:5 f@1:16->1:16 x@1:23->1:23 x@1:28->1:23 x@1:33->1:5",
+		},
+		{
+			"let f = fn(n) { f(n) }; len(f)",
+			"f@1:5->1:5 n@1:12->1:12 f@1:17->1:5 n@1:19->1:12 len@1:25->BUILTIN f@1:29->1:5",
+		},
+		{
+			"let a = 1; let f = fn() { let b = a; fn() { a + b } }",
+			"a@1:5->1:5 f@1:16->1:16 b@1:31->1:31 a@1:35->1:5 a@1:45->1:5 b@1:49->1:31",
+		},
+		{
+			"let x = 1; let x = x; x",
+			"x@1:5->1:5 x@1:16->1:16 x@1:20->1:5 x@1:23->1:16",
+		},
+		{
+			"for (let i = 0; i < 3; ++i) { i }",
+			"i@1:10->1:10 i@1:17->1:10 i@1:26->1:10 i@1:31->1:10",
+		},
+	}
+
+	for _, tt := range tests {
+		got := bindings(Resolve(parse(tt.input)))
+		if got != tt.expected {
+			t.Errorf("wrong bindings for %q.\nwant=%s\n got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestResolveSymbols(t *testing.T) {
+	index := Resolve(parse("let g = 1; fn(p) { let l = p; fn() { g + l } }"))
+	expected := map[string]SymbolScope{}
+	for _, ident := range index.Identifiers() {
+		symbol, _ := index.Symbol(ident)
+		expected[position(ident)] = symbol.Scope
+	}
+	for pos, scope := range map[string]SymbolScope{
+		"1:5":  GlobalScope,
+		"1:15": LocalScope,
+		"1:24": LocalScope,
+		"1:38": GlobalScope,
+		"1:42": FreeScope,
+	} {
+		if expected[pos] != scope {
+			t.Errorf("identifier at %s has scope %s, want %s", pos, expected[pos], scope)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	program := parse("let x = 1;\nlet f = fn(x) { x };\nx + f(x)")
+	index := Resolve(program)
+
+	use := index.At(3, 1)
+	if use == nil || use.Value != "x" {
+		t.Fatalf("At(3, 1) = %v, want x", use)
+	}
+	decl, ok := index.Definition(use)
+	if !ok || position(decl) != "1:5" {
+		t.Fatalf("x at 3:1 should be declared at 1:5, got %v", decl)
+	}
+
+	got := []string{}
+	for _, ref := range index.References(decl) {
+		got = append(got, position(ref))
+	}
+	if strings.Join(got, " ") != "1:5 3:1 3:7" {
+		t.Errorf("wrong references %v", got)
+	}
+
+	if index.At(2, 9) != nil {
+		t.Errorf("At should not find an identifier on fn")
+	}
+}
+
+func TestRename(t *testing.T) {
+	tests := []struct {
+		input    string
+		at       [2]int
+		name     string
+		expected string
+		err      string
+	}{
+		{
+			input:    "let x = 1; let f = fn(x) { x }; x + f(x)",
+			at:       [2]int{1, 5},
+			name:     "y",
+			expected: "1:5 1:33 1:39",
+		},
+		{
+			input:    "let x = 1; let f = fn(x) { x }; x + f(x)",
+			at:       [2]int{1, 28},
+			name:     "n",
+			expected: "1:23 1:28",
+		},
+		{
+			input:    "let f = fn() { f() }; f()",
+			at:       [2]int{1, 16},
+			name:     "g",
+			expected: "1:5 1:16 1:23",
+		},
+		{
+			input: "let x = 1; let y = 2; fn(x) { x + y }",
+			at:    [2]int{1, 5},
+			name:  "z",
+			// the x inside the function belongs to the parameter
+			expected: "1:5",
+		},
+		{
+			input: "let x = 1; let y = 2; fn(x) { x + y }",
+			at:    [2]int{1, 16},
+			name:  "x",
+			err:   "renaming y to x changes what y at 1:35 refers to",
+		},
+		{
+			input: "let x = 1; fn(y) { x + y }",
+			at:    [2]int{1, 15},
+			name:  "x",
+			err:   "renaming y to x changes what x at 1:20 refers to",
+		},
+		{
+			input: "let x = [1]; len(x)",
+			at:    [2]int{1, 5},
+			name:  "len",
+			err:   "renaming x to len changes what len at 1:14 refers to",
+		},
+		{
+			input: "let x = 1; x + missing",
+			at:    [2]int{1, 5},
+			name:  "missing",
+			err:   "renaming x to missing changes what missing at 1:16 refers to",
+		},
+		{
+			input: "len([])",
+			at:    [2]int{1, 1},
+			name:  "size",
+			err:   "cannot rename builtin len",
+		},
+		{
+			input: "missing",
+			at:    [2]int{1, 1},
+			name:  "found",
+			err:   "undefined variable: missing",
+		},
+		{
+			input: "let x = 1;",
+			at:    [2]int{1, 5},
+			name:  "fn",
+			err:   `"fn" is not a valid identifier`,
+		},
+		{
+			input: "let x = 1;",
+			at:    [2]int{1, 5},
+			name:  "a b",
+			err:   `"a b" is not a valid identifier`,
+		},
+	}
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+		ident := Resolve(program).At(tt.at[0], tt.at[1])
+		if ident == nil {
+			t.Fatalf("no identifier at %v in %q", tt.at, tt.input)
+		}
+		refs, err := Rename(program, ident, tt.name)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("wrong error for %q. want=%q, got=%v", tt.input, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("rename failed for %q: %s", tt.input, err)
+			continue
+		}
+		got := []string{}
+		for _, ref := range refs {
+			got = append(got, position(ref))
+		}
+		if strings.Join(got, " ") != tt.expected {
+			t.Errorf("wrong identifiers for %q. want=%s, got=%v", tt.input, tt.expected, got)
+		}
+		if program.String() != parse(tt.input).String() {
+			t.Errorf("Rename changed the program")
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package compiler
 
+import "sort"
+
 type SymbolScope string
 
 const (
@@ -29,7 +31,13 @@ func NewSymbolTable() *SymbolTable {
 	return &SymbolTable{store: s, FreeSymbols: free}
 }
 
+// Define binds name in s. Defining a name again in the same scope reuses
+// its slot, so a let in a loop body updates the variable like the
+// evaluator does.
 func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && (symbol.Scope == GlobalScope || symbol.Scope == LocalScope) {
+		return symbol
+	}
 	symbol := Symbol{Name: name, Index: s.numDefinitions}
 	if s.Outer == nil {
 		symbol.Scope = GlobalScope
@@ -90,3 +98,47 @@ func (s *SymbolTable) DefineFunctionName(name string) Symbol {
 	s.store[name] = symbol
 	return symbol
 }
+
+// Names lists every name visible from s, inner definitions first.
+func (s *SymbolTable) Names() []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for table := s; table != nil; table = table.Outer {
+		scope := []string{}
+		for name := range table.store {
+			if !seen[name] {
+				seen[name] = true
+				scope = append(scope, name)
+			}
+		}
+		sort.Strings(scope)
+		names = append(names, scope...)
+	}
+	return names
+}
+
+// Definitions returns the symbols defined with Define in s itself, in the
+// order they were first defined.
+func (s *SymbolTable) Definitions() []Symbol {
+	symbols := []Symbol{}
+	for _, symbol := range s.store {
+		if symbol.Scope == GlobalScope || symbol.Scope == LocalScope {
+			symbols = append(symbols, symbol)
+		}
+	}
+	sort.Slice(symbols, func(i, j int) bool { return symbols[i].Index < symbols[j].Index })
+	return symbols
+}
+
+// DefinedNames names the symbols defined with Define in s by index, the
+// index of a name that was defined again has an empty one.
+func (s *SymbolTable) DefinedNames() []string {
+	if s.numDefinitions == 0 {
+		return nil
+	}
+	names := make([]string, s.numDefinitions)
+	for _, symbol := range s.Definitions() {
+		names[symbol.Index] = symbol.Name
+	}
+	return names
+}
@@ -275,3 +275,26 @@ func TestShadowingFunctionName(t *testing.T) {
 		t.Errorf("expected %s to resolve to %+v, got=%+v", expected.Name, expected, result)
 	}
 }
+
+func TestDefinitions(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	global.Define("b")
+	global.Define("a")
+	global.Define("b")
+	global.DefineFunctionName("f")
+
+	expected := []Symbol{
+		{Name: "b", Scope: GlobalScope, Index: 0},
+		{Name: "a", Scope: GlobalScope, Index: 1},
+	}
+	result := global.Definitions()
+	if len(result) != len(expected) {
+		t.Fatalf("wrong number of definitions. want=%+v, got=%+v", expected, result)
+	}
+	for i, symbol := range expected {
+		if result[i] != symbol {
+			t.Errorf("definition %d wrong. want=%+v, got=%+v", i, symbol, result[i])
+		}
+	}
+}
@@ -0,0 +1,606 @@
+package conformance
+
+import "mokey-type/object"
+
+var IntegerArithmetic = []Case{
+	{"1", 1},
+	{"2", 2},
+	{"1 + 2", 3},
+	{"1 - 2", -1},
+	{"1 * 2", 2},
+	{"4 / 2", 2},
+	{"50 / 2 * 2 + 10 - 5", 55},
+	{"5 + 5 + 5 + 5 - 10", 10},
+	{"2 * 2 * 2 * 2 * 2", 32},
+	{"5 * 2 + 10", 20},
+	{"5 + 2 * 10", 25},
+	{"5 * (2 + 10)", 60},
+	{"-5", -5},
+	{"-10", -10},
+	{"-50 + 100 + -50", 0},
+	{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+	{"++1", 2},
+	{"--2", 1},
+	{"1 / 0", RuntimeError("division by zero")},
+	{"let f = fn(x) { 10 / x }; f(5) + f(0)", RuntimeError("division by zero")},
+}
+
+var BooleanExpressions = []Case{
+	{"true", true},
+	{"false", false},
+	{"1 < 2", true},
+	{"1 > 2", false},
+	{"1 < 1", false},
+	{"1 > 1", false},
+	{"1 == 1", true},
+	{"1 != 1", false},
+	{"1 == 2", false},
+	{"1 != 2", true},
+	{"true == true", true},
+	{"false == false", true},
+	{"true == false", false},
+	{"true != false", true},
+	{"false != true", true},
+	{"(1 < 2) == true", true},
+	{"(1 < 2) == false", false},
+	{"(1 > 2) == true", false},
+	{"(1 > 2) == false", true},
+	{"!true", false},
+	{"!false", true},
+	{"!5", false},
+	{"!!true", true},
+	{"!!false", false},
+	{"!!5", true},
+	{"!(if (false) { 5; })", true},
+}
+
+var Conditionals = []Case{
+	{"if (true) { 10 }", 10},
+	{"if (true) { 10 } else { 20 }", 10},
+	{"if (false) { 10 } else { 20 } ", 20},
+	{"if (1) { 10 }", 10},
+	{"if (1 < 2) { 10 }", 10},
+	{"if (1 < 2) { 10 } else { 20 }", 10},
+	{"if (1 > 2) { 10 } else { 20 }", 20},
+	{"if (1 > 2) { 10 }", Null},
+	{"if (false) { 10 }", Null},
+	{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
+}
+
+var GlobalLetStatements = []Case{
+	{"let one = 1; one", 1},
+	{"let one = 1; let two = 2; one + two", 3},
+	{"let one = 1; let two = one + one; one + two", 3},
+	{"let x = 1; let x = x + 1; x", 2},
+	{"let x = 1; let f = fn() { x }; let x = 2; f()", 2},
+}
+
+var StringExpressions = []Case{
+	{`"monkey"`, "monkey"},
+	{`"mon" + "key"`, "monkey"},
+	{`"mon" + "key" + "banana"`, "monkeybanana"},
+	{`"mon" + "key" == "monkey"`, true},
+	{`"mon" != "key"`, true},
+	{`"monkey" != "monkey"`, false},
+}
+
+var ArrayLiterals = []Case{
+	{"[]", []int{}},
+	{"[1, 2, 3]", []int{1, 2, 3}},
+	{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
+}
+
+var HashLiterals = []Case{
+	{
+		"{}", map[object.HashKey]int64{},
+	},
+	{
+		"{1: 2, 2: 3}",
+		map[object.HashKey]int64{
+			(&object.Integer{Value: 1}).HashKey(): 2,
+			(&object.Integer{Value: 2}).HashKey(): 3,
+		},
+	},
+	{
+		"{1 + 1: 2 * 2, 3 + 3: 4 * 4}",
+		map[object.HashKey]int64{
+			(&object.Integer{Value: 2}).HashKey(): 4,
+			(&object.Integer{Value: 6}).HashKey(): 16,
+		},
+	},
+	// the pairs run sorted by the text of their key
+	{`let f = fn() { {"b": if (true) { return 2 }, "a": if (true) { return 1 }} }; f()`, 1},
+}
+
+var IndexExpressions = []Case{
+	{"[1, 2, 3][1]", 2},
+	{"[1, 2, 3][0 + 2]", 3},
+	{"[[1, 1, 1]][0][0]", 1},
+	{"[][0]", Null},
+	{"[1, 2, 3][99]", Null},
+	{"[1][-1]", Null},
+	{"{1: 1, 2: 2}[1]", 1},
+	{"{1: 1, 2: 2}[2]", 2},
+	{"{1: 1}[0]", Null},
+	{"{}[0]", Null},
+}
+
+var CallingFunctionsWithoutArguments = []Case{
+	{
+		Input: `
+			let fivePlusTen = fn() { 5 + 10; };
+			fivePlusTen();
+			`,
+		Expected: 15,
+	},
+	{
+		Input: `
+			let one = fn() { 1; };
+			let two = fn() { 2; };
+			one() + two()
+			`,
+		Expected: 3,
+	},
+	{
+		Input: `
+			let a = fn() { 1 };
+			let b = fn() { a() + 1 };
+			let c = fn() { b() + 1 };
+			c();
+			`,
+		Expected: 3,
+	},
+}
+
+var FunctionsWithReturnStatement = []Case{
+	{
+		Input: `
+			let earlyExit = fn() { return 99; 100; };
+			earlyExit();
+			`,
+		Expected: 99,
+	},
+	{
+		Input: `
+			let earlyExit = fn() { return 99; return 100; };
+			earlyExit();
+			`,
+		Expected: 99,
+	},
+	{
+		Input: `
+			let nested = fn() { if (true) { if (true) { return 99; } 0 } + 1 };
+			nested();
+			`,
+		Expected: 99,
+	},
+}
+
+var FunctionsWithoutReturnValue = []Case{
+	{
+		Input: `
+				let noReturn = fn() { };
+				noReturn();
+			`,
+		Expected: Null,
+	},
+	{
+		Input: `
+			let noReturn = fn() { };
+			let noReturnTwo = fn() { noReturn(); };
+			noReturn();
+			noReturnTwo();
+			`,
+		Expected: Null,
+	},
+}
+
+var FirstClassFunctions = []Case{
+	{
+		Input: `
+			let returnsOne = fn() { 1; };
+			let returnsOneReturner = fn() { returnsOne; };
+			returnsOneReturner()();
+			`,
+		Expected: 1,
+	},
+}
+
+var CallingFunctionsWithBindings = []Case{
+	{"let f = fn() { let x = 1; let x = x + 1; x }; f()", 2},
+	{"let f = fn(a) { let a = 1 + a * 2; a }; f(3)", 7},
+	{"let x = 5; let f = fn() { let x = x * 2; x }; [f(), x]", []int{10, 5}},
+	{"let x = 1; let f = fn() { let y = x; let x = 2; y + x }; f()", 3},
+	{"let len = fn(x) { 42 }; len([])", 42},
+	{
+		Input: `
+			let one = fn() { let one = 1; one };
+			one();
+			`,
+		Expected: 1,
+	},
+	{
+		Input: `
+			let oneAndTwo = fn() { let one = 1; let two = 2; one + two; };
+			oneAndTwo();
+			`,
+		Expected: 3,
+	},
+	{
+		Input: `
+			let oneAndTwo = fn() { let one = 1; let two = 2; one + two; };
+			let threeAndFour = fn() { let three = 3; let four = 4; three + four; };
+			oneAndTwo() + threeAndFour();
+			`,
+		Expected: 10,
+	},
+	{
+		Input: `
+			let firstFoobar = fn() { let foobar = 50; foobar; };
+			let secondFoobar = fn() { let foobar = 100; foobar; };
+			firstFoobar() + secondFoobar();
+			`,
+		Expected: 150,
+	},
+	{
+		Input: `
+			let globalSeed = 50;
+			let minusOne = fn() {
+			let num = 1;
+			globalSeed - num;
+			}
+			let minusTwo = fn() {
+			let num = 2;
+			globalSeed - num;
+			}
+			minusOne() + minusTwo();
+			`,
+		Expected: 97,
+	},
+}
+
+var CallingFunctionsWithArgumentsAndBindings = []Case{
+	{
+		Input: `
+			let identity = fn(a) { a; };
+			identity(4);
+			`,
+		Expected: 4,
+	},
+	{
+		Input: `
+			let sum = fn(a, b) { a + b; };
+			sum(1, 2);
+			`,
+		Expected: 3,
+	},
+	{
+		Input: `
+			let sum = fn(a, b) {
+			let c = a + b;
+			c;
+			};
+			sum(1, 2);
+			`,
+		Expected: 3,
+	},
+	{
+		Input: `
+			let sum = fn(a, b) {
+			let c = a + b;
+			c;
+			};
+			sum(1, 2) + sum(3, 4);`,
+		Expected: 10,
+	},
+	{
+		Input: `
+			let sum = fn(a, b) {
+			let c = a + b;
+			c;
+			};
+			let outer = fn() {
+			sum(1, 2) + sum(3, 4);
+			};
+			outer();
+			`,
+		Expected: 10,
+	},
+	{
+		Input: `
+			let globalNum = 10;
+			let sum = fn(a, b) {
+				let c = a + b;
+				c + globalNum;
+			};
+			let outer = fn() {
+				sum(1, 2) + sum(3, 4) + globalNum;
+			};
+			outer() + globalNum;
+			`,
+		Expected: 50,
+	},
+}
+
+var CallingFunctionsWithWrongArguments = []Case{
+	{
+		Input:    `fn() { 1; }(1);`,
+		Expected: RuntimeError(`wrong number of arguments: want=0, got=1`),
+	},
+	{
+		Input:    `fn(a) { a; }();`,
+		Expected: RuntimeError(`wrong number of arguments: want=1, got=0`),
+	},
+	{
+		Input:    `fn(a, b) { a + b; }(1);`,
+		Expected: RuntimeError(`wrong number of arguments: want=2, got=1`),
+	},
+}
+
+// BuiltinFunctions expects a builtin's error to stop the program on every
+// engine, also when the call is an operand or an element.
+var BuiltinFunctions = []Case{
+	{`len("")`, 0},
+	{`len("four")`, 4},
+	{`len("hello world")`, 11},
+	{
+		`len(1)`,
+		RuntimeError("argument to `len` not supported, got INTEGER"),
+	},
+	{`len("one", "two")`,
+		RuntimeError("wrong number of arguments. got=2, want=1"),
+	},
+	{`len(1) + 1`, RuntimeError("argument to `len` not supported, got INTEGER")},
+	{`[len(1), 2]`, RuntimeError("argument to `len` not supported, got INTEGER")},
+	{`len([1, 2, 3])`, 3},
+	{`len([])`, 0},
+	{`puts("hello", "world!")`, Null},
+	{`first([1, 2, 3])`, 1},
+	{`first([])`, Null},
+	{`first(1)`,
+		RuntimeError("argument to `first` must be ARRAY, got INTEGER"),
+	},
+	{`last([1, 2, 3])`, 3},
+	{`last([])`, Null},
+	{`last(1)`,
+		RuntimeError("argument to `last` must be ARRAY, got INTEGER"),
+	},
+	{`rest([1, 2, 3])`, []int{2, 3}},
+	{`rest([])`, Null},
+	{`push([], 1)`, []int{1}},
+	{`push(1, 1)`,
+		RuntimeError("argument to `push` must be ARRAY, got INTEGER"),
+	},
+}
+
+var Closures = []Case{
+	{
+		Input: `
+			let newClosure = fn(a) {
+				fn() { a; };
+			};
+			let closure = newClosure(99);
+			closure();
+			`,
+		Expected: 99,
+	},
+	{
+		Input: `
+			let newAdder = fn(a, b) {
+				fn(c) { a + b + c };
+			};
+			let adder = newAdder(1, 2);
+			adder(8);
+			`,
+		Expected: 11,
+	},
+	{
+		Input: `
+			let newAdder = fn(a, b) {
+				let c = a + b;
+				fn(d) { c + d };
+			};
+			let adder = newAdder(1, 2);
+			adder(8);
+			`,
+		Expected: 11,
+	},
+	{
+		Input: `
+			let newAdderOuter = fn(a, b) {
+				let c = a + b;
+				fn(d) {
+					let e = d + c;
+					fn(f) { e + f; };
+				};
+			};
+			let newAdderInner = newAdderOuter(1, 2)
+			let adder = newAdderInner(3);
+			adder(8);
+			`,
+		Expected: 14,
+	},
+	{
+		Input: `
+			let a = 1;
+			let newAdderOuter = fn(b) {
+				fn(c) {
+					fn(d) { a + b + c + d };
+				};
+			};
+			let newAdderInner = newAdderOuter(2)
+			let adder = newAdderInner(3);
+			adder(8);
+			`,
+		Expected: 14,
+	},
+	{
+		Input: `
+			let newClosure = fn(a, b) {
+				let one = fn() { a; };
+				let two = fn() { b; };
+				fn() { one() + two(); };
+			};
+			let closure = newClosure(9, 90);
+			closure();
+			`,
+		Expected: 99,
+	},
+}
+
+var RecursiveFunctions = []Case{
+	{
+		Input: `
+			let countDown = fn(x) {
+				if (x == 0) {
+					return 0;
+				} else {
+					countDown(x - 1);
+				}
+			};
+			countDown(1);
+			`,
+		Expected: 0,
+	},
+	{
+		Input: `
+			let countDown = fn(x) {
+				if (x == 0) {
+					return 0;
+				} else {
+					countDown(x - 1);
+				}
+			};
+			let wrapper = fn() {
+				countDown(1);
+			};
+			wrapper();
+			`,
+		Expected: 0,
+	},
+	{
+		Input: `
+			let wrapper = fn() {
+				let countDown = fn(x) {
+					if (x == 0) {
+						return 0;
+					} else {
+						countDown(x - 1);
+					}
+				};
+				countDown(1);
+			};
+			wrapper();
+			`,
+		Expected: 0,
+	},
+}
+
+var RecursiveFibonacci = []Case{
+	{
+		Input: `
+			let fibonacci = fn(x) {
+				if (x == 0) {
+					return 0;
+				} else {
+					if (x == 1) {
+						return 1;
+					} else {
+						fibonacci(x - 1) + fibonacci(x - 2);
+					}
+				}
+			};
+			fibonacci(8);
+			`,
+		Expected: 21,
+	},
+}
+
+var ForLoops = []Case{
+	{"for (let i = 0; i < 3; ++i) { i }", Null},
+	{"for (let i = 0; i < 3; ++i) { i }; 10", 10},
+	{"let f = fn(n) { for (let i = 0; i < n; ++i) { i }; n * 2 }; f(3)", 6},
+	{"let f = fn() { for (let i = 10; i > 0; --i) { if (i == 3) { return i } }; 0 }; f()", 3},
+	{"let i = 5; ++i", 6},
+	{"let i = 5; --i; i", 5},
+	{"let sum = 0; for (let i = 0; i < 4; ++i) { let sum = sum + i }; sum", 6},
+	{"let f = fn(n) { let sum = 0; for (let i = 0; i < n; ++i) { let sum = sum + i }; sum }; f(5)", 10},
+}
+
+var MoreBuiltinFunctions = []Case{
+	{`typeOf(1)`, "INTEGER"},
+	{`pop([1, 2, 3])`, []int{1, 2}},
+	{`push([1], 2)`, []int{1, 2}},
+	{`reverse([1, 2, 3])`, []int{3, 2, 1}},
+	{`reverse("abc")`, "cba"},
+	{`join(["a", "b"], "-")`, "a-b"},
+	{`join("a", "b", "-")`, "a-b"},
+	{`len(split("a,b,c", ","))`, 3},
+	{`replace("aXaX", "X", "b")`, "abab"},
+	{`toLower("AB")`, "ab"},
+	{`toUpper("ab")`, "AB"},
+	{`trim("xxaxx", "x")`, "a"},
+	{`trimLeft("xxa", "x")`, "a"},
+	{`trimRight("axx", "x")`, "a"},
+	{`contains("team", "ea")`, true},
+	{`contains([1, 2], 2)`, true},
+	{`if (contains("team", "i")) { 1 } else { 2 }`, 2},
+	{`merge([1], [2, 3])`, []int{1, 2, 3}},
+	{`findIndex([1, 2, 3], 3)`, 2},
+	{`reverse(1)`, RuntimeError("argument to `reverse` not supported, got INTEGER")},
+}
+
+var Assertions = []Case{
+	{`assert(1 < 2)`, Null},
+	{`assert(true, "ignored")`, Null},
+	{`assert(false)`, RuntimeError("assert failed: got false")},
+	{`assert(if (false) { 1 })`, RuntimeError("assert failed: got null")},
+	{`assert(1 > 2, "order")`, RuntimeError("assert failed: order: got false")},
+	{`assert(true, 1)`, RuntimeError("argument to `assert` must be STRING, got INTEGER")},
+	{`assertEqual([1, {"a": [2]}], [1, {"a": [2]}])`, Null},
+	{`assertEqual(1, "1")`, RuntimeError(`assertEqual failed: got 1, want "1"`)},
+	{`assertEqual([1, 2], [1, 3], "lists")`, RuntimeError("assertEqual failed: lists: got [1, 2], want [1, 3]")},
+	{`assertEqual({"a": 1}, {"a": 1, "b": 2})`, RuntimeError(`assertEqual failed: got {"a": 1}, want {"a": 1, "b": 2}`)},
+	{`let f = fn() { assertEqual(1, 1); 2 }; f()`, 2},
+}
+
+// AssertErrors need an engine that lets builtins call functions.
+var AssertErrors = []Case{
+	{"assertError(fn() { len(1) })", "argument to `len` not supported, got INTEGER"},
+	{`assertError(fn() { len(1) }, "len")`, "argument to `len` not supported, got INTEGER"},
+	{`assertError(fn() { 1 })`, RuntimeError("assertError failed: got 1, want an error")},
+	{`assertError(fn() { len(1) }, "push")`, RuntimeError("assertError failed: got error \"argument to `len` not supported, got INTEGER\", want one containing \"push\"")},
+	{`assertError(1)`, RuntimeError("argument to `assertError` must be a function, got INTEGER")},
+	{`let f = fn() { assertEqual(1, 2) }; assertError(f)`, "assertEqual failed: got 1, want 2"},
+	// the error is two calls deep, the engine carries on where it was
+	{`let f = fn(x) { let a = [x, x]; len(a, a) }; let g = fn() { f(1) }; let m = assertError(g); m + " " + toUpper("ok")`, "wrong number of arguments. got=2, want=1 OK"},
+}
+
+// Suites lists every table above so a new engine can run all of them at once.
+var Suites = []struct {
+	Name  string
+	Cases []Case
+}{
+	{"IntegerArithmetic", IntegerArithmetic},
+	{"BooleanExpressions", BooleanExpressions},
+	{"Conditionals", Conditionals},
+	{"GlobalLetStatements", GlobalLetStatements},
+	{"StringExpressions", StringExpressions},
+	{"ArrayLiterals", ArrayLiterals},
+	{"HashLiterals", HashLiterals},
+	{"IndexExpressions", IndexExpressions},
+	{"CallingFunctionsWithoutArguments", CallingFunctionsWithoutArguments},
+	{"FunctionsWithReturnStatement", FunctionsWithReturnStatement},
+	{"FunctionsWithoutReturnValue", FunctionsWithoutReturnValue},
+	{"FirstClassFunctions", FirstClassFunctions},
+	{"CallingFunctionsWithBindings", CallingFunctionsWithBindings},
+	{"CallingFunctionsWithArgumentsAndBindings", CallingFunctionsWithArgumentsAndBindings},
+	{"CallingFunctionsWithWrongArguments", CallingFunctionsWithWrongArguments},
+	{"BuiltinFunctions", BuiltinFunctions},
+	{"Closures", Closures},
+	{"RecursiveFunctions", RecursiveFunctions},
+	{"RecursiveFibonacci", RecursiveFibonacci},
+	{"ForLoops", ForLoops},
+	{"MoreBuiltinFunctions", MoreBuiltinFunctions},
+	{"Assertions", Assertions},
+}
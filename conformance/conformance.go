@@ -0,0 +1,176 @@
+// Package conformance holds the language tests that every execution engine
+// has to pass, so the stack vm and the other backends can share one table.
+package conformance
+
+import (
+	"fmt"
+	"mokey-type/ast"
+	"mokey-type/lexer"
+	"mokey-type/object"
+	"mokey-type/parser"
+	"testing"
+)
+
+type Case struct {
+	Input    string
+	Expected interface{}
+}
+
+// RuntimeError is the expected value of a case that must make the engine
+// stop with an error instead of producing a value. Engines that report
+// runtime errors as values pass when the result is an *object.Error with
+// the same message.
+type RuntimeError string
+
+// Runner compiles and executes a program on one engine and returns the value
+// of the last expression statement.
+type Runner func(program *ast.Program) (object.Object, error)
+
+var Null = &object.NullValue{}
+
+func Parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func Run(t *testing.T, run Runner, cases []Case) {
+	t.Helper()
+	for _, tt := range cases {
+		program := Parse(tt.Input)
+		result, err := run(program)
+
+		if expected, ok := tt.Expected.(RuntimeError); ok {
+			if errObj, ok := result.(*object.Error); ok && err == nil {
+				err = fmt.Errorf("%s", errObj.Message)
+			}
+			if err == nil {
+				t.Fatalf("expected runtime error but resulted in none. input=%s", tt.Input)
+			}
+			if err.Error() != string(expected) {
+				t.Fatalf("wrong runtime error: input=%s want=%q, got=%q", tt.Input, expected, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("runtime error: input=%s %s", tt.Input, err)
+		}
+		CheckExpectedObject(t, tt.Expected, result, tt.Input)
+	}
+}
+
+func CheckIntegerObject(expected int64, actual object.Object) error {
+	result, ok := actual.(*object.Integer)
+	if !ok {
+		return fmt.Errorf("object is not Integer. got=%T (%+v)", actual, actual)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+	}
+	return nil
+}
+
+func CheckStringObject(expected string, actual object.Object) error {
+	result, ok := actual.(*object.String)
+	if !ok {
+		return fmt.Errorf("object is not String. got=%T (%+v)", actual, actual)
+	}
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+	}
+	return nil
+}
+
+func CheckBooleanObject(expected bool, actual object.Object) error {
+	result, ok := actual.(*object.Boolean)
+	if !ok {
+		return fmt.Errorf("object is not boolean got=%T (%+v)", actual, actual)
+	}
+
+	if result.Value != expected {
+		return fmt.Errorf("object has wrong value got=%t want=%t", result.Value, expected)
+	}
+	return nil
+}
+
+func CheckExpectedObject(t *testing.T, expected interface{}, actual object.Object, input string) {
+	t.Helper()
+	switch expected := expected.(type) {
+	case int:
+		err := CheckIntegerObject(int64(expected), actual)
+		if err != nil {
+			t.Fatalf("checkIntegerObject failed: input=%s %s", input, err)
+		}
+
+	case bool:
+		err := CheckBooleanObject(bool(expected), actual)
+		if err != nil {
+			t.Errorf("checkBooleanObject failed: input=%s %s", input, err)
+		}
+
+	case *object.NullValue:
+		if actual == nil || actual.Type() != object.NULL_OBJ {
+			t.Errorf("object is not Null: input=%s %T (%+v)", input, actual, actual)
+		}
+
+	case string:
+		err := CheckStringObject(string(expected), actual)
+		if err != nil {
+			t.Errorf("checkStringObject failed: input=%s %s", input, err)
+		}
+
+	case []int:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object not Array: input=%s %T (%+v)", input, actual, actual)
+			return
+		}
+		if len(array.Elements) != len(expected) {
+			t.Errorf("wrong num of elements.input=%s want=%d, got=%d",
+				input, len(expected), len(array.Elements))
+			return
+		}
+		for i, expectedElem := range expected {
+			err := CheckIntegerObject(int64(expectedElem), array.Elements[i])
+			if err != nil {
+				t.Errorf("checkIntegerObject failed: input=%s %s", input, err)
+			}
+		}
+
+	case map[object.HashKey]int64:
+		hash, ok := actual.(*object.Hash)
+		if !ok {
+			t.Errorf("object is not Hash. input=%s got=%T (%+v)", input, actual, actual)
+			return
+		}
+		if len(hash.Pairs) != len(expected) {
+			t.Errorf("hash has wrong number of Pairs. input=%s want=%d, got=%d",
+				input, len(expected), len(hash.Pairs))
+			return
+		}
+		for expectedKey, expectedValue := range expected {
+			pair, ok := hash.Pairs[expectedKey]
+			if !ok {
+				t.Errorf("no pair for given key in Pairs, input=%s", input)
+			}
+			err := CheckIntegerObject(expectedValue, pair.Value)
+			if err != nil {
+				t.Errorf("checkIntegerObject failed: input=%s %s", input, err)
+			}
+		}
+
+	case *object.Error:
+		errObj, ok := actual.(*object.Error)
+		if !ok {
+			t.Errorf("object is not Error: input=%s %T (%+v)", input, actual, actual)
+			return
+		}
+		if errObj.Message != expected.Message {
+			t.Errorf("wrong error message. input=%s expected=%q, got=%q", input, expected.Message, errObj.Message)
+		}
+
+	default:
+		t.Fatalf("unsupported expected value %T in input=%s", expected, input)
+	}
+}
@@ -0,0 +1,226 @@
+package conformance
+
+import "mokey-type/object"
+
+var EvalIntegerExpression = []Case{
+	{"5", 5},
+	{"10", 10},
+	{"-5", -5},
+	{"-10", -10},
+	{"5 + 5 + 5 + 5 - 10", 10},
+	{"2 * 2 * 2 * 2 * 2", 32},
+	{"-50 + 100 + -50", 0},
+	{"5 * 2 + 10", 20},
+	{"5 + 2 * 10", 25},
+	{"20 + 2 * -10", 0},
+	{"50 / 2 * 2 + 10", 60},
+	{"2 * (5 + 10)", 30},
+	{"3 * 3 * 3 + 10", 37},
+	{"3 * (3 * 3) + 10", 37},
+	{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+}
+
+var EvalBooleanExpression = []Case{
+	{"true", true},
+	{"false", false},
+	{"1 < 2", true},
+	{"1 > 2", false},
+	{"1 < 1", false},
+	{"1 > 1", false},
+	{"1 == 1", true},
+	{"1 != 1", false},
+	{"1 == 2", false},
+	{"1 != 2", true},
+	{"true == true", true},
+	{"false == false", true},
+	{"true == false", false},
+	{"true != false", true},
+	{"false != true", true},
+	{"(1 < 2) == true", true},
+	{"(1 < 2) == false", false},
+	{"(1 > 2) == true", false},
+	{"(1 > 2) == false", true},
+}
+
+var BangOperator = []Case{
+	{"!true", false},
+	{"!false", true},
+	{"!5", false},
+	{"!!true", true},
+	{"!!false", false},
+	{"!!5", true},
+}
+
+var IfElseExpressions = []Case{
+	{"if (true) { 10 }", 10},
+	{"if (false) { 10 }", Null},
+	{"if (1) { 10 }", 10},
+	{"if (1 < 2) { 10 }", 10},
+	{"if (1 > 2) { 10 }", Null},
+	{"if (1 > 2) { 10 } else { 20 }", 20},
+	{"if (1 < 2) { 10 } else { 20 }", 10},
+}
+
+var ReturnStatements = []Case{
+	{"return 10;", 10},
+	{"return 10; 9;", 10},
+	{"return 2 * 5; 9;", 10},
+	{"9; return 2 * 5; 9;", 10},
+	{"if (10 > 1) { if (10 > 1) { return 10; } return 1; }", 10},
+}
+
+var ErrorHandling = []Case{
+	{
+		"5 + true;",
+		&object.Error{Message: "type mismatch: INTEGER + BOOLEAN"},
+	},
+	{
+		"5 + true; 5;",
+		&object.Error{Message: "type mismatch: INTEGER + BOOLEAN"},
+	},
+	{
+		"-true",
+		&object.Error{Message: "unknown operator: -BOOLEAN"},
+	},
+	{
+		"true + false;",
+		&object.Error{Message: "unknown operator: BOOLEAN + BOOLEAN"},
+	},
+	{
+		"5; true + false; 5",
+		&object.Error{Message: "unknown operator: BOOLEAN + BOOLEAN"},
+	},
+	{
+		"if (10 > 1) { true + false; }",
+		&object.Error{Message: "unknown operator: BOOLEAN + BOOLEAN"},
+	},
+	{
+		"foobar",
+		&object.Error{Message: "identifier not found: foobar"},
+	},
+	{
+		`"Hello" - "World"`,
+		&object.Error{Message: "unknown operator: STRING - STRING"},
+	},
+	{
+		`{"name": "Monkey"}[fn(x) { x }];`,
+		&object.Error{Message: "unusable as hash key: FUNCTION"},
+	},
+}
+
+var LetStatements = []Case{
+	{"let a = 5; a;", 5},
+	{"let a = 5 * 5; a;", 25},
+	{"let a = 5; let b = a; b;", 5},
+	{"let a = 5; let b = a; let c = a + b + 5; c;", 15},
+}
+
+var FunctionApplication = []Case{
+	{"let identity = fn(x) { x; }; identity(5);", 5},
+	{"let identity = fn(x) { return x; }; identity(5);", 5},
+	{"let double = fn(x) { x * 2; }; double(5);", 10},
+	{"let add = fn(x, y) { x + y; }; add(5, 5);", 10},
+	{"let add = fn(x, y) { x + y; }; add(5 + 5, add(5, 5));", 20},
+	{"fn(x) { x; }(5)", 5},
+}
+
+var EvalClosures = []Case{
+	{
+		`
+	let newAdder = fn(x) {
+		fn(y) { x + y };
+	};
+	let addTwo = newAdder(2);
+	addTwo(2);`,
+		4,
+	},
+}
+
+var StringLiteral = []Case{
+	{`"Hello World!"`, "Hello World!"},
+}
+
+var StringConcatenation = []Case{
+	{`"Hello" + " " + "World!"`, "Hello World!"},
+}
+
+var EvalBuiltinFunctions = []Case{
+	{`len("")`, 0},
+	{`len("four")`, 4},
+	{`len("hello world")`, 11},
+	{`len(1)`, &object.Error{Message: "argument to `len` not supported, got INTEGER"}},
+	{`len("one", "two")`, &object.Error{Message: "wrong number of arguments. got=2, want=1"}},
+}
+
+var EvalArrayLiterals = []Case{
+	{"[1, 2 * 2, 3 + 3]", []int{1, 4, 6}},
+}
+
+var ArrayIndexExpressions = []Case{
+	{"[1, 2, 3][0]", 1},
+	{"[1, 2, 3][1]", 2},
+	{"[1, 2, 3][2]", 3},
+	{"let i = 0; [1][i];", 1},
+	{"[1, 2, 3][1 + 1];", 3},
+	{"let myArray = [1, 2, 3]; myArray[2];", 3},
+	{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+	{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+	{"[1, 2, 3][3]", Null},
+	{"[1, 2, 3][-1]", Null},
+}
+
+var EvalHashLiterals = []Case{
+	{
+		`let two = "two";
+	{
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	}`,
+		map[object.HashKey]int64{
+			(&object.String{Value: "one"}).HashKey():   1,
+			(&object.String{Value: "two"}).HashKey():   2,
+			(&object.String{Value: "three"}).HashKey(): 3,
+			(&object.Integer{Value: 4}).HashKey():      4,
+			(&object.Boolean{Value: true}).HashKey():   5,
+			(&object.Boolean{Value: false}).HashKey():  6,
+		},
+	},
+}
+
+var HashIndexExpressions = []Case{
+	{`{"foo": 5}["foo"]`, 5},
+	{`{"foo": 5}["bar"]`, Null},
+	{`let key = "foo"; {"foo": 5}[key]`, 5},
+	{`{}["foo"]`, Null},
+	{`{5: 5}[5]`, 5},
+	{`{true: 5}[true]`, 5},
+	{`{false: 5}[false]`, 5},
+}
+
+// EvaluatorSuites lists the tables of the tree-walking evaluator, which
+// reports runtime errors as *object.Error values.
+var EvaluatorSuites = []struct {
+	Name  string
+	Cases []Case
+}{
+	{"EvalIntegerExpression", EvalIntegerExpression},
+	{"EvalBooleanExpression", EvalBooleanExpression},
+	{"BangOperator", BangOperator},
+	{"IfElseExpressions", IfElseExpressions},
+	{"ReturnStatements", ReturnStatements},
+	{"ErrorHandling", ErrorHandling},
+	{"LetStatements", LetStatements},
+	{"FunctionApplication", FunctionApplication},
+	{"EvalClosures", EvalClosures},
+	{"StringLiteral", StringLiteral},
+	{"StringConcatenation", StringConcatenation},
+	{"EvalBuiltinFunctions", EvalBuiltinFunctions},
+	{"EvalArrayLiterals", EvalArrayLiterals},
+	{"ArrayIndexExpressions", ArrayIndexExpressions},
+	{"EvalHashLiterals", EvalHashLiterals},
+	{"HashIndexExpressions", HashIndexExpressions},
+}
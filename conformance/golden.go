@@ -0,0 +1,132 @@
+package conformance
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mokey-type/ast"
+	"mokey-type/lexer"
+	"mokey-type/object"
+	"mokey-type/parser"
+	"os"
+	"strings"
+)
+
+// Golden is a .mk program that states what it does in the comments at the
+// top of the file, one line for each thing it prints, its result or its
+// error:
+//
+//	// stdout: 1
+//	// stdout: 2
+//	// result: [1, 2]
+//
+// The other comments at the top describe the program and are kept when the
+// expectations are rewritten.
+type Golden struct {
+	Path        string
+	Description []string
+	Expected    Outcome
+	// Source is the file after the comments at the top
+	Source string
+}
+
+// Outcome is what a program did: the lines it printed, the value of its
+// last expression, strings quoted, and the error that stopped it. Result
+// is empty when the program ends in a let or fails.
+type Outcome struct {
+	Stdout []string
+	Result string
+	Error  string
+}
+
+func (o Outcome) header() []string {
+	lines := []string{}
+	for _, line := range o.Stdout {
+		lines = append(lines, strings.TrimRight("// stdout: "+line, " "))
+	}
+	if o.Result != "" {
+		lines = append(lines, "// result: "+o.Result)
+	}
+	if o.Error != "" {
+		lines = append(lines, "// error: "+o.Error)
+	}
+	return lines
+}
+
+func (o Outcome) String() string {
+	return strings.Join(o.header(), "\n")
+}
+
+func ReadGolden(path string) (*Golden, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	golden := &Golden{Path: path}
+	lines := strings.SplitAfter(string(data), "\n")
+	i := 0
+	for ; i < len(lines) && strings.HasPrefix(lines[i], "//"); i++ {
+		line := strings.TrimRight(lines[i], "\r\n")
+		key, value, _ := strings.Cut(strings.TrimSpace(strings.TrimPrefix(line, "//")), ":")
+		value = strings.TrimPrefix(value, " ")
+		switch key {
+		case "stdout":
+			golden.Expected.Stdout = append(golden.Expected.Stdout, value)
+		case "result":
+			golden.Expected.Result = value
+		case "error":
+			golden.Expected.Error = value
+		default:
+			golden.Description = append(golden.Description, line)
+		}
+	}
+	golden.Source = strings.Join(lines[i:], "")
+	return golden, nil
+}
+
+// Write saves the file with the expectations in g.Expected.
+func (g *Golden) Write() error {
+	var out bytes.Buffer
+	for _, line := range append(g.Description, g.Expected.header()...) {
+		out.WriteString(line + "\n")
+	}
+	out.WriteString(g.Source)
+	return os.WriteFile(g.Path, out.Bytes(), 0o644)
+}
+
+// RunGolden runs source on one engine and returns what it did, what puts
+// prints is captured.
+func RunGolden(run Runner, source string) (outcome Outcome) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return Outcome{Error: "parser errors: " + strings.Join(p.Errors(), "; ")}
+	}
+
+	var stdout bytes.Buffer
+	defer func(previous io.Writer) {
+		object.Stdout = previous
+		if r := recover(); r != nil {
+			outcome.Error = fmt.Sprintf("panic: %v", r)
+		}
+		if text := strings.TrimSuffix(stdout.String(), "\n"); text != "" {
+			outcome.Stdout = strings.Split(text, "\n")
+		}
+	}(object.Stdout)
+	object.Stdout = &stdout
+
+	result, err := run(program)
+	if errObj, ok := result.(*object.Error); ok && err == nil {
+		err = fmt.Errorf("%s", errObj.Message)
+	}
+	if err != nil {
+		return Outcome{Error: err.Error()}
+	}
+	if len(program.Statements) == 0 {
+		return Outcome{}
+	}
+	if _, ok := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement); !ok || result == nil {
+		return Outcome{}
+	}
+	return Outcome{Result: object.Quoted(result)}
+}
@@ -0,0 +1,63 @@
+package conformance
+
+import (
+	"flag"
+	"mokey-type/closure"
+	"mokey-type/evaluator"
+	"mokey-type/object"
+	"mokey-type/regvm"
+	"mokey-type/vm"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the expectations of the golden files with what the vm does")
+
+// engines run every golden file. The vm comes first, it is the reference:
+// -update writes what it does and the others only have to fail where it
+// fails with an error of the same object.ErrorCategory.
+var engines = []struct {
+	name string
+	run  Runner
+}{
+	{"vm", vm.RunProgram},
+	{"regvm", regvm.RunProgram},
+	{"closure", closure.RunProgram},
+	{"eval", evaluator.RunProgram},
+}
+
+// TestGolden runs the programs in testdata/conformance on every engine,
+// go test ./conformance -run TestGolden -update rewrites their expectations.
+func TestGolden(t *testing.T) {
+	paths, err := filepath.Glob("../testdata/conformance/*.mk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no golden files in ../testdata/conformance")
+	}
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			golden, err := ReadGolden(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *update {
+				golden.Expected = RunGolden(engines[0].run, golden.Source)
+				if err := golden.Write(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for i, engine := range engines {
+				got := RunGolden(engine.run, golden.Source)
+				if i > 0 && object.ErrorCategory(got.Error) == object.ErrorCategory(golden.Expected.Error) {
+					got.Error = golden.Expected.Error
+				}
+				if !reflect.DeepEqual(got, golden.Expected) {
+					t.Errorf("%s:\nwant:\n%s\ngot:\n%s", engine.name, golden.Expected, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package conformance
+
+import (
+	"mokey-type/ast"
+	"mokey-type/object"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ModuleRunner runs a program that is in the file file, so it can import
+// the modules next to it.
+type ModuleRunner func(file string, program *ast.Program) (object.Object, error)
+
+// ModuleFiles are the modules the Modules cases import, relative to the
+// directory of the program.
+var ModuleFiles = map[string]string{
+	"math.mk": `
+let add = fn(a, b) { a + b };
+let _square = fn(x) { x * x };
+let square = fn(x) { _square(x) };
+let pi = 3;
+`,
+	"lib/strings.mk": `
+let _math = import "../math";
+let double = fn(x) { _math["add"](x, x) };
+`,
+	"sizes.mk": `
+let size = fn(x) { len(x) };
+`,
+	"rebind.mk": `
+let x = 1;
+let x = 2;
+`,
+	"closure.mk": `
+let offset = 10;
+let adder = fn(x) { fn(y) { x + y + offset } };
+`,
+}
+
+var Modules = []Case{
+	{Input: `let m = import "math"; m["add"](2, 3)`, Expected: 5},
+	{Input: `import "math.mk"["pi"]`, Expected: 3},
+	{Input: `import "math"["square"](4)`, Expected: 16},
+	{Input: `import "math"["_square"]`, Expected: Null},
+	{Input: `let a = import "math"; let b = import "./math"; a["add"](b["pi"], 1)`, Expected: 4},
+	{Input: `import "lib/strings"["double"](21)`, Expected: 42},
+	{Input: `import "sizes"["size"]("abc")`, Expected: 3},
+	{Input: `import "rebind"["x"]`, Expected: 2},
+	{Input: `let add = import "closure"["adder"](1); add(2)`, Expected: 13},
+	{Input: `let f = fn() { import "math"["pi"] }; f() + f()`, Expected: 6},
+	{Input: `import "nope"`, Expected: RuntimeError(`module "nope" not found`)},
+	{Input: `import "./sizes/x"`, Expected: RuntimeError(`module "./sizes/x" not found`)},
+}
+
+// RunModules writes ModuleFiles to a temporary directory and runs the
+// cases as the program main.mk next to them.
+func RunModules(t *testing.T, run ModuleRunner, cases []Case) {
+	t.Helper()
+	dir := WriteModules(t, ModuleFiles)
+	file := filepath.Join(dir, "main.mk")
+	Run(t, func(program *ast.Program) (object.Object, error) {
+		return run(file, program)
+	}, cases)
+}
+
+// WriteModules writes files to a temporary directory and returns it.
+func WriteModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, source := range files {
+		path := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(source), 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
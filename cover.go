@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"mokey-type/coverage"
+	"os"
+)
+
+const coverUsage = "mokey-type cover [-html out.html] profile"
+
+const coverDoc = `Shows a coverage profile written by mokey-type run -coverprofile or
+mokey-type test -coverprofile. It prints the source of every file in it
+with how often its statements ran in the margin and how often each arm of
+every if was taken after it. Lines with a statement that never ran and arms
+that were never taken are marked with !. The percentage of statements and
+branches that ran comes last.`
+
+// cover shows a profile written by run or test -coverprofile, next to the
+// source of each file in the terminal or as an html page.
+func cover(args []string) error {
+	flags := flag.NewFlagSet("cover", flag.ExitOnError)
+	output := flags.String("html", "", "write an html page to this file instead of printing the annotated source")
+	usage(flags, coverUsage, coverDoc)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: %s", coverUsage)
+	}
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	profile, err := coverage.Read(file)
+	if err != nil {
+		return fmt.Errorf("%s: %s", flags.Arg(0), err)
+	}
+
+	sources := map[string]string{}
+	for _, path := range profile.Files() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sources[path] = string(source)
+	}
+
+	if *output != "" {
+		var buf bytes.Buffer
+		if err := profile.HTML(&buf, sources); err != nil {
+			return err
+		}
+		return os.WriteFile(*output, buf.Bytes(), 0644)
+	}
+	for i, path := range profile.Files() {
+		if i > 0 {
+			fmt.Println()
+		}
+		profile.Annotate(os.Stdout, path, sources[path])
+	}
+	fmt.Println(profile.Summary(""))
+	return nil
+}
+
+func writeProfile(path string, profile *coverage.Profile) error {
+	var buf bytes.Buffer
+	if err := profile.Write(&buf); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
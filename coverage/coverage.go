@@ -0,0 +1,212 @@
+// Package coverage collects how often the coverage counters of compiled
+// programs ran, reads and writes them as profiles and shows them next to
+// the source.
+package coverage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mokey-type/compiler"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Block is one counter of a file and how often it ran.
+type Block struct {
+	Path   string
+	Kind   string
+	Line   int
+	Column int
+	Count  int
+}
+
+func (b Block) branch() bool { return b.Kind != "statement" }
+
+type key struct {
+	path         string
+	kind         string
+	line, column int
+}
+
+// Profile is the blocks of every file that ran, the counts of the runs of
+// a file add up.
+type Profile struct {
+	Blocks []Block
+	index  map[key]int
+}
+
+func (p *Profile) block(b Block) *Block {
+	if p.index == nil {
+		p.index = map[key]int{}
+		for i, b := range p.Blocks {
+			p.index[key{b.Path, b.Kind, b.Line, b.Column}] = i
+		}
+	}
+	k := key{b.Path, b.Kind, b.Line, b.Column}
+	if i, ok := p.index[k]; ok {
+		return &p.Blocks[i]
+	}
+	p.index[k] = len(p.Blocks)
+	p.Blocks = append(p.Blocks, b)
+	return &p.Blocks[len(p.Blocks)-1]
+}
+
+// Add counts one run of path, counters come from the compiler and hits
+// from the vm that ran the bytecode.
+func (p *Profile) Add(path string, counters []compiler.Counter, hits []int) {
+	for i, c := range counters {
+		b := p.block(Block{Path: path, Kind: c.Kind, Line: c.Line, Column: c.Column})
+		if i < len(hits) {
+			b.Count += hits[i]
+		}
+	}
+}
+
+// Files returns the paths in the profile, sorted.
+func (p *Profile) Files() []string {
+	seen := map[string]bool{}
+	files := []string{}
+	for _, b := range p.Blocks {
+		if !seen[b.Path] {
+			seen[b.Path] = true
+			files = append(files, b.Path)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// file returns the blocks of path sorted by position.
+func (p *Profile) file(path string) []Block {
+	blocks := []Block{}
+	for _, b := range p.Blocks {
+		if b.Path == path {
+			blocks = append(blocks, b)
+		}
+	}
+	sort.SliceStable(blocks, func(i, j int) bool {
+		if blocks[i].Line != blocks[j].Line {
+			return blocks[i].Line < blocks[j].Line
+		}
+		return blocks[i].Column < blocks[j].Column
+	})
+	return blocks
+}
+
+// Summary is how many statements and arms of ifs ran at least once.
+type Summary struct {
+	Statements, CoveredStatements int
+	Branches, CoveredBranches     int
+}
+
+func percent(covered, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(covered) / float64(total)
+}
+
+func (s Summary) String() string {
+	out := fmt.Sprintf("coverage: %.1f%% of statements", percent(s.CoveredStatements, s.Statements))
+	if s.Branches > 0 {
+		out += fmt.Sprintf(", %.1f%% of branches", percent(s.CoveredBranches, s.Branches))
+	}
+	return out
+}
+
+// Summary adds up the blocks of path, or of every file when path is empty.
+func (p *Profile) Summary(path string) Summary {
+	var s Summary
+	for _, b := range p.Blocks {
+		if path != "" && b.Path != path {
+			continue
+		}
+		covered := 0
+		if b.Count > 0 {
+			covered = 1
+		}
+		if b.branch() {
+			s.Branches++
+			s.CoveredBranches += covered
+		} else {
+			s.Statements++
+			s.CoveredStatements += covered
+		}
+	}
+	return s
+}
+
+// Write saves the profile in its text format, a mode line and then a line
+// for each block:
+//
+//	mode: count
+//	path:line.column kind count
+func (p *Profile) Write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "mode: count")
+	for _, path := range p.Files() {
+		for _, b := range p.file(path) {
+			fmt.Fprintf(bw, "%s:%d.%d %s %d\n", b.Path, b.Line, b.Column, b.Kind, b.Count)
+		}
+	}
+	return bw.Flush()
+}
+
+// Read parses a profile written by Write.
+func Read(r io.Reader) (*Profile, error) {
+	p := &Profile{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if n == 1 {
+			if line != "mode: count" {
+				return nil, fmt.Errorf("line 1: not a coverage profile")
+			}
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		b, err := parseBlock(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		p.block(Block{Path: b.Path, Kind: b.Kind, Line: b.Line, Column: b.Column}).Count += b.Count
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func parseBlock(line string) (Block, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return Block{}, fmt.Errorf("want path:line.column kind count, got %q", line)
+	}
+	// the path may have spaces, the last two fields can't
+	n := len(fields)
+	kind, count := fields[n-2], fields[n-1]
+	at := strings.TrimSuffix(line, " "+kind+" "+count)
+	i := strings.LastIndex(at, ":")
+	if i < 0 {
+		return Block{}, fmt.Errorf("missing position in %q", line)
+	}
+	l, c, ok := strings.Cut(at[i+1:], ".")
+	b := Block{Path: at[:i], Kind: kind}
+	var err1, err2, err3 error
+	b.Line, err1 = strconv.Atoi(l)
+	b.Column, err2 = strconv.Atoi(c)
+	b.Count, err3 = strconv.Atoi(count)
+	if !ok || err1 != nil || err2 != nil || err3 != nil {
+		return Block{}, fmt.Errorf("bad position or count in %q", line)
+	}
+	switch kind {
+	case "statement", "then", "else":
+	default:
+		return Block{}, fmt.Errorf("unknown kind %q", kind)
+	}
+	return b, nil
+}
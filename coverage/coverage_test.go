@@ -0,0 +1,157 @@
+package coverage
+
+import (
+	"bytes"
+	"mokey-type/compiler"
+	"mokey-type/conformance"
+	"mokey-type/vm"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const source = `let sign = fn(n) {
+  if (n < 0) {
+    "negative"
+  } else {
+    "positive"
+  }
+};
+let check = fn(n) { if (n > 9) { puts("big") } };
+sign(1);
+sign(2);
+check(1);
+`
+
+func run(t *testing.T, p *Profile, path, source string) {
+	t.Helper()
+	comp := compiler.New()
+	comp.EnableCoverage()
+	if err := comp.Compile(conformance.Parse(source)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+	machine := vm.New(bytecode)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	p.Add(path, bytecode.Counters, machine.Hits())
+}
+
+func TestProfile(t *testing.T) {
+	p := &Profile{}
+	run(t, p, "sign.mk", source)
+	run(t, p, "sign.mk", source)
+
+	expected := []Block{
+		{"sign.mk", "statement", 1, 1, 2},
+		{"sign.mk", "statement", 2, 3, 4},
+		{"sign.mk", "then", 2, 14, 0},
+		{"sign.mk", "statement", 3, 5, 0},
+		{"sign.mk", "else", 4, 10, 4},
+		{"sign.mk", "statement", 5, 5, 4},
+		{"sign.mk", "statement", 8, 1, 2},
+		{"sign.mk", "statement", 8, 21, 2},
+		{"sign.mk", "else", 8, 21, 2},
+		{"sign.mk", "then", 8, 32, 0},
+		{"sign.mk", "statement", 8, 34, 0},
+		{"sign.mk", "statement", 9, 1, 2},
+		{"sign.mk", "statement", 10, 1, 2},
+		{"sign.mk", "statement", 11, 1, 2},
+	}
+	if got := p.file("sign.mk"); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("wrong blocks.\nwant=%v\n got=%v", expected, got)
+	}
+
+	summary := p.Summary("")
+	if summary != (Summary{Statements: 10, CoveredStatements: 8, Branches: 4, CoveredBranches: 2}) {
+		t.Errorf("wrong summary %+v", summary)
+	}
+	if got := summary.String(); got != "coverage: 80.0% of statements, 50.0% of branches" {
+		t.Errorf("wrong summary text %q", got)
+	}
+
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("reading the profile back: %s", err)
+	}
+	if !reflect.DeepEqual(read.file("sign.mk"), expected) {
+		t.Errorf("the profile reads back differently.\nwant=%v\n got=%v", expected, read.file("sign.mk"))
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", ""},
+		{"mode: set\n", "line 1: not a coverage profile"},
+		{"mode: count\nf.mk:1.1 statement\n", "line 2: want path:line.column kind count"},
+		{"mode: count\nf.mk:1 statement 1\n", "line 2: bad position or count"},
+		{"mode: count\nf.mk:1.1 loop 1\n", `line 2: unknown kind "loop"`},
+	}
+	for _, tt := range tests {
+		_, err := Read(strings.NewReader(tt.input))
+		if tt.expected == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error %s", tt.input, err)
+			}
+			continue
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), tt.expected) {
+			t.Errorf("%q: wrong error. want=%q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+
+	p, err := Read(strings.NewReader("mode: count\nmy dir/f.mk:3.2 then 7\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Block{{"my dir/f.mk", "then", 3, 2, 7}}; !reflect.DeepEqual(p.Blocks, want) {
+		t.Errorf("paths with spaces. want=%v, got=%v", want, p.Blocks)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	p := &Profile{}
+	run(t, p, "sign.mk", source)
+
+	var buf bytes.Buffer
+	p.Annotate(&buf, "sign.mk", source)
+	lines := strings.Split(buf.String(), "\n")
+	expected := map[int]string{
+		0: "== sign.mk: coverage: 80.0% of statements, 50.0% of branches ==",
+		2: "    2      2  |   if (n < 0) {    [then 0 !]",
+		3: "    3      0 !|     \"negative\"",
+		4: "    4      2  |   } else {    [else 2]",
+		5: "    5      2  |     \"positive\"",
+		6: "    6         |   }",
+		8: "    8      0 !| let check = fn(n) { if (n > 9) { puts(\"big\") } };    [then 0 !, else 1]",
+	}
+	for i, want := range expected {
+		if i >= len(lines) || lines[i] != want {
+			t.Errorf("line %d: want=%q\n%s", i, want, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := p.HTML(&buf, map[string]string{"sign.mk": source}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<option value="0">sign.mk (coverage: 80.0% of statements, 50.0% of branches)</option>`,
+		`<span class="line missed" title="0 hits"><span class="number">3</span><span class="count">0</span>    &#34;negative&#34;</span>`,
+		`<span class="line covered" title="2 hits"><span class="number">2</span>`,
+		`<span class="line covered" title="2 hits"><span class="number">5</span>`,
+		`<span class="arms">then 0 !, else 1</span>`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("html is missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package coverage
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// line is a line of source and the blocks that start on it.
+type line struct {
+	Number int
+	Text   string
+	// Counted is set when a block starts on the line, Count is then the
+	// smallest count among its statements, so a line is only covered when
+	// all of them ran. The arms of its ifs are counted apart, a line with
+	// no statement, like } else {, shows the count of its arms instead.
+	Counted  bool
+	Count    int
+	Branches []Block
+}
+
+func (l line) Covered() bool { return l.Counted && l.Count > 0 }
+
+// Arms lists the counts of the arms of the ifs on the line, then before
+// else: the else of an if without one is at the if, before its then. Arms
+// that were never taken are marked with !.
+func (l line) Arms() string {
+	arms := []string{}
+	for _, kind := range []string{"then", "else"} {
+		for _, b := range l.Branches {
+			if b.Kind != kind {
+				continue
+			}
+			arm := fmt.Sprintf("%s %d", b.Kind, b.Count)
+			if b.Count == 0 {
+				arm += " !"
+			}
+			arms = append(arms, arm)
+		}
+	}
+	return strings.Join(arms, ", ")
+}
+
+func (p *Profile) lines(path, source string) []line {
+	lines := []line{}
+	for i, text := range strings.Split(strings.TrimSuffix(source, "\n"), "\n") {
+		lines = append(lines, line{Number: i + 1, Text: text})
+	}
+	for _, b := range p.file(path) {
+		if b.Line < 1 || b.Line > len(lines) {
+			continue
+		}
+		l := &lines[b.Line-1]
+		if b.branch() {
+			l.Branches = append(l.Branches, b)
+			continue
+		}
+		if !l.Counted || b.Count < l.Count {
+			l.Count = b.Count
+		}
+		l.Counted = true
+	}
+	for i := range lines {
+		l := &lines[i]
+		if l.Counted {
+			continue
+		}
+		for _, b := range l.Branches {
+			if !l.Counted || b.Count < l.Count {
+				l.Count = b.Count
+			}
+			l.Counted = true
+		}
+	}
+	return lines
+}
+
+// Annotate prints source with how often the statements of each line ran in
+// the margin, blank for lines where nothing starts, and the count of each
+// arm of the ifs at the end of their line.
+func (p *Profile) Annotate(w io.Writer, path, source string) {
+	fmt.Fprintf(w, "== %s: %s ==\n", path, p.Summary(path))
+	for _, l := range p.lines(path, source) {
+		count := ""
+		if l.Counted {
+			count = fmt.Sprint(l.Count)
+		}
+		mark := " "
+		if l.Counted && l.Count == 0 {
+			mark = "!"
+		}
+		fmt.Fprintf(w, "%5d %6s %s| %s", l.Number, count, mark, l.Text)
+		if len(l.Branches) > 0 {
+			fmt.Fprintf(w, "    [%s]", l.Arms())
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+type htmlFile struct {
+	Path    string
+	Summary Summary
+	Lines   []line
+}
+
+var page = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>coverage</title>
+<style>
+body { background: #fff; color: #222; font-family: sans-serif; }
+select { margin: 8px 0; }
+pre { font-family: monospace; margin: 0; }
+.line { display: block; }
+.number, .count { display: inline-block; text-align: right; color: #999; user-select: none; }
+.number { width: 4em; }
+.count { width: 6em; margin-right: 1em; }
+.covered { background: #d7f5d7; }
+.missed { background: #f8d0d0; }
+.arms { color: #666; margin-left: 2em; }
+.file { display: none; }
+</style>
+</head>
+<body>
+<select id="files" onchange="show(this.value)">
+{{range $i, $f := .}}<option value="{{$i}}">{{$f.Path}} ({{$f.Summary}})</option>
+{{end}}</select>
+{{range $i, $f := .}}<pre class="file" id="file{{$i}}">
+{{range $f.Lines}}<span class="line{{if .Counted}}{{if .Covered}} covered{{else}} missed{{end}}{{end}}" title="{{if .Counted}}{{.Count}} hits{{end}}"><span class="number">{{.Number}}</span><span class="count">{{if .Counted}}{{.Count}}{{end}}</span>{{.Text}}{{if .Branches}}<span class="arms">{{.Arms}}</span>{{end}}</span>
+{{end}}</pre>
+{{end}}<script>
+function show(i) {
+	for (const pre of document.querySelectorAll(".file")) {
+		pre.style.display = pre.id === "file" + i ? "block" : "none";
+	}
+}
+show(0);
+</script>
+</body>
+</html>
+`))
+
+// HTML writes a page that shows every file of the profile like Annotate
+// does, covered lines in green and lines that never ran in red. sources has
+// the source of each file.
+func (p *Profile) HTML(w io.Writer, sources map[string]string) error {
+	files := []htmlFile{}
+	for _, path := range p.Files() {
+		files = append(files, htmlFile{
+			Path:    path,
+			Summary: p.Summary(path),
+			Lines:   p.lines(path, sources[path]),
+		})
+	}
+	return page.Execute(w, files)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mokey-type/dap"
+	"os"
+)
+
+const dapUsage = "mokey-type dap"
+
+const dapDoc = `Starts a debug adapter that speaks the debug adapter protocol on stdin
+and stdout, editors start it themselves. A launch request with the path of
+a .mk file in program runs it, stopOnEntry stops it before the first
+statement. Editors can set breakpoints, continue, step in, over and out,
+look at the stack, scopes and variables and evaluate expressions in a frame
+while it is stopped.`
+
+// debugAdapter runs the debug adapter over stdin and stdout.
+func debugAdapter(args []string) error {
+	flags := flag.NewFlagSet("dap", flag.ExitOnError)
+	usage(flags, dapUsage, dapDoc)
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		return fmt.Errorf("usage: %s", dapUsage)
+	}
+	return dap.NewServer(os.Stdin, os.Stdout).Serve()
+}
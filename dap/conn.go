@@ -0,0 +1,130 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Message is a request, a response or an event of the debug adapter
+// protocol, Type tells which.
+type Message struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	Command    string          `json:"command,omitempty"`
+	Arguments  json.RawMessage `json:"arguments,omitempty"`
+	RequestSeq int             `json:"request_seq,omitempty"`
+	// Success is only in responses, they always carry it
+	Success *bool           `json:"success,omitempty"`
+	Message string          `json:"message,omitempty"`
+	Event   string          `json:"event,omitempty"`
+	Body    json.RawMessage `json:"body,omitempty"`
+}
+
+// Succeeded reports whether msg is a response to a request that
+// succeeded.
+func (m *Message) Succeeded() bool {
+	return m.Success != nil && *m.Success
+}
+
+// Conn reads and writes messages framed with a Content-Length header like
+// the language server protocol does, it numbers the messages it writes.
+type Conn struct {
+	r   *bufio.Reader
+	w   io.Writer
+	mu  sync.Mutex
+	seq int
+}
+
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	return &Conn{r: bufio.NewReader(r), w: w}
+}
+
+func (c *Conn) Read() (*Message, error) {
+	length := -1
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message without Content-Length")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return nil, err
+	}
+	msg := &Message{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, fmt.Errorf("invalid message: %s", err)
+	}
+	return msg, nil
+}
+
+// Write sends msg with the next sequence number, body becomes its body
+// unless it is nil.
+func (c *Conn) Write(msg Message, body interface{}) error {
+	_, err := c.send(msg, body)
+	return err
+}
+
+func (c *Conn) send(msg Message, body interface{}) (int, error) {
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		msg.Body = b
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	msg.Seq = c.seq
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return 0, err
+	}
+	_, err = fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(data), data)
+	return msg.Seq, err
+}
+
+// Request sends a request and returns its sequence number, it is what a
+// client needs.
+func (c *Conn) Request(command string, arguments interface{}) (int, error) {
+	args, err := json.Marshal(arguments)
+	if err != nil {
+		return 0, err
+	}
+	return c.send(Message{Type: "request", Command: command, Arguments: args}, nil)
+}
+
+func (c *Conn) respond(request *Message, body interface{}) error {
+	success := true
+	return c.Write(Message{Type: "response", RequestSeq: request.Seq, Command: request.Command, Success: &success}, body)
+}
+
+func (c *Conn) fail(request *Message, message string) error {
+	success := false
+	return c.Write(Message{Type: "response", RequestSeq: request.Seq, Command: request.Command, Success: &success, Message: message}, nil)
+}
+
+func (c *Conn) event(event string, body interface{}) error {
+	return c.Write(Message{Type: "event", Event: event}, body)
+}
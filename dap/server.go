@@ -0,0 +1,455 @@
+// Package dap is a debug adapter for Monkey, editors talk to it with the
+// debug adapter protocol over a pair of streams. It runs one program in the
+// vm under a debug.Debugger, in a goroutine of its own that waits while the
+// program is stopped.
+package dap
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mokey-type/compiler"
+	"mokey-type/debug"
+	"mokey-type/lexer"
+	"mokey-type/module"
+	"mokey-type/object"
+	"mokey-type/parser"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// threadID is the only thread, the vm has no others.
+const threadID = 1
+
+type Server struct {
+	conn *Conn
+
+	path     string
+	debugger *debug.Debugger
+	// done is closed when the program ended
+	done   chan struct{}
+	resume chan struct{}
+
+	// mu guards stopped, the vm may only be looked at while it is set
+	mu      sync.Mutex
+	stopped bool
+	// refs are the variables of the variablesReferences handed out since
+	// the program stopped, a reference is its index plus one
+	refs []func() []Variable
+	// after runs once the response to the request was sent
+	after func()
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{conn: NewConn(in, out), resume: make(chan struct{})}
+}
+
+var errDisconnect = errors.New("disconnect")
+
+// Serve handles requests until the client disconnects or closes the input.
+func (s *Server) Serve() error {
+	defer s.terminate()
+	for {
+		msg, err := s.conn.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.Type != "request" {
+			continue
+		}
+		err = s.handle(msg)
+		if err == errDisconnect {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// argumentError is a request the client got wrong, it fails the request
+// instead of stopping the server.
+type argumentError struct{ message string }
+
+func (e *argumentError) Error() string { return e.message }
+
+func (s *Server) handle(msg *Message) error {
+	body, err := s.dispatch(msg)
+	var argErr *argumentError
+	if errors.As(err, &argErr) {
+		return s.conn.fail(msg, argErr.message)
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.conn.respond(msg, body); err != nil {
+		return err
+	}
+	if s.after != nil {
+		after := s.after
+		s.after = nil
+		after()
+	}
+	switch msg.Command {
+	case "launch":
+		// breakpoints can be set now, configurationDone starts the program
+		return s.conn.event("initialized", nil)
+	case "disconnect", "terminate":
+		return errDisconnect
+	}
+	return nil
+}
+
+// dispatch runs a request and returns the body of its response.
+func (s *Server) dispatch(msg *Message) (interface{}, error) {
+	switch msg.Command {
+	case "initialize":
+		return Capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsEvaluateForHovers:        true,
+			SupportTerminateDebuggee:         true,
+		}, nil
+
+	case "launch":
+		var args LaunchArguments
+		if err := unmarshal(msg, &args); err != nil {
+			return nil, err
+		}
+		return nil, s.launch(args)
+
+	case "setBreakpoints":
+		var args SetBreakpointsArguments
+		if err := unmarshal(msg, &args); err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(args), nil
+
+	case "configurationDone":
+		if s.debugger == nil {
+			return nil, &argumentError{"configurationDone before launch"}
+		}
+		if s.done == nil {
+			s.start()
+		}
+		return nil, nil
+
+	case "threads":
+		return ThreadsResponse{Threads: []Thread{{ID: threadID, Name: "main"}}}, nil
+
+	case "stackTrace":
+		var args StackTraceArguments
+		if err := unmarshal(msg, &args); err != nil {
+			return nil, err
+		}
+		return s.whileStopped(func() (interface{}, error) { return s.stackTrace(args), nil })
+
+	case "scopes":
+		var args ScopesArguments
+		if err := unmarshal(msg, &args); err != nil {
+			return nil, err
+		}
+		return s.whileStopped(func() (interface{}, error) { return s.scopes(args) })
+
+	case "variables":
+		var args VariablesArguments
+		if err := unmarshal(msg, &args); err != nil {
+			return nil, err
+		}
+		return s.whileStopped(func() (interface{}, error) { return s.variables(args) })
+
+	case "evaluate":
+		var args EvaluateArguments
+		if err := unmarshal(msg, &args); err != nil {
+			return nil, err
+		}
+		return s.whileStopped(func() (interface{}, error) { return s.evaluate(args) })
+
+	case "continue":
+		return ContinueResponse{AllThreadsContinued: true}, s.proceed(s.debugger.Continue)
+	case "next":
+		return nil, s.proceed(s.debugger.StepOver)
+	case "stepIn":
+		return nil, s.proceed(s.debugger.StepIn)
+	case "stepOut":
+		return nil, s.proceed(s.debugger.StepOut)
+
+	case "disconnect", "terminate":
+		return nil, nil
+
+	default:
+		return nil, &argumentError{fmt.Sprintf("unsupported request %q", msg.Command)}
+	}
+}
+
+func unmarshal(msg *Message, v interface{}) error {
+	if len(msg.Arguments) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(msg.Arguments, v); err != nil {
+		return &argumentError{fmt.Sprintf("invalid arguments of %s: %s", msg.Command, err)}
+	}
+	return nil
+}
+
+func (s *Server) launch(args LaunchArguments) error {
+	if s.debugger != nil {
+		return &argumentError{"the program was launched already"}
+	}
+	source, err := os.ReadFile(args.Program)
+	if err != nil {
+		return &argumentError{err.Error()}
+	}
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return &argumentError{fmt.Sprintf("%s: parser errors:\n\t%s", args.Program, strings.Join(p.Errors(), "\n\t"))}
+	}
+	comp := compiler.New()
+	comp.EnableImports(args.Program, module.NewLoader(module.SearchPath()))
+	if err := comp.Compile(program); err != nil {
+		return &argumentError{fmt.Sprintf("%s: compiling bytecode failed: %s", args.Program, err)}
+	}
+
+	s.path = args.Program
+	s.debugger = debug.New(comp.Bytecode())
+	s.debugger.StopOnEntry = args.StopOnEntry
+	s.debugger.Stopped = s.stop
+	return nil
+}
+
+func (s *Server) setBreakpoints(args SetBreakpointsArguments) SetBreakpointsResponse {
+	response := SetBreakpointsResponse{Breakpoints: []Breakpoint{}}
+	for _, b := range args.Breakpoints {
+		response.Breakpoints = append(response.Breakpoints, Breakpoint{Line: b.Line, Message: "the program was not launched"})
+	}
+	if s.debugger == nil {
+		return response
+	}
+	if args.Source.Path != s.path {
+		for i := range response.Breakpoints {
+			response.Breakpoints[i].Message = fmt.Sprintf("only %s is debugged", s.path)
+		}
+		return response
+	}
+
+	for _, line := range s.debugger.Breakpoints() {
+		s.debugger.ClearBreakpoint(line)
+	}
+	for i, b := range args.Breakpoints {
+		line, err := s.debugger.SetBreakpoint(b.Line)
+		if err != nil {
+			response.Breakpoints[i].Message = err.Error()
+			continue
+		}
+		response.Breakpoints[i] = Breakpoint{Verified: true, Line: line}
+	}
+	return response
+}
+
+// start runs the program, what it prints is sent as output events.
+func (s *Server) start() {
+	s.done = make(chan struct{})
+	previous := object.Stdout
+	object.Stdout = &output{conn: s.conn}
+	go func() {
+		defer close(s.done)
+		_, err := s.debugger.Run()
+		object.Stdout = previous
+		code := 0
+		if err != nil {
+			code = 1
+			s.conn.event("output", OutputEvent{Category: "stderr", Output: err.Error() + "\n"})
+		}
+		s.conn.event("exited", ExitedEvent{ExitCode: code})
+		s.conn.event("terminated", nil)
+	}()
+}
+
+// stop runs in the program's goroutine, it tells the client and waits for
+// a request that lets the program go on.
+func (s *Server) stop(reason debug.Reason) {
+	s.mu.Lock()
+	s.stopped = true
+	s.refs = nil
+	s.mu.Unlock()
+
+	event := StoppedEvent{Reason: string(reason), ThreadID: threadID, AllThreadsStopped: true}
+	if reason == debug.Exception {
+		event.Text = s.debugger.Err.Error()
+	}
+	s.conn.event("stopped", event)
+	<-s.resume
+}
+
+// proceed makes the stopped program go on after calling step, which says
+// how, once the response was sent so it comes before the next stop.
+func (s *Server) proceed(step func()) error {
+	s.mu.Lock()
+	if !s.stopped {
+		s.mu.Unlock()
+		return &argumentError{"the program is not stopped"}
+	}
+	s.stopped = false
+	step()
+	s.mu.Unlock()
+	s.after = func() { s.resume <- struct{}{} }
+	return nil
+}
+
+// terminate ends the program when the client goes away.
+func (s *Server) terminate() {
+	if s.debugger == nil || s.done == nil {
+		return
+	}
+	s.debugger.Quit()
+	s.mu.Lock()
+	stopped := s.stopped
+	s.stopped = false
+	s.mu.Unlock()
+	if stopped {
+		s.resume <- struct{}{}
+	}
+	<-s.done
+}
+
+// whileStopped runs f, which looks at the vm, if the program is stopped.
+func (s *Server) whileStopped(f func() (interface{}, error)) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.stopped {
+		return nil, &argumentError{"the program is not stopped"}
+	}
+	return f()
+}
+
+func (s *Server) stackTrace(args StackTraceArguments) StackTraceResponse {
+	frames := s.debugger.Frames()
+	response := StackTraceResponse{StackFrames: []StackFrame{}, TotalFrames: len(frames)}
+	for i, f := range frames {
+		path := s.path
+		if f.File != "" {
+			path = f.File
+		}
+		source := Source{Name: filepath.Base(path), Path: path}
+		if i < args.StartFrame || (args.Levels > 0 && i >= args.StartFrame+args.Levels) {
+			continue
+		}
+		response.StackFrames = append(response.StackFrames, StackFrame{
+			ID:     i + 1,
+			Name:   f.Name,
+			Source: source,
+			Line:   f.Line,
+			Column: f.Column,
+		})
+	}
+	return response
+}
+
+func (s *Server) frame(id int) (debug.Frame, error) {
+	frames := s.debugger.Frames()
+	if id < 1 || id > len(frames) {
+		return debug.Frame{}, &argumentError{fmt.Sprintf("no frame %d", id)}
+	}
+	return frames[id-1], nil
+}
+
+func (s *Server) scopes(args ScopesArguments) (interface{}, error) {
+	frame, err := s.frame(args.FrameID)
+	if err != nil {
+		return nil, err
+	}
+	scopes := []Scope{{Name: "Locals", VariablesReference: s.reference(frame.Locals)}}
+	if len(frame.Free) > 0 {
+		scopes = append(scopes, Scope{Name: "Closure", VariablesReference: s.reference(frame.Free)})
+	}
+	scopes = append(scopes, Scope{Name: "Globals", VariablesReference: s.reference(s.debugger.Globals())})
+	return ScopesResponse{Scopes: scopes}, nil
+}
+
+func (s *Server) reference(vars []debug.Variable) int {
+	return s.add(func() []Variable {
+		variables := []Variable{}
+		for _, v := range vars {
+			variables = append(variables, s.variable(v.Name, v.Value))
+		}
+		return variables
+	})
+}
+
+func (s *Server) add(variables func() []Variable) int {
+	s.refs = append(s.refs, variables)
+	return len(s.refs)
+}
+
+// variable shows value, arrays and hashes get a reference to their
+// elements.
+func (s *Server) variable(name string, value object.Object) Variable {
+	if value == nil {
+		return Variable{Name: name, Value: "<not set>"}
+	}
+	v := Variable{Name: name, Value: object.Quoted(value), Type: string(value.Type())}
+	switch value := value.(type) {
+	case *object.Array:
+		if len(value.Elements) > 0 {
+			v.VariablesReference = s.add(func() []Variable {
+				elements := []Variable{}
+				for i, e := range value.Elements {
+					elements = append(elements, s.variable(fmt.Sprintf("[%d]", i), e))
+				}
+				return elements
+			})
+		}
+	case *object.Hash:
+		if len(value.Pairs) > 0 {
+			v.VariablesReference = s.add(func() []Variable {
+				pairs := []Variable{}
+				for _, pair := range value.Pairs {
+					pairs = append(pairs, s.variable(object.Quoted(pair.Key), pair.Value))
+				}
+				sort.Slice(pairs, func(i, j int) bool { return pairs[i].Name < pairs[j].Name })
+				return pairs
+			})
+		}
+	}
+	return v
+}
+
+func (s *Server) variables(args VariablesArguments) (interface{}, error) {
+	ref := args.VariablesReference
+	if ref < 1 || ref > len(s.refs) {
+		return nil, &argumentError{fmt.Sprintf("no variables %d", ref)}
+	}
+	return VariablesResponse{Variables: s.refs[ref-1]()}, nil
+}
+
+func (s *Server) evaluate(args EvaluateArguments) (interface{}, error) {
+	frame := 0
+	if args.FrameID > 0 {
+		frame = args.FrameID - 1
+	}
+	result, err := s.debugger.Evaluate(frame, args.Expression)
+	if err != nil {
+		return nil, &argumentError{err.Error()}
+	}
+	v := s.variable("", result)
+	return EvaluateResponse{Result: v.Value, Type: v.Type, VariablesReference: v.VariablesReference}, nil
+}
+
+// output sends what the program prints as output events.
+type output struct {
+	conn *Conn
+}
+
+func (o *output) Write(p []byte) (int, error) {
+	if err := o.conn.event("output", OutputEvent{Category: "stdout", Output: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
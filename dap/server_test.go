@@ -0,0 +1,355 @@
+package dap
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// client drives a Server over pipes the way an editor would.
+type client struct {
+	t        *testing.T
+	conn     *Conn
+	done     chan error
+	in       io.Closer
+	messages chan *Message
+
+	events []Message
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	c := &client{
+		t:        t,
+		conn:     NewConn(clientIn, clientOut),
+		done:     make(chan error, 1),
+		in:       clientOut,
+		messages: make(chan *Message, 100),
+	}
+	go func() {
+		err := NewServer(serverIn, serverOut).Serve()
+		serverOut.Close()
+		c.done <- err
+	}()
+	// the pipes have no buffer, reading all the time keeps the server from
+	// blocking on an event while the client writes a request
+	go func() {
+		defer close(c.messages)
+		for {
+			msg, err := c.conn.Read()
+			if err != nil {
+				return
+			}
+			c.messages <- msg
+		}
+	}()
+	return c
+}
+
+func (c *client) read() *Message {
+	c.t.Helper()
+	msg, ok := <-c.messages
+	if !ok {
+		c.t.Fatal("the server closed the connection")
+	}
+	// success belongs to responses only
+	if msg.Type == "event" && msg.Success != nil {
+		c.t.Fatalf("event %s with success", msg.Event)
+	}
+	return msg
+}
+
+// request sends a request and returns its response, the events that come
+// before it are kept for event.
+func (c *client) request(command string, arguments interface{}, body interface{}) *Message {
+	c.t.Helper()
+	seq, err := c.conn.Request(command, arguments)
+	if err != nil {
+		c.t.Fatalf("request %s: %s", command, err)
+	}
+	for {
+		msg := c.read()
+		if msg.Type == "event" {
+			c.events = append(c.events, *msg)
+			continue
+		}
+		if msg.RequestSeq != seq || msg.Command != command {
+			c.t.Fatalf("response to %s %d, want %s %d", msg.Command, msg.RequestSeq, command, seq)
+		}
+		if msg.Success == nil {
+			c.t.Fatalf("response to %s without success", command)
+		}
+		if msg.Succeeded() && body != nil {
+			if err := json.Unmarshal(msg.Body, body); err != nil {
+				c.t.Fatalf("bad body for %s: %s", command, err)
+			}
+		}
+		return msg
+	}
+}
+
+// event returns the next event called name, and drops the events before
+// it.
+func (c *client) event(name string, body interface{}) {
+	c.t.Helper()
+	for {
+		var msg Message
+		if len(c.events) > 0 {
+			msg, c.events = c.events[0], c.events[1:]
+		} else {
+			msg = *c.read()
+		}
+		if msg.Type != "event" || msg.Event != name {
+			continue
+		}
+		if body != nil {
+			if err := json.Unmarshal(msg.Body, body); err != nil {
+				c.t.Fatalf("bad body for %s: %s", name, err)
+			}
+		}
+		return
+	}
+}
+
+// disconnect ends the session, what the server still sends is read and
+// dropped.
+func (c *client) disconnect() {
+	c.t.Helper()
+	c.request("disconnect", map[string]bool{"terminateDebuggee": true}, nil)
+	go func() {
+		for range c.messages {
+		}
+	}()
+	if err := <-c.done; err != nil {
+		c.t.Fatalf("serve: %s", err)
+	}
+	c.in.Close()
+}
+
+func (c *client) stopped() StoppedEvent {
+	c.t.Helper()
+	var event StoppedEvent
+	c.event("stopped", &event)
+	return event
+}
+
+func (c *client) variables(ref int) map[string]Variable {
+	c.t.Helper()
+	var response VariablesResponse
+	if msg := c.request("variables", VariablesArguments{VariablesReference: ref}, &response); !msg.Succeeded() {
+		c.t.Fatalf("variables failed: %s", msg.Message)
+	}
+	vars := map[string]Variable{}
+	for _, v := range response.Variables {
+		vars[v.Name] = v
+	}
+	return vars
+}
+
+func (c *client) frames() []string {
+	c.t.Helper()
+	var response StackTraceResponse
+	c.request("stackTrace", StackTraceArguments{ThreadID: threadID}, &response)
+	names := []string{}
+	for _, f := range response.StackFrames {
+		names = append(names, f.Name+":"+itoa(f.Line))
+	}
+	return names
+}
+
+func itoa(n int) string {
+	b, _ := json.Marshal(n)
+	return string(b)
+}
+
+func writeProgram(t *testing.T, source string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "program.mk")
+	if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const program = `let greeting = "hi";
+let make = fn(n) {
+  let items = [n, n * 2];
+  fn(x) { x + len(items) }
+};
+let add = make(10);
+puts(greeting);
+add(5);
+`
+
+func TestSession(t *testing.T) {
+	path := writeProgram(t, program)
+	c := newClient(t)
+
+	var capabilities Capabilities
+	c.request("initialize", map[string]string{"adapterID": "mokey-type"}, &capabilities)
+	if !capabilities.SupportsConfigurationDoneRequest {
+		t.Errorf("wrong capabilities %+v", capabilities)
+	}
+	if msg := c.request("launch", LaunchArguments{Program: path}, nil); !msg.Succeeded() {
+		t.Fatalf("launch failed: %s", msg.Message)
+	}
+	c.event("initialized", nil)
+
+	var breakpoints SetBreakpointsResponse
+	c.request("setBreakpoints", SetBreakpointsArguments{
+		Source:      Source{Path: path},
+		Breakpoints: []SourceBreakpoint{{Line: 4}, {Line: 5}, {Line: 20}},
+	}, &breakpoints)
+	expected := []Breakpoint{
+		{Verified: true, Line: 4},
+		{Verified: true, Line: 6},
+		{Line: 20, Message: "no statement on line 20 or after it"},
+	}
+	if !reflect.DeepEqual(breakpoints.Breakpoints, expected) {
+		t.Errorf("wrong breakpoints.\nwant=%+v\n got=%+v", expected, breakpoints.Breakpoints)
+	}
+
+	c.request("configurationDone", nil, nil)
+	if event := c.stopped(); event.Reason != "breakpoint" || event.ThreadID != threadID {
+		t.Errorf("wrong stop %+v", event)
+	}
+	if got := c.frames(); !reflect.DeepEqual(got, []string{"main:6"}) {
+		t.Errorf("wrong frames %v", got)
+	}
+
+	c.request("continue", map[string]int{"threadId": threadID}, nil)
+	c.stopped()
+	var threads ThreadsResponse
+	c.request("threads", nil, &threads)
+	if len(threads.Threads) != 1 || threads.Threads[0].ID != threadID {
+		t.Errorf("wrong threads %+v", threads)
+	}
+	if got := c.frames(); !reflect.DeepEqual(got, []string{"make:4", "main:6"}) {
+		t.Errorf("wrong frames %v", got)
+	}
+
+	var scopes ScopesResponse
+	c.request("scopes", ScopesArguments{FrameID: 1}, &scopes)
+	if len(scopes.Scopes) != 2 || scopes.Scopes[0].Name != "Locals" || scopes.Scopes[1].Name != "Globals" {
+		t.Fatalf("wrong scopes %+v", scopes)
+	}
+	locals := c.variables(scopes.Scopes[0].VariablesReference)
+	if locals["n"].Value != "10" || locals["items"].Value != "[10, 20]" || locals["items"].VariablesReference == 0 {
+		t.Errorf("wrong locals %+v", locals)
+	}
+	items := c.variables(locals["items"].VariablesReference)
+	if items["[1]"].Value != "20" || items["[1]"].Type != "INTEGER" {
+		t.Errorf("wrong elements %+v", items)
+	}
+	globals := c.variables(scopes.Scopes[1].VariablesReference)
+	if globals["greeting"].Value != `"hi"` || globals["add"].Value != "<not set>" {
+		t.Errorf("wrong globals %+v", globals)
+	}
+
+	var result EvaluateResponse
+	c.request("evaluate", EvaluateArguments{Expression: "n * 3", FrameID: 1}, &result)
+	if result.Result != "30" {
+		t.Errorf("wrong evaluation %+v", result)
+	}
+	if msg := c.request("evaluate", EvaluateArguments{Expression: "nope", FrameID: 1}, nil); msg.Succeeded() || msg.Message != "undefined variable: nope" {
+		t.Errorf("evaluating an unknown name should fail, got %+v", msg)
+	}
+
+	// the returned function stops at line 4 too, after puts ran
+	c.request("continue", map[string]int{"threadId": threadID}, nil)
+	var output OutputEvent
+	c.event("output", &output)
+	if output.Output != "hi\n" || output.Category != "stdout" {
+		t.Errorf("wrong output %+v", output)
+	}
+	c.stopped()
+	if got := c.frames(); !reflect.DeepEqual(got, []string{"fn@4:4", "main:8"}) {
+		t.Errorf("wrong frames %v", got)
+	}
+	c.request("scopes", ScopesArguments{FrameID: 1}, &scopes)
+	if len(scopes.Scopes) != 3 || scopes.Scopes[1].Name != "Closure" {
+		t.Fatalf("wrong scopes %+v", scopes)
+	}
+	if free := c.variables(scopes.Scopes[1].VariablesReference); free["items"].Value != "[10, 20]" {
+		t.Errorf("wrong free variables %+v", free)
+	}
+
+	c.request("stepOut", map[string]int{"threadId": threadID}, nil)
+	if event := c.stopped(); event.Reason != "step" {
+		t.Errorf("wrong stop %+v", event)
+	}
+	if got := c.frames(); !reflect.DeepEqual(got, []string{"main:8"}) {
+		t.Errorf("wrong frames %v", got)
+	}
+
+	c.request("continue", map[string]int{"threadId": threadID}, nil)
+	var exited ExitedEvent
+	c.event("exited", &exited)
+	if exited.ExitCode != 0 {
+		t.Errorf("wrong exit code %d", exited.ExitCode)
+	}
+	c.event("terminated", nil)
+	if msg := c.request("stackTrace", StackTraceArguments{ThreadID: threadID}, nil); msg.Succeeded() {
+		t.Errorf("stackTrace should fail after the program ended")
+	}
+	c.disconnect()
+}
+
+func TestStepping(t *testing.T) {
+	path := writeProgram(t, program)
+	c := newClient(t)
+	c.request("initialize", nil, nil)
+	c.request("launch", LaunchArguments{Program: path, StopOnEntry: true}, nil)
+	c.request("configurationDone", nil, nil)
+
+	if event := c.stopped(); event.Reason != "entry" {
+		t.Errorf("wrong stop %+v", event)
+	}
+	steps := []string{}
+	for _, command := range []string{"next", "next", "stepIn", "next", "next"} {
+		c.request(command, map[string]int{"threadId": threadID}, nil)
+		c.stopped()
+		steps = append(steps, c.frames()[0])
+	}
+	if want := []string{"main:2", "main:6", "make:3", "make:4", "main:6"}; !reflect.DeepEqual(steps, want) {
+		t.Errorf("wrong steps.\nwant=%v\n got=%v", want, steps)
+	}
+	// the program is stopped, disconnecting ends it
+	c.disconnect()
+}
+
+func TestErrors(t *testing.T) {
+	c := newClient(t)
+	if msg := c.request("launch", LaunchArguments{Program: "missing.mk"}, nil); msg.Succeeded() {
+		t.Errorf("launching a missing file should fail")
+	}
+	if msg := c.request("attach", nil, nil); msg.Succeeded() || msg.Message != `unsupported request "attach"` {
+		t.Errorf("wrong failure %+v", msg)
+	}
+	if msg := c.request("next", map[string]int{"threadId": threadID}, nil); msg.Succeeded() || msg.Message != "the program is not stopped" {
+		t.Errorf("wrong failure %+v", msg)
+	}
+
+	path := writeProgram(t, "let f = fn(x) {\n  x + true\n};\nf(1);\n")
+	c.request("launch", LaunchArguments{Program: path}, nil)
+	c.request("configurationDone", nil, nil)
+	event := c.stopped()
+	if event.Reason != "exception" || event.Text != "unsoported types for binary operation: INTEGER BOOLEAN" {
+		t.Errorf("wrong stop %+v", event)
+	}
+	if got := c.frames(); !reflect.DeepEqual(got, []string{"f:2", "main:4"}) {
+		t.Errorf("wrong frames %v", got)
+	}
+	c.request("continue", map[string]int{"threadId": threadID}, nil)
+	var exited ExitedEvent
+	c.event("exited", &exited)
+	if exited.ExitCode != 1 {
+		t.Errorf("wrong exit code %d", exited.ExitCode)
+	}
+	c.disconnect()
+}
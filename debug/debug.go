@@ -0,0 +1,330 @@
+// Package debug runs a program in the vm under the control of a debugger:
+// the program stops at breakpoints and after steps, and while it is stopped
+// its frames, their variables and the value of expressions in them can be
+// looked at. The terminal debugger and the debug adapter are built on it.
+package debug
+
+import (
+	"errors"
+	"fmt"
+	"mokey-type/code"
+	"mokey-type/compiler"
+	"mokey-type/lexer"
+	"mokey-type/object"
+	"mokey-type/parser"
+	"mokey-type/vm"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Reason is why the program stopped.
+type Reason string
+
+const (
+	Entry      Reason = "entry"
+	Breakpoint Reason = "breakpoint"
+	Step       Reason = "step"
+	// Exception is a runtime error, the frames are where it happened
+	Exception Reason = "exception"
+)
+
+type mode int
+
+const (
+	running mode = iota
+	stepIn
+	stepOver
+	stepOut
+)
+
+var errQuit = errors.New("quit")
+
+// Debugger runs bytecode compiled with its source map. Stopped is called
+// every time the program stops, the frames and variables can be looked at
+// until it returns, then the program goes on as the last call to Continue,
+// StepIn, StepOver, StepOut or Quit said, it continues without one.
+// Breakpoints and Quit can be used from another goroutine while the
+// program runs.
+type Debugger struct {
+	Stopped func(reason Reason)
+	// StopOnEntry stops the program before its first statement
+	StopOnEntry bool
+	// Err is the runtime error of an Exception stop
+	Err error
+
+	bytecode *compiler.Bytecode
+	machine  *vm.VM
+	lines    map[int]bool
+
+	mu          sync.Mutex
+	breakpoints map[int]bool
+
+	mode mode
+	// depth is the number of frames when the step started
+	depth int
+	quit  atomic.Bool
+}
+
+func New(bytecode *compiler.Bytecode) *Debugger {
+	d := &Debugger{
+		bytecode:    bytecode,
+		machine:     vm.New(bytecode),
+		breakpoints: map[int]bool{},
+		lines:       map[int]bool{},
+	}
+	d.addLines(bytecode.SourceMap)
+	// breakpoints are for the program, not the modules it imports
+	for _, constant := range bytecode.Constanst {
+		if fn, ok := constant.(*object.CompiledFunction); ok && fn.File == "" {
+			d.addLines(fn.SourceMap)
+		}
+	}
+	d.machine.SetHook(d.hook)
+	return d
+}
+
+func (d *Debugger) addLines(m code.SourceMap) {
+	for _, pos := range m {
+		if pos.Statement {
+			d.lines[pos.Line] = true
+		}
+	}
+}
+
+// SetBreakpoint stops the program before the statements of line, or of
+// the first line after it that has one. It returns the line it used.
+func (d *Debugger) SetBreakpoint(line int) (int, error) {
+	last := 0
+	for l := range d.lines {
+		last = max(last, l)
+	}
+	for l := line; l <= last; l++ {
+		if d.lines[l] {
+			d.mu.Lock()
+			d.breakpoints[l] = true
+			d.mu.Unlock()
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("no statement on line %d or after it", line)
+}
+
+// ClearBreakpoint removes the breakpoint of line, it reports whether there
+// was one.
+func (d *Debugger) ClearBreakpoint(line int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ok := d.breakpoints[line]
+	delete(d.breakpoints, line)
+	return ok
+}
+
+// Breakpoints returns the lines with a breakpoint, sorted.
+func (d *Debugger) Breakpoints() []int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	lines := []int{}
+	for l := range d.breakpoints {
+		lines = append(lines, l)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// Continue runs until the next breakpoint.
+func (d *Debugger) Continue() {
+	d.mode = running
+}
+
+// StepIn stops at the next statement, in a function it calls too.
+func (d *Debugger) StepIn() {
+	d.mode, d.depth = stepIn, d.machine.Depth()
+}
+
+// StepOver stops at the next statement of the current function, or where
+// it returns to.
+func (d *Debugger) StepOver() {
+	d.mode, d.depth = stepOver, d.machine.Depth()
+}
+
+// StepOut stops where the current function returns to.
+func (d *Debugger) StepOut() {
+	d.mode, d.depth = stepOut, d.machine.Depth()
+}
+
+// Quit stops the program for good, Run returns without an error.
+func (d *Debugger) Quit() {
+	d.quit.Store(true)
+}
+
+// Run runs the program to its end, stopping as told. It returns the result
+// of the program, or the runtime error after the Exception stop.
+func (d *Debugger) Run() (object.Object, error) {
+	if d.StopOnEntry {
+		d.mode, d.depth = stepIn, 0
+	}
+	err := d.run()
+	if err == errQuit {
+		return nil, nil
+	}
+	if err != nil {
+		d.Err = err
+		d.stop(Exception)
+		return nil, err
+	}
+	return d.machine.LastPopedStackElement(), nil
+}
+
+// run turns the panics of the vm into errors, so the frames of the panic
+// can be looked at too.
+func (d *Debugger) run() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return d.machine.Run()
+}
+
+func (d *Debugger) stop(reason Reason) {
+	d.mode = running
+	if d.Stopped != nil {
+		d.Stopped(reason)
+	}
+}
+
+func (d *Debugger) hook(machine *vm.VM) error {
+	depth := machine.Depth()
+	statement := machine.Statement()
+
+	var reason Reason
+	switch {
+	case d.mode != running && depth < d.depth:
+		// the function the step started in returned
+		reason = Step
+	case statement && d.atBreakpoint():
+		reason = Breakpoint
+	case statement && d.mode == stepIn:
+		reason = Step
+		if d.depth == 0 {
+			reason = Entry
+		}
+	case statement && d.mode == stepOver && depth <= d.depth:
+		reason = Step
+	}
+	if reason != "" {
+		d.stop(reason)
+	}
+	if d.quit.Load() {
+		return errQuit
+	}
+	return nil
+}
+
+func (d *Debugger) atBreakpoint() bool {
+	pos, ok := d.machine.Position()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return ok && d.machine.File() == "" && d.breakpoints[pos.Line]
+}
+
+// Variable is a name and its value, nil when it was not set yet.
+type Variable struct {
+	Name  string
+	Value object.Object
+}
+
+// Frame is a function that was called and did not return yet.
+type Frame struct {
+	Name string
+	// File is the module the frame is in, empty in the program itself
+	File         string
+	Line, Column int
+	// Locals are the parameters and the lets of the function, Free the
+	// variables of the functions around it that it uses
+	Locals []Variable
+	Free   []Variable
+
+	closure *object.Closure
+}
+
+// Frames returns the frames of the stopped program, innermost first.
+func (d *Debugger) Frames() []Frame {
+	frames := []Frame{}
+	for _, f := range d.machine.Backtrace() {
+		fn := f.Closure.Fn
+		frame := Frame{Name: f.Name, File: fn.File, Line: f.Position.Line, Column: f.Position.Column, closure: f.Closure}
+		frame.Locals = variables(fn.LocalNames, f.Locals)
+		frame.Free = variables(fn.FreeNames, f.Closure.Free)
+		frames = append(frames, frame)
+	}
+	return frames
+}
+
+// variables pairs names and values, the values whose name was reused have
+// none and are left out.
+func variables(names []string, values []object.Object) []Variable {
+	vars := []Variable{}
+	for i, name := range names {
+		if name != "" && i < len(values) {
+			vars = append(vars, Variable{Name: name, Value: values[i]})
+		}
+	}
+	return vars
+}
+
+// Globals returns the global variables, in the order they were defined.
+func (d *Debugger) Globals() []Variable {
+	return variables(d.bytecode.GlobalNames, d.machine.Globals())
+}
+
+// Evaluate runs input in the frame at index of Frames, where its locals,
+// free variables and the globals are visible, and returns its value. It
+// runs in a vm of its own on a copy of the globals, a let in input doesn't
+// change the program.
+func (d *Debugger) Evaluate(frame int, input string) (result object.Object, err error) {
+	frames := d.Frames()
+	if frame < 0 || frame >= len(frames) {
+		return nil, fmt.Errorf("no frame %d", frame)
+	}
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("%s", strings.Join(p.Errors(), "\n"))
+	}
+
+	// the locals and free variables become globals after the program's
+	// own, so they shadow them
+	table := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		table.DefineBuiltin(i, v.Name)
+	}
+	for _, name := range d.bytecode.GlobalNames {
+		table.Define(name)
+	}
+	globals := make([]object.Object, vm.GlobalsSize)
+	copy(globals, d.machine.Globals())
+	f := frames[frame]
+	if name := f.closure.Fn.Name; name != "" {
+		globals[table.Define(name).Index] = f.closure
+	}
+	for _, v := range append(f.Free, f.Locals...) {
+		if v.Value != nil {
+			globals[table.Define(v.Name).Index] = v.Value
+		}
+	}
+
+	constants := append([]object.Object{}, d.bytecode.Constanst...)
+	comp := compiler.NewWithState(table, constants)
+	if err := comp.Compile(program); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return vm.Execute(comp.Bytecode(), globals)
+}
@@ -0,0 +1,198 @@
+package debug
+
+import (
+	"fmt"
+	"mokey-type/compiler"
+	"mokey-type/conformance"
+	"mokey-type/object"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const source = `let total = 10;
+let add = fn(a, b) {
+  let sum = a + b;
+  sum + total
+};
+let twice = fn(f) {
+  let once = f(1);
+  f(once)
+};
+twice(fn(x) { add(x, x) });
+`
+
+func newDebugger(t *testing.T, input string) *Debugger {
+	t.Helper()
+	comp := compiler.New()
+	if err := comp.Compile(conformance.Parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	return New(comp.Bytecode())
+}
+
+// stops runs the program and does the next action at every stop, it
+// returns the stops as reason, function and line.
+func stops(t *testing.T, d *Debugger, actions ...func()) []string {
+	t.Helper()
+	got := []string{}
+	d.Stopped = func(reason Reason) {
+		top := d.Frames()[0]
+		got = append(got, fmt.Sprintf("%s %s:%d", reason, top.Name, top.Line))
+		if len(actions) > 0 {
+			actions[0]()
+			actions = actions[1:]
+		}
+	}
+	if _, err := d.Run(); err != nil {
+		t.Fatalf("run error: %s", err)
+	}
+	return got
+}
+
+func TestStepping(t *testing.T) {
+	d := newDebugger(t, source)
+	d.StopOnEntry = true
+	got := stops(t, d, d.StepOver, d.StepOver, d.StepOver, d.StepIn, d.StepIn, d.StepIn, d.StepIn, d.StepOut, d.StepOver, d.Continue)
+	expected := []string{
+		"entry main:1",
+		"step main:2",
+		"step main:6",
+		"step main:10",
+		// into twice, the function literal and add
+		"step twice:7",
+		"step fn@10:10",
+		"step add:3",
+		"step add:4",
+		// out of add returns to the middle of the literal
+		"step fn@10:10",
+		// and over its end to twice
+		"step twice:7",
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong stops.\nwant=%q\n got=%q", expected, got)
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	d := newDebugger(t, source)
+	if line, err := d.SetBreakpoint(3); line != 3 || err != nil {
+		t.Fatalf("breakpoint at line 3: got %d, %v", line, err)
+	}
+	// line 5 is the end of add, the next statement is on line 6
+	if line, err := d.SetBreakpoint(5); line != 6 || err != nil {
+		t.Fatalf("breakpoint at line 5: got %d, %v", line, err)
+	}
+	if _, err := d.SetBreakpoint(11); err == nil || err.Error() != "no statement on line 11 or after it" {
+		t.Fatalf("wrong error for line 11: %v", err)
+	}
+	if !reflect.DeepEqual(d.Breakpoints(), []int{3, 6}) {
+		t.Fatalf("wrong breakpoints %v", d.Breakpoints())
+	}
+
+	got := stops(t, d, d.Continue, d.Continue, func() { d.ClearBreakpoint(3) })
+	expected := []string{"breakpoint main:6", "breakpoint add:3", "breakpoint add:3"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("wrong stops.\nwant=%q\n got=%q", expected, got)
+	}
+}
+
+func TestVariables(t *testing.T) {
+	d := newDebugger(t, source)
+	d.SetBreakpoint(4)
+	var frames []Frame
+	var globals []Variable
+	evaluated := []string{}
+	d.Stopped = func(reason Reason) {
+		frames = d.Frames()
+		globals = d.Globals()
+		for _, input := range []string{"sum * total", "let total = 1; total", "add(a, 100)", "x", "nope"} {
+			result, err := d.Evaluate(0, input)
+			if err != nil {
+				evaluated = append(evaluated, "error: "+err.Error())
+			} else {
+				evaluated = append(evaluated, result.Inspect())
+			}
+		}
+		// x is a parameter of the function literal that called add
+		result, err := d.Evaluate(1, "x * 3")
+		if err != nil || result.Inspect() != "3" {
+			t.Errorf("evaluating in the caller: got %v, %v", result, err)
+		}
+		result, err = d.Evaluate(2, "f(2)")
+		if err != nil || result.Inspect() != "14" {
+			t.Errorf("calling a local function: got %v, %v", result, err)
+		}
+		d.Quit()
+	}
+	if result, err := d.Run(); result != nil || err != nil {
+		t.Fatalf("quit should end the run without a result, got %v, %v", result, err)
+	}
+
+	names := []string{}
+	for _, f := range frames {
+		names = append(names, fmt.Sprintf("%s:%d", f.Name, f.Line))
+	}
+	if want := []string{"add:4", "fn@10:10", "twice:7", "main:10"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("wrong frames.\nwant=%q\n got=%q", want, names)
+	}
+	if got := variableString(frames[0].Locals); got != "a=1 b=1 sum=2" {
+		t.Errorf("wrong locals of add %q", got)
+	}
+	if got := variableString(frames[2].Locals); got != "f=closure once=<nil>" {
+		t.Errorf("wrong locals of twice %q", got)
+	}
+	if got := variableString(globals); got != "total=10 add=closure twice=closure" {
+		t.Errorf("wrong globals %q", got)
+	}
+	expected := []string{"20", "1", "111", "error: undefined variable: x", "error: undefined variable: nope"}
+	if !reflect.DeepEqual(evaluated, expected) {
+		t.Errorf("wrong values.\nwant=%q\n got=%q", expected, evaluated)
+	}
+}
+
+func TestFreeVariables(t *testing.T) {
+	d := newDebugger(t, "let adder = fn(n) { fn(m) { n + m } };\nlet addTwo = adder(2);\naddTwo(3);")
+	d.SetBreakpoint(1)
+	var free []Variable
+	d.Stopped = func(reason Reason) {
+		if top := d.Frames()[0]; top.Name == "fn@1" {
+			free = top.Free
+		}
+	}
+	if result, err := d.Run(); err != nil || result.Inspect() != "5" {
+		t.Fatalf("wrong result %v, %v", result, err)
+	}
+	if got := variableString(free); got != "n=2" {
+		t.Errorf("wrong free variables %q", got)
+	}
+}
+
+func TestException(t *testing.T) {
+	d := newDebugger(t, "let f = fn(x) {\n  x + true\n};\nf(1);")
+	got := []string{}
+	d.Stopped = func(reason Reason) {
+		top := d.Frames()[0]
+		got = append(got, fmt.Sprintf("%s %s:%d %s", reason, top.Name, top.Line, d.Err))
+	}
+	if _, err := d.Run(); err == nil {
+		t.Fatal("expected an error")
+	}
+	if want := []string{"exception f:2 unsoported types for binary operation: INTEGER BOOLEAN"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong stops.\nwant=%q\n got=%q", want, got)
+	}
+}
+
+func variableString(vars []Variable) string {
+	out := []string{}
+	for _, v := range vars {
+		value := "<nil>"
+		if _, ok := v.Value.(*object.Closure); ok {
+			value = "closure"
+		} else if v.Value != nil {
+			value = v.Value.Inspect()
+		}
+		out = append(out, v.Name+"="+value)
+	}
+	return strings.Join(out, " ")
+}
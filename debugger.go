@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"mokey-type/debug"
+	"mokey-type/object"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const debugHelp = `commands:
+  break LINE, b LINE   stop before the statements of LINE
+  clear LINE           remove the breakpoint of LINE
+  breakpoints          list the breakpoints
+  continue, c          run until the next breakpoint
+  step, s              stop at the next statement, in called functions too
+  next, n              stop at the next statement of this function
+  out, o               stop where this function returns to
+  backtrace, bt        list the frames
+  up, down, frame N    pick the frame that locals and print look at
+  locals               the locals and free variables of the frame
+  globals              the global variables
+  print EXPR, p EXPR   the value of EXPR in the frame
+  list, l              the source around the frame's line
+  quit, q              stop the program
+`
+
+// debugFile runs a source file under the terminal debugger, it stops before
+// the first statement so breakpoints can be set.
+func debugFile(args []string) error {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	usage(flags, "mokey-type debug file.mk", "Runs file.mk under the debugger, it stops before the first statement and\nreads gdb like commands from stdin.\n\n"+strings.TrimSuffix(debugHelp, "\n"))
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: mokey-type debug file.mk")
+	}
+	path := flags.Arg(0)
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return debugSource(os.Stdin, os.Stdout, path, string(source))
+}
+
+func debugSource(in io.Reader, out io.Writer, path, source string) error {
+	bytecode, err := compileSource(path, source)
+	if err != nil {
+		return err
+	}
+	t := &terminal{
+		d:     debug.New(bytecode),
+		path:  path,
+		lines: strings.Split(source, "\n"),
+		in:    bufio.NewScanner(in),
+		out:   out,
+	}
+	t.d.StopOnEntry = true
+	t.d.Stopped = t.stopped
+
+	result, err := t.d.Run()
+	switch {
+	case t.quit:
+		fmt.Fprintln(out, "quit")
+	case err != nil:
+		fmt.Fprintf(out, "exited with error: %s\n", err)
+	case result != nil:
+		fmt.Fprintf(out, "exited, the result is %s\n", object.Quoted(result))
+	default:
+		fmt.Fprintln(out, "exited")
+	}
+	return nil
+}
+
+// terminal reads the commands of the debugger from in while the program is
+// stopped.
+type terminal struct {
+	d     *debug.Debugger
+	path  string
+	lines []string
+	in    *bufio.Scanner
+	out   io.Writer
+	// frame is the index of the frame locals and print look at
+	frame int
+	quit  bool
+}
+
+func (t *terminal) stopped(reason debug.Reason) {
+	t.frame = 0
+	frames := t.d.Frames()
+	top := frames[0]
+	if reason == debug.Exception {
+		fmt.Fprintf(t.out, "error: %s\n", t.d.Err)
+	}
+	fmt.Fprintf(t.out, "stopped at %s in %s %s:%d\n", reason, top.Name, t.file(top), top.Line)
+	t.printLine(top.Line, top.Line)
+
+	for {
+		fmt.Fprint(t.out, "(debug) ")
+		if !t.in.Scan() {
+			fmt.Fprintln(t.out)
+			t.quit = true
+			t.d.Quit()
+			return
+		}
+		if t.command(strings.TrimSpace(t.in.Text())) {
+			return
+		}
+	}
+}
+
+// command runs one command, it reports whether the program goes on.
+func (t *terminal) command(line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+	frames := t.d.Frames()
+	frame := frames[t.frame]
+
+	switch name {
+	case "":
+	case "break", "b":
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			fmt.Fprintln(t.out, "break needs a line number")
+			break
+		}
+		line, err := t.d.SetBreakpoint(n)
+		if err != nil {
+			fmt.Fprintln(t.out, err)
+			break
+		}
+		fmt.Fprintf(t.out, "breakpoint at %s:%d\n", t.path, line)
+	case "clear":
+		n, err := strconv.Atoi(arg)
+		if err != nil || !t.d.ClearBreakpoint(n) {
+			fmt.Fprintf(t.out, "no breakpoint at line %s\n", arg)
+			break
+		}
+		fmt.Fprintf(t.out, "cleared %s:%d\n", t.path, n)
+	case "breakpoints":
+		for _, line := range t.d.Breakpoints() {
+			fmt.Fprintf(t.out, "%s:%d\n", t.path, line)
+		}
+	case "continue", "c":
+		t.d.Continue()
+		return true
+	case "step", "s":
+		t.d.StepIn()
+		return true
+	case "next", "n":
+		t.d.StepOver()
+		return true
+	case "out", "o":
+		t.d.StepOut()
+		return true
+	case "quit", "q":
+		t.quit = true
+		t.d.Quit()
+		return true
+	case "backtrace", "bt":
+		for i, f := range frames {
+			mark := " "
+			if i == t.frame {
+				mark = "*"
+			}
+			fmt.Fprintf(t.out, "%s#%d %s %s:%d:%d\n", mark, i, f.Name, t.file(f), f.Line, f.Column)
+		}
+	case "up", "down", "frame":
+		n := t.frame
+		switch name {
+		case "up":
+			n++
+		case "down":
+			n--
+		default:
+			n, _ = strconv.Atoi(arg)
+		}
+		if n < 0 || n >= len(frames) {
+			fmt.Fprintf(t.out, "no frame %d\n", n)
+			break
+		}
+		t.frame = n
+		f := frames[n]
+		fmt.Fprintf(t.out, "#%d %s %s:%d:%d\n", n, f.Name, t.file(f), f.Line, f.Column)
+		t.printLine(f.Line, f.Line)
+	case "locals":
+		printVariables(t.out, frame.Locals)
+		printVariables(t.out, frame.Free)
+	case "globals":
+		printVariables(t.out, t.d.Globals())
+	case "print", "p":
+		result, err := t.d.Evaluate(t.frame, arg)
+		switch {
+		case err != nil:
+			fmt.Fprintf(t.out, "error: %s\n", err)
+		case result == nil:
+			fmt.Fprintln(t.out, "null")
+		default:
+			fmt.Fprintln(t.out, object.Quoted(result))
+		}
+	case "list", "l":
+		t.printLine(frame.Line-5, frame.Line+5)
+	case "help", "h":
+		fmt.Fprint(t.out, debugHelp)
+	default:
+		fmt.Fprintf(t.out, "unknown command %q, try help\n", name)
+	}
+	return false
+}
+
+// file is the file frame is in, the program's or a module's.
+func (t *terminal) file(frame debug.Frame) string {
+	if frame.File != "" {
+		return frame.File
+	}
+	return t.path
+}
+
+// printLine prints the lines from first to last of the source of the
+// frame, its current line with a mark.
+func (t *terminal) printLine(first, last int) {
+	frame := t.d.Frames()[t.frame]
+	lines := t.lines
+	if frame.File != "" {
+		source, _ := os.ReadFile(frame.File)
+		lines = strings.Split(string(source), "\n")
+	}
+	for n := max(first, 1); n <= last && n <= len(lines); n++ {
+		mark := " "
+		if n == frame.Line {
+			mark = ">"
+		}
+		fmt.Fprintf(t.out, "%s%4d  %s\n", mark, n, lines[n-1])
+	}
+}
+
+func printVariables(w io.Writer, vars []debug.Variable) {
+	for _, v := range vars {
+		value := "<not set>"
+		if v.Value != nil {
+			value = object.Quoted(v.Value)
+		}
+		fmt.Fprintf(w, "%s = %s\n", v.Name, value)
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDebugSource(t *testing.T) {
+	source := `let scale = 3;
+let area = fn(w, h) {
+  let size = w * h;
+  size * scale
+};
+area(2, 5);
+`
+	commands := "b 4\nc\nlocals\nbt\np size + 1\nup\np size\nbreakpoints\nclear 4\nn\nc\n"
+	var out bytes.Buffer
+	if err := debugSource(strings.NewReader(commands), &out, "area.mk", source); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"stopped at entry in main area.mk:1\n>   1  let scale = 3;\n",
+		"(debug) breakpoint at area.mk:4\n",
+		"stopped at breakpoint in area area.mk:4\n>   4    size * scale\n",
+		"(debug) w = 2\nh = 5\nsize = 10\n",
+		"(debug) *#0 area area.mk:4:3\n #1 main area.mk:6:1\n",
+		"(debug) 11\n",
+		"(debug) #1 main area.mk:6:1\n>   6  area(2, 5);\n(debug) error: undefined variable: size\n",
+		"(debug) area.mk:4\n(debug) cleared area.mk:4\n",
+		"stopped at step in main area.mk:6\n",
+		"(debug) exited, the result is 30\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output is missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	debugSource(strings.NewReader("q\n"), &out, "area.mk", source)
+	if !strings.HasSuffix(out.String(), "(debug) quit\n") {
+		t.Errorf("quit should stop the program:\n%s", out.String())
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContext = 3
+
+type diffLine struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+// diff returns a unified diff from a to b, or "" when they are equal.
+func diff(name, a, b string) string {
+	if a == b {
+		return ""
+	}
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s.orig\n+++ %s\n", name, name)
+	aLine, bLine := 1, 1
+	for i := 0; i < len(lines); {
+		if lines[i].kind == ' ' {
+			aLine++
+			bLine++
+			i++
+			continue
+		}
+		// a hunk starts diffContext lines before the change and runs until
+		// there are more than two contexts' worth of equal lines
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for equal := 0; end < len(lines) && equal <= 2*diffContext; end++ {
+			if lines[end].kind == ' ' {
+				equal++
+			} else {
+				equal = 0
+			}
+		}
+		for end > i && lines[end-1].kind == ' ' {
+			end--
+		}
+		end += diffContext
+		if end > len(lines) {
+			end = len(lines)
+		}
+
+		aStart, bStart := aLine-(i-start), bLine-(i-start)
+		aCount, bCount := 0, 0
+		for _, l := range lines[start:end] {
+			if l.kind != '+' {
+				aCount++
+			}
+			if l.kind != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		for _, l := range lines[start:end] {
+			fmt.Fprintf(&out, "%c%s\n", l.kind, l.text)
+		}
+		aLine, bLine = aStart+aCount, bStart+bCount
+		i = end
+	}
+	return out.String()
+}
+
+// hunkRange numbers an empty range by the line before it, like diff -u.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines lines up a and b along their longest common subsequence.
+func diffLines(a, b []string) []diffLine {
+	common := make([][]int, len(a)+1)
+	for i := range common {
+		common[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	lines := []diffLine{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{' ', a[i]})
+			i++
+			j++
+		case j == len(b) || i < len(a) && common[i+1][j] >= common[i][j+1]:
+			lines = append(lines, diffLine{'-', a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{'+', b[j]})
+			j++
+		}
+	}
+	return lines
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestDiff(t *testing.T) {
+	a := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+	b := "1\ntwo\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"
+	expected := `--- f.mk.orig
++++ f.mk
+@@ -1,5 +1,5 @@
+ 1
+-2
++two
+ 3
+ 4
+ 5
+@@ -10,3 +10,4 @@
+ 10
+ 11
+ 12
++13
+`
+	if got := diff("f.mk", a, b); got != expected {
+		t.Errorf("wrong diff.\nwant=%q\n got=%q", expected, got)
+	}
+	if got := diff("f.mk", a, a); got != "" {
+		t.Errorf("expected no diff for equal files, got %q", got)
+	}
+	if got := diff("f.mk", "", "x\n"); got != "--- f.mk.orig\n+++ f.mk\n@@ -0,0 +1,1 @@\n+x\n" {
+		t.Errorf("wrong diff for a new file %q", got)
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// disasm prints the bytecode of a source or .mkc file.
+func disasm(args []string) error {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: mokey-type disasm file.mkc|file.mk")
+	}
+
+	bytecode, err := loadBytecode(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Print(bytecode.Disassemble())
+	return nil
+}
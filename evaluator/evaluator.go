@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"mokey-type/ast"
 	"mokey-type/object"
+	"sort"
 )
 
 var (
@@ -12,6 +13,12 @@ var (
 	NULL  = &object.NullValue{}
 )
 
+// RunProgram evaluates program in a new environment, errors are returned
+// as *object.Error values like Eval does.
+func RunProgram(program *ast.Program) (object.Object, error) {
+	return Eval(program, object.NewEnviroment()), nil
+}
+
 func Eval(node ast.Node, env *object.Enviroment) object.Object {
 	switch node := node.(type) {
 	case *ast.Program:
@@ -28,17 +35,17 @@ func Eval(node ast.Node, env *object.Enviroment) object.Object {
 		return nativeBoolToBooleanObject(node.Value)
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if abrupt(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if abrupt(left) {
 			return left
 		}
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if abrupt(right) {
 			return right
 		}
 		return evalInfixExpression(node.Operator, left, right)
@@ -48,13 +55,13 @@ func Eval(node ast.Node, env *object.Enviroment) object.Object {
 		return evalIfExpression(node, env)
 	case *ast.ReturnStatement:
 		value := Eval(node.ReturnValue, env)
-		if isError(value) {
+		if abrupt(value) {
 			return value
 		}
 		return &object.ReturnValue{Value: value}
 	case *ast.LetStatement:
 		value := Eval(node.Value, env)
-		if isError(value) {
+		if abrupt(value) {
 			return value
 		}
 		env.Set(node.Name.Value, value)
@@ -69,11 +76,11 @@ func Eval(node ast.Node, env *object.Enviroment) object.Object {
 		}
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
-		if isError(function) {
+		if abrupt(function) {
 			return function
 		}
 		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		if len(args) == 1 && abrupt(args[0]) {
 			return args[0]
 		}
 
@@ -82,22 +89,30 @@ func Eval(node ast.Node, env *object.Enviroment) object.Object {
 		return &object.String{Value: node.Value}
 	case *ast.ArrayLiteral:
 		elements := evalExpressions(node.Elements, env)
-		if len(elements) == 1 && isError(elements[0]) {
+		if len(elements) == 1 && abrupt(elements[0]) {
 			return elements[0]
 		}
 		return &object.Array{Elements: elements}
 	case *ast.IndexExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if abrupt(left) {
 			return left
 		}
 		index := Eval(node.Index, env)
-		if isError(index) {
+		if abrupt(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
 	case *ast.HashLiteral:
 		return evalHashLiteral(node, env)
+	case *ast.ForLoop:
+		return evalForLoop(node, env)
+	case *ast.ImportExpression:
+		importer := env.Importer()
+		if importer == nil {
+			return newError("imports are not enabled")
+		}
+		return importer.Import(node.Path.Value)
 	}
 	return nil
 }
@@ -144,27 +159,17 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 		return evalBangOperatorExpression(right)
 	case "-":
 		return evalMinusPrefixOperatorExpression(right)
+	case "++":
+		return evalInfixExpression("+", right, &object.Integer{Value: 1})
+	case "--":
+		return evalInfixExpression("-", right, &object.Integer{Value: 1})
 	default:
 		return newError("unknown operator: %s%s", operator, right.Type())
 	}
 }
 
 func evalBangOperatorExpression(right object.Object) object.Object {
-	switch right {
-	case TRUE:
-		return FALSE
-	case FALSE:
-		return TRUE
-	case NULL:
-		return TRUE
-	default:
-		if right.Type() == object.INTEGER_OBJ {
-			if right.(*object.Integer).Value == 0 {
-				return TRUE
-			}
-		}
-		return FALSE
-	}
+	return nativeBoolToBooleanObject(!isTruthy(right))
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
@@ -204,11 +209,14 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: leftVal / rightVal}
 	case "==":
-		return &object.Boolean{Value: leftVal == rightVal}
+		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
-		return &object.Boolean{Value: leftVal != rightVal}
+		return nativeBoolToBooleanObject(leftVal != rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(left.(*object.Integer).Value > right.(*object.Integer).Value)
 	case "<":
@@ -220,7 +228,7 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 
 func evalIfExpression(ie *ast.IfExpression, env *object.Enviroment) object.Object {
 	condition := Eval(ie.Condition, env)
-	if isError(condition) {
+	if abrupt(condition) {
 		return condition
 	}
 	if isTruthy(condition) {
@@ -232,13 +240,13 @@ func evalIfExpression(ie *ast.IfExpression, env *object.Enviroment) object.Objec
 	}
 }
 
+// isTruthy looks at the value of booleans, builtins like contains return
+// their own instead of TRUE and FALSE.
 func isTruthy(obj object.Object) bool {
-	switch obj {
-	case NULL:
-		return false
-	case TRUE:
-		return true
-	case FALSE:
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+	case *object.NullValue:
 		return false
 	default:
 		return true
@@ -256,13 +264,22 @@ func isError(obj object.Object) bool {
 	return false
 }
 
+// abrupt reports whether obj ends the evaluation of the expression it is
+// part of: an error, or a return from a block nested in the expression.
+func abrupt(obj object.Object) bool {
+	if obj != nil {
+		return obj.Type() == object.ERROR_OBJ || obj.Type() == object.RETURN_VALUE_OBJ
+	}
+	return false
+}
+
 func evalIdentifier(node *ast.Identifier, env *object.Enviroment) object.Object {
 	val, ok := env.Get(node.Value)
 	if ok {
 		return val
 	}
 
-	if builtin, ok := builtins[node.Value]; ok {
+	if builtin := object.GetBuiltinByName(node.Value); builtin != nil {
 		return builtin
 	}
 	return newError("identifier not found: " + node.Value)
@@ -272,7 +289,7 @@ func evalExpressions(expressions []ast.Expression, env *object.Enviroment) []obj
 	var result []object.Object
 	for _, e := range expressions {
 		evaluated := Eval(e, env)
-		if isError(evaluated) {
+		if abrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 		result = append(result, evaluated)
@@ -283,15 +300,27 @@ func evalExpressions(expressions []ast.Expression, env *object.Enviroment) []obj
 func applyFunction(fn object.Object, args []object.Object) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+		}
 		extendedEnv := extendFunctionEnv(fn, args)
 		evaluated := Eval(fn.Body, extendedEnv)
+		if evaluated == nil {
+			// an empty body, or one that ends in a let
+			return NULL
+		}
 		return unwrapReturnValue(evaluated)
 
 	case *object.Builtin:
-		if result := fn.Fn(args...); result != nil {
+		switch result := fn.Call(apply, args...).(type) {
+		case nil:
+			return NULL
+		case *object.Boolean:
+			// booleans compare by identity, builtins make their own
+			return nativeBoolToBooleanObject(result.Value)
+		default:
 			return result
 		}
-		return NULL
 
 	default:
 		return newError("not a function: %s", fn.Type())
@@ -307,6 +336,11 @@ func extendFunctionEnv(fn *object.Function, args []object.Object) *object.Enviro
 	return env
 }
 
+// apply lets builtins call the functions they are given.
+func apply(fn object.Object, args ...object.Object) object.Object {
+	return applyFunction(fn, args)
+}
+
 func unwrapReturnValue(obj object.Object) object.Object {
 	if returnValue, ok := obj.(*object.ReturnValue); ok {
 		return returnValue.Value
@@ -315,12 +349,18 @@ func unwrapReturnValue(obj object.Object) object.Object {
 }
 
 func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
-	if operator != "+" {
-		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
-	}
 	leftVal := left.(*object.String).Value
 	rightVal := right.(*object.String).Value
-	return &object.String{Value: leftVal + rightVal}
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
 }
 
 func evalIndexExpression(left, index object.Object) object.Object {
@@ -348,10 +388,19 @@ func evalHashLiteral(
 	node *ast.HashLiteral,
 	env *object.Enviroment,
 ) object.Object {
+	// the pairs run in the order the compiler emits them, sorted by the
+	// text of the key
+	keys := []ast.Expression{}
+	for key := range node.Pairs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+
 	pairs := make(map[object.HashKey]object.HashPair)
-	for keyNode, valueNode := range node.Pairs {
+	for _, keyNode := range keys {
+		valueNode := node.Pairs[keyNode]
 		key := Eval(keyNode, env)
-		if isError(key) {
+		if abrupt(key) {
 			return key
 		}
 		hashKey, ok := key.(object.Hashable)
@@ -359,7 +408,7 @@ func evalHashLiteral(
 			return newError("unusable as hash key: %s", key.Type())
 		}
 		value := Eval(valueNode, env)
-		if isError(value) {
+		if abrupt(value) {
 			return value
 		}
 		hashed := hashKey.HashKey()
@@ -380,3 +429,34 @@ func evalHashIndexExpression(hash, index object.Object) object.Object {
 	}
 	return pair.Value
 }
+
+// evalForLoop runs a loop like the compiler does: the declaration lives in
+// the enclosing scope and the value of the consequence is assigned to it
+// after every iteration.
+func evalForLoop(loop *ast.ForLoop, env *object.Enviroment) object.Object {
+	if result := Eval(&loop.Declaration, env); abrupt(result) {
+		return result
+	}
+	for {
+		condition := Eval(loop.Condition, env)
+		if abrupt(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return NULL
+		}
+
+		result := Eval(loop.Body, env)
+		if result != nil {
+			if rt := result.Type(); rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+
+		next := Eval(loop.Consequence, env)
+		if abrupt(next) {
+			return next
+		}
+		env.Set(loop.Declaration.Name.Value, next)
+	}
+}
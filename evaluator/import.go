@@ -0,0 +1,54 @@
+package evaluator
+
+import (
+	"mokey-type/module"
+	"mokey-type/object"
+)
+
+// EnableImports makes the imports evaluated in env load their modules
+// with loader, file is the file of the program, empty when there is none
+// and imports are relative to the working directory.
+func EnableImports(env *object.Enviroment, file string, loader *module.Loader) {
+	modules := &modules{loader: loader, exports: map[string]object.Object{}}
+	env.SetImporter(&importer{modules: modules, file: file})
+}
+
+// modules are the exports of the modules a program imported, every
+// module is evaluated once.
+type modules struct {
+	loader  *module.Loader
+	exports map[string]object.Object
+}
+
+// importer imports for the code of one file, the program or a module.
+type importer struct {
+	modules *modules
+	file    string
+}
+
+func (i *importer) Import(path string) object.Object {
+	file, program, err := i.modules.loader.Load(i.file, path)
+	if err != nil {
+		return newError("%s", err)
+	}
+	if exports, ok := i.modules.exports[file]; ok {
+		return exports
+	}
+
+	// a module sees the builtins and nothing of the file importing it
+	env := object.NewEnviroment()
+	env.SetImporter(&importer{modules: i.modules, file: file})
+	if result := Eval(program, env); isError(result) {
+		return newError("%s: %s", file, result.(*object.Error).Message)
+	}
+
+	pairs := map[object.HashKey]object.HashPair{}
+	for _, name := range module.Exports(program) {
+		value, _ := env.Get(name)
+		key := &object.String{Value: name}
+		pairs[key.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+	exports := &object.Hash{Pairs: pairs}
+	i.modules.exports[file] = exports
+	return exports
+}
@@ -0,0 +1,63 @@
+package evaluator
+
+import (
+	"bytes"
+	"mokey-type/ast"
+	"mokey-type/conformance"
+	"mokey-type/module"
+	"mokey-type/object"
+	"path/filepath"
+	"testing"
+)
+
+func runEvalModule(file string, program *ast.Program) (object.Object, error) {
+	env := object.NewEnviroment()
+	EnableImports(env, file, module.NewLoader(nil))
+	return Eval(program, env), nil
+}
+
+func TestImports(t *testing.T) {
+	conformance.RunModules(t, runEvalModule, conformance.Modules)
+}
+
+func TestImportErrors(t *testing.T) {
+	dir := conformance.WriteModules(t, map[string]string{
+		"puts.mk":  `let x = puts("loaded");`,
+		"bad.mk":   "let f = fn(x) {\n  x + true\n};\nlet y = f(1);",
+		"scope.mk": `let f = fn() { secret }; let y = f();`,
+	})
+	file := filepath.Join(dir, "main.mk")
+
+	// a module runs once however many times it is imported
+	var out bytes.Buffer
+	stdout := object.Stdout
+	object.Stdout = &out
+	defer func() { object.Stdout = stdout }()
+	result, _ := runEvalModule(file, conformance.Parse(`import "puts"; let f = fn() { import "puts" }; f(); f();`))
+	if isError(result) {
+		t.Fatal(result.Inspect())
+	}
+	if out.String() != "loaded\n" {
+		t.Errorf("module ran more than once. got=%q", out.String())
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "bad"`, filepath.Join(dir, "bad.mk") + ": type mismatch: INTEGER + BOOLEAN"},
+		{`let secret = 1; import "scope"`, filepath.Join(dir, "scope.mk") + ": identifier not found: secret"},
+	}
+	for _, tt := range tests {
+		result, _ := runEvalModule(file, conformance.Parse(tt.input))
+		errObj, ok := result.(*object.Error)
+		if !ok || errObj.Message != tt.expected {
+			t.Errorf("wrong error. input=%s want=%q, got=%v", tt.input, tt.expected, result)
+		}
+	}
+
+	errObj, ok := testEval(`import "puts"`).(*object.Error)
+	if !ok || errObj.Message != "imports are not enabled" {
+		t.Errorf("wrong error. got=%v", errObj)
+	}
+}
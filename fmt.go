@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"mokey-type/format"
+	"os"
+)
+
+const fmtUsage = "mokey-type fmt [-w] [-d] [file.mk...]"
+
+const fmtDoc = `Prints the files in the canonical layout: tabs for indentation, one
+statement per line and lists broken one element per line when they don't
+fit in 80 columns, comments are kept. -w rewrites the files that change and -d prints a
+diff instead, both together rewrite and show what changed. With no files it
+formats stdin.`
+
+// formatFiles prints the files in the canonical layout, standard input when
+// there are none.
+func formatFiles(args []string) error {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the result back to the files instead of stdout")
+	showDiff := flags.Bool("d", false, "print a diff instead of the formatted source")
+	usage(flags, fmtUsage, fmtDoc)
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		if *write {
+			return fmt.Errorf("usage: mokey-type fmt -w needs files")
+		}
+		source, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		return formatSource("<standard input>", string(source), *showDiff)
+	}
+
+	for _, path := range flags.Args() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !*write {
+			if err := formatSource(path, string(source), *showDiff); err != nil {
+				return err
+			}
+			continue
+		}
+
+		formatted, err := format.Source(string(source))
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		if *showDiff {
+			fmt.Print(diff(path, string(source), formatted))
+		}
+		if formatted != string(source) {
+			if err := os.WriteFile(path, []byte(formatted), 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func formatSource(path, source string, showDiff bool) error {
+	formatted, err := format.Source(source)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+	if showDiff {
+		fmt.Print(diff(path, source, formatted))
+	} else {
+		fmt.Print(formatted)
+	}
+	return nil
+}
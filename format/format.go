@@ -0,0 +1,576 @@
+// Package format prints programs in one canonical layout: tabs for
+// indentation, one statement per line and lists that are broken one element
+// per line when they don't fit in maxWidth columns. Comments are kept, they
+// end up before the statement, list element or closing brace they precede.
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"mokey-type/ast"
+	"mokey-type/lexer"
+	"mokey-type/parser"
+	"mokey-type/token"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxWidth = 80
+	tabWidth = 4
+)
+
+// the parser's precedences, used to put back the parentheses it drops
+const (
+	_ int = iota
+	lowest
+	equals
+	lessGreater
+	sum
+	product
+	prefix
+	call
+	index
+	primary
+)
+
+var precedences = map[token.TokenType]int{
+	token.EQ:       equals,
+	token.NOT_EQ:   equals,
+	token.LT:       lessGreater,
+	token.GT:       lessGreater,
+	token.PLUS:     sum,
+	token.MINUS:    sum,
+	token.SLASH:    product,
+	token.ASTERISK: product,
+	token.LPAREN:   call,
+	token.LBRACKET: index,
+}
+
+// Source formats a whole file. Files that don't parse are rejected, the
+// formatter never guesses.
+func Source(source string) (string, error) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", fmt.Errorf("parser errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+	}
+
+	printer := newPrinter(source)
+	printer.program(program)
+	return printer.out.String(), nil
+}
+
+// Program formats a program that was built instead of parsed, there is no
+// source so there are no comments or blank lines to keep.
+func Program(program *ast.Program) string {
+	printer := newPrinter("")
+	printer.program(program)
+	return printer.out.String()
+}
+
+type pos struct {
+	line, column int
+}
+
+func at(tok token.Token) pos {
+	return pos{tok.Line, tok.Column}
+}
+
+func (a pos) before(b pos) bool {
+	return a.line < b.line || a.line == b.line && a.column < b.column
+}
+
+// endLine is the last line of tok, strings can span several.
+func endLine(tok token.Token) int {
+	return tok.Line + strings.Count(tok.Literal, "\n")
+}
+
+type printer struct {
+	out    *bytes.Buffer
+	indent int
+	column int  // width of the current line, 0 when nothing is on it
+	fresh  bool // nothing printed since the last opening brace
+
+	comments []token.Token       // comments not printed yet
+	items    []token.Token       // every token and comment in source order
+	closing  map[pos]token.Token // the bracket that closes each opening one
+
+	flat   bool // measuring, everything goes on one line
+	failed bool // flat printing met a block that needs several lines
+}
+
+func newPrinter(source string) *printer {
+	p := &printer{out: &bytes.Buffer{}, closing: make(map[pos]token.Token)}
+
+	l := lexer.New(source)
+	open := []token.Token{}
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		p.items = append(p.items, tok)
+		switch tok.Type {
+		case token.LPAREN, token.LBRACKET, token.LBRACE:
+			open = append(open, tok)
+		case token.RPAREN, token.RBRACKET, token.RBRACE:
+			if len(open) > 0 {
+				p.closing[at(open[len(open)-1])] = tok
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	p.comments = l.Comments()
+	p.items = append(p.items, p.comments...)
+	sort.SliceStable(p.items, func(i, j int) bool {
+		return at(p.items[i]).before(at(p.items[j]))
+	})
+	return p
+}
+
+// previous returns the token or comment right before position.
+func (p *printer) previous(position pos) (token.Token, bool) {
+	i := sort.Search(len(p.items), func(i int) bool {
+		return !at(p.items[i]).before(position)
+	})
+	if i == 0 {
+		return token.Token{}, false
+	}
+	return p.items[i-1], true
+}
+
+// gap reports whether the source has a blank line before position.
+func (p *printer) gap(position pos) bool {
+	prev, ok := p.previous(position)
+	return ok && position.line-endLine(prev) > 1
+}
+
+// trailing reports whether c follows code on the same line.
+func (p *printer) trailing(c token.Token) bool {
+	prev, ok := p.previous(at(c))
+	return ok && prev.Type != token.COMMENT && endLine(prev) == c.Line
+}
+
+func (p *printer) commentBefore(tok token.Token) bool {
+	return len(p.comments) > 0 && (tok.Line == 0 || at(p.comments[0]).before(at(tok)))
+}
+
+func (p *printer) write(s string) {
+	if p.column == 0 && !p.flat && s != "" {
+		p.out.WriteString(strings.Repeat("\t", p.indent))
+		p.column = p.indent * tabWidth
+	}
+	p.out.WriteString(s)
+	if i := strings.LastIndex(s, "\n"); i >= 0 {
+		p.column = utf8.RuneCountInString(s[i+1:])
+	} else {
+		p.column += utf8.RuneCountInString(s)
+	}
+}
+
+func (p *printer) newline() {
+	if p.column > 0 {
+		p.out.WriteByte('\n')
+		p.column = 0
+	}
+}
+
+func (p *printer) blankLine() {
+	p.newline()
+	if p.out.Len() > 0 && !bytes.HasSuffix(p.out.Bytes(), []byte("\n\n")) {
+		p.out.WriteByte('\n')
+	}
+}
+
+// flush prints the comments that come before position.
+func (p *printer) flush(position pos) {
+	for len(p.comments) > 0 && at(p.comments[0]).before(position) {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+		if p.trailing(c) && p.column > 0 {
+			p.write(" " + c.Literal)
+		} else {
+			p.newline()
+			if !p.fresh && p.gap(at(c)) {
+				p.blankLine()
+			}
+			p.write(c.Literal)
+		}
+		p.newline()
+		p.fresh = false
+	}
+}
+
+// measure prints f on a single line and returns the text, it fails when
+// something in f can't be put on one line.
+func (p *printer) measure(f func()) (string, bool) {
+	out, column, flat, failed := p.out, p.column, p.flat, p.failed
+	p.out, p.column, p.flat, p.failed = &bytes.Buffer{}, 0, true, false
+	f()
+	text, ok := p.out.String(), !p.failed
+	p.out, p.column, p.flat, p.failed = out, column, flat, failed
+	return text, ok
+}
+
+func (p *printer) fits(text string) bool {
+	return p.column+utf8.RuneCountInString(text) <= maxWidth
+}
+
+func (p *printer) program(program *ast.Program) {
+	p.fresh = true
+	p.statements(program.Statements, false)
+	p.flush(pos{math.MaxInt32, 0})
+	p.newline()
+}
+
+func (p *printer) statements(statements []ast.Statement, inBlock bool) {
+	for i, s := range statements {
+		start := at(ast.Start(s))
+		p.flush(start)
+		p.newline()
+		if !p.fresh && p.gap(start) {
+			p.blankLine()
+		}
+		p.statement(s)
+		p.fresh = false
+
+		var next ast.Statement
+		if i+1 < len(statements) {
+			next = statements[i+1]
+		}
+		if p.needsSemicolon(s, next, inBlock) {
+			p.write(";")
+		}
+	}
+}
+
+// needsSemicolon leaves the semicolon out after the last expression of a
+// block and after if and for, unless the next statement would read as the
+// continuation of the expression.
+func (p *printer) needsSemicolon(s, next ast.Statement, inBlock bool) bool {
+	es, ok := s.(*ast.ExpressionStatement)
+	if !ok {
+		return true
+	}
+	if inBlock && next == nil {
+		return false
+	}
+	switch es.Expression.(type) {
+	case *ast.IfExpression, *ast.ForLoop:
+		next, ok := next.(*ast.ExpressionStatement)
+		if !ok {
+			return false
+		}
+		_, continues := precedences[token.TokenType(leading(next.Expression))]
+		return continues
+	}
+	return true
+}
+
+func (p *printer) statement(s ast.Statement) {
+	switch s := s.(type) {
+	case *ast.LetStatement:
+		p.write(letHeader(s))
+		p.expression(s.Value)
+	case *ast.ReturnStatement:
+		p.write("return ")
+		p.expression(s.ReturnValue)
+	case *ast.ExpressionStatement:
+		p.expression(s.Expression)
+	}
+}
+
+func precedence(e ast.Expression) int {
+	switch e := e.(type) {
+	case *ast.InfixExpression:
+		return precedences[e.Token.Type]
+	case *ast.PrefixExpression:
+		return prefix
+	case *ast.CallExpression:
+		return call
+	case *ast.IndexExpression:
+		return index
+	}
+	return primary
+}
+
+// leading is the text e starts with when printed, an opening parenthesis
+// when the printer puts back one the parser dropped.
+func leading(e ast.Expression) string {
+	switch e := e.(type) {
+	case *ast.PrefixExpression:
+		return e.Operator
+	case *ast.InfixExpression:
+		if precedence(e.Left) < precedence(e) {
+			return "("
+		}
+		return leading(e.Left)
+	case *ast.CallExpression:
+		if precedence(e.Function) < call {
+			return "("
+		}
+		return leading(e.Function)
+	case *ast.IndexExpression:
+		if precedence(e.Left) < call {
+			return "("
+		}
+		return leading(e.Left)
+	case *ast.ArrayLiteral:
+		return "["
+	}
+	return ""
+}
+
+// leadingOperator is the prefix operator e starts with when printed.
+func leadingOperator(e ast.Expression) string {
+	switch e := e.(type) {
+	case *ast.PrefixExpression:
+		return e.Operator
+	case *ast.InfixExpression:
+		if precedence(e.Left) >= precedence(e) {
+			return leadingOperator(e.Left)
+		}
+	case *ast.CallExpression:
+		if precedence(e.Function) >= call {
+			return leadingOperator(e.Function)
+		}
+	case *ast.IndexExpression:
+		if precedence(e.Left) >= call {
+			return leadingOperator(e.Left)
+		}
+	}
+	return ""
+}
+
+func (p *printer) operand(e ast.Expression, parens bool) {
+	if parens {
+		p.write("(")
+		p.expression(e)
+		p.write(")")
+		return
+	}
+	p.expression(e)
+}
+
+func (p *printer) expression(e ast.Expression) {
+	switch e := e.(type) {
+	case *ast.Identifier:
+		p.write(e.Value)
+	case *ast.IntegerLiteral:
+		p.write(e.Token.Literal)
+	case *ast.Boolean:
+		p.write(e.Token.Literal)
+	case *ast.StringLiteral:
+		p.write(`"` + e.Value + `"`)
+	case *ast.ImportExpression:
+		p.write(`import "` + e.Path.Value + `"`)
+
+	case *ast.PrefixExpression:
+		p.write(e.Operator)
+		// - -x must not become --x
+		lead := leadingOperator(e.Right)
+		clash := lead != "" && strings.ContainsAny(lead[:1], "+-") && lead[0] == e.Operator[len(e.Operator)-1]
+		p.operand(e.Right, precedence(e.Right) < prefix || clash)
+
+	case *ast.InfixExpression:
+		prec := precedence(e)
+		p.operand(e.Left, precedence(e.Left) < prec)
+		p.write(" " + e.Operator + " ")
+		p.operand(e.Right, precedence(e.Right) <= prec)
+
+	case *ast.CallExpression:
+		p.operand(e.Function, precedence(e.Function) < call)
+		p.list("(", ")", e.Token, e.Arguments, nil)
+
+	case *ast.IndexExpression:
+		p.operand(e.Left, precedence(e.Left) < call)
+		p.write("[")
+		p.expression(e.Index)
+		p.write("]")
+
+	case *ast.ArrayLiteral:
+		p.list("[", "]", e.Token, e.Elements, nil)
+
+	case *ast.HashLiteral:
+		keys := e.OrderedKeys()
+		values := []ast.Expression{}
+		for _, key := range keys {
+			values = append(values, e.Pairs[key])
+		}
+		p.list("{", "}", e.Token, keys, values)
+
+	case *ast.FunctionLiteral:
+		p.write(functionHeader(e))
+		p.block(e.Body)
+
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(e.Condition)
+		p.write(") ")
+		p.block(e.Consequence)
+		if e.Alternative != nil {
+			p.write(" else ")
+			p.block(e.Alternative)
+		}
+
+	case *ast.ForLoop:
+		p.write("for (" + letHeader(&e.Declaration))
+		p.expression(e.Declaration.Value)
+		p.write("; ")
+		p.expression(e.Condition)
+		p.write("; ")
+		p.expression(e.Consequence)
+		p.write(") ")
+		p.block(e.Body)
+	}
+}
+
+func letHeader(let *ast.LetStatement) string {
+	if let.Type != nil {
+		return "let " + let.Name.Value + ": " + let.Type.String() + " = "
+	}
+	return "let " + let.Name.Value + " = "
+}
+
+func functionHeader(fn *ast.FunctionLiteral) string {
+	params := []string{}
+	for i, param := range fn.Parameters {
+		if i < len(fn.ParameterTypes) && fn.ParameterTypes[i] != nil {
+			params = append(params, param.Value+": "+fn.ParameterTypes[i].String())
+		} else {
+			params = append(params, param.Value)
+		}
+	}
+	header := "fn(" + strings.Join(params, ", ") + ") "
+	if fn.ReturnType != nil {
+		header += "-> " + fn.ReturnType.String() + " "
+	}
+	return header
+}
+
+// list prints elements between open and close, as key: value pairs when
+// there are values. It stays on one line when it fits and has no comments,
+// a trailing function literal may open its body on the same line.
+func (p *printer) list(open, close string, openTok token.Token, elements, values []ast.Expression) {
+	element := func(i int) {
+		p.expression(elements[i])
+		if values != nil {
+			p.write(": ")
+			p.expression(values[i])
+		}
+	}
+	oneLine := func() {
+		p.write(open)
+		for i := range elements {
+			if i > 0 {
+				p.write(", ")
+			}
+			element(i)
+		}
+		p.write(close)
+	}
+
+	if p.flat || len(elements) == 0 {
+		oneLine()
+		return
+	}
+	closeTok := p.closing[at(openTok)]
+	if p.commentBefore(closeTok) {
+		p.broken(open, close, closeTok, elements, element)
+		return
+	}
+	text, ok := p.measure(oneLine)
+	if ok && p.fits(text) {
+		p.write(text)
+		return
+	}
+
+	last := len(elements) - 1
+	if fn, isFn := elements[last].(*ast.FunctionLiteral); isFn && !ok && values == nil {
+		head, headOk := p.measure(func() {
+			p.write(open)
+			for i := 0; i < last; i++ {
+				element(i)
+				p.write(", ")
+			}
+		})
+		if headOk && p.fits(head+functionHeader(fn)+"{") {
+			p.write(head)
+			p.expression(fn)
+			p.write(close)
+			return
+		}
+	}
+	p.broken(open, close, closeTok, elements, element)
+}
+
+func (p *printer) broken(open, close string, closeTok token.Token, elements []ast.Expression, element func(int)) {
+	p.write(open)
+	p.indent++
+	for i := range elements {
+		p.flush(at(ast.Start(elements[i])))
+		p.newline()
+		element(i)
+		if i < len(elements)-1 {
+			p.write(",")
+		}
+	}
+	if closeTok.Line != 0 {
+		p.flush(at(closeTok))
+	}
+	p.indent--
+	p.newline()
+	p.write(close)
+}
+
+// oneLine reports whether b can be printed as { statement }. That is kept
+// for empty blocks and for a single expression or return that was already
+// written on one line.
+func (p *printer) oneLine(b *ast.BlockStatement) bool {
+	if p.commentBefore(b.Close) {
+		return false
+	}
+	switch len(b.Statements) {
+	case 0:
+		return true
+	case 1:
+		if b.Token.Line != b.Close.Line {
+			return false
+		}
+		if _, ok := b.Statements[0].(*ast.LetStatement); ok {
+			return false
+		}
+		_, ok := p.measure(func() { p.statement(b.Statements[0]) })
+		return ok
+	}
+	return false
+}
+
+func (p *printer) block(b *ast.BlockStatement) {
+	if p.oneLine(b) {
+		if len(b.Statements) == 0 {
+			p.write("{}")
+			return
+		}
+		p.write("{ ")
+		p.statement(b.Statements[0])
+		if _, ok := b.Statements[0].(*ast.ReturnStatement); ok {
+			p.write(";")
+		}
+		p.write(" }")
+		return
+	}
+	if p.flat {
+		p.failed = true
+		return
+	}
+
+	p.write("{")
+	p.indent++
+	p.fresh = true
+	p.statements(b.Statements, true)
+	p.flush(at(b.Close))
+	p.indent--
+	p.newline()
+	p.write("}")
+	p.fresh = false
+}
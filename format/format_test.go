@@ -0,0 +1,130 @@
+package format
+
+import (
+	"mokey-type/conformance"
+	"mokey-type/lexer"
+	"mokey-type/parser"
+	"strings"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=1;x+2", "let x = 1;\nx + 2;\n"},
+		{"let x = 1\n\n\n\nlet y = 2", "let x = 1;\n\nlet y = 2;\n"},
+		{"(1 + 2) * 3; 1 + (2 * 3); 1 - (2 - 3); (1 - 2) - 3", "(1 + 2) * 3;\n1 + 2 * 3;\n1 - (2 - 3);\n1 - 2 - 3;\n"},
+		{"-(-x); -(a + b); !(-x); (-f)(1); -f(1); (a + b)[0]", "-(-x);\n-(a + b);\n!-x;\n(-f)(1);\n-f(1);\n(a + b)[0];\n"},
+		{"- --x; ++(--x)", "-(--x);\n++--x;\n"},
+		{
+			"let f = fn(a,b){let c = a+b; return c;}",
+			"let f = fn(a, b) {\n\tlet c = a + b;\n\treturn c;\n};\n",
+		},
+		{"let id = fn(x) { x };", "let id = fn(x) { x };\n"},
+		{"let id = fn(x) {\n x };", "let id = fn(x) {\n\tx\n};\n"},
+		{"let nop = fn() {\n};", "let nop = fn() {};\n"},
+		{"let r = fn(x) { return x };", "let r = fn(x) { return x; };\n"},
+		{
+			"if (x > 1) { puts(x) } else { puts(0) }\nif (x) { 1 };\n-2;\nif (x) { 1 }; (2)",
+			"if (x > 1) { puts(x) } else { puts(0) }\nif (x) { 1 };\n-2;\nif (x) { 1 }\n2;\n",
+		},
+		{"if (x) { 1 }; (a + b) * c; for (let i = 0; i < 1; ++i) {}; (f)(1)", "if (x) { 1 };\n(a + b) * c;\nfor (let i = 0; i < 1; ++i) {}\nf(1);\n"},
+		{
+			"for (let i = 0; i < 10; ++i) {\nputs(i);\n}",
+			"for (let i = 0; i < 10; ++i) {\n\tputs(i)\n}\n",
+		},
+		{`{"b": 2, "a": 1}; {}; []; f()`, "{\"b\": 2, \"a\": 1};\n{};\n[];\nf();\n"},
+		{
+			`let names = ["alpha", "beta", "gamma", "delta", "epsilon", "zeta", "eta", "theta", "iota"];`,
+			"let names = [\n\t\"alpha\",\n\t\"beta\",\n\t\"gamma\",\n\t\"delta\",\n\t\"epsilon\",\n\t\"zeta\",\n\t\"eta\",\n\t\"theta\",\n\t\"iota\"\n];\n",
+		},
+		{
+			"let m = map(xs, fn(x) {\nx * 2\n});",
+			"let m = map(xs, fn(x) {\n\tx * 2\n});\n",
+		},
+		{
+			"// header\n\nlet x = 1; // one\n// before y\nlet y = [\n1, // first\n2\n];\nlet f = fn() { // body\n x // last\n // end\n};\n// footer",
+			"// header\n\nlet x = 1; // one\n// before y\nlet y = [\n\t1, // first\n\t2\n];\nlet f = fn() { // body\n\tx // last\n\t// end\n};\n// footer\n",
+		},
+		{
+			"let n:int=1;let f=fn(a:[int],b){a}; let g = fn()->{string:fn(int)->bool}{h}",
+			"let n: int = 1;\nlet f = fn(a: [int], b) { a };\nlet g = fn() -> {string: fn(int) -> bool} { h };\n",
+		},
+		{"for (let i:int = 0; i < 1; ++i) {}", "for (let i: int = 0; i < 1; ++i) {}\n"},
+		{"", ""},
+		{"\"multi\nline\"; x", "\"multi\nline\";\nx;\n"},
+	}
+
+	for _, tt := range tests {
+		got, err := Source(tt.input)
+		if err != nil {
+			t.Errorf("Source(%q) failed: %s", tt.input, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("wrong format for %q.\nwant=%q\n got=%q", tt.input, tt.expected, got)
+		}
+		checkFormatted(t, tt.input, got)
+	}
+}
+
+// checkFormatted makes sure formatting kept the meaning of input and that
+// formatting again changes nothing.
+func checkFormatted(t *testing.T, input, formatted string) {
+	t.Helper()
+	if program(input) != program(formatted) {
+		t.Errorf("formatting changed the program.\ninput=%q\n  got=%q\nwant=%s\n got=%s",
+			input, formatted, program(input), program(formatted))
+	}
+	again, err := Source(formatted)
+	if err != nil {
+		t.Fatalf("formatted source %q does not parse: %s", formatted, err)
+	}
+	if again != formatted {
+		t.Errorf("formatting is not idempotent.\nonce =%q\ntwice=%q", formatted, again)
+	}
+	l := lexer.New(input)
+	parser.New(l).ParseProgram()
+	for _, c := range l.Comments() {
+		if !strings.Contains(formatted, c.Literal) {
+			t.Errorf("comment %q was lost", c.Literal)
+		}
+	}
+}
+
+func program(input string) string {
+	return parser.New(lexer.New(input)).ParseProgram().String()
+}
+
+func TestSourceErrors(t *testing.T) {
+	_, err := Source("let = 1;")
+	if err == nil || !strings.HasPrefix(err.Error(), "parser errors:") {
+		t.Errorf("expected parser errors, got %v", err)
+	}
+}
+
+func TestConformanceInputs(t *testing.T) {
+	tables := [][]conformance.Case{}
+	for _, suite := range conformance.Suites {
+		tables = append(tables, suite.Cases)
+	}
+	for _, suite := range conformance.EvaluatorSuites {
+		tables = append(tables, suite.Cases)
+	}
+	for _, cases := range tables {
+		for _, tt := range cases {
+			p := parser.New(lexer.New(tt.Input))
+			p.ParseProgram()
+			if len(p.Errors()) != 0 {
+				continue
+			}
+			formatted, err := Source(tt.Input)
+			if err != nil {
+				t.Fatalf("Source(%q) failed: %s", tt.Input, err)
+			}
+			checkFormatted(t, tt.Input, formatted)
+		}
+	}
+}
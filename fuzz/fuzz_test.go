@@ -0,0 +1,101 @@
+package fuzz
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"mokey-type/ast"
+	"mokey-type/conformance"
+	"mokey-type/evaluator"
+	"mokey-type/format"
+	"mokey-type/object"
+	"mokey-type/vm"
+	"testing"
+)
+
+// outcome is what a program did on one engine and what it printed, err is
+// the category of its error.
+type outcome struct {
+	value  string
+	err    string
+	panic  interface{}
+	stdout string
+}
+
+func (o outcome) String() string {
+	result := o.value
+	switch {
+	case o.panic != nil:
+		result = fmt.Sprintf("panic: %v", o.panic)
+	case o.err != "":
+		result = "error: " + o.err
+	}
+	if o.stdout != "" {
+		return fmt.Sprintf("%s, printed %q", result, o.stdout)
+	}
+	return result
+}
+
+func run(program *ast.Program, engine conformance.Runner) (o outcome) {
+	var stdout bytes.Buffer
+	defer func(previous io.Writer) {
+		object.Stdout = previous
+		if r := recover(); r != nil {
+			o = outcome{panic: r}
+		}
+		o.stdout = stdout.String()
+	}(object.Stdout)
+	object.Stdout = &stdout
+
+	result, err := engine(program)
+	if errObj, ok := result.(*object.Error); ok && err == nil {
+		err = fmt.Errorf("%s", errObj.Message)
+	}
+	if err != nil {
+		return outcome{err: object.ErrorCategory(err.Error())}
+	}
+	return outcome{value: object.Canonical(result)}
+}
+
+// FuzzEngines runs generated programs on the evaluator and the vm and fails
+// when their results, printed output or kinds of error don't agree. go test
+// runs the seeds and the inputs saved in testdata/fuzz/FuzzEngines, go test
+// -fuzz=FuzzEngines ./fuzz looks for new ones and saves the failing input it
+// minimized there.
+func FuzzEngines(f *testing.F) {
+	f.Add([]byte{})
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		data := make([]byte, r.Intn(256))
+		r.Read(data)
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		program := Generate(data)
+		evaluated := run(program, evaluator.RunProgram)
+		executed := run(program, vm.RunProgram)
+		if evaluated != executed || evaluated.panic != nil {
+			t.Fatalf("engines disagree on\n%s\nevaluator: %s\nvm:        %s",
+				format.Program(program), evaluated, executed)
+		}
+	})
+}
+
+// TestGeneratedSource checks that the printed program parses back to the
+// program that was generated, so failures can be reproduced from their
+// source.
+func TestGeneratedSource(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		data := make([]byte, r.Intn(512))
+		r.Read(data)
+		program := Generate(data)
+		source := format.Program(program)
+		reparsed := conformance.Parse(source)
+		if reparsed.String() != program.String() {
+			t.Fatalf("printed program parses differently:\n%s\ngot=%s\nwant=%s",
+				source, reparsed.String(), program.String())
+		}
+	}
+}
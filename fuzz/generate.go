@@ -0,0 +1,562 @@
+// Package fuzz generates random programs for differential testing of the
+// execution engines. Programs are built from the ast directly, only use
+// variables that are in scope, never recurse and only loop a bounded
+// number of times, so every program terminates.
+package fuzz
+
+import (
+	"mokey-type/ast"
+	"mokey-type/token"
+	"strconv"
+)
+
+// kind is the type of a generated expression. Arrays hold integers, hashes
+// map strings to integers and functions take and return integers, which
+// keeps the generator simple while covering every object the engines have.
+type kind int
+
+const (
+	intKind kind = iota
+	boolKind
+	stringKind
+	arrayKind
+	hashKind
+	fnKind
+	kinds
+)
+
+const (
+	maxDepth      = 4
+	maxStatements = 6
+	maxLoopDepth  = 2
+	maxIterations = 5
+	maxElements   = 4
+	maxParameters = 2
+	// maxCost bounds the work of a program and of every function, loops and
+	// calls multiply it quickly
+	maxCost = 10000
+)
+
+type variable struct {
+	name string
+	kind kind
+	// arity is the number of parameters of a function and cost the work
+	// of calling it
+	arity int
+	cost  int
+	// counter is true for the variable a for loop counts with
+	counter bool
+}
+
+type generator struct {
+	data  []byte
+	scope []variable
+	names int
+	depth int
+	loops int
+	// cost estimates the work done by the program or function being
+	// generated, every expression adds weight, the product of the
+	// iterations of the loops around it
+	cost   int
+	weight int
+	// returns is true while generating a function body, return statements
+	// are only generated there
+	returns bool
+	// local is where the variables of the function being generated start
+	// in scope
+	local int
+}
+
+// Generate builds a program from data. Every byte picks one choice of the
+// grammar, when data runs out the simplest choice is taken, so any data,
+// even none, gives a valid program and small changes to data give small
+// changes to the program.
+func Generate(data []byte) *ast.Program {
+	g := &generator{data: data, weight: 1}
+	program := &ast.Program{}
+	program.Statements = g.statements()
+	program.Statements = append(program.Statements, expressionStatement(g.expression(g.kind())))
+	return program
+}
+
+// choose returns a number below n taken from the data.
+func (g *generator) choose(n int) int {
+	if len(g.data) == 0 {
+		return 0
+	}
+	b := g.data[0]
+	g.data = g.data[1:]
+	return int(b) % n
+}
+
+func (g *generator) kind() kind {
+	return kind(g.choose(int(kinds)))
+}
+
+// name returns a fresh variable name. Identifiers can't hold digits, the
+// count is written in letters after an underscore, which keeps clear of
+// keywords and builtins.
+func (g *generator) name(prefix string) string {
+	suffix := ""
+	for n := g.names; ; n = n/26 - 1 {
+		suffix = string(rune('a'+n%26)) + suffix
+		if n < 26 {
+			break
+		}
+	}
+	g.names++
+	return prefix + "_" + suffix
+}
+
+func (g *generator) statements() []ast.Statement {
+	statements := []ast.Statement{}
+	for len(statements) < maxStatements && g.choose(3) != 0 {
+		statements = append(statements, g.statement())
+	}
+	return statements
+}
+
+func (g *generator) statement() ast.Statement {
+	switch g.choose(4) {
+	case 1:
+		if g.loops < maxLoopDepth {
+			return expressionStatement(g.forLoop())
+		}
+	case 2:
+		return expressionStatement(g.expression(g.kind()))
+	case 3:
+		if g.returns {
+			return g.returnStatement()
+		}
+	}
+	return g.let()
+}
+
+func (g *generator) let() ast.Statement {
+	k := g.kind()
+	var value ast.Expression
+	arity, cost := 0, 0
+	if k == fnKind {
+		fn, fnCost := g.function()
+		arity, cost = len(fn.Parameters), fnCost
+		value = fn
+	} else {
+		value = g.expression(k)
+	}
+	// now and then a variable of the function being generated is defined
+	// again with a value of its kind, which can use the value it replaces.
+	// Functions are not, the calls generated before counted their cost, and
+	// counters neither, so the loops still end. An outer variable is not
+	// either: the vm binds a name to the variable defined before it in the
+	// source and the evaluator to the one set last, which differ in a loop.
+	name := ""
+	if k != fnKind && g.choose(4) == 0 {
+		if v, ok := g.variable(k); ok && !v.counter && g.defines(v.name) {
+			name = v.name
+		}
+	}
+	if name == "" {
+		name = g.name("v")
+		if fn, ok := value.(*ast.FunctionLiteral); ok {
+			fn.Name = name
+		}
+		g.scope = append(g.scope, variable{name: name, kind: k, arity: arity, cost: cost})
+	}
+	return &ast.LetStatement{
+		Token: token.Token{Type: token.LET, Literal: "let"},
+		Name:  identifier(name),
+		Value: value,
+	}
+}
+
+// returnStatement returns early from the function being generated, behind
+// a condition so the rest of the body is still reachable.
+func (g *generator) returnStatement() ast.Statement {
+	ret := &ast.ReturnStatement{
+		Token:       token.Token{Type: token.RETURN, Literal: "return"},
+		ReturnValue: g.expression(intKind),
+	}
+	return expressionStatement(&ast.IfExpression{
+		Token:       token.Token{Type: token.IF, Literal: "if"},
+		Condition:   g.expression(boolKind),
+		Consequence: block(ret),
+	})
+}
+
+// forLoop counts a fresh variable up to a small constant, nothing else can
+// change it since counters are never defined again.
+func (g *generator) forLoop() ast.Expression {
+	name := g.name("i")
+	iterations := int64(g.choose(maxIterations + 1))
+	if g.cost >= maxCost {
+		iterations = 0
+	}
+
+	outer, weight := len(g.scope), g.weight
+	g.loops++
+	g.weight *= int(iterations) + 1
+	g.scope = append(g.scope, variable{name: name, kind: intKind, counter: true})
+	body := g.statements()
+	g.loops--
+	g.weight = weight
+	g.scope = g.scope[:outer]
+
+	return &ast.ForLoop{
+		Token: token.Token{Type: token.FOR, Literal: "for"},
+		Declaration: ast.LetStatement{
+			Token: token.Token{Type: token.LET, Literal: "let"},
+			Name:  identifier(name),
+			Value: integer(0),
+		},
+		Condition:   infix(identifier(name), "<", integer(iterations)),
+		Consequence: prefix("++", identifier(name)),
+		Body:        block(body...),
+	}
+}
+
+// function generates a function literal whose body can use the parameters
+// and every variable in scope, but not the function itself. It returns the
+// cost of a call too.
+func (g *generator) function() (*ast.FunctionLiteral, int) {
+	outer, returns, loops, cost, weight, local := len(g.scope), g.returns, g.loops, g.cost, g.weight, g.local
+	g.returns, g.loops, g.cost, g.weight, g.local = true, 0, 0, 1, outer
+
+	parameters := []*ast.Identifier{}
+	for i := g.choose(maxParameters + 1); i > 0; i-- {
+		name := g.name("p")
+		parameters = append(parameters, identifier(name))
+		g.scope = append(g.scope, variable{name: name, kind: intKind})
+	}
+	body := g.statements()
+	body = append(body, expressionStatement(g.expression(intKind)))
+
+	g.scope = g.scope[:outer]
+	fnCost := g.cost
+	g.returns, g.loops, g.cost, g.weight, g.local = returns, loops, cost, weight, local
+	return &ast.FunctionLiteral{
+		Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+		Parameters: parameters,
+		Body:       block(body...),
+	}, fnCost
+}
+
+// expression generates an expression of kind k. Now and then an operand of
+// another kind is used instead, so the engines' type errors are compared
+// too.
+func (g *generator) expression(k kind) ast.Expression {
+	g.depth++
+	defer func() { g.depth-- }()
+	g.cost += g.weight
+
+	choice := 0
+	if g.depth < maxDepth && g.cost < maxCost {
+		choice = g.choose(8)
+	}
+	switch choice {
+	case 1:
+		if v, ok := g.variable(k); ok {
+			return identifier(v.name)
+		}
+	case 2:
+		return g.conditional(k)
+	case 3:
+		if k == intKind {
+			return g.call()
+		}
+	}
+	if choice >= 4 {
+		switch k {
+		case intKind:
+			return g.integerExpression()
+		case boolKind:
+			return g.booleanExpression()
+		case stringKind:
+			return g.stringExpression()
+		case arrayKind:
+			return g.arrayExpression()
+		case hashKind:
+			return g.hash()
+		case fnKind:
+			fn, _ := g.function()
+			return fn
+		}
+	}
+	return g.literal(k)
+}
+
+// operand is the expression of kind k used by an operator, or sometimes one
+// of another kind. Functions are left out, the engines print them
+// differently and join would show it.
+func (g *generator) operand(k kind) ast.Expression {
+	if g.choose(16) == 15 {
+		k = kind(g.choose(int(fnKind)))
+	}
+	return g.expression(k)
+}
+
+func (g *generator) literal(k kind) ast.Expression {
+	switch k {
+	case boolKind:
+		return boolean(g.choose(2) == 1)
+	case stringKind:
+		return str(g.string())
+	case arrayKind:
+		return g.array()
+	case hashKind:
+		return g.hash()
+	case fnKind:
+		fn, _ := g.function()
+		return fn
+	}
+	return integer(int64(g.choose(10)))
+}
+
+func (g *generator) string() string {
+	words := []string{"", "a", "b", "ab", " a ", "mokey", "Type"}
+	return words[g.choose(len(words))]
+}
+
+func (g *generator) array() ast.Expression {
+	elements := []ast.Expression{}
+	for i := g.choose(maxElements + 1); i > 0; i-- {
+		elements = append(elements, g.expression(intKind))
+	}
+	return &ast.ArrayLiteral{
+		Token:    token.Token{Type: token.LBRACKET, Literal: "["},
+		Elements: elements,
+	}
+}
+
+func (g *generator) hash() ast.Expression {
+	hash := &ast.HashLiteral{
+		Token: token.Token{Type: token.LBRACE, Literal: "{"},
+		Pairs: map[ast.Expression]ast.Expression{},
+	}
+	// the engines build hashes in different orders, a repeated key could end
+	// up with either value
+	seen := map[string]bool{}
+	for i := g.choose(maxElements + 1); i > 0; i-- {
+		word := g.string()
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		key := str(word)
+		hash.Keys = append(hash.Keys, key)
+		hash.Pairs[key] = g.expression(intKind)
+	}
+	return hash
+}
+
+// variable picks a variable of kind k from the scope.
+func (g *generator) variable(k kind) (variable, bool) {
+	candidates := []variable{}
+	for _, v := range g.scope {
+		if v.kind == k {
+			candidates = append(candidates, v)
+		}
+	}
+	if len(candidates) == 0 {
+		return variable{}, false
+	}
+	return candidates[g.choose(len(candidates))], true
+}
+
+// defines reports whether the function being generated has a variable
+// called name.
+func (g *generator) defines(name string) bool {
+	for _, v := range g.scope[g.local:] {
+		if v.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *generator) conditional(k kind) ast.Expression {
+	ifExpression := &ast.IfExpression{
+		Token:       token.Token{Type: token.IF, Literal: "if"},
+		Condition:   g.expression(boolKind),
+		Consequence: g.branch(k),
+	}
+	if g.choose(4) != 0 {
+		ifExpression.Alternative = g.branch(k)
+	}
+	return ifExpression
+}
+
+// branch is a block ending in an expression of kind k, its variables go out
+// of scope with it since the branch might not run.
+func (g *generator) branch(k kind) *ast.BlockStatement {
+	outer := len(g.scope)
+	statements := g.statements()
+	statements = append(statements, expressionStatement(g.expression(k)))
+	g.scope = g.scope[:outer]
+	return block(statements...)
+}
+
+// call calls a function in scope or a function literal with integer
+// arguments, or gives a literal when the call would cost too much.
+func (g *generator) call() ast.Expression {
+	var function ast.Expression
+	arity, cost := 0, 0
+	if v, ok := g.variable(fnKind); ok && g.choose(2) == 0 {
+		function, arity, cost = identifier(v.name), v.arity, v.cost
+	} else {
+		fn, fnCost := g.function()
+		function, arity, cost = fn, len(fn.Parameters), fnCost
+	}
+	if g.cost+cost*g.weight > maxCost {
+		return g.literal(intKind)
+	}
+	g.cost += cost * g.weight
+	arguments := []ast.Expression{}
+	for i := 0; i < arity; i++ {
+		arguments = append(arguments, g.operand(intKind))
+	}
+	return call(function, arguments...)
+}
+
+func (g *generator) integerExpression() ast.Expression {
+	switch g.choose(10) {
+	case 1:
+		return prefix("-", g.operand(intKind))
+	case 2:
+		return prefix([]string{"++", "--"}[g.choose(2)], g.operand(intKind))
+	case 3:
+		return infix(g.operand(intKind), "/", g.operand(intKind))
+	case 4:
+		return builtin("len", g.operand([]kind{stringKind, arrayKind}[g.choose(2)]))
+	case 5:
+		return index(g.operand(arrayKind), g.operand(intKind))
+	case 6:
+		return index(g.operand(hashKind), g.operand(stringKind))
+	case 7:
+		return builtin([]string{"first", "last"}[g.choose(2)], g.operand(arrayKind))
+	case 8:
+		return builtin("findIndex", g.operand(arrayKind), g.operand(intKind))
+	case 9:
+		return g.traced(g.operand(intKind))
+	}
+	operators := []string{"+", "-", "*"}
+	return infix(g.operand(intKind), operators[g.choose(len(operators))], g.operand(intKind))
+}
+
+// traced puts the value of an integer expression before giving it, the
+// engines only print the same when they evaluate operands in the same order.
+func (g *generator) traced(value ast.Expression) ast.Expression {
+	name := g.name("t")
+	trace := &ast.FunctionLiteral{
+		Token:      token.Token{Type: token.FUNCTION, Literal: "fn"},
+		Parameters: []*ast.Identifier{identifier(name)},
+		Body:       block(expressionStatement(builtin("puts", identifier(name))), expressionStatement(identifier(name))),
+	}
+	return call(trace, value)
+}
+
+func (g *generator) booleanExpression() ast.Expression {
+	switch g.choose(5) {
+	case 1:
+		return prefix("!", g.operand(g.kind()))
+	case 2:
+		operators := []string{"==", "!="}
+		return infix(g.operand(boolKind), operators[g.choose(len(operators))], g.operand(boolKind))
+	case 3:
+		return builtin("contains", g.operand(stringKind), g.operand(stringKind))
+	case 4:
+		return builtin("contains", g.operand(arrayKind), g.operand(intKind))
+	}
+	operators := []string{"<", ">", "==", "!="}
+	return infix(g.operand(intKind), operators[g.choose(len(operators))], g.operand(intKind))
+}
+
+func (g *generator) stringExpression() ast.Expression {
+	switch g.choose(5) {
+	case 1:
+		name := []string{"toUpper", "toLower", "trim", "trimLeft", "trimRight", "reverse"}[g.choose(6)]
+		return builtin(name, g.operand(stringKind))
+	case 2:
+		return builtin("typeOf", g.expression(kind(g.choose(int(fnKind)))))
+	case 3:
+		return builtin("join", g.operand(arrayKind), g.operand(stringKind))
+	case 4:
+		return builtin("replace", g.operand(stringKind), g.operand(stringKind), g.operand(stringKind))
+	}
+	return infix(g.operand(stringKind), "+", g.operand(stringKind))
+}
+
+func (g *generator) arrayExpression() ast.Expression {
+	switch g.choose(4) {
+	case 1:
+		return builtin("push", g.operand(arrayKind), g.operand(intKind))
+	case 2:
+		name := []string{"rest", "pop", "reverse"}[g.choose(3)]
+		return builtin(name, g.operand(arrayKind))
+	case 3:
+		return builtin("merge", g.operand(arrayKind), g.operand(arrayKind))
+	}
+	return g.array()
+}
+
+func identifier(name string) *ast.Identifier {
+	return &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: name}, Value: name}
+}
+
+func integer(value int64) *ast.IntegerLiteral {
+	return &ast.IntegerLiteral{Token: token.Token{Type: token.INT, Literal: strconv.FormatInt(value, 10)}, Value: value}
+}
+
+func boolean(value bool) *ast.Boolean {
+	if value {
+		return &ast.Boolean{Token: token.Token{Type: token.TRUE, Literal: "true"}, Value: true}
+	}
+	return &ast.Boolean{Token: token.Token{Type: token.FALSE, Literal: "false"}, Value: false}
+}
+
+func str(value string) *ast.StringLiteral {
+	return &ast.StringLiteral{Token: token.Token{Type: token.STRING, Literal: value}, Value: value}
+}
+
+func prefix(operator string, right ast.Expression) *ast.PrefixExpression {
+	return &ast.PrefixExpression{
+		Token:    token.Token{Type: token.TokenType(operator), Literal: operator},
+		Operator: operator,
+		Right:    right,
+	}
+}
+
+func infix(left ast.Expression, operator string, right ast.Expression) *ast.InfixExpression {
+	return &ast.InfixExpression{
+		Token:    token.Token{Type: token.TokenType(operator), Literal: operator},
+		Left:     left,
+		Operator: operator,
+		Right:    right,
+	}
+}
+
+func index(left, i ast.Expression) *ast.IndexExpression {
+	return &ast.IndexExpression{Token: token.Token{Type: token.LBRACKET, Literal: "["}, Left: left, Index: i}
+}
+
+func call(function ast.Expression, arguments ...ast.Expression) *ast.CallExpression {
+	return &ast.CallExpression{
+		Token:     token.Token{Type: token.LPAREN, Literal: "("},
+		Function:  function,
+		Arguments: arguments,
+	}
+}
+
+func builtin(name string, arguments ...ast.Expression) *ast.CallExpression {
+	return call(identifier(name), arguments...)
+}
+
+func block(statements ...ast.Statement) *ast.BlockStatement {
+	return &ast.BlockStatement{
+		Token:      token.Token{Type: token.LBRACE, Literal: "{"},
+		Statements: statements,
+	}
+}
+
+func expressionStatement(expression ast.Expression) *ast.ExpressionStatement {
+	return &ast.ExpressionStatement{Expression: expression}
+}
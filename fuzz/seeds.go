@@ -0,0 +1,38 @@
+package fuzz
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// Seeds adds every string literal in the go files matching patterns to the
+// seed corpus of f, the inputs of the existing tests make a good start for
+// the fuzz targets of the lexer, the parser and the compiler.
+func Seeds(f *testing.F, patterns ...string) {
+	f.Helper()
+	fset := token.NewFileSet()
+	for _, pattern := range patterns {
+		paths, err := filepath.Glob(pattern)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, path := range paths {
+			file, err := parser.ParseFile(fset, path, nil, 0)
+			if err != nil {
+				f.Fatal(err)
+			}
+			ast.Inspect(file, func(n ast.Node) bool {
+				if lit, ok := n.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+					if s, err := strconv.Unquote(lit.Value); err == nil {
+						f.Add(s)
+					}
+				}
+				return true
+			})
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mokey-type/types"
+	"os"
+)
+
+const inferUsage = "mokey-type infer [-signatures] file.mk..."
+
+const inferDoc = `Infers the types of the files without annotations, hindley-milner style,
+functions get generic types, and reports where a value is used at a type it
+can't have. -signatures prints the type of every top-level let, like
+let apply: fn(fn(a) -> b, a) -> b.`
+
+// inferFiles infers the types of source files without annotations, it
+// reports where values are used at types they can't have.
+func inferFiles(args []string) error {
+	flags := flag.NewFlagSet("infer", flag.ExitOnError)
+	signatures := flags.Bool("signatures", false, "print the inferred type of every top-level let")
+	usage(flags, inferUsage, inferDoc)
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: %s", inferUsage)
+	}
+
+	failed := 0
+	for _, path := range flags.Args() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		program, err := parseSource(path, string(source))
+		if err != nil {
+			return err
+		}
+		inference := types.Infer(program)
+		for _, err := range inference.Errors {
+			fmt.Printf("%s:%d:%d: %s\n", path, err.Token.Line, err.Token.Column, err)
+			failed++
+		}
+		if *signatures {
+			for _, b := range inference.Bindings {
+				fmt.Printf("%s:%d:%d: let %s: %s\n", path, b.Name.Token.Line, b.Name.Token.Column, b.Name.Value, types.Signature(b.Type))
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("infer: %d error(s)", failed)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"mokey-type/token"
+	"strings"
 )
 
 type Lexer struct {
@@ -9,15 +10,24 @@ type Lexer struct {
 	position     int // current position in input (current char)
 	readPosition int // current reading position in input (after current char)
 	ch           byte
+	line         int // line of the current char
+	column       int // column of the current char
+	comments     []token.Token
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.ReadChar()
 	return l
 }
 
 func (l *Lexer) ReadChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
@@ -31,6 +41,7 @@ func (l *Lexer) NextToken() token.Token {
 	var tok token.Token
 
 	l.skipWhitespace()
+	line, column := l.line, l.column
 
 	switch l.ch {
 	case '=':
@@ -62,6 +73,10 @@ func (l *Lexer) NextToken() token.Token {
 			ch := l.ch
 			l.ReadChar()
 			tok = token.Token{Type: token.DECREMENT, Literal: string(ch) + string(l.ch)}
+		} else if l.peekChar() == '>' {
+			ch := l.ch
+			l.ReadChar()
+			tok = token.Token{Type: token.ARROW, Literal: string(ch) + string(l.ch)}
 		} else {
 			tok = token.NewToken(token.MINUS, l.ch)
 		}
@@ -113,10 +128,12 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Line, tok.Column = line, column
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Type = token.INT
 			tok.Literal = l.readNumber()
+			tok.Line, tok.Column = line, column
 			return tok
 		} else {
 			tok = token.NewToken(token.ILLEGAL, l.ch)
@@ -124,6 +141,7 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.ReadChar()
+	tok.Line, tok.Column = line, column
 	return tok
 }
 
@@ -143,10 +161,34 @@ func (l *Lexer) readNumber() string {
 	return l.input[position:l.position]
 }
 
+// skipWhitespace also skips // comments, they are kept aside for tools that
+// need them, like the formatter.
 func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r':
+			l.ReadChar()
+		case l.ch == '/' && l.peekChar() == '/':
+			l.readComment()
+		default:
+			return
+		}
+	}
+}
+
+func (l *Lexer) readComment() {
+	tok := token.Token{Type: token.COMMENT, Line: l.line, Column: l.column}
+	position := l.position
+	for l.ch != '\n' && l.ch != 0 {
 		l.ReadChar()
 	}
+	tok.Literal = strings.TrimRight(l.input[position:l.position], " \t\r")
+	l.comments = append(l.comments, tok)
+}
+
+// Comments returns the comments read so far.
+func (l *Lexer) Comments() []token.Token {
+	return l.comments
 }
 
 func (l *Lexer) peekChar() byte {
@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"fmt"
+	"mokey-type/fuzz"
 	"mokey-type/token"
 	"testing"
 )
@@ -160,3 +161,83 @@ func TestNewToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenPositions(t *testing.T) {
+	input := `let five = 5;
+  "two words" != fn
+`
+	tests := []struct {
+		literal string
+		line    int
+		column  int
+	}{
+		{"let", 1, 1},
+		{"five", 1, 5},
+		{"=", 1, 10},
+		{"5", 1, 12},
+		{";", 1, 13},
+		{"two words", 2, 3},
+		{"!=", 2, 15},
+		{"fn", 2, 18},
+		{"", 3, 1},
+	}
+
+	l := New(input)
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Literal != tt.literal {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.literal, tok.Literal)
+		}
+		if tok.Line != tt.line || tok.Column != tt.column {
+			t.Errorf("tests[%d] - %q at wrong position. expected=%d:%d, got=%d:%d",
+				i, tt.literal, tt.line, tt.column, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// header
+let x = 5; // five
+x / 2 //
+"// not a comment"`
+
+	expected := []token.TokenType{
+		token.LET, token.IDENT, token.ASSIGN, token.INT, token.SEMICOLON,
+		token.IDENT, token.SLASH, token.INT, token.STRING, token.EOF,
+	}
+	l := New(input)
+	for i, tt := range expected {
+		tok := l.NextToken()
+		if tok.Type != tt {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt, tok.Type)
+		}
+	}
+
+	comments := []token.Token{
+		{Type: token.COMMENT, Literal: "// header", Line: 1, Column: 1},
+		{Type: token.COMMENT, Literal: "// five", Line: 2, Column: 12},
+		{Type: token.COMMENT, Literal: "//", Line: 3, Column: 7},
+	}
+	if len(l.Comments()) != len(comments) {
+		t.Fatalf("wrong comments. expected=%v, got=%v", comments, l.Comments())
+	}
+	for i, c := range comments {
+		if l.Comments()[i] != c {
+			t.Errorf("comments[%d] wrong. expected=%+v, got=%+v", i, c, l.Comments()[i])
+		}
+	}
+}
+
+// FuzzLexer checks that the lexer reaches EOF on any input, every token
+// but EOF takes at least one byte.
+func FuzzLexer(f *testing.F) {
+	fuzz.Seeds(f, "*_test.go", "../conformance/*.go")
+	f.Fuzz(func(t *testing.T, input string) {
+		l := New(input)
+		for i := 0; l.NextToken().Type != token.EOF; i++ {
+			if i > len(input) {
+				t.Fatalf("no EOF after %d tokens. input=%q", i, input)
+			}
+		}
+	})
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"mokey-type/lint"
+	"os"
+	"strings"
+)
+
+const lintUsage = "mokey-type lint [-format text|json] [-enable rules] [-disable rules] [-severity rule=level] [-fail level] file.mk..."
+
+const lintDoc = `Warns about likely mistakes in the files: unused variables, shadowed
+parameters, unreachable code, builtins called with the wrong number of
+arguments and comparisons like x == x. -list prints the rules with their
+severity. It fails when a finding is at or above the -fail severity, so CI
+can gate on it.`
+
+// lintFiles reports likely mistakes in source files. It fails when there
+// are findings at or above the -fail severity, so CI can gate on it.
+func lintFiles(args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	output := flags.String("format", "text", "output format, text or json")
+	enable := flags.String("enable", "", "comma separated rules to run instead of all of them")
+	disable := flags.String("disable", "", "comma separated rules to skip")
+	severities := flags.String("severity", "", "comma separated rule=severity overrides, like unused-variable=error")
+	fail := flags.String("fail", "warning", "lowest severity that makes lint fail")
+	list := flags.Bool("list", false, "list the rules and exit")
+	usage(flags, lintUsage, lintDoc)
+	flags.Parse(args)
+
+	if *list {
+		for _, rule := range lint.Rules {
+			fmt.Printf("%-20s %-8s %s\n", rule.Name, rule.Severity, rule.Description)
+		}
+		return nil
+	}
+	if flags.NArg() == 0 || *output != "text" && *output != "json" {
+		return fmt.Errorf("usage: %s", lintUsage)
+	}
+
+	rules, err := selectRules(*enable, *disable, *severities)
+	if err != nil {
+		return err
+	}
+	failAt, err := lint.ParseSeverity(*fail)
+	if err != nil {
+		return err
+	}
+
+	findings := []lint.Finding{}
+	for _, path := range flags.Args() {
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		program, err := parseSource(path, string(source))
+		if err != nil {
+			return err
+		}
+		for _, f := range lint.Lint(program, rules) {
+			f.File = path
+			findings = append(findings, f)
+		}
+	}
+
+	if *output == "json" {
+		out, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+	} else {
+		for _, f := range findings {
+			fmt.Println(f)
+		}
+	}
+
+	failed := 0
+	for _, f := range findings {
+		if f.Severity >= failAt {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("lint: %d finding(s) at %s or above", failed, failAt)
+	}
+	return nil
+}
+
+func selectRules(enable, disable, severities string) ([]lint.Rule, error) {
+	rules := []lint.Rule{}
+	if enable == "" {
+		rules = append(rules, lint.Rules...)
+	} else {
+		for _, name := range strings.Split(enable, ",") {
+			rule, ok := lint.Lookup(name)
+			if !ok {
+				return nil, fmt.Errorf("unknown rule %q", name)
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	if disable != "" {
+		for _, name := range strings.Split(disable, ",") {
+			if _, ok := lint.Lookup(name); !ok {
+				return nil, fmt.Errorf("unknown rule %q", name)
+			}
+			for i := 0; i < len(rules); i++ {
+				if rules[i].Name == name {
+					rules = append(rules[:i], rules[i+1:]...)
+					i--
+				}
+			}
+		}
+	}
+
+	if severities != "" {
+		for _, override := range strings.Split(severities, ",") {
+			name, level, ok := strings.Cut(override, "=")
+			if !ok {
+				return nil, fmt.Errorf("bad severity %q, want rule=level", override)
+			}
+			if _, ok := lint.Lookup(name); !ok {
+				return nil, fmt.Errorf("unknown rule %q", name)
+			}
+			severity, err := lint.ParseSeverity(level)
+			if err != nil {
+				return nil, err
+			}
+			for i := range rules {
+				if rules[i].Name == name {
+					rules[i].Severity = severity
+				}
+			}
+		}
+	}
+	return rules, nil
+}
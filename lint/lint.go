@@ -0,0 +1,110 @@
+// Package lint finds code that compiles but is most likely wrong. Every
+// rule walks the ast, the ones about names use the symbol index the
+// compiler package builds.
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"mokey-type/ast"
+	"mokey-type/compiler"
+	"mokey-type/token"
+	"sort"
+)
+
+type Severity int
+
+const (
+	Info Severity = iota
+	Warning
+	Error
+)
+
+var severityNames = []string{"info", "warning", "error"}
+
+func (s Severity) String() string {
+	if s < Info || s > Error {
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+	return severityNames[s]
+}
+
+func ParseSeverity(name string) (Severity, error) {
+	for i, n := range severityNames {
+		if n == name {
+			return Severity(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown severity %q, want info, warning or error", name)
+}
+
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+type Finding struct {
+	File     string   `json:"file,omitempty"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Severity Severity `json:"severity"`
+	Rule     string   `json:"rule"`
+	Message  string   `json:"message"`
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s: %s (%s)", f.File, f.Line, f.Column, f.Severity, f.Message, f.Rule)
+}
+
+type Rule struct {
+	Name        string
+	Description string
+	Severity    Severity
+	check       func(p *pass)
+}
+
+// pass is one rule running over one program.
+type pass struct {
+	rule     Rule
+	program  *ast.Program
+	index    *compiler.Index
+	findings []Finding
+}
+
+func (p *pass) report(tok token.Token, format string, a ...interface{}) {
+	p.findings = append(p.findings, Finding{
+		Line:     tok.Line,
+		Column:   tok.Column,
+		Severity: p.rule.Severity,
+		Rule:     p.rule.Name,
+		Message:  fmt.Sprintf(format, a...),
+	})
+}
+
+// Lookup returns the default rule called name.
+func Lookup(name string) (Rule, bool) {
+	for _, rule := range Rules {
+		if rule.Name == name {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Lint runs rules over program and returns the findings by position.
+func Lint(program *ast.Program, rules []Rule) []Finding {
+	index := compiler.Resolve(program)
+	findings := []Finding{}
+	for _, rule := range rules {
+		p := &pass{rule: rule, program: program, index: index}
+		rule.check(p)
+		findings = append(findings, p.findings...)
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		a, b := findings[i], findings[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return findings
+}
@@ -0,0 +1,128 @@
+package lint
+
+import (
+	"encoding/json"
+	"mokey-type/lexer"
+	"mokey-type/object"
+	"mokey-type/parser"
+	"testing"
+)
+
+func lint(t *testing.T, input string, rules []Rule) []Finding {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return Lint(program, rules)
+}
+
+func rule(t *testing.T, name string) []Rule {
+	t.Helper()
+	r, ok := Lookup(name)
+	if !ok {
+		t.Fatalf("no rule %q", name)
+	}
+	return []Rule{r}
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		rule     string
+		input    string
+		expected []string
+	}{
+		{"unused-variable", "let x = 1; let y = 2; puts(y)", []string{
+			":1:5: warning: x is declared but never used (unused-variable)",
+		}},
+		{"unused-variable", "let _x = 1; let f = fn(a) { let b = a; 1 }; f(1)", []string{
+			":1:33: warning: b is declared but never used (unused-variable)",
+		}},
+		{"unused-variable", "for (let i = 0; i < 3; ++i) { puts(i) }", nil},
+		{"shadowed-parameter", "fn(a, b, a) { let b = 1; fn(c) { let a = 2; a } }", []string{
+			":1:10: warning: parameter a is declared twice (shadowed-parameter)",
+			":1:19: warning: let b shadows the parameter b (shadowed-parameter)",
+		}},
+		{"shadowed-parameter", "let a = 1; fn(x) { fn(a) { let x = a; x } }", nil},
+		{"unreachable-code", "fn() { return 1; puts(2); puts(3) }; if (true) { return 1 } else { 2 }", []string{
+			":1:18: warning: unreachable code after return (unreachable-code)",
+		}},
+		{"builtin-arity", `len(); len([1]); join([1], ","); join("a", "b", "c", "d"); puts(); push([1]); let len = fn() { 1 }; len()`, []string{
+			":1:1: error: len takes 1 argument, got 0 (builtin-arity)",
+			":1:34: error: join takes 2 or 3 arguments, got 4 (builtin-arity)",
+			":1:68: error: push takes 2 arguments, got 1 (builtin-arity)",
+		}},
+		{"self-comparison", "let x = 1; x == x; x + 1 != x + 1; x < 2; f(x) == f(x); [1] == [1]; x - x", []string{
+			":1:12: warning: (x == x) is always true (self-comparison)",
+			":1:20: warning: ((x + 1) != (x + 1)) is always false (self-comparison)",
+		}},
+	}
+
+	for _, tt := range tests {
+		findings := lint(t, tt.input, rule(t, tt.rule))
+		if len(findings) != len(tt.expected) {
+			t.Errorf("wrong findings for %q. want=%q, got=%v", tt.input, tt.expected, findings)
+			continue
+		}
+		for i, f := range findings {
+			if f.String() != tt.expected[i] {
+				t.Errorf("wrong finding for %q.\nwant=%q\n got=%q", tt.input, tt.expected[i], f.String())
+			}
+		}
+	}
+}
+
+func TestLintOrderAndSeverity(t *testing.T) {
+	rules := append([]Rule{}, Rules...)
+	for i := range rules {
+		if rules[i].Name == "unused-variable" {
+			rules[i].Severity = Error
+		}
+	}
+	findings := lint(t, "let x = 1;\nx == x;\nlet y = 2;", rules)
+	expected := []string{
+		":2:1: warning: (x == x) is always true (self-comparison)",
+		":3:5: error: y is declared but never used (unused-variable)",
+	}
+	if len(findings) != len(expected) {
+		t.Fatalf("wrong findings. want=%q, got=%v", expected, findings)
+	}
+	for i, f := range findings {
+		if f.String() != expected[i] {
+			t.Errorf("findings[%d] wrong. want=%q, got=%q", i, expected[i], f.String())
+		}
+	}
+	if Rules[0].Severity != Warning {
+		t.Errorf("changing a copy of the rules changed the defaults")
+	}
+
+	out, err := json.Marshal(findings[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"line":2,"column":1,"severity":"warning","rule":"self-comparison","message":"(x == x) is always true"}`
+	if string(out) != want {
+		t.Errorf("wrong json.\nwant=%s\n got=%s", want, out)
+	}
+}
+
+func TestParseSeverity(t *testing.T) {
+	for _, s := range []Severity{Info, Warning, Error} {
+		got, err := ParseSeverity(s.String())
+		if err != nil || got != s {
+			t.Errorf("ParseSeverity(%q) = %v, %v", s, got, err)
+		}
+	}
+	if _, err := ParseSeverity("fatal"); err == nil {
+		t.Errorf("expected an error for an unknown severity")
+	}
+}
+
+func TestBuiltinArities(t *testing.T) {
+	for _, builtin := range object.Builtins {
+		if _, ok := builtinArities[builtin.Name]; !ok {
+			t.Errorf("builtin %q has no arity", builtin.Name)
+		}
+	}
+}
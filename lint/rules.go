@@ -0,0 +1,220 @@
+package lint
+
+import (
+	"fmt"
+	"mokey-type/ast"
+	"mokey-type/compiler"
+	"strings"
+)
+
+// Rules are the rules Lint runs by default, with their default severity.
+var Rules = []Rule{
+	{
+		Name:        "unused-variable",
+		Description: "a let binding that is never read, names starting with _ are left alone",
+		Severity:    Warning,
+		check:       unusedVariables,
+	},
+	{
+		Name:        "shadowed-parameter",
+		Description: "a parameter declared twice or redeclared with let in its own function",
+		Severity:    Warning,
+		check:       shadowedParameters,
+	},
+	{
+		Name:        "unreachable-code",
+		Description: "statements after a return in the same block",
+		Severity:    Warning,
+		check:       unreachableCode,
+	},
+	{
+		Name:        "builtin-arity",
+		Description: "a builtin called with the wrong number of arguments",
+		Severity:    Error,
+		check:       builtinArity,
+	},
+	{
+		Name:        "self-comparison",
+		Description: "a comparison of an expression with itself, like x == x",
+		Severity:    Warning,
+		check:       selfComparison,
+	},
+}
+
+func unusedVariables(p *pass) {
+	ast.Inspect(p.program, func(n ast.Node) bool {
+		let, ok := n.(*ast.LetStatement)
+		if !ok || let.Name == nil || strings.HasPrefix(let.Name.Value, "_") {
+			return true
+		}
+		if len(p.index.References(let.Name)) == 1 {
+			p.report(let.Name.Token, "%s is declared but never used", let.Name.Value)
+		}
+		return true
+	})
+}
+
+func shadowedParameters(p *pass) {
+	ast.Inspect(p.program, func(n ast.Node) bool {
+		fn, ok := n.(*ast.FunctionLiteral)
+		if !ok {
+			return true
+		}
+		params := map[string]bool{}
+		for _, param := range fn.Parameters {
+			if params[param.Value] {
+				p.report(param.Token, "parameter %s is declared twice", param.Value)
+			}
+			params[param.Value] = true
+		}
+		if fn.Body == nil {
+			return true
+		}
+		// lets in nested functions have their own scope, they are checked
+		// when Inspect gets to them
+		ast.Inspect(fn.Body, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.FunctionLiteral:
+				return false
+			case *ast.LetStatement:
+				if n.Name != nil && params[n.Name.Value] {
+					p.report(n.Name.Token, "let %s shadows the parameter %s", n.Name.Value, n.Name.Value)
+				}
+			}
+			return true
+		})
+		return true
+	})
+}
+
+func unreachableCode(p *pass) {
+	check := func(statements []ast.Statement) {
+		for i := 0; i+1 < len(statements); i++ {
+			if _, ok := statements[i].(*ast.ReturnStatement); ok {
+				p.report(ast.Start(statements[i+1]), "unreachable code after return")
+				return
+			}
+		}
+	}
+	ast.Inspect(p.program, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Program:
+			check(n.Statements)
+		case *ast.BlockStatement:
+			check(n.Statements)
+		}
+		return true
+	})
+}
+
+// arity is how many arguments a builtin takes, max is -1 when there is no
+// limit.
+type arity struct {
+	min, max int
+}
+
+var builtinArities = map[string]arity{
+	"puts":        {0, -1},
+	"typeOf":      {1, 1},
+	"len":         {1, 1},
+	"first":       {1, 1},
+	"last":        {1, 1},
+	"rest":        {1, 1},
+	"push":        {2, 2},
+	"pop":         {1, 1},
+	"reverse":     {1, 1},
+	"join":        {2, 3},
+	"split":       {2, 2},
+	"replace":     {3, 3},
+	"toLower":     {1, 1},
+	"toUpper":     {1, 1},
+	"trim":        {2, 2},
+	"trimLeft":    {2, 2},
+	"trimRight":   {2, 2},
+	"contains":    {2, 2},
+	"merge":       {2, 2},
+	"findIndex":   {2, 2},
+	"assert":      {1, 2},
+	"assertEqual": {2, 3},
+	"assertError": {1, 2},
+}
+
+func (a arity) String() string {
+	switch {
+	case a.max == -1:
+		return fmt.Sprintf("%d or more arguments", a.min)
+	case a.min == a.max && a.min == 1:
+		return "1 argument"
+	case a.min == a.max:
+		return fmt.Sprintf("%d arguments", a.min)
+	default:
+		return fmt.Sprintf("%d or %d arguments", a.min, a.max)
+	}
+}
+
+func builtinArity(p *pass) {
+	ast.Inspect(p.program, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpression)
+		if !ok {
+			return true
+		}
+		ident, ok := call.Function.(*ast.Identifier)
+		if !ok {
+			return true
+		}
+		symbol, ok := p.index.Symbol(ident)
+		if !ok || symbol.Scope != compiler.BuiltinScope {
+			return true
+		}
+		want, ok := builtinArities[ident.Value]
+		if !ok {
+			return true
+		}
+		got := len(call.Arguments)
+		if got < want.min || want.max != -1 && got > want.max {
+			p.report(ident.Token, "%s takes %s, got %d", ident.Value, want, got)
+		}
+		return true
+	})
+}
+
+func selfComparison(p *pass) {
+	ast.Inspect(p.program, func(n ast.Node) bool {
+		infix, ok := n.(*ast.InfixExpression)
+		if !ok || infix.Left == nil || infix.Right == nil {
+			return true
+		}
+		var result string
+		switch infix.Operator {
+		case "==":
+			result = "true"
+		case "!=", "<", ">":
+			result = "false"
+		default:
+			return true
+		}
+		if pure(infix.Left) && infix.Left.String() == infix.Right.String() {
+			p.report(ast.Start(infix), "%s is always %s", infix.String(), result)
+		}
+		return true
+	})
+}
+
+// pure reports whether evaluating e twice gives the same value. Calls and ++
+// or -- might not, and literals that build arrays, hashes or functions make a
+// new object each time.
+func pure(e ast.Expression) bool {
+	pure := true
+	ast.Inspect(e, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpression, *ast.FunctionLiteral, *ast.ArrayLiteral, *ast.HashLiteral:
+			pure = false
+		case *ast.PrefixExpression:
+			if n.Operator == "++" || n.Operator == "--" {
+				pure = false
+			}
+		}
+		return pure
+	})
+	return pure
+}
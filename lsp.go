@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mokey-type/lsp"
+	"os"
+)
+
+const lspUsage = "mokey-type lsp"
+
+const lspDoc = `Starts a language server that speaks the language server protocol on
+stdin and stdout, editors start it themselves. It reports parse and
+compile errors as diagnostics while a file is edited and answers
+completion, hover, go to definition, references and rename requests.`
+
+// languageServer runs the language server over stdin and stdout.
+func languageServer(args []string) error {
+	flags := flag.NewFlagSet("lsp", flag.ExitOnError)
+	usage(flags, lspUsage, lspDoc)
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		return fmt.Errorf("usage: %s", lspUsage)
+	}
+	return lsp.NewServer(os.Stdin, os.Stdout).Serve()
+}
@@ -0,0 +1,213 @@
+package lsp
+
+import (
+	"errors"
+	"mokey-type/ast"
+	"mokey-type/compiler"
+	"mokey-type/format"
+	"mokey-type/lexer"
+	"mokey-type/module"
+	"mokey-type/object"
+	"mokey-type/parser"
+	"mokey-type/token"
+)
+
+const source = "mokey-type"
+
+// diagnostics reports the parser errors of the document, or the first
+// compiler error when it parses.
+func (d *document) diagnostics() []Diagnostic {
+	p := parser.New(lexer.New(d.text))
+	program := p.ParseProgram()
+
+	diagnostics := []Diagnostic{}
+	for _, e := range p.ErrorDetails() {
+		diagnostics = append(diagnostics, Diagnostic{
+			Range:    d.tokenRange(e.Token),
+			Severity: SeverityError,
+			Source:   source,
+			Message:  e.Message,
+		})
+	}
+	if len(diagnostics) > 0 {
+		return diagnostics
+	}
+
+	comp := compiler.New()
+	comp.EnableImports(d.path, module.NewLoader(module.SearchPath()))
+	err := comp.Compile(program)
+	if err == nil {
+		return diagnostics
+	}
+	diagnostic := Diagnostic{Severity: SeverityError, Source: source, Message: err.Error()}
+	var compileErr *compiler.Error
+	if errors.As(err, &compileErr) {
+		diagnostic.Range = d.tokenRange(compileErr.Token)
+	}
+	return append(diagnostics, diagnostic)
+}
+
+func (d *document) completion(p Position) []CompletionItem {
+	items := []CompletionItem{}
+	for _, keyword := range token.Keywords() {
+		items = append(items, CompletionItem{Label: keyword, Kind: CompletionKeyword})
+	}
+	for _, builtin := range object.Builtins {
+		items = append(items, CompletionItem{
+			Label:  builtin.Name,
+			Kind:   CompletionFunction,
+			Detail: builtinDocs[builtin.Name][0],
+		})
+	}
+
+	program := parser.New(lexer.New(d.text)).ParseProgram()
+	line, column := d.column(p)
+	table := scopeAt(program, line, column, compiler.NewSymbolTable())
+	for _, name := range table.Names() {
+		items = append(items, CompletionItem{Label: name, Kind: CompletionVariable})
+	}
+	return items
+}
+
+func before(tok token.Token, line, column int) bool {
+	return tok.Line < line || tok.Line == line && tok.Column <= column
+}
+
+// scopeAt defines in table every binding that is visible at line and
+// column. The bindings come in the order the compiler would define them, a
+// function that contains the position opens an enclosed table.
+func scopeAt(node ast.Node, line, column int, table *compiler.SymbolTable) *compiler.SymbolTable {
+	result := table
+	ast.Inspect(node, func(n ast.Node) bool {
+		if _, ok := n.(*ast.Program); !ok && !before(ast.Start(n), line, column) {
+			return false
+		}
+
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			if n.Name != nil {
+				table.Define(n.Name.Value)
+			}
+
+		case *ast.FunctionLiteral:
+			if n.Body == nil {
+				return false
+			}
+			end := n.Body.Close
+			if end.Type == token.RBRACE && !before(token.Token{Line: line, Column: column}, end.Line, end.Column) {
+				return false
+			}
+			inner := compiler.NewEnclosedSymbolTable(table)
+			if n.Name != "" {
+				inner.DefineFunctionName(n.Name)
+			}
+			for _, param := range n.Parameters {
+				inner.Define(param.Value)
+			}
+			result = scopeAt(n.Body, line, column, inner)
+			return false
+		}
+		return true
+	})
+	return result
+}
+
+// hover shows the documentation of the builtin under p.
+func (d *document) hover(p Position) *Hover {
+	line, column := d.column(p)
+	l := lexer.New(d.text)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		if tok.Line != line || column < tok.Column || column >= tok.Column+len(tok.Literal) {
+			continue
+		}
+		if tok.Type != token.IDENT {
+			return nil
+		}
+		doc, ok := builtinDocs[tok.Literal]
+		if !ok {
+			return nil
+		}
+		r := d.tokenRange(tok)
+		return &Hover{
+			Contents: MarkupContent{
+				Kind:  "markdown",
+				Value: "```\n" + doc[0] + "\n```\n" + doc[1],
+			},
+			Range: &r,
+		}
+	}
+	return nil
+}
+
+// identifier resolves the document and finds the identifier under p.
+func (d *document) identifier(p Position) (*ast.Program, *compiler.Index, *ast.Identifier) {
+	program := parser.New(lexer.New(d.text)).ParseProgram()
+	index := compiler.Resolve(program)
+	line, column := d.column(p)
+	return program, index, index.At(line, column)
+}
+
+func (d *document) definition(uri string, p Position) *Location {
+	_, index, ident := d.identifier(p)
+	if ident == nil {
+		return nil
+	}
+	decl, ok := index.Definition(ident)
+	if !ok {
+		return nil
+	}
+	return &Location{URI: uri, Range: d.tokenRange(decl.Token)}
+}
+
+func (d *document) references(uri string, p Position, includeDeclaration bool) []Location {
+	locations := []Location{}
+	_, index, ident := d.identifier(p)
+	if ident == nil {
+		return locations
+	}
+	decl, ok := index.Definition(ident)
+	if !ok {
+		return locations
+	}
+	for _, ref := range index.References(decl) {
+		if ref == decl && !includeDeclaration {
+			continue
+		}
+		locations = append(locations, Location{URI: uri, Range: d.tokenRange(ref.Token)})
+	}
+	return locations
+}
+
+func (d *document) rename(uri string, p Position, name string) (*WorkspaceEdit, error) {
+	if len(d.diagnostics()) > 0 {
+		return nil, errors.New("the document has errors, fix them before renaming")
+	}
+	program, _, ident := d.identifier(p)
+	if ident == nil {
+		return nil, errors.New("no variable to rename here")
+	}
+	refs, err := compiler.Rename(program, ident, name)
+	if err != nil {
+		return nil, err
+	}
+	edits := []TextEdit{}
+	for _, ref := range refs {
+		edits = append(edits, TextEdit{Range: d.tokenRange(ref.Token), NewText: name})
+	}
+	return &WorkspaceEdit{Changes: map[string][]TextEdit{uri: edits}}, nil
+}
+
+// formatting replaces the whole document with its formatted text.
+func (d *document) formatting() ([]TextEdit, error) {
+	formatted, err := format.Source(d.text)
+	if err != nil {
+		return nil, err
+	}
+	edits := []TextEdit{}
+	if formatted == d.text {
+		return edits, nil
+	}
+	last := len(d.lines) - 1
+	end := d.position(last+1, len(d.lines[last])+1)
+	return append(edits, TextEdit{Range: Range{End: end}, NewText: formatted}), nil
+}
@@ -0,0 +1,29 @@
+package lsp
+
+// builtinDocs is the hover text of every builtin in object.Builtins, the
+// signature first and then what it does.
+var builtinDocs = map[string][2]string{
+	"puts":        {"puts(values...)", "Prints every value on its own line and returns null."},
+	"typeOf":      {"typeOf(value)", "Returns the type of value as a string, like \"INTEGER\"."},
+	"len":         {"len(value)", "Returns the length of a string or an array."},
+	"first":       {"first(array)", "Returns the first element of array, null when it is empty."},
+	"last":        {"last(array)", "Returns the last element of array, null when it is empty."},
+	"rest":        {"rest(array)", "Returns a new array without the first element, null when it is empty."},
+	"push":        {"push(array, value)", "Returns a new array with value appended."},
+	"pop":         {"pop(array)", "Returns a new array without the last element."},
+	"reverse":     {"reverse(value)", "Returns the string or array in reverse order."},
+	"join":        {"join(array, separator) / join(a, b, separator)", "Joins the elements of array, or the strings a and b, with separator."},
+	"split":       {"split(string, separator)", "Splits string around every separator and returns an array of strings."},
+	"replace":     {"replace(string, old, new)", "Replaces every old in string with new."},
+	"toLower":     {"toLower(string)", "Returns string in lower case."},
+	"toUpper":     {"toUpper(string)", "Returns string in upper case."},
+	"trim":        {"trim(string, cutset)", "Removes the characters in cutset from both ends of string."},
+	"trimLeft":    {"trimLeft(string, cutset)", "Removes the characters in cutset from the start of string."},
+	"trimRight":   {"trimRight(string, cutset)", "Removes the characters in cutset from the end of string."},
+	"contains":    {"contains(value, element)", "Reports whether the string contains the substring or the array contains element."},
+	"merge":       {"merge(a, b)", "Returns a new array with the elements of a followed by the elements of b."},
+	"findIndex":   {"findIndex(array, value)", "Returns the index of value in array, 0 when it is missing."},
+	"assert":      {"assert(condition, message?)", "Stops the program with an error when condition is false or null."},
+	"assertEqual": {"assertEqual(actual, expected, message?)", "Stops the program with an error when actual and expected differ, arrays and hashes are compared element by element."},
+	"assertError": {"assertError(fn, substring?)", "Calls fn and stops the program with an error unless fn fails with an error containing substring, returns the error message."},
+}
@@ -0,0 +1,83 @@
+package lsp
+
+import (
+	"mokey-type/token"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+)
+
+// document converts between the lexer's 1-based byte columns and the
+// protocol's 0-based UTF-16 positions.
+type document struct {
+	text  string
+	lines []string
+	// path is the file of the document, its imports are relative to it,
+	// empty when it is not a file
+	path string
+}
+
+func newDocument(text string) *document {
+	return &document{text: text, lines: strings.Split(text, "\n")}
+}
+
+// filePath returns the path of a file:// uri, empty for any other uri.
+func filePath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func (d *document) line(n int) string {
+	if n < 0 || n >= len(d.lines) {
+		return ""
+	}
+	return d.lines[n]
+}
+
+// position converts a 1-based line and byte column.
+func (d *document) position(line, column int) Position {
+	text := d.line(line - 1)
+	column--
+	if column > len(text) {
+		column = len(text)
+	}
+	if column < 0 {
+		column = 0
+	}
+	return Position{Line: line - 1, Character: len(utf16.Encode([]rune(text[:column])))}
+}
+
+// column converts p to a 1-based line and byte column.
+func (d *document) column(p Position) (int, int) {
+	text := d.line(p.Line)
+	units := 0
+	for i, r := range text {
+		if units >= p.Character {
+			return p.Line + 1, i + 1
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return p.Line + 1, len(text) + 1
+}
+
+// tokenRange covers the source text of tok.
+func (d *document) tokenRange(tok token.Token) Range {
+	length := len(tok.Literal)
+	if tok.Type == token.STRING {
+		length += 2
+	}
+	if length == 0 {
+		length = 1
+	}
+	start := d.position(tok.Line, tok.Column)
+	end := d.position(tok.Line, tok.Column+length)
+	if strings.Contains(tok.Literal, "\n") {
+		// only underline the opening quote of a multi line string
+		end = Position{Line: start.Line, Character: start.Character + 1}
+	}
+	return Range{Start: start, End: end}
+}
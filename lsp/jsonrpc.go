@@ -0,0 +1,115 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Message is a JSON-RPC 2.0 request, notification or response. Requests
+// and responses have an ID, notifications don't.
+type Message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *ResponseError   `json:"error,omitempty"`
+}
+
+type ResponseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+const (
+	parseError     = -32700
+	invalidParams  = -32602
+	methodNotFound = -32601
+	requestFailed  = -32803
+)
+
+// Conn reads and writes messages framed with a Content-Length header, the
+// base protocol of the language server protocol.
+type Conn struct {
+	r  *bufio.Reader
+	w  io.Writer
+	mu sync.Mutex
+}
+
+func NewConn(r io.Reader, w io.Writer) *Conn {
+	return &Conn{r: bufio.NewReader(r), w: w}
+}
+
+func (c *Conn) Read() (*Message, error) {
+	length := -1
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("invalid Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message without Content-Length")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return nil, err
+	}
+	msg := &Message{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, &ResponseError{Code: parseError, Message: err.Error()}
+	}
+	return msg, nil
+}
+
+func (c *Conn) Write(v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err = fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n%s", len(body), body)
+	return err
+}
+
+func (e *ResponseError) Error() string { return e.Message }
+
+// Call sends a request, Notify a notification. They are what a client
+// needs, the server only answers.
+func (c *Conn) Call(id int, method string, params interface{}) error {
+	return c.Write(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+}
+
+func (c *Conn) Notify(method string, params interface{}) error {
+	return c.Write(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+func (c *Conn) reply(id *json.RawMessage, result interface{}) error {
+	return c.Write(map[string]interface{}{"jsonrpc": "2.0", "id": id, "result": result})
+}
+
+func (c *Conn) replyError(id *json.RawMessage, code int, message string) error {
+	return c.Write(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error":   ResponseError{Code: code, Message: message},
+	})
+}
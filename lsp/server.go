@@ -0,0 +1,195 @@
+// Package lsp is a language server for Monkey. It speaks JSON-RPC over a
+// pair of streams and keeps every open document in memory, nothing is read
+// from disk.
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+type Server struct {
+	conn      *Conn
+	documents map[string]*document
+	shutdown  bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{conn: NewConn(in, out), documents: make(map[string]*document)}
+}
+
+var errExit = errors.New("exit")
+
+// Serve handles messages until the client sends exit or closes the input.
+func (s *Server) Serve() error {
+	for {
+		msg, err := s.conn.Read()
+		if err == io.EOF {
+			return nil
+		}
+		var rpcErr *ResponseError
+		if errors.As(err, &rpcErr) {
+			s.conn.replyError(nil, rpcErr.Code, rpcErr.Message)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		err = s.handle(msg)
+		if err == errExit {
+			if !s.shutdown {
+				return fmt.Errorf("exit before shutdown")
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg *Message) error {
+	switch msg.Method {
+	case "initialize":
+		return s.conn.reply(msg.ID, map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":           1,
+				"completionProvider":         map[string]interface{}{},
+				"hoverProvider":              true,
+				"definitionProvider":         true,
+				"referencesProvider":         true,
+				"renameProvider":             true,
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]string{"name": "mokey-type"},
+		})
+
+	case "shutdown":
+		s.shutdown = true
+		return s.conn.reply(msg.ID, nil)
+
+	case "exit":
+		return errExit
+
+	case "textDocument/didOpen":
+		var params DidOpenParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+		return s.update(params.TextDocument.URI, params.TextDocument.Text)
+
+	case "textDocument/didChange":
+		var params DidChangeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil || len(params.ContentChanges) == 0 {
+			return nil
+		}
+		// we only ask for full sync, the last change is the whole text
+		text := params.ContentChanges[len(params.ContentChanges)-1].Text
+		return s.update(params.TextDocument.URI, text)
+
+	case "textDocument/didClose":
+		var params DidCloseParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil
+		}
+		delete(s.documents, params.TextDocument.URI)
+		return s.conn.Notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+
+	case "textDocument/completion":
+		doc, params, err := s.position(msg)
+		if err != nil {
+			return s.conn.replyError(msg.ID, invalidParams, err.Error())
+		}
+		return s.conn.reply(msg.ID, doc.completion(params.Position))
+
+	case "textDocument/hover":
+		doc, params, err := s.position(msg)
+		if err != nil {
+			return s.conn.replyError(msg.ID, invalidParams, err.Error())
+		}
+		return s.conn.reply(msg.ID, doc.hover(params.Position))
+
+	case "textDocument/definition":
+		doc, params, err := s.position(msg)
+		if err != nil {
+			return s.conn.replyError(msg.ID, invalidParams, err.Error())
+		}
+		return s.conn.reply(msg.ID, doc.definition(params.TextDocument.URI, params.Position))
+
+	case "textDocument/references":
+		var params ReferenceParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return s.conn.replyError(msg.ID, invalidParams, err.Error())
+		}
+		doc, _, err := s.position(msg)
+		if err != nil {
+			return s.conn.replyError(msg.ID, invalidParams, err.Error())
+		}
+		locations := doc.references(params.TextDocument.URI, params.Position, params.Context.IncludeDeclaration)
+		return s.conn.reply(msg.ID, locations)
+
+	case "textDocument/rename":
+		var params RenameParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return s.conn.replyError(msg.ID, invalidParams, err.Error())
+		}
+		doc, _, err := s.position(msg)
+		if err != nil {
+			return s.conn.replyError(msg.ID, invalidParams, err.Error())
+		}
+		edit, err := doc.rename(params.TextDocument.URI, params.Position, params.NewName)
+		if err != nil {
+			return s.conn.replyError(msg.ID, requestFailed, err.Error())
+		}
+		return s.conn.reply(msg.ID, edit)
+
+	case "textDocument/formatting":
+		var params DocumentFormattingParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return s.conn.replyError(msg.ID, invalidParams, err.Error())
+		}
+		doc, ok := s.documents[params.TextDocument.URI]
+		if !ok {
+			return s.conn.replyError(msg.ID, invalidParams, "unknown document "+params.TextDocument.URI)
+		}
+		edits, err := doc.formatting()
+		if err != nil {
+			return s.conn.replyError(msg.ID, requestFailed, err.Error())
+		}
+		return s.conn.reply(msg.ID, edits)
+	}
+
+	if msg.ID != nil {
+		return s.conn.replyError(msg.ID, methodNotFound, "method not found: "+msg.Method)
+	}
+	// notifications we don't know about, like initialized, are ignored
+	return nil
+}
+
+func (s *Server) update(uri, text string) error {
+	doc := newDocument(text)
+	doc.path = filePath(uri)
+	s.documents[uri] = doc
+	return s.conn.Notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: doc.diagnostics(),
+	})
+}
+
+func (s *Server) position(msg *Message) (*document, TextDocumentPositionParams, error) {
+	var params TextDocumentPositionParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		return nil, params, err
+	}
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, params, fmt.Errorf("unknown document %s", params.TextDocument.URI)
+	}
+	return doc, params, nil
+}
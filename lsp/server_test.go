@@ -0,0 +1,461 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"mokey-type/object"
+	"testing"
+)
+
+// client drives a Server over pipes the way an editor would.
+type client struct {
+	t      *testing.T
+	conn   *Conn
+	nextID int
+	done   chan error
+
+	notifications []Message
+}
+
+func newClient(t *testing.T) *client {
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	c := &client{t: t, conn: NewConn(clientIn, clientOut), done: make(chan error, 1)}
+	go func() {
+		err := NewServer(serverIn, serverOut).Serve()
+		serverOut.Close()
+		c.done <- err
+	}()
+	return c
+}
+
+func (c *client) call(method string, params interface{}, result interface{}) *ResponseError {
+	c.t.Helper()
+	c.nextID++
+	if err := c.conn.Call(c.nextID, method, params); err != nil {
+		c.t.Fatalf("call %s: %s", method, err)
+	}
+	for {
+		msg := c.read()
+		if msg.ID == nil {
+			c.notifications = append(c.notifications, *msg)
+			continue
+		}
+		var id int
+		json.Unmarshal(*msg.ID, &id)
+		if id != c.nextID {
+			c.t.Fatalf("response for request %d, want %d", id, c.nextID)
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil {
+			if err := json.Unmarshal(msg.Result, result); err != nil {
+				c.t.Fatalf("bad result for %s: %s", method, err)
+			}
+		}
+		return nil
+	}
+}
+
+func (c *client) notify(method string, params interface{}) {
+	c.t.Helper()
+	if err := c.conn.Notify(method, params); err != nil {
+		c.t.Fatalf("notify %s: %s", method, err)
+	}
+}
+
+func (c *client) read() *Message {
+	c.t.Helper()
+	msg, err := c.conn.Read()
+	if err != nil {
+		c.t.Fatalf("read: %s", err)
+	}
+	return msg
+}
+
+// diagnostics waits for the next publishDiagnostics notification.
+func (c *client) diagnostics() PublishDiagnosticsParams {
+	c.t.Helper()
+	var msg *Message
+	if len(c.notifications) > 0 {
+		msg = &c.notifications[0]
+		c.notifications = c.notifications[1:]
+	} else {
+		msg = c.read()
+	}
+	if msg.Method != "textDocument/publishDiagnostics" {
+		c.t.Fatalf("expected diagnostics, got %q", msg.Method)
+	}
+	var params PublishDiagnosticsParams
+	json.Unmarshal(msg.Params, &params)
+	return params
+}
+
+func (c *client) open(uri, text string) PublishDiagnosticsParams {
+	c.t.Helper()
+	c.notify("textDocument/didOpen", DidOpenParams{TextDocument: TextDocumentItem{URI: uri, Text: text}})
+	return c.diagnostics()
+}
+
+func (c *client) close() {
+	c.t.Helper()
+	if err := c.call("shutdown", nil, nil); err != nil {
+		c.t.Fatalf("shutdown: %s", err)
+	}
+	c.notify("exit", nil)
+	if err := <-c.done; err != nil {
+		c.t.Fatalf("server stopped with %s", err)
+	}
+}
+
+func TestInitialize(t *testing.T) {
+	c := newClient(t)
+	var result struct {
+		Capabilities struct {
+			TextDocumentSync int  `json:"textDocumentSync"`
+			HoverProvider    bool `json:"hoverProvider"`
+		} `json:"capabilities"`
+	}
+	c.call("initialize", map[string]interface{}{}, &result)
+	if result.Capabilities.TextDocumentSync != 1 || !result.Capabilities.HoverProvider {
+		t.Errorf("wrong capabilities: %+v", result.Capabilities)
+	}
+	c.notify("initialized", map[string]interface{}{})
+
+	if err := c.call("textDocument/definitionOfEverything", nil, nil); err == nil || err.Code != methodNotFound {
+		t.Errorf("expected method not found, got %v", err)
+	}
+	c.close()
+}
+
+func TestDiagnostics(t *testing.T) {
+	c := newClient(t)
+	c.call("initialize", nil, nil)
+
+	tests := []struct {
+		text     string
+		expected []Diagnostic
+	}{
+		{"let x = 5;\nx + 1", []Diagnostic{}},
+		{
+			"let x = 5;\nlet = 3;",
+			[]Diagnostic{{
+				Range:    Range{Start: Position{1, 4}, End: Position{1, 5}},
+				Severity: SeverityError,
+				Source:   source,
+				Message:  "expected next token to be IDENT, got = instead",
+			}, {
+				Range:    Range{Start: Position{1, 4}, End: Position{1, 5}},
+				Severity: SeverityError,
+				Source:   source,
+				Message:  "no prefix parse function for = found \"=\"",
+			}},
+		},
+		{
+			"let s = \"héllo\"; s + missing",
+			[]Diagnostic{{
+				Range:    Range{Start: Position{0, 21}, End: Position{0, 28}},
+				Severity: SeverityError,
+				Source:   source,
+				Message:  "undefined variable: missing",
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		params := c.open("file:///test.mk", tt.text)
+		if params.URI != "file:///test.mk" {
+			t.Errorf("diagnostics for wrong document %q", params.URI)
+		}
+		if len(params.Diagnostics) != len(tt.expected) {
+			t.Fatalf("wrong diagnostics for %q. want=%+v, got=%+v", tt.text, tt.expected, params.Diagnostics)
+		}
+		for i, d := range tt.expected {
+			if params.Diagnostics[i] != d {
+				t.Errorf("wrong diagnostic for %q.\nwant=%+v\n got=%+v", tt.text, d, params.Diagnostics[i])
+			}
+		}
+	}
+
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   TextDocumentIdentifier{URI: "file:///test.mk"},
+		"contentChanges": []map[string]string{{"text": "let y = ;"}},
+	})
+	if got := c.diagnostics(); len(got.Diagnostics) != 1 {
+		t.Errorf("expected one diagnostic after the change, got %+v", got.Diagnostics)
+	}
+
+	c.notify("textDocument/didClose", DidCloseParams{TextDocument: TextDocumentIdentifier{URI: "file:///test.mk"}})
+	if got := c.diagnostics(); len(got.Diagnostics) != 0 {
+		t.Errorf("closing should clear the diagnostics, got %+v", got.Diagnostics)
+	}
+	c.close()
+}
+
+func TestCompletion(t *testing.T) {
+	c := newClient(t)
+	c.call("initialize", nil, nil)
+	text := `let global = 1;
+let outer = fn(a) {
+	let local = a;
+	let inner = fn(b) {
+		b
+	};
+	local
+};
+let later = 2;
+`
+	c.open("file:///c.mk", text)
+
+	complete := func(line, character int) map[string]int {
+		var items []CompletionItem
+		err := c.call("textDocument/completion", TextDocumentPositionParams{
+			TextDocument: TextDocumentIdentifier{URI: "file:///c.mk"},
+			Position:     Position{Line: line, Character: character},
+		}, &items)
+		if err != nil {
+			t.Fatalf("completion failed: %s", err)
+		}
+		kinds := map[string]int{}
+		for _, item := range items {
+			kinds[item.Label] = item.Kind
+		}
+		return kinds
+	}
+
+	inner := complete(4, 2)
+	for _, name := range []string{"b", "a", "local", "inner", "outer", "global"} {
+		if inner[name] != CompletionVariable {
+			t.Errorf("%q not offered inside inner, got %v", name, inner)
+		}
+	}
+	if _, ok := inner["later"]; ok {
+		t.Errorf("later is defined after the cursor but was offered")
+	}
+	if inner["fn"] != CompletionKeyword || inner["len"] != CompletionFunction {
+		t.Errorf("keywords and builtins missing: %v", inner)
+	}
+
+	top := complete(9, 0)
+	for _, name := range []string{"global", "outer", "later"} {
+		if top[name] != CompletionVariable {
+			t.Errorf("%q not offered at the top level", name)
+		}
+	}
+	for _, name := range []string{"a", "b", "local", "inner"} {
+		if _, ok := top[name]; ok {
+			t.Errorf("%q is local to a function but was offered at the top level", name)
+		}
+	}
+	c.close()
+}
+
+func TestHover(t *testing.T) {
+	c := newClient(t)
+	c.call("initialize", nil, nil)
+	c.open("file:///h.mk", "let xs = [1];\nlen(xs)")
+
+	var hover *Hover
+	c.call("textDocument/hover", TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: "file:///h.mk"},
+		Position:     Position{Line: 1, Character: 1},
+	}, &hover)
+	if hover == nil {
+		t.Fatalf("no hover for len")
+	}
+	expected := "```\nlen(value)\n```\nReturns the length of a string or an array."
+	if hover.Contents.Value != expected {
+		t.Errorf("wrong hover.\nwant=%q\n got=%q", expected, hover.Contents.Value)
+	}
+	if *hover.Range != (Range{Start: Position{1, 0}, End: Position{1, 3}}) {
+		t.Errorf("wrong hover range %+v", *hover.Range)
+	}
+
+	hover = nil
+	c.call("textDocument/hover", TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: "file:///h.mk"},
+		Position:     Position{Line: 1, Character: 5},
+	}, &hover)
+	if hover != nil {
+		t.Errorf("expected no hover over xs, got %+v", hover)
+	}
+
+	if err := c.call("textDocument/hover", TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: "file:///missing.mk"},
+	}, nil); err == nil || err.Code != invalidParams {
+		t.Errorf("expected invalid params for an unknown document, got %v", err)
+	}
+	c.close()
+}
+
+func TestBuiltinDocs(t *testing.T) {
+	for _, builtin := range object.Builtins {
+		if _, ok := builtinDocs[builtin.Name]; !ok {
+			t.Errorf("builtin %q has no documentation", builtin.Name)
+		}
+	}
+}
+
+func TestDefinitionAndReferences(t *testing.T) {
+	c := newClient(t)
+	c.call("initialize", nil, nil)
+	uri := "file:///d.mk"
+	c.open(uri, "let x = 1;\nlet f = fn(x) { x };\nf(x) + x")
+	at := func(line, character int) TextDocumentPositionParams {
+		return TextDocumentPositionParams{
+			TextDocument: TextDocumentIdentifier{URI: uri},
+			Position:     Position{Line: line, Character: character},
+		}
+	}
+
+	var location *Location
+	c.call("textDocument/definition", at(2, 2), &location)
+	expected := Location{URI: uri, Range: Range{Start: Position{0, 4}, End: Position{0, 5}}}
+	if location == nil || *location != expected {
+		t.Errorf("wrong definition of x. want=%+v, got=%+v", expected, location)
+	}
+
+	location = nil
+	c.call("textDocument/definition", at(1, 16), &location)
+	expected = Location{URI: uri, Range: Range{Start: Position{1, 11}, End: Position{1, 12}}}
+	if location == nil || *location != expected {
+		t.Errorf("wrong definition of the parameter. want=%+v, got=%+v", expected, location)
+	}
+
+	location = nil
+	c.call("textDocument/definition", at(0, 8), &location)
+	if location != nil {
+		t.Errorf("expected no definition for a literal, got %+v", location)
+	}
+
+	references := func(includeDeclaration bool) []Range {
+		params := ReferenceParams{TextDocumentPositionParams: at(0, 4)}
+		params.Context.IncludeDeclaration = includeDeclaration
+		var locations []Location
+		c.call("textDocument/references", params, &locations)
+		ranges := []Range{}
+		for _, l := range locations {
+			ranges = append(ranges, l.Range)
+		}
+		return ranges
+	}
+	uses := []Range{
+		{Start: Position{2, 2}, End: Position{2, 3}},
+		{Start: Position{2, 7}, End: Position{2, 8}},
+	}
+	if got := references(false); !equalRanges(got, uses) {
+		t.Errorf("wrong references. want=%+v, got=%+v", uses, got)
+	}
+	all := append([]Range{{Start: Position{0, 4}, End: Position{0, 5}}}, uses...)
+	if got := references(true); !equalRanges(got, all) {
+		t.Errorf("wrong references with declaration. want=%+v, got=%+v", all, got)
+	}
+	c.close()
+}
+
+func equalRanges(a, b []Range) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRename(t *testing.T) {
+	c := newClient(t)
+	c.call("initialize", nil, nil)
+	uri := "file:///r.mk"
+	c.open(uri, "let x = 1;\nlet y = fn(a) { a + x };\ny(x)")
+	params := func(line, character int, name string) RenameParams {
+		return RenameParams{
+			TextDocumentPositionParams: TextDocumentPositionParams{
+				TextDocument: TextDocumentIdentifier{URI: uri},
+				Position:     Position{Line: line, Character: character},
+			},
+			NewName: name,
+		}
+	}
+
+	var edit WorkspaceEdit
+	if err := c.call("textDocument/rename", params(2, 2, "total"), &edit); err != nil {
+		t.Fatalf("rename failed: %s", err)
+	}
+	var got []Range
+	for _, e := range edit.Changes[uri] {
+		if e.NewText != "total" {
+			t.Errorf("wrong new text %q", e.NewText)
+		}
+		got = append(got, e.Range)
+	}
+	expected := []Range{
+		{Start: Position{0, 4}, End: Position{0, 5}},
+		{Start: Position{1, 20}, End: Position{1, 21}},
+		{Start: Position{2, 2}, End: Position{2, 3}},
+	}
+	if !equalRanges(got, expected) {
+		t.Errorf("wrong edits. want=%+v, got=%+v", expected, got)
+	}
+
+	err := c.call("textDocument/rename", params(1, 11, "x"), nil)
+	if err == nil || err.Code != requestFailed {
+		t.Errorf("renaming a to x captures x, expected a failure, got %v", err)
+	}
+
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   TextDocumentIdentifier{URI: uri},
+		"contentChanges": []map[string]string{{"text": "let x = ;\nx"}},
+	})
+	c.diagnostics()
+	err = c.call("textDocument/rename", params(1, 0, "y"), nil)
+	if err == nil || err.Code != requestFailed {
+		t.Errorf("expected rename to fail on a broken document, got %v", err)
+	}
+	c.close()
+}
+
+func TestFormatting(t *testing.T) {
+	c := newClient(t)
+	c.call("initialize", nil, nil)
+	uri := "file:///f.mk"
+	c.open(uri, "let x=1;\nputs( x )")
+
+	var edits []TextEdit
+	if err := c.call("textDocument/formatting", DocumentFormattingParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &edits); err != nil {
+		t.Fatalf("formatting failed: %s", err)
+	}
+	expected := []TextEdit{{
+		Range:   Range{Start: Position{0, 0}, End: Position{1, 9}},
+		NewText: "let x = 1;\nputs(x);\n",
+	}}
+	if len(edits) != 1 || edits[0] != expected[0] {
+		t.Errorf("wrong edits. want=%+v, got=%+v", expected, edits)
+	}
+
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   TextDocumentIdentifier{URI: uri},
+		"contentChanges": []map[string]string{{"text": "let x = 1;\n"}},
+	})
+	c.diagnostics()
+	edits = nil
+	c.call("textDocument/formatting", DocumentFormattingParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &edits)
+	if len(edits) != 0 {
+		t.Errorf("a formatted document needs no edits, got %+v", edits)
+	}
+
+	c.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   TextDocumentIdentifier{URI: uri},
+		"contentChanges": []map[string]string{{"text": "let x = ;"}},
+	})
+	c.diagnostics()
+	err := c.call("textDocument/formatting", DocumentFormattingParams{TextDocument: TextDocumentIdentifier{URI: uri}}, nil)
+	if err == nil || err.Code != requestFailed {
+		t.Errorf("expected formatting to fail on a broken document, got %v", err)
+	}
+	c.close()
+}
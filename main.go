@@ -1,13 +1,40 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"mokey-type/repl"
 	"os"
 	"os/user"
 )
 
+var commands = map[string]func(args []string) error{
+	"build":  build,
+	"check":  checkFiles,
+	"cover":  cover,
+	"dap":    debugAdapter,
+	"debug":  debugFile,
+	"disasm": disasm,
+	"fmt":    formatFiles,
+	"infer":  inferFiles,
+	"lint":   lintFiles,
+	"lsp":    languageServer,
+	"rename": rename,
+	"run":    run,
+	"test":   testFiles,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	user, err := user.Current()
 	if err != nil {
 		panic(err)
@@ -15,3 +42,12 @@ func main() {
 	fmt.Printf("Hello %s!, This Is MonkeyType\n", user.Username)
 	repl.Start(os.Stdout)
 }
+
+// usage makes -h print the command line of a command, what it does and its
+// flags.
+func usage(flags *flag.FlagSet, line, doc string) {
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s\n\n%s\n\n", line, doc)
+		flags.PrintDefaults()
+	}
+}
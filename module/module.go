@@ -0,0 +1,182 @@
+// Package module finds and parses the files programs import, both engines
+// use it so they resolve imports and report cycles the same way.
+package module
+
+import (
+	"fmt"
+	"mokey-type/ast"
+	"mokey-type/lexer"
+	"mokey-type/parser"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Ext is the extension of source files, imports can leave it out.
+const Ext = ".mk"
+
+// SearchPath returns the directories of the MOKEYPATH environment
+// variable, separated like PATH.
+func SearchPath() []string {
+	return filepath.SplitList(os.Getenv("MOKEYPATH"))
+}
+
+// Loader resolves import paths and parses every module once. A module is
+// only loaded when it doesn't import itself through the modules it
+// imports.
+type Loader struct {
+	// SearchPath are the directories tried after the one of the importing
+	// file, for paths that don't start with ./ or ../
+	SearchPath []string
+
+	programs map[string]*ast.Program
+	// imports are the files every parsed module imports, in order
+	imports map[string][]string
+	// acyclic are the modules whose imports were followed to the end
+	acyclic map[string]bool
+}
+
+func NewLoader(searchPath []string) *Loader {
+	return &Loader{
+		SearchPath: searchPath,
+		programs:   map[string]*ast.Program{},
+		imports:    map[string][]string{},
+		acyclic:    map[string]bool{},
+	}
+}
+
+// Resolve returns the file path names when from imports it. from is empty
+// for a program without a file, its imports are relative to the working
+// directory.
+func (l *Loader) Resolve(from, path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("empty import path")
+	}
+	name := path
+	if filepath.Ext(name) != Ext {
+		name += Ext
+	}
+
+	candidates := []string{name}
+	if !filepath.IsAbs(name) {
+		candidates = []string{filepath.Join(filepath.Dir(from), name)}
+		if !strings.HasPrefix(path, "./") && !strings.HasPrefix(path, "../") {
+			for _, dir := range l.SearchPath {
+				candidates = append(candidates, filepath.Join(dir, name))
+			}
+		}
+	}
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && info.Mode().IsRegular() {
+			return filepath.Clean(candidate), nil
+		}
+	}
+	return "", fmt.Errorf("module %q not found", path)
+}
+
+// Load resolves path imported from the file from and returns the file and
+// its program. The modules it imports are parsed too, so a cycle is found
+// before anything of it runs, and reported starting at from.
+func (l *Loader) Load(from, path string) (string, *ast.Program, error) {
+	file, err := l.Resolve(from, path)
+	if err != nil {
+		return "", nil, err
+	}
+	stack := []string{}
+	if from != "" {
+		stack = append(stack, filepath.Clean(from))
+	}
+	err = l.follow(file, stack)
+	if err != nil {
+		return "", nil, err
+	}
+	return file, l.programs[file], nil
+}
+
+// follow parses file and the modules it imports, stack are the files that
+// import it.
+func (l *Loader) follow(file string, stack []string) error {
+	if l.acyclic[file] {
+		return nil
+	}
+	for i, f := range stack {
+		if f == file {
+			return fmt.Errorf("import cycle: %s", strings.Join(append(stack[i:], file), " -> "))
+		}
+	}
+	err := l.parse(file)
+	if err != nil {
+		return err
+	}
+	stack = append(stack, file)
+	for _, imported := range l.imports[file] {
+		err := l.follow(imported, stack)
+		if err != nil {
+			return err
+		}
+	}
+	l.acyclic[file] = true
+	return nil
+}
+
+func (l *Loader) parse(file string) error {
+	if _, ok := l.programs[file]; ok {
+		return nil
+	}
+	source, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	p := parser.New(lexer.New(string(source)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return fmt.Errorf("%s: parser errors:\n\t%s", file, strings.Join(p.Errors(), "\n\t"))
+	}
+	// the value of a module is its exports
+	for _, s := range program.Statements {
+		if s, ok := s.(*ast.ReturnStatement); ok {
+			return fmt.Errorf("%s:%d:%d: return outside of a function", file, s.Token.Line, s.Token.Column)
+		}
+	}
+
+	imports := []string{}
+	var resolveErr error
+	ast.Inspect(program, func(node ast.Node) bool {
+		if node, ok := node.(*ast.ImportExpression); ok && resolveErr == nil {
+			imported, err := l.Resolve(file, node.Path.Value)
+			if err != nil {
+				resolveErr = fmt.Errorf("%s:%d:%d: %s", file, node.Token.Line, node.Token.Column, err)
+			}
+			imports = append(imports, imported)
+		}
+		return resolveErr == nil
+	})
+	if resolveErr != nil {
+		return resolveErr
+	}
+	l.programs[file] = program
+	l.imports[file] = imports
+	return nil
+}
+
+// Exported reports whether a top-level binding called name is part of
+// the module, the ones starting with _ are private.
+func Exported(name string) bool {
+	return !strings.HasPrefix(name, "_")
+}
+
+// Exports returns the names of the exported top-level bindings of
+// program, in the order they are first bound.
+func Exports(program *ast.Program) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, s := range program.Statements {
+		let, ok := s.(*ast.LetStatement)
+		if !ok || let.Name == nil || seen[let.Name.Value] || !Exported(let.Name.Value) {
+			continue
+		}
+		seen[let.Name.Value] = true
+		names = append(names, let.Name.Value)
+	}
+	return names
+}
@@ -0,0 +1,139 @@
+package module
+
+import (
+	"mokey-type/conformance"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	dir := conformance.WriteModules(t, map[string]string{
+		"main.mk":        "",
+		"math.mk":        "",
+		"lib/strings.mk": "",
+		"lib/util.mk":    "",
+		"path/list.mk":   "",
+	})
+	loader := NewLoader([]string{filepath.Join(dir, "path")})
+	main := filepath.Join(dir, "main.mk")
+
+	tests := []struct {
+		from     string
+		path     string
+		expected string
+		err      string
+	}{
+		{main, "math", filepath.Join(dir, "math.mk"), ""},
+		{main, "math.mk", filepath.Join(dir, "math.mk"), ""},
+		{main, "./lib/strings", filepath.Join(dir, "lib/strings.mk"), ""},
+		{filepath.Join(dir, "lib/strings.mk"), "util", filepath.Join(dir, "lib/util.mk"), ""},
+		{filepath.Join(dir, "lib/strings.mk"), "../math", filepath.Join(dir, "math.mk"), ""},
+		{main, "list", filepath.Join(dir, "path/list.mk"), ""},
+		{main, "./list", "", `module "./list" not found`},
+		{main, filepath.Join(dir, "math"), filepath.Join(dir, "math.mk"), ""},
+		{main, "nope", "", `module "nope" not found`},
+		{main, "lib", "", `module "lib" not found`},
+		{main, "", "", "empty import path"},
+	}
+
+	for _, tt := range tests {
+		file, err := loader.Resolve(tt.from, tt.path)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("Resolve(%q) wrong error. want=%q, got=%v", tt.path, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Resolve(%q) failed: %s", tt.path, err)
+			continue
+		}
+		if file != tt.expected {
+			t.Errorf("Resolve(%q) wrong file. want=%q, got=%q", tt.path, tt.expected, file)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := conformance.WriteModules(t, map[string]string{
+		"a.mk":      `let b = import "b"; let a = 1;`,
+		"b.mk":      `let c = import "c";`,
+		"c.mk":      `let a = import "a";`,
+		"self.mk":   `let self = import "self";`,
+		"ok.mk":     `let x = import "leaf"; let y = import "leaf";`,
+		"leaf.mk":   `let x = 1;`,
+		"parse.mk":  `let = 1;`,
+		"return.mk": "let x = 1;\nreturn x;",
+		"bad.mk":    "let x = 1;\nlet y = import \"missing\";",
+		"cy1.mk":    `let two = import "cy2";`,
+		"cy2.mk":    `let one = import "cy1";`,
+	})
+	main := filepath.Join(dir, "main.mk")
+
+	tests := []struct {
+		path string
+		err  string
+	}{
+		{"ok", ""},
+		{"leaf", ""},
+		{"a", "import cycle: " + strings.Join([]string{
+			filepath.Join(dir, "a.mk"), filepath.Join(dir, "b.mk"), filepath.Join(dir, "c.mk"), filepath.Join(dir, "a.mk"),
+		}, " -> ")},
+		{"self", "import cycle: " + filepath.Join(dir, "self.mk") + " -> " + filepath.Join(dir, "self.mk")},
+		{"parse", filepath.Join(dir, "parse.mk") + ": parser errors:"},
+		{"return", filepath.Join(dir, "return.mk") + ":2:1: return outside of a function"},
+		{"bad", filepath.Join(dir, "bad.mk") + `:2:9: module "missing" not found`},
+	}
+
+	for _, tt := range tests {
+		loader := NewLoader(nil)
+		file, program, err := loader.Load(main, tt.path)
+		if tt.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("Load(%q) wrong error. want=%q, got=%v", tt.path, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Load(%q) failed: %s", tt.path, err)
+			continue
+		}
+		if file != filepath.Join(dir, tt.path+Ext) || program == nil {
+			t.Errorf("Load(%q) wrong result. got=%q %v", tt.path, file, program)
+		}
+		// a module is parsed once
+		_, again, _ := loader.Load(main, tt.path)
+		if again != program {
+			t.Errorf("Load(%q) parsed the module again", tt.path)
+		}
+	}
+
+	// a cycle through the file that imports starts at it
+	cy1, cy2 := filepath.Join(dir, "cy1.mk"), filepath.Join(dir, "cy2.mk")
+	_, _, err := NewLoader(nil).Load(cy1, "cy2")
+	if want := "import cycle: " + cy1 + " -> " + cy2 + " -> " + cy1; err == nil || err.Error() != want {
+		t.Errorf("wrong cycle. want=%q, got=%v", want, err)
+	}
+}
+
+func TestExports(t *testing.T) {
+	dir := conformance.WriteModules(t, map[string]string{
+		"math.mk": `
+let add = fn(a, b) { a + b };
+let _square = fn(x) { x * x };
+let pi = 3;
+let add = fn(a, b) { b + a };
+puts("loaded");
+`,
+	})
+	_, program, err := NewLoader(nil).Load(filepath.Join(dir, "main.mk"), "math")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exports := Exports(program)
+	expected := []string{"add", "pi"}
+	if strings.Join(exports, ",") != strings.Join(expected, ",") {
+		t.Errorf("wrong exports. want=%v, got=%v", expected, exports)
+	}
+}
@@ -0,0 +1,133 @@
+package object
+
+import "strings"
+
+// Equal reports whether a and b are the same value, arrays and hashes are
+// compared element by element and functions by identity.
+func Equal(a, b Object) bool {
+	switch a := a.(type) {
+	case *Integer:
+		b, ok := b.(*Integer)
+		return ok && a.Value == b.Value
+	case *String:
+		b, ok := b.(*String)
+		return ok && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && a.Value == b.Value
+	case *NullValue:
+		_, ok := b.(*NullValue)
+		return ok
+	case *Array:
+		b, ok := b.(*Array)
+		if !ok || len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !Equal(a.Elements[i], b.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		b, ok := b.(*Hash)
+		if !ok || len(a.Pairs) != len(b.Pairs) {
+			return false
+		}
+		for key, pair := range a.Pairs {
+			other, ok := b.Pairs[key]
+			if !ok || !Equal(pair.Value, other.Value) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+// message is the optional last argument of the assert builtins, it is put
+// in front of what failed.
+func message(name string, args []Object, i int) (string, *Error) {
+	if len(args) <= i {
+		return "", nil
+	}
+	s, ok := args[i].(*String)
+	if !ok {
+		return "", NewError("argument to `%s` must be STRING, got %s", name, args[i].Type())
+	}
+	return s.Value + ": ", nil
+}
+
+var Assert = &Builtin{
+	Fn: func(args ...Object) Object {
+		if len(args) < 1 || len(args) > 2 {
+			return NewError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+		}
+		prefix, err := message("assert", args, 1)
+		if err != nil {
+			return err
+		}
+		switch cond := args[0].(type) {
+		case *Boolean:
+			if cond.Value {
+				return nil
+			}
+		case *NullValue:
+		default:
+			return nil
+		}
+		return NewError("assert failed: %sgot %s", prefix, Quoted(args[0]))
+	},
+}
+
+var AssertEqual = &Builtin{
+	Fn: func(args ...Object) Object {
+		if len(args) < 2 || len(args) > 3 {
+			return NewError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+		}
+		prefix, err := message("assertEqual", args, 2)
+		if err != nil {
+			return err
+		}
+		if Equal(args[0], args[1]) {
+			return nil
+		}
+		return NewError("assertEqual failed: %sgot %s, want %s", prefix, Quoted(args[0]), Quoted(args[1]))
+	},
+}
+
+// AssertError calls the function it is given, it only works on the engines
+// that pass an Apply.
+var AssertError = &Builtin{
+	Fn: func(args ...Object) Object {
+		return NewError("`assertError` is not supported by this engine")
+	},
+	WithApply: func(apply Apply, args ...Object) Object {
+		if len(args) < 1 || len(args) > 2 {
+			return NewError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+		}
+		switch args[0].Type() {
+		case FUNCTION_OBJ, CLOSURE_OBJ, BUILTIN_OBJ:
+		default:
+			return NewError("argument to `assertError` must be a function, got %s", args[0].Type())
+		}
+		var want string
+		if len(args) == 2 {
+			s, ok := args[1].(*String)
+			if !ok {
+				return NewError("argument to `assertError` must be STRING, got %s", args[1].Type())
+			}
+			want = s.Value
+		}
+		switch result := apply(args[0]).(type) {
+		case *Error:
+			if !strings.Contains(result.Message, want) {
+				return NewError("assertError failed: got error %q, want one containing %q", result.Message, want)
+			}
+			// the message, so tests can look at it further
+			return &String{Value: result.Message}
+		default:
+			return NewError("assertError failed: got %s, want an error", Quoted(result))
+		}
+	},
+}
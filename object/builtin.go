@@ -2,8 +2,13 @@ package object
 
 import (
 	"fmt"
+	"io"
+	"os"
 )
 
+// Stdout is where puts writes.
+var Stdout io.Writer = os.Stdout
+
 var Builtins = []struct {
 	Name    string
 	Builtin *Builtin
@@ -13,7 +18,7 @@ var Builtins = []struct {
 		&Builtin{
 			Fn: func(args ...Object) Object {
 				for _, arg := range args {
-					fmt.Println(arg.Inspect())
+					fmt.Fprintln(Stdout, arg.Inspect())
 				}
 				return nil
 			},
@@ -102,6 +107,18 @@ var Builtins = []struct {
 		"findIndex",
 		FindIndex,
 	},
+	{
+		"assert",
+		Assert,
+	},
+	{
+		"assertEqual",
+		AssertEqual,
+	},
+	{
+		"assertError",
+		AssertError,
+	},
 }
 
 func NewError(format string, a ...interface{}) *Error {
@@ -0,0 +1,91 @@
+package object
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Canonical prints obj so that values two engines agree on print the same:
+// every kind of function prints as "function" and hash pairs are sorted,
+// since their order follows map iteration.
+func Canonical(obj Object) string {
+	switch obj.Type() {
+	case FUNCTION_OBJ, COMPILED_FUNCTION_OBJ, CLOSURE_OBJ:
+		return "function"
+	}
+	switch obj := obj.(type) {
+	case *Array:
+		elements := []string{}
+		for _, el := range obj.Elements {
+			elements = append(elements, Canonical(el))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *Hash:
+		pairs := []string{}
+		for _, pair := range obj.Pairs {
+			pairs = append(pairs, Canonical(pair.Key)+": "+Canonical(pair.Value))
+		}
+		sort.Strings(pairs)
+		return "{" + strings.Join(pairs, ", ") + "}"
+	}
+	return obj.Inspect()
+}
+
+// Quoted is Canonical with strings in quotes, so "1" and 1 don't look alike.
+func Quoted(obj Object) string {
+	switch obj := obj.(type) {
+	case *String:
+		return strconv.Quote(obj.Value)
+	case *Array:
+		elements := []string{}
+		for _, el := range obj.Elements {
+			elements = append(elements, Quoted(el))
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case *Hash:
+		pairs := []string{}
+		for _, pair := range obj.Pairs {
+			pairs = append(pairs, Quoted(pair.Key)+": "+Quoted(pair.Value))
+		}
+		sort.Strings(pairs)
+		return "{" + strings.Join(pairs, ", ") + "}"
+	}
+	return Canonical(obj)
+}
+
+// ErrorCategory names the kind of the runtime error in message, so that
+// errors two engines agree on compare the same even though every engine
+// words them its own way. A message of no known kind is its own category.
+func ErrorCategory(message string) string {
+	kind, detail, _ := strings.Cut(message, ": ")
+	switch {
+	case kind == "type mismatch":
+		return "type mismatch"
+	case kind == "unsoported types for binary operation", kind == "unknow operator":
+		// the vms end these with the operand types, in parentheses after a
+		// comparison, and they only differ in a type mismatch
+		types := strings.Fields(strings.TrimSuffix(detail[strings.LastIndex(detail, "(")+1:], ")"))
+		if len(types) == 2 && types[0] != types[1] {
+			return "type mismatch"
+		}
+		return "unknown operator"
+	case kind == "unknown operator", kind == "unknow integer operation", kind == "unsuported type for negation":
+		return "unknown operator"
+	case kind == "calling non-function", kind == "not a function":
+		return "not callable"
+	case strings.HasPrefix(kind, "index operat"), strings.HasPrefix(kind, "unsuported index"):
+		return "index"
+	case strings.HasPrefix(kind, "unusable as hash"), strings.HasPrefix(kind, "unable to hash key"):
+		return "hash key"
+	case strings.HasPrefix(kind, "wrong number of arguments"):
+		return "argument count"
+	case strings.HasPrefix(kind, "argument to `"):
+		return "argument"
+	case kind == "Stack Overflow":
+		return "stack overflow"
+	case kind == "identifier not found", kind == "undefined variable":
+		return "unknown identifier"
+	}
+	return message
+}
@@ -1,8 +1,15 @@
 package object
 
 type Enviroment struct {
-	store map[string]Object
-	outer *Enviroment
+	store    map[string]Object
+	outer    *Enviroment
+	importer Importer
+}
+
+// Importer evaluates the modules the code of an enviroment imports and
+// returns their exports.
+type Importer interface {
+	Import(path string) Object
 }
 
 func NewEnviroment() *Enviroment {
@@ -28,3 +35,27 @@ func NewEnclosedEnviroment(e *Enviroment) *Enviroment {
 	env.outer = e
 	return env
 }
+
+// Bindings returns the names set in e itself and their values.
+func (e *Enviroment) Bindings() map[string]Object {
+	bindings := make(map[string]Object, len(e.store))
+	for name, value := range e.store {
+		bindings[name] = value
+	}
+	return bindings
+}
+
+// SetImporter makes the imports in e and in the enviroments enclosed by it
+// use importer.
+func (e *Enviroment) SetImporter(importer Importer) {
+	e.importer = importer
+}
+
+// Importer returns the importer of e or of the closest enviroment around
+// it that has one, nil when none has.
+func (e *Enviroment) Importer() Importer {
+	if e.importer == nil && e.outer != nil {
+		return e.outer.Importer()
+	}
+	return e.importer
+}
@@ -6,6 +6,7 @@ import (
 	"hash/fnv"
 	"mokey-type/ast"
 	"mokey-type/code"
+	"sort"
 	"strings"
 )
 
@@ -94,8 +95,24 @@ func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return s.Value }
 
 type BuiltinFunction func(args ...Object) Object
+
+// Apply calls fn with args on the engine that is running, errors come back
+// as an *Error.
+type Apply func(fn Object, args ...Object) Object
+
 type Builtin struct {
 	Fn BuiltinFunction
+	// WithApply is set by the builtins that call the functions they are
+	// given, engines that can't call back keep using Fn.
+	WithApply func(apply Apply, args ...Object) Object
+}
+
+// Call runs the builtin, giving it apply when it wants one.
+func (b *Builtin) Call(apply Apply, args ...Object) Object {
+	if b.WithApply != nil && apply != nil {
+		return b.WithApply(apply, args...)
+	}
+	return b.Fn(args...)
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -159,6 +176,8 @@ func (h *Hash) Inspect() string {
 	for _, pair := range h.Pairs {
 		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
 	}
+	// map order changes from run to run
+	sort.Strings(pairs)
 	out.WriteString("{")
 	out.WriteString(strings.Join(pairs, ", "))
 	out.WriteString("}")
@@ -173,6 +192,17 @@ type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int
 	NumParameters int
+	SourceMap     code.SourceMap
+	// Name is the name the function was bound to with let, empty for
+	// anonymous functions
+	Name string
+	// LocalNames and FreeNames name the locals and the free variables by
+	// index, for debuggers
+	LocalNames []string
+	FreeNames  []string
+	// File is the module the function is in, empty for the functions of
+	// the program itself
+	File string
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
@@ -65,13 +65,13 @@ var Join = &Builtin{
 			arg1 := args[1].(*String).Value
 			return &String{Value: arg.Value + separator + arg1}
 		case *Array:
-			separator := args[1].(*String).Value
 			if len(args) != 2 {
 				return NewError("wrong number of arguments. got=%d, want=2", len(args))
 			}
 			if args[1].Type() != STRING_OBJ {
 				return NewError("argument to `join` must be STRING, got %s", args[1].Type())
 			}
+			separator := args[1].(*String).Value
 			elements := []string{}
 			for _, v := range arg.Elements {
 				elements = append(elements, v.Inspect())
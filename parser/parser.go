@@ -38,6 +38,7 @@ type Parser struct {
 	currentToken   token.Token
 	peekToken      token.Token
 	errors         []string
+	details        []Error
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
@@ -70,6 +71,7 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
 	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.IMPORT, p.parseImportExpression)
 	//infix
 	p.registerInfix(token.PLUS, p.parseInfixExpression)
 	p.registerInfix(token.MINUS, p.parseInfixExpression)
@@ -86,13 +88,29 @@ func New(l *lexer.Lexer) *Parser {
 	return p
 }
 
+// Error is a parser error together with the token it was reported at.
+type Error struct {
+	Message string
+	Token   token.Token
+}
+
 func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// ErrorDetails returns the same errors as Errors with their positions.
+func (p *Parser) ErrorDetails() []Error {
+	return p.details
+}
+
+func (p *Parser) addError(tok token.Token, msg string) {
+	p.errors = append(p.errors, msg)
+	p.details = append(p.details, Error{Message: msg, Token: tok})
+}
+
 func (p *Parser) peekError(t token.TokenType) {
 	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.addError(p.peekToken, msg)
 }
 
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
@@ -116,7 +134,11 @@ func (p *Parser) NextToken() {
 func (p *Parser) ParseStatement() ast.Statement {
 	switch p.currentToken.Type {
 	case token.LET:
-		return p.ParseLetStatement()
+		// a nil *ast.LetStatement would not compare equal to nil as a Statement
+		if statement := p.ParseLetStatement(); statement != nil {
+			return statement
+		}
+		return nil
 	case token.RETURN:
 		return p.ParseReturnStatement()
 	default:
@@ -130,6 +152,14 @@ func (p *Parser) ParseLetStatement() *ast.LetStatement {
 		return nil
 	}
 	ls.Name = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+	if p.peekTokenIs(token.COLON) {
+		p.NextToken()
+		p.NextToken()
+		ls.Type = p.parseType()
+		if ls.Type == nil {
+			return nil
+		}
+	}
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -159,7 +189,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	value, err := strconv.ParseInt(p.currentToken.Literal, 0, 64)
 	if err != nil {
 		msg := fmt.Sprintf("could not parse %q as integer", p.currentToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(p.currentToken, msg)
 		return nil
 	}
 	lit.Value = value
@@ -247,8 +277,8 @@ func (p *Parser) parseIdentifier() ast.Expression {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.Token) {
-	msg := fmt.Sprintf("no prefix parse function for %s found %+v", t.Type, t)
-	p.errors = append(p.errors, msg)
+	msg := fmt.Sprintf("no prefix parse function for %s found %q", t.Type, t.Literal)
+	p.addError(t, msg)
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
@@ -286,6 +316,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.NextToken()
 	}
+	block.Close = p.currentToken
 
 	return block
 }
@@ -316,29 +347,104 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expresssion
 }
 
-func (p *Parser) parseParameters() []*ast.Identifier {
+// parseParameters parses the parameters of a function literal, the
+// parameters are nil when the list is malformed.
+func (p *Parser) parseParameters() ([]*ast.Identifier, []*ast.TypeAnnotation) {
 	parameters := []*ast.Identifier{}
+	types := []*ast.TypeAnnotation{}
 
 	if p.currentTokenIs(token.RPAREN) {
-		return parameters
+		return parameters, types
 	}
 
-	ident := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
-	parameters = append(parameters, ident)
-	for p.peekTokenIs(token.COMMA) {
+	for {
+		if !p.currentTokenIs(token.IDENT) {
+			p.addError(p.currentToken, fmt.Sprintf("expected a parameter name, got %s", p.currentToken.Type))
+			return nil, nil
+		}
+		ident := &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
+		parameters = append(parameters, ident)
+		var annotation *ast.TypeAnnotation
+		if p.peekTokenIs(token.COLON) {
+			p.NextToken()
+			p.NextToken()
+			annotation = p.parseType()
+			if annotation == nil {
+				return nil, nil
+			}
+		}
+		types = append(types, annotation)
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
 		p.NextToken()
 		p.NextToken()
-		ident = &ast.Identifier{Token: p.currentToken, Value: p.currentToken.Literal}
-		parameters = append(parameters, ident)
 	}
 
-	if !p.peekTokenIs(token.RPAREN) {
-		return nil
+	if !p.expectPeek(token.RPAREN) {
+		return nil, nil
 	}
 
-	p.NextToken()
+	return parameters, types
+}
+
+// parseType parses the type annotation that starts at the current token.
+func (p *Parser) parseType() *ast.TypeAnnotation {
+	annotation := &ast.TypeAnnotation{Token: p.currentToken}
+	switch p.currentToken.Type {
+	case token.IDENT:
+		annotation.Name = p.currentToken.Literal
+
+	case token.LBRACKET:
+		p.NextToken()
+		annotation.Element = p.parseType()
+		if annotation.Element == nil || !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+
+	case token.LBRACE:
+		p.NextToken()
+		annotation.Key = p.parseType()
+		if annotation.Key == nil || !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.NextToken()
+		annotation.Value = p.parseType()
+		if annotation.Value == nil || !p.expectPeek(token.RBRACE) {
+			return nil
+		}
 
-	return parameters
+	case token.FUNCTION:
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		annotation.Parameters = []*ast.TypeAnnotation{}
+		for !p.peekTokenIs(token.RPAREN) {
+			p.NextToken()
+			param := p.parseType()
+			if param == nil {
+				return nil
+			}
+			annotation.Parameters = append(annotation.Parameters, param)
+			if !p.peekTokenIs(token.RPAREN) && !p.expectPeek(token.COMMA) {
+				return nil
+			}
+		}
+		p.NextToken()
+		if p.peekTokenIs(token.ARROW) {
+			p.NextToken()
+			p.NextToken()
+			annotation.Return = p.parseType()
+			if annotation.Return == nil {
+				return nil
+			}
+		}
+
+	default:
+		p.addError(p.currentToken, fmt.Sprintf("expected a type, got %s", p.currentToken.Type))
+		return nil
+	}
+	return annotation
 }
 
 func (p *Parser) parseFunctionLiteral() ast.Expression {
@@ -347,7 +453,19 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 	p.NextToken()
-	literal.Parameters = p.parseParameters()
+	literal.Parameters, literal.ParameterTypes = p.parseParameters()
+	if literal.Parameters == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.ARROW) {
+		p.NextToken()
+		p.NextToken()
+		literal.ReturnType = p.parseType()
+		if literal.ReturnType == nil {
+			return nil
+		}
+	}
 
 	if !p.expectPeek(token.LBRACE) {
 		return nil
@@ -427,6 +545,15 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
 }
 
+func (p *Parser) parseImportExpression() ast.Expression {
+	expression := &ast.ImportExpression{Token: p.currentToken}
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	expression.Path = &ast.StringLiteral{Token: p.currentToken, Value: p.currentToken.Literal}
+	return expression
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.currentToken}
 	array.Elements = p.parseExpressionList(token.RBRACKET)
@@ -463,6 +590,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		p.NextToken()
 		value := p.parseExpression(LOWEST)
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
@@ -483,7 +611,7 @@ func (p *Parser) ParseProgram() *ast.Program {
 		if p.currentToken.Type != "" {
 			statement = p.ParseStatement()
 		}
-		if statement != nil && statement.TokenLiteral() != "" {
+		if statement != nil {
 			program.Statements = append(program.Statements, statement)
 		}
 		p.NextToken()
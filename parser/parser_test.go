@@ -3,6 +3,7 @@ package parser
 import (
 	"fmt"
 	"mokey-type/ast"
+	"mokey-type/fuzz"
 	"mokey-type/lexer"
 	"strconv"
 	"testing"
@@ -380,7 +381,7 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		},
 		{
 			"3 + 4; -5 * 5",
-			"(3 + 4)((-5) * 5)",
+			"(3 + 4);((-5) * 5)",
 		},
 		{
 			"5 > 4 == 3 < 4",
@@ -581,6 +582,26 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestFunctionParameterErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(1) {}", "expected a parameter name, got INT"},
+		{`fn("s") { 1 }`, "expected a parameter name, got STRING"},
+		{"fn(a,) { a }", "expected a parameter name, got )"},
+		{"fn(a b) { a }", "expected next token to be ), got IDENT instead"},
+		{"fn(\x8d){", "expected a parameter name, got ILLEGAL"},
+	}
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want first=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 	l := lexer.New(input)
@@ -625,6 +646,21 @@ func TestStringLiteral(t *testing.T) {
 	}
 }
 
+func TestEmptyStringStatement(t *testing.T) {
+	input := `""; 1`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	if _, ok := stmt.Expression.(*ast.StringLiteral); !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+}
+
 func TestParsingArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 	l := lexer.New(input)
@@ -663,6 +699,35 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestImportExpression(t *testing.T) {
+	input := `import "lib/math"["add"]`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+	importExp, ok := indexExp.Left.(*ast.ImportExpression)
+	if !ok {
+		t.Fatalf("exp not *ast.ImportExpression. got=%T", indexExp.Left)
+	}
+	if importExp.Path.Value != "lib/math" {
+		t.Errorf("wrong path %q", importExp.Path.Value)
+	}
+	if program.String() != `(import "lib/math"["add"])` {
+		t.Errorf("wrong string %q", program.String())
+	}
+
+	p = New(lexer.New("import math"))
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Errorf("expected an error for a path that is not a string")
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 	l := lexer.New(input)
@@ -687,7 +752,7 @@ func TestParsingHashLiteralsStringKeys(t *testing.T) {
 		if !ok {
 			t.Errorf("key is not ast.StringLiteral. got=%T", key)
 		}
-		expectedValue := expected[literal.String()]
+		expectedValue := expected[literal.Value]
 		testIntegerLiteral(t, value, expectedValue)
 	}
 }
@@ -739,9 +804,9 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 			t.Errorf("key is not ast.StringLiteral. got=%T", key)
 			continue
 		}
-		testFunc, ok := tests[literal.String()]
+		testFunc, ok := tests[literal.Value]
 		if !ok {
-			t.Errorf("No test function for key %q found", literal.String())
+			t.Errorf("No test function for key %q found", literal.Value)
 			continue
 		}
 		testFunc(value)
@@ -808,3 +873,96 @@ func TestForLoop(t *testing.T) {
 		}
 	}
 }
+
+func TestInvalidLetStatement(t *testing.T) {
+	p := New(lexer.New("let = 3; let x 5; let y = 1;"))
+	program := p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected parser errors")
+	}
+	for _, statement := range program.Statements {
+		if statement == nil {
+			t.Fatalf("program has a nil statement")
+		}
+		_ = statement.String()
+	}
+
+	details := p.ErrorDetails()
+	if len(details) != len(p.Errors()) {
+		t.Fatalf("ErrorDetails and Errors differ. %d != %d", len(details), len(p.Errors()))
+	}
+	if details[0].Token.Line != 1 || details[0].Token.Column != 5 {
+		t.Errorf("first error at wrong position %d:%d", details[0].Token.Line, details[0].Token.Column)
+	}
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: int = 5;", "let x: int = 5;"},
+		{"let xs: [string] = [];", "let xs: [string] = [];"},
+		{"let h: {string: [int]} = {};", "let h: {string: [int]} = {};"},
+		{"let f: fn(int, string) -> bool = g;", "let f: fn(int, string) -> bool = g;"},
+		{"let f: fn() = g;", "let f: fn() = g;"},
+		{"let f: fn(fn(int) -> int) -> [int] = g;", "let f: fn(fn(int) -> int) -> [int] = g;"},
+		{"fn(a: string, b: [int]) -> bool { true }", "fn(a: string, b: [int]) -> bool {true}"},
+		{"fn(a, b: int) { a }", "fn(a, b: int) {a}"},
+		{"fn() -> fn() -> int { f }", "fn() -> fn() -> int {f}"},
+		{"for (let i: int = 0; i < 1; ++i) { i }", "for (let i: int = 0; (i < 1); (++i)) {i}"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("wrong program for %q.\nwant=%q\n got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	fn := New(lexer.New("fn(a, b: int) { a }")).ParseProgram().Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(fn.ParameterTypes) != 2 || fn.ParameterTypes[0] != nil || fn.ParameterTypes[1].Name != "int" {
+		t.Errorf("wrong parameter types %+v", fn.ParameterTypes)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: = 5;", "expected a type, got ="},
+		{"let x: [int = 5;", "expected next token to be ], got = instead"},
+		{"fn(a: 5) { a }", "expected a type, got INT"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. want first=%q, got=%q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+// FuzzParser checks that the parser reports errors instead of panicking and
+// that the String of a program parses back to the same program.
+func FuzzParser(f *testing.F) {
+	fuzz.Seeds(f, "*_test.go", "../conformance/*.go")
+	f.Fuzz(func(t *testing.T, input string) {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return
+		}
+		printed := program.String()
+		p = New(lexer.New(printed))
+		reparsed := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("String of %q does not parse. printed=%q errors=%q", input, printed, p.Errors())
+		}
+		if reparsed.String() != printed {
+			t.Fatalf("String of %q parses to another program.\nprinted=%q\n   got=%q", input, printed, reparsed.String())
+		}
+	})
+}
@@ -0,0 +1,258 @@
+// Package pprof writes profiles in the protobuf format of pprof, so
+// `go tool pprof` can show them. It only encodes what the vm's profiler
+// records, see https://github.com/google/pprof/blob/main/proto/profile.proto
+// for the whole format.
+package pprof
+
+import (
+	"compress/gzip"
+	"io"
+	"sort"
+	"time"
+)
+
+// ValueType is the name and unit of a value of the samples, like cpu and
+// nanoseconds.
+type ValueType struct {
+	Type string
+	Unit string
+}
+
+// Function is a function that shows up in the stacks.
+type Function struct {
+	Name      string
+	File      string
+	StartLine int
+}
+
+// Frame is a line of a function.
+type Frame struct {
+	Function Function
+	Line     int
+}
+
+// Sample is a stack, innermost frame first, with one value for each of the
+// profile's sample types.
+type Sample struct {
+	Stack  []Frame
+	Values []int64
+	Labels map[string]string
+}
+
+// Profile is the samples and how they were taken.
+type Profile struct {
+	SampleTypes []ValueType
+	Samples     []Sample
+	// Period is how much of PeriodType a sample stands for
+	PeriodType ValueType
+	Period     int64
+	Time       time.Time
+	Duration   time.Duration
+}
+
+// field numbers of profile.proto
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+	sampleLabel      = 3
+
+	labelKey = 1
+	labelStr = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID        = 1
+	functionName      = 2
+	functionFilename  = 4
+	functionStartLine = 5
+)
+
+// Write encodes the profile gzipped, like pprof expects it.
+func (p *Profile) Write(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(p.Encode()); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Encode returns the profile as an uncompressed protobuf message. Functions
+// and frames are numbered in the order they first appear in the samples.
+func (p *Profile) Encode() []byte {
+	e := &encoder{strings: map[string]int{"": 0}, table: []string{""}, functions: map[Function]int{}, locations: map[Frame]int{}}
+	var out buffer
+
+	for _, t := range p.SampleTypes {
+		out.message(profileSampleType, e.valueType(t))
+	}
+	for _, s := range p.Samples {
+		var sample buffer
+		ids := []uint64{}
+		for _, frame := range s.Stack {
+			ids = append(ids, uint64(e.location(frame)))
+		}
+		sample.packed(sampleLocationID, ids)
+		values := []uint64{}
+		for _, v := range s.Values {
+			values = append(values, uint64(v))
+		}
+		sample.packed(sampleValue, values)
+		for _, key := range sortedKeys(s.Labels) {
+			var label buffer
+			label.varint(labelKey, uint64(e.str(key)))
+			label.varint(labelStr, uint64(e.str(s.Labels[key])))
+			sample.message(sampleLabel, label)
+		}
+		out.message(profileSample, sample)
+	}
+	out.bytes = append(out.bytes, e.locationsAndFunctions.bytes...)
+	out.varint(profileTimeNanos, uint64(p.Time.UnixNano()))
+	out.varint(profileDurationNanos, uint64(p.Duration))
+	out.message(profilePeriodType, e.valueType(p.PeriodType))
+	out.varint(profilePeriod, uint64(p.Period))
+	// the strings go last, every other field has added its own by now
+	for _, s := range e.table {
+		out.string(profileStringTable, s)
+	}
+	return out.bytes
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// encoder numbers the strings, functions and locations of a profile.
+type encoder struct {
+	strings   map[string]int
+	table     []string
+	functions map[Function]int
+	locations map[Frame]int
+	// locationsAndFunctions has the messages of both, in the order they
+	// were numbered
+	locationsAndFunctions buffer
+}
+
+func (e *encoder) str(s string) int {
+	if i, ok := e.strings[s]; ok {
+		return i
+	}
+	e.strings[s] = len(e.table)
+	e.table = append(e.table, s)
+	return e.strings[s]
+}
+
+func (e *encoder) valueType(t ValueType) buffer {
+	var b buffer
+	b.varint(valueTypeType, uint64(e.str(t.Type)))
+	b.varint(valueTypeUnit, uint64(e.str(t.Unit)))
+	return b
+}
+
+func (e *encoder) function(f Function) int {
+	if id, ok := e.functions[f]; ok {
+		return id
+	}
+	id := len(e.functions) + 1
+	e.functions[f] = id
+	var b buffer
+	b.varint(functionID, uint64(id))
+	b.varint(functionName, uint64(e.str(f.Name)))
+	b.varint(functionFilename, uint64(e.str(f.File)))
+	b.varint(functionStartLine, uint64(f.StartLine))
+	e.locationsAndFunctions.message(profileFunction, b)
+	return id
+}
+
+func (e *encoder) location(f Frame) int {
+	if id, ok := e.locations[f]; ok {
+		return id
+	}
+	function := e.function(f.Function)
+	id := len(e.locations) + 1
+	e.locations[f] = id
+	var line buffer
+	line.varint(lineFunctionID, uint64(function))
+	line.varint(lineLine, uint64(f.Line))
+	var b buffer
+	b.varint(locationID, uint64(id))
+	b.message(locationLine, line)
+	e.locationsAndFunctions.message(profileLocation, b)
+	return id
+}
+
+// buffer builds a protobuf message, fields with a zero value are left out
+// like proto3 does.
+type buffer struct {
+	bytes []byte
+}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *buffer) uvarint(n uint64) {
+	for n >= 0x80 {
+		b.bytes = append(b.bytes, byte(n)|0x80)
+		n >>= 7
+	}
+	b.bytes = append(b.bytes, byte(n))
+}
+
+func (b *buffer) key(field, wire int) {
+	b.uvarint(uint64(field<<3 | wire))
+}
+
+func (b *buffer) varint(field int, n uint64) {
+	if n == 0 {
+		return
+	}
+	b.key(field, wireVarint)
+	b.uvarint(n)
+}
+
+func (b *buffer) packed(field int, ns []uint64) {
+	if len(ns) == 0 {
+		return
+	}
+	var values buffer
+	for _, n := range ns {
+		values.uvarint(n)
+	}
+	b.message(field, values)
+}
+
+// string is always written, the string table starts with an empty one.
+func (b *buffer) string(field int, s string) {
+	b.key(field, wireBytes)
+	b.uvarint(uint64(len(s)))
+	b.bytes = append(b.bytes, s...)
+}
+
+func (b *buffer) message(field int, m buffer) {
+	b.key(field, wireBytes)
+	b.uvarint(uint64(len(m.bytes)))
+	b.bytes = append(b.bytes, m.bytes...)
+}
@@ -0,0 +1,137 @@
+package pprof
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// field is a decoded field of a protobuf message, messages and strings are
+// left as bytes.
+type field struct {
+	number int
+	value  uint64
+	bytes  []byte
+}
+
+func decode(t *testing.T, b []byte) []field {
+	t.Helper()
+	fields := []field{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("bad key in %v", b)
+		}
+		b = b[n:]
+		f := field{number: int(key >> 3)}
+		switch key & 7 {
+		case wireVarint:
+			f.value, n = binary.Uvarint(b)
+			b = b[n:]
+		case wireBytes:
+			length, n := binary.Uvarint(b)
+			b = b[n:]
+			f.bytes = b[:length]
+			b = b[length:]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func packed(b []byte) []uint64 {
+	values := []uint64{}
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		values = append(values, v)
+		b = b[n:]
+	}
+	return values
+}
+
+func TestWrite(t *testing.T) {
+	main := Function{Name: "main", File: "fib.mk", StartLine: 1}
+	fib := Function{Name: "fib", File: "fib.mk", StartLine: 2}
+	p := &Profile{
+		SampleTypes: []ValueType{{"samples", "count"}, {"cpu", "nanoseconds"}},
+		Samples: []Sample{
+			{Stack: []Frame{{fib, 3}, {main, 5}}, Values: []int64{2, 2000}, Labels: map[string]string{"opcode": "OpAdd"}},
+			{Stack: []Frame{{fib, 3}, {fib, 4}, {main, 5}}, Values: []int64{1, 1000}},
+		},
+		PeriodType: ValueType{"cpu", "nanoseconds"},
+		Period:     1000,
+		Time:       time.Unix(0, 42),
+		Duration:   3 * time.Microsecond,
+	}
+
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("not gzipped: %s", err)
+	}
+	encoded, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var strings []string
+	var samples, locations, functions [][]field
+	scalars := map[int]uint64{}
+	for _, f := range decode(t, encoded) {
+		switch f.number {
+		case profileStringTable:
+			strings = append(strings, string(f.bytes))
+		case profileSample:
+			samples = append(samples, decode(t, f.bytes))
+		case profileLocation:
+			locations = append(locations, decode(t, f.bytes))
+		case profileFunction:
+			functions = append(functions, decode(t, f.bytes))
+		case profileTimeNanos, profileDurationNanos, profilePeriod:
+			scalars[f.number] = f.value
+		}
+	}
+
+	if want := []string{"", "samples", "count", "cpu", "nanoseconds", "fib", "fib.mk", "main", "opcode", "OpAdd"}; !reflect.DeepEqual(strings, want) {
+		t.Errorf("wrong string table.\nwant=%q\n got=%q", want, strings)
+	}
+	if want := map[int]uint64{profileTimeNanos: 42, profileDurationNanos: 3000, profilePeriod: 1000}; !reflect.DeepEqual(scalars, want) {
+		t.Errorf("wrong scalars. want=%v, got=%v", want, scalars)
+	}
+	// fib:3, main:5 and fib:4 are three locations of two functions
+	if len(locations) != 3 || len(functions) != 2 {
+		t.Fatalf("want 3 locations and 2 functions, got %d and %d", len(locations), len(functions))
+	}
+	if len(samples) != 2 {
+		t.Fatalf("want 2 samples, got %d", len(samples))
+	}
+	second := samples[1]
+	if ids := packed(second[0].bytes); !reflect.DeepEqual(ids, []uint64{1, 3, 2}) {
+		t.Errorf("wrong stack of the second sample %v", ids)
+	}
+	if values := packed(second[1].bytes); !reflect.DeepEqual(values, []uint64{1, 1000}) {
+		t.Errorf("wrong values of the second sample %v", values)
+	}
+	label := decode(t, samples[0][2].bytes)
+	if strings[label[0].value] != "opcode" || strings[label[1].value] != "OpAdd" {
+		t.Errorf("wrong label %v", label)
+	}
+
+	fibLocation := decode(t, locations[2][1].bytes)
+	if fibLocation[0].value != 1 || fibLocation[1].value != 4 {
+		t.Errorf("location 3 should be line 4 of function 1, got %v", fibLocation)
+	}
+	function := functions[0]
+	if strings[function[1].value] != "fib" || strings[function[2].value] != "fib.mk" || function[3].value != 2 {
+		t.Errorf("wrong first function %v", function)
+	}
+}
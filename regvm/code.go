@@ -0,0 +1,140 @@
+package regvm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"mokey-type/code"
+)
+
+// Opcodes of the register machine. Operands named A, B and C are register
+// numbers relative to the frame base, K is a constant index and T a jump
+// target, so "OpAdd A B C" means R[A] = R[B] + R[C].
+type Opcode byte
+
+const (
+	OpLoadConstant   Opcode = iota // A K
+	OpLoadInt                      // A value
+	OpLoadTrue                     // A
+	OpLoadFalse                    // A
+	OpLoadNull                     // A
+	OpMove                         // A B
+	OpGetGlobal                    // A K
+	OpSetGlobal                    // K A
+	OpGetBuiltin                   // A K
+	OpGetFree                      // A K
+	OpCurrentClosure               // A
+	OpAdd                          // A B C
+	OpSub                          // A B C
+	OpMul                          // A B C
+	OpDiv                          // A B C
+	OpEqual                        // A B C
+	OpNotEqual                     // A B C
+	OpGreaterThan                  // A B C
+	OpMinus                        // A B
+	OpBang                         // A B
+	OpJump                         // T
+	OpJumpNotTruthy                // A T
+	OpArray                        // A B C: R[A] = [R[B] ... R[B+C-1]]
+	OpHash                         // A B C: R[A] = {R[B]: R[B+1] ...}, C registers
+	OpIndex                        // A B C: R[A] = R[B][R[C]]
+	OpCall                         // A B C: R[A] = R[B](R[B+1] ... R[B+C])
+	OpClosure                      // A K B C: R[A] = closure of K with free R[B] ... R[B+C-1]
+	OpReturnValue                  // A
+	OpReturn                       //
+	OpPop                          // A: record R[A] as the last expression value
+)
+
+var definitions = map[Opcode]*code.Definition{
+	OpLoadConstant:   {Name: "OpLoadConstant", OperandWidths: []int{2, 2}},
+	OpLoadInt:        {Name: "OpLoadInt", OperandWidths: []int{2, 4}},
+	OpLoadTrue:       {Name: "OpLoadTrue", OperandWidths: []int{2}},
+	OpLoadFalse:      {Name: "OpLoadFalse", OperandWidths: []int{2}},
+	OpLoadNull:       {Name: "OpLoadNull", OperandWidths: []int{2}},
+	OpMove:           {Name: "OpMove", OperandWidths: []int{2, 2}},
+	OpGetGlobal:      {Name: "OpGetGlobal", OperandWidths: []int{2, 2}},
+	OpSetGlobal:      {Name: "OpSetGlobal", OperandWidths: []int{2, 2}},
+	OpGetBuiltin:     {Name: "OpGetBuiltin", OperandWidths: []int{2, 2}},
+	OpGetFree:        {Name: "OpGetFree", OperandWidths: []int{2, 2}},
+	OpCurrentClosure: {Name: "OpCurrentClosure", OperandWidths: []int{2}},
+	OpAdd:            {Name: "OpAdd", OperandWidths: []int{2, 2, 2}},
+	OpSub:            {Name: "OpSub", OperandWidths: []int{2, 2, 2}},
+	OpMul:            {Name: "OpMul", OperandWidths: []int{2, 2, 2}},
+	OpDiv:            {Name: "OpDiv", OperandWidths: []int{2, 2, 2}},
+	OpEqual:          {Name: "OpEqual", OperandWidths: []int{2, 2, 2}},
+	OpNotEqual:       {Name: "OpNotEqual", OperandWidths: []int{2, 2, 2}},
+	OpGreaterThan:    {Name: "OpGreaterThan", OperandWidths: []int{2, 2, 2}},
+	OpMinus:          {Name: "OpMinus", OperandWidths: []int{2, 2}},
+	OpBang:           {Name: "OpBang", OperandWidths: []int{2, 2}},
+	OpJump:           {Name: "OpJump", OperandWidths: []int{2}},
+	OpJumpNotTruthy:  {Name: "OpJumpNotTruthy", OperandWidths: []int{2, 2}},
+	OpArray:          {Name: "OpArray", OperandWidths: []int{2, 2, 2}},
+	OpHash:           {Name: "OpHash", OperandWidths: []int{2, 2, 2}},
+	OpIndex:          {Name: "OpIndex", OperandWidths: []int{2, 2, 2}},
+	OpCall:           {Name: "OpCall", OperandWidths: []int{2, 2, 2}},
+	OpClosure:        {Name: "OpClosure", OperandWidths: []int{2, 2, 2, 2}},
+	OpReturnValue:    {Name: "OpReturnValue", OperandWidths: []int{2}},
+	OpReturn:         {Name: "OpReturn", OperandWidths: []int{}},
+	OpPop:            {Name: "OpPop", OperandWidths: []int{2}},
+}
+
+func Lookup(op byte) (*code.Definition, error) {
+	def, ok := definitions[Opcode(op)]
+
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+	return def, nil
+}
+
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+	offset := 1
+
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 4:
+			binary.BigEndian.PutUint32(instruction[offset:], uint32(o))
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		}
+		offset += width
+	}
+	return instruction
+}
+
+func Disassemble(ins code.Instructions) string {
+	var out bytes.Buffer
+	i := 0
+
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "%04d ERROR: %s\n", i, err)
+			i++
+			continue
+		}
+		operands, read := code.ReadOperands(def, ins[i+1:])
+		fmt.Fprintf(&out, "%04d %s", i, def.Name)
+		for _, o := range operands {
+			fmt.Fprintf(&out, " %d", o)
+		}
+		out.WriteString("\n")
+		i += 1 + read
+	}
+
+	return out.String()
+}
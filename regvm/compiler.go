@@ -0,0 +1,665 @@
+package regvm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"mokey-type/ast"
+	"mokey-type/code"
+	"mokey-type/compiler"
+	"mokey-type/object"
+	"sort"
+)
+
+// Bytecode is the output of the register compiler. NumRegisters is the size
+// of the register window of the main program; functions keep theirs in
+// CompiledFunction.NumLocals.
+type Bytecode struct {
+	Instructions code.Instructions
+	Constants    []object.Object
+	NumRegisters int
+}
+
+// Every function gets a window of registers. Parameters and let bindings
+// keep the index the symbol table gives them, temporaries are allocated
+// above them like a stack and released once the expression is done.
+type compilationScope struct {
+	instructions    code.Instructions
+	lastInstruction Opcode
+	numLocals       int
+	defined         int
+	next            int
+	max             int
+}
+
+type Compiler struct {
+	constants   []object.Object
+	symbolTable *compiler.SymbolTable
+
+	scopes     []*compilationScope
+	scopeIndex int
+}
+
+func NewCompiler() *Compiler {
+	symbolTable := compiler.NewSymbolTable()
+
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: symbolTable,
+		scopes:      []*compilationScope{{instructions: code.Instructions{}}},
+		scopeIndex:  0,
+	}
+}
+
+func NewCompilerWithState(symbols *compiler.SymbolTable, constants []object.Object) *Compiler {
+	c := NewCompiler()
+	c.constants = constants
+	c.symbolTable = symbols
+
+	return c
+}
+
+func (c *Compiler) Compile(node ast.Node) error {
+	switch node := node.(type) {
+	case *ast.Program:
+		for _, s := range node.Statements {
+			err := c.compileStatement(s)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case ast.Statement:
+		return c.compileStatement(node)
+
+	default:
+		return fmt.Errorf("unsupported node %T", node)
+	}
+}
+
+func (c *Compiler) Bytecode() *Bytecode {
+	scope := c.scopes[0]
+	return &Bytecode{
+		Instructions: scope.instructions,
+		Constants:    c.constants,
+		NumRegisters: scope.max,
+	}
+}
+
+func (c *Compiler) compileStatement(node ast.Statement) error {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		mark := c.scope().next
+		defer c.release(mark)
+
+		reg := c.alloc()
+		err := c.compileExpression(node.Expression, reg)
+		if err != nil {
+			return err
+		}
+		if c.scopeIndex == 0 {
+			c.emit(OpPop, reg)
+		}
+
+	case *ast.LetStatement:
+		// a value that uses the name reads the variable defined before, it
+		// can't be built in the register the let writes
+		if c.scopeIndex > 0 && !uses(node.Value, node.Name.Value) {
+			symbol := c.define(node.Name.Value)
+			return c.compileExpression(node.Value, symbol.Index)
+		}
+
+		mark := c.scope().next
+		defer c.release(mark)
+
+		reg, err := c.operand(node.Value)
+		if err != nil {
+			return err
+		}
+		symbol := c.define(node.Name.Value)
+		if symbol.Scope == compiler.LocalScope {
+			if reg != symbol.Index {
+				c.emit(OpMove, symbol.Index, reg)
+			}
+			return nil
+		}
+		c.emit(OpSetGlobal, symbol.Index, reg)
+
+	case *ast.ReturnStatement:
+		mark := c.scope().next
+		defer c.release(mark)
+
+		reg, err := c.operand(node.ReturnValue)
+		if err != nil {
+			return err
+		}
+		c.emit(OpReturnValue, reg)
+
+	default:
+		return fmt.Errorf("unsupported statement %T", node)
+	}
+	return nil
+}
+
+// compileExpression leaves the value of node in register dst.
+func (c *Compiler) compileExpression(node ast.Expression, dst int) error {
+	mark := c.scope().next
+	defer c.release(mark)
+
+	switch node := node.(type) {
+	case *ast.IntegerLiteral:
+		integer := &object.Integer{Value: node.Value}
+		c.emit(OpLoadConstant, dst, c.addConstant(integer))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(OpLoadConstant, dst, c.addConstant(str))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(OpLoadTrue, dst)
+		} else {
+			c.emit(OpLoadFalse, dst)
+		}
+
+	case *ast.Identifier:
+		symbol, ok := c.symbolTable.Resolve(node.Value)
+		if !ok {
+			return fmt.Errorf("undefined variable: %s", node.Value)
+		}
+		c.loadSymbol(symbol, dst)
+
+	case *ast.PrefixExpression:
+		right, err := c.operand(node.Right)
+		if err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "!":
+			c.emit(OpBang, dst, right)
+
+		case "-":
+			c.emit(OpMinus, dst, right)
+
+		case "++":
+			one := c.alloc()
+			c.emit(OpLoadInt, one, 1)
+			c.emit(OpAdd, dst, right, one)
+
+		case "--":
+			one := c.alloc()
+			c.emit(OpLoadInt, one, 1)
+			c.emit(OpSub, dst, right, one)
+
+		default:
+			return fmt.Errorf("unknown operato %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		left, err := c.operandBefore(node.Left, node.Right)
+		if err != nil {
+			return err
+		}
+		right, err := c.operand(node.Right)
+		if err != nil {
+			return err
+		}
+		switch node.Operator {
+		case "+":
+			c.emit(OpAdd, dst, left, right)
+
+		case "-":
+			c.emit(OpSub, dst, left, right)
+
+		case "*":
+			c.emit(OpMul, dst, left, right)
+
+		case "/":
+			c.emit(OpDiv, dst, left, right)
+
+		case ">":
+			c.emit(OpGreaterThan, dst, left, right)
+
+		case "<":
+			c.emit(OpGreaterThan, dst, right, left)
+
+		case "==":
+			c.emit(OpEqual, dst, left, right)
+
+		case "!=":
+			c.emit(OpNotEqual, dst, left, right)
+
+		default:
+			return fmt.Errorf("unknow operator %s", node.Operator)
+		}
+
+	case *ast.IfExpression:
+		condition, err := c.operand(node.Condition)
+		if err != nil {
+			return err
+		}
+		//Bogus value for jump
+		jumpNotTruthyPos := c.emit(OpJumpNotTruthy, condition, 9999)
+
+		err = c.compileBlock(node.Consequence, dst)
+		if err != nil {
+			return err
+		}
+		jumpPos := c.emit(OpJump, 9999)
+		c.changeOperand(jumpNotTruthyPos, 1, len(c.currentInstructions()))
+
+		if node.Alternative == nil {
+			c.emit(OpLoadNull, dst)
+		} else {
+			err = c.compileBlock(node.Alternative, dst)
+			if err != nil {
+				return err
+			}
+		}
+		c.changeOperand(jumpPos, 0, len(c.currentInstructions()))
+
+	case *ast.ArrayLiteral:
+		base := c.allocRange(len(node.Elements))
+		for i, el := range node.Elements {
+			err := c.compileExpression(el, base+i)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(OpArray, dst, base, len(node.Elements))
+
+	case *ast.HashLiteral:
+		keys := []ast.Expression{}
+		for k := range node.Pairs {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		base := c.allocRange(len(keys) * 2)
+		for i, k := range keys {
+			err := c.compileExpression(k, base+2*i)
+			if err != nil {
+				return err
+			}
+			err = c.compileExpression(node.Pairs[k], base+2*i+1)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(OpHash, dst, base, len(keys)*2)
+
+	case *ast.IndexExpression:
+		left, err := c.operandBefore(node.Left, node.Index)
+		if err != nil {
+			return err
+		}
+		index, err := c.operand(node.Index)
+		if err != nil {
+			return err
+		}
+		c.emit(OpIndex, dst, left, index)
+
+	case *ast.CallExpression:
+		base := c.allocRange(len(node.Arguments) + 1)
+		err := c.compileExpression(node.Function, base)
+		if err != nil {
+			return err
+		}
+		for i, arg := range node.Arguments {
+			err = c.compileExpression(arg, base+1+i)
+			if err != nil {
+				return err
+			}
+		}
+		c.emit(OpCall, dst, base, len(node.Arguments))
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, dst)
+
+	case *ast.ForLoop:
+		return c.compileForLoop(node, dst)
+
+	default:
+		return fmt.Errorf("unsupported expression %T", node)
+	}
+	return nil
+}
+
+// compileBlock runs the statements of block and leaves the value of the
+// last expression statement, or null, in dst.
+func (c *Compiler) compileBlock(block *ast.BlockStatement, dst int) error {
+	statements := block.Statements
+	if len(statements) == 0 {
+		c.emit(OpLoadNull, dst)
+		return nil
+	}
+
+	for _, s := range statements[:len(statements)-1] {
+		err := c.compileStatement(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	last := statements[len(statements)-1]
+	if es, ok := last.(*ast.ExpressionStatement); ok {
+		return c.compileExpression(es.Expression, dst)
+	}
+
+	err := c.compileStatement(last)
+	if err != nil {
+		return err
+	}
+	c.emit(OpLoadNull, dst)
+	return nil
+}
+
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral, dst int) error {
+	c.enterScope(len(node.Parameters) + countLocals(node.Body.Statements))
+	if node.Name != "" {
+		c.symbolTable.DefineFunctionName(node.Name)
+	}
+	for _, arg := range node.Parameters {
+		c.define(arg.Value)
+	}
+
+	statements := node.Body.Statements
+	for i, s := range statements {
+		es, ok := s.(*ast.ExpressionStatement)
+		if !ok || i != len(statements)-1 {
+			err := c.compileStatement(s)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		reg, err := c.operand(es.Expression)
+		if err != nil {
+			return err
+		}
+		c.emit(OpReturnValue, reg)
+	}
+
+	if !c.lastInstructionIs(OpReturnValue) {
+		c.emit(OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	scope := c.scopes[c.scopeIndex]
+	if scope.defined != scope.numLocals {
+		return fmt.Errorf("register allocation failed: counted %d locals, defined %d", scope.numLocals, scope.defined)
+	}
+	instructions := c.leaveScope()
+
+	base := c.allocRange(len(freeSymbols))
+	for i, s := range freeSymbols {
+		c.loadSymbol(s, base+i)
+	}
+
+	compiledFunc := &object.CompiledFunction{
+		Instructions:  instructions,
+		NumLocals:     scope.max,
+		NumParameters: len(node.Parameters),
+	}
+
+	c.emit(OpClosure, dst, c.addConstant(compiledFunc), base, len(freeSymbols))
+	return nil
+}
+
+func (c *Compiler) compileForLoop(node *ast.ForLoop, dst int) error {
+	err := c.compileStatement(&node.Declaration)
+	if err != nil {
+		return err
+	}
+
+	indexSymbol, _ := c.symbolTable.Resolve(node.Declaration.Name.Value)
+
+	conditionPos := len(c.currentInstructions())
+
+	mark := c.scope().next
+	condition, err := c.operand(node.Condition)
+	if err != nil {
+		return err
+	}
+	//Bogus value for jump
+	jumpNotTruthyPos := c.emit(OpJumpNotTruthy, condition, 9999)
+	c.release(mark)
+
+	for _, s := range node.Body.Statements {
+		err = c.compileStatement(s)
+		if err != nil {
+			return err
+		}
+	}
+
+	if indexSymbol.Scope == compiler.LocalScope {
+		err = c.compileExpression(node.Consequence, indexSymbol.Index)
+		if err != nil {
+			return err
+		}
+	} else {
+		reg, err := c.operand(node.Consequence)
+		if err != nil {
+			return err
+		}
+		c.emit(OpSetGlobal, indexSymbol.Index, reg)
+	}
+	c.release(mark)
+
+	c.emit(OpJump, conditionPos)
+	c.changeOperand(jumpNotTruthyPos, 1, len(c.currentInstructions()))
+
+	c.emit(OpLoadNull, dst)
+	return nil
+}
+
+// operand returns a register that holds the value of node. Locals are used
+// in place, everything else is compiled into a fresh temporary.
+func (c *Compiler) operand(node ast.Expression) (int, error) {
+	if ident, ok := node.(*ast.Identifier); ok {
+		symbol, ok := c.symbolTable.Resolve(ident.Value)
+		if ok && symbol.Scope == compiler.LocalScope {
+			return symbol.Index, nil
+		}
+	}
+
+	reg := c.alloc()
+	return reg, c.compileExpression(node, reg)
+}
+
+// operandBefore is operand for the left side of a binary expression. A
+// local can only be read in place when evaluating next cannot reassign it.
+func (c *Compiler) operandBefore(node, next ast.Expression) (int, error) {
+	switch next.(type) {
+	case *ast.Identifier, *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		return c.operand(node)
+	}
+
+	reg := c.alloc()
+	return reg, c.compileExpression(node, reg)
+}
+
+func (c *Compiler) loadSymbol(s compiler.Symbol, dst int) {
+	switch s.Scope {
+	case compiler.GlobalScope:
+		c.emit(OpGetGlobal, dst, s.Index)
+
+	case compiler.LocalScope:
+		if s.Index != dst {
+			c.emit(OpMove, dst, s.Index)
+		}
+
+	case compiler.BuiltinScope:
+		c.emit(OpGetBuiltin, dst, s.Index)
+
+	case compiler.FreeScope:
+		c.emit(OpGetFree, dst, s.Index)
+
+	case compiler.FunctionScope:
+		c.emit(OpCurrentClosure, dst)
+	}
+}
+
+func (c *Compiler) define(name string) compiler.Symbol {
+	c.scope().defined++
+	return c.symbolTable.Define(name)
+}
+
+func (c *Compiler) scope() *compilationScope {
+	return c.scopes[c.scopeIndex]
+}
+
+func (c *Compiler) alloc() int {
+	return c.allocRange(1)
+}
+
+func (c *Compiler) allocRange(n int) int {
+	scope := c.scope()
+	reg := scope.next
+	scope.next += n
+	if scope.next > scope.max {
+		scope.max = scope.next
+	}
+	return reg
+}
+
+func (c *Compiler) release(mark int) {
+	c.scope().next = mark
+}
+
+func (c *Compiler) addConstant(ob object.Object) int {
+	c.constants = append(c.constants, ob)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op Opcode, operands ...int) int {
+	ins := Make(op, operands...)
+	pos := len(c.currentInstructions())
+	c.scope().instructions = append(c.currentInstructions(), ins...)
+	c.scope().lastInstruction = op
+	return pos
+}
+
+func (c *Compiler) changeOperand(opPos, operandIndex, operand int) {
+	ins := c.currentInstructions()
+	def := definitions[Opcode(ins[opPos])]
+	offset := opPos + 1
+	for _, w := range def.OperandWidths[:operandIndex] {
+		offset += w
+	}
+	binary.BigEndian.PutUint16(ins[offset:], uint16(operand))
+}
+
+func (c *Compiler) lastInstructionIs(op Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+	return c.scope().lastInstruction == op
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) enterScope(numLocals int) {
+	c.scopes = append(c.scopes, &compilationScope{
+		instructions: code.Instructions{},
+		numLocals:    numLocals,
+		next:         numLocals,
+		max:          numLocals,
+	})
+	c.scopeIndex++
+	c.symbolTable = compiler.NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+	c.symbolTable = c.symbolTable.Outer
+	return instructions
+}
+
+// uses reports whether name appears in node.
+func uses(node ast.Node, name string) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Identifier); ok && ident.Value == name {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// countLocals counts the let bindings a function body defines outside of
+// nested function literals, so temporaries can start above them.
+func countLocals(statements []ast.Statement) int {
+	count := 0
+	for _, s := range statements {
+		switch s := s.(type) {
+		case *ast.LetStatement:
+			count += 1 + countExpressionLocals(s.Value)
+		case *ast.ReturnStatement:
+			count += countExpressionLocals(s.ReturnValue)
+		case *ast.ExpressionStatement:
+			count += countExpressionLocals(s.Expression)
+		}
+	}
+	return count
+}
+
+func countExpressionLocals(node ast.Expression) int {
+	switch node := node.(type) {
+	case *ast.PrefixExpression:
+		return countExpressionLocals(node.Right)
+
+	case *ast.InfixExpression:
+		return countExpressionLocals(node.Left) + countExpressionLocals(node.Right)
+
+	case *ast.IfExpression:
+		count := countExpressionLocals(node.Condition) + countLocals(node.Consequence.Statements)
+		if node.Alternative != nil {
+			count += countLocals(node.Alternative.Statements)
+		}
+		return count
+
+	case *ast.CallExpression:
+		count := countExpressionLocals(node.Function)
+		for _, arg := range node.Arguments {
+			count += countExpressionLocals(arg)
+		}
+		return count
+
+	case *ast.ArrayLiteral:
+		count := 0
+		for _, el := range node.Elements {
+			count += countExpressionLocals(el)
+		}
+		return count
+
+	case *ast.HashLiteral:
+		count := 0
+		for k, v := range node.Pairs {
+			count += countExpressionLocals(k) + countExpressionLocals(v)
+		}
+		return count
+
+	case *ast.IndexExpression:
+		return countExpressionLocals(node.Left) + countExpressionLocals(node.Index)
+
+	case *ast.ForLoop:
+		return countLocals([]ast.Statement{&node.Declaration}) +
+			countExpressionLocals(node.Condition) +
+			countExpressionLocals(node.Consequence) +
+			countLocals(node.Body.Statements)
+	}
+	return 0
+}
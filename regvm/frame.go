@@ -0,0 +1,23 @@
+package regvm
+
+import (
+	"mokey-type/code"
+	"mokey-type/object"
+)
+
+// A Frame owns the registers vm.registers[base : base+NumLocals]. Its result
+// is written to vm.registers[ret] in the caller's window.
+type Frame struct {
+	cl   *object.Closure
+	ip   int
+	base int
+	ret  int
+}
+
+func NewFrame(cl *object.Closure, base, ret int) *Frame {
+	return &Frame{cl: cl, ip: 0, base: base, ret: ret}
+}
+
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
@@ -0,0 +1,450 @@
+package regvm
+
+import (
+	"fmt"
+	"mokey-type/ast"
+	"mokey-type/code"
+	"mokey-type/object"
+)
+
+const RegistersSize = 65536
+const GlobalsSize = 65536
+const MaxFrames = 2048
+
+var True = &object.Boolean{Value: true}
+var False = &object.Boolean{Value: false}
+var Null = &object.NullValue{}
+
+type VM struct {
+	constants []object.Object
+
+	registers []object.Object
+	globals   []object.Object
+
+	frames      []Frame
+	framesIndex int
+
+	last object.Object
+}
+
+func New(bytecode *Bytecode) *VM {
+	return NewWithGlobalsStore(bytecode, make([]object.Object, GlobalsSize))
+}
+
+func NewWithGlobalsStore(bytecode *Bytecode, globals []object.Object) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		NumLocals:    bytecode.NumRegisters,
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+	frames := make([]Frame, MaxFrames)
+	frames[0] = *NewFrame(mainClosure, 0, 0)
+
+	return &VM{
+		constants: bytecode.Constants,
+
+		registers: make([]object.Object, RegistersSize),
+		globals:   globals,
+
+		frames:      frames,
+		framesIndex: 1,
+
+		last: Null,
+	}
+}
+
+// Execute runs bytecode on a new vm with globals as its globals store and
+// returns the value of the last expression statement.
+func Execute(bytecode *Bytecode, globals []object.Object) (object.Object, error) {
+	machine := NewWithGlobalsStore(bytecode, globals)
+	err := machine.Run()
+	if err != nil {
+		return nil, err
+	}
+	return machine.LastPopedStackElement(), nil
+}
+
+// RunProgram compiles program and executes it with fresh globals.
+func RunProgram(program *ast.Program) (object.Object, error) {
+	comp := NewCompiler()
+	err := comp.Compile(program)
+	if err != nil {
+		return nil, err
+	}
+	return Execute(comp.Bytecode(), make([]object.Object, GlobalsSize))
+}
+
+// LastPopedStackElement mirrors vm.VM: it is the value of the last
+// expression statement executed in the main program.
+func (vm *VM) LastPopedStackElement() object.Object {
+	return vm.last
+}
+
+func (vm *VM) Run() error {
+	frame := &vm.frames[vm.framesIndex-1]
+	if frame.base+frame.cl.Fn.NumLocals > len(vm.registers) {
+		return fmt.Errorf("Stack Overflow")
+	}
+	ins := frame.Instructions()
+	regs := vm.registers[frame.base:]
+
+	for frame.ip < len(ins) {
+		op := Opcode(ins[frame.ip])
+		ip := frame.ip + 1
+
+		switch op {
+		case OpLoadConstant:
+			a, k := read2(ins, ip)
+			regs[a] = vm.constants[k]
+			frame.ip = ip + 4
+
+		case OpLoadInt:
+			a := code.ReadUint16(ins[ip:])
+			value := int32(code.ReadUint32(ins[ip+2:]))
+			regs[a] = &object.Integer{Value: int64(value)}
+			frame.ip = ip + 6
+
+		case OpLoadTrue:
+			regs[code.ReadUint16(ins[ip:])] = True
+			frame.ip = ip + 2
+
+		case OpLoadFalse:
+			regs[code.ReadUint16(ins[ip:])] = False
+			frame.ip = ip + 2
+
+		case OpLoadNull:
+			regs[code.ReadUint16(ins[ip:])] = Null
+			frame.ip = ip + 2
+
+		case OpMove:
+			a, b := read2(ins, ip)
+			regs[a] = regs[b]
+			frame.ip = ip + 4
+
+		case OpGetGlobal:
+			a, k := read2(ins, ip)
+			regs[a] = vm.globals[k]
+			frame.ip = ip + 4
+
+		case OpSetGlobal:
+			k, a := read2(ins, ip)
+			vm.globals[k] = regs[a]
+			frame.ip = ip + 4
+
+		case OpGetBuiltin:
+			a, k := read2(ins, ip)
+			regs[a] = object.Builtins[k].Builtin
+			frame.ip = ip + 4
+
+		case OpGetFree:
+			a, k := read2(ins, ip)
+			regs[a] = frame.cl.Free[k]
+			frame.ip = ip + 4
+
+		case OpCurrentClosure:
+			regs[code.ReadUint16(ins[ip:])] = frame.cl
+			frame.ip = ip + 2
+
+		case OpAdd, OpSub, OpMul, OpDiv:
+			a, b, c := read3(ins, ip)
+			result, err := executeBinaryOperation(op, regs[b], regs[c])
+			if err != nil {
+				return err
+			}
+			regs[a] = result
+			frame.ip = ip + 6
+
+		case OpEqual, OpNotEqual, OpGreaterThan:
+			a, b, c := read3(ins, ip)
+			result, err := executeComparison(op, regs[b], regs[c])
+			if err != nil {
+				return err
+			}
+			regs[a] = result
+			frame.ip = ip + 6
+
+		case OpMinus:
+			a, b := read2(ins, ip)
+			operand := regs[b]
+			if operand.Type() != object.INTEGER_OBJ {
+				return fmt.Errorf("unsuported type for negation: %s", operand.Type())
+			}
+			regs[a] = &object.Integer{Value: -operand.(*object.Integer).Value}
+			frame.ip = ip + 4
+
+		case OpBang:
+			a, b := read2(ins, ip)
+			switch regs[b] {
+			case False, Null:
+				regs[a] = True
+			default:
+				regs[a] = False
+			}
+			frame.ip = ip + 4
+
+		case OpJump:
+			frame.ip = int(code.ReadUint16(ins[ip:]))
+
+		case OpJumpNotTruthy:
+			a, target := read2(ins, ip)
+			if isTruthy(regs[a]) {
+				frame.ip = ip + 4
+			} else {
+				frame.ip = target
+			}
+
+		case OpArray:
+			a, b, c := read3(ins, ip)
+			elements := make([]object.Object, c)
+			copy(elements, regs[b:b+c])
+			regs[a] = &object.Array{Elements: elements}
+			frame.ip = ip + 6
+
+		case OpHash:
+			a, b, c := read3(ins, ip)
+			hash, err := buildHash(regs[b : b+c])
+			if err != nil {
+				return err
+			}
+			regs[a] = hash
+			frame.ip = ip + 6
+
+		case OpIndex:
+			a, b, c := read3(ins, ip)
+			result, err := executeIndexExpression(regs[b], regs[c])
+			if err != nil {
+				return err
+			}
+			regs[a] = result
+			frame.ip = ip + 6
+
+		case OpCall:
+			a, b, c := read3(ins, ip)
+			frame.ip = ip + 6
+
+			switch callee := regs[b].(type) {
+			case *object.Closure:
+				if c != callee.Fn.NumParameters {
+					return fmt.Errorf("wrong number of arguments: want=%d, got=%d", callee.Fn.NumParameters, c)
+				}
+				base := frame.base + b + 1
+				if vm.framesIndex >= MaxFrames || base+callee.Fn.NumLocals > len(vm.registers) {
+					return fmt.Errorf("Stack Overflow")
+				}
+				vm.frames[vm.framesIndex] = Frame{cl: callee, base: base, ret: frame.base + a}
+				frame = &vm.frames[vm.framesIndex]
+				vm.framesIndex++
+				ins = frame.Instructions()
+				regs = vm.registers[base:]
+
+			case *object.Builtin:
+				result, err := callBuiltin(callee, regs[b+1:b+1+c])
+				if err != nil {
+					return err
+				}
+				regs[a] = result
+
+			default:
+				return fmt.Errorf("calling non-function")
+			}
+
+		case OpClosure:
+			a, k := read2(ins, ip)
+			b, c := read2(ins, ip+4)
+			function, ok := vm.constants[k].(*object.CompiledFunction)
+			if !ok {
+				return fmt.Errorf("not a function: %+v", vm.constants[k])
+			}
+			free := make([]object.Object, c)
+			copy(free, regs[b:b+c])
+			regs[a] = &object.Closure{Fn: function, Free: free}
+			frame.ip = ip + 8
+
+		case OpReturnValue, OpReturn:
+			var value object.Object = Null
+			if op == OpReturnValue {
+				value = regs[code.ReadUint16(ins[ip:])]
+			}
+
+			if vm.framesIndex == 1 {
+				vm.last = value
+				frame.ip = len(ins)
+				return nil
+			}
+
+			vm.framesIndex--
+			vm.registers[frame.ret] = value
+			frame = &vm.frames[vm.framesIndex-1]
+			ins = frame.Instructions()
+			regs = vm.registers[frame.base:]
+
+		case OpPop:
+			vm.last = regs[code.ReadUint16(ins[ip:])]
+			frame.ip = ip + 2
+
+		default:
+			return fmt.Errorf("opcode %d undefined", op)
+		}
+	}
+	return nil
+}
+
+func read2(ins code.Instructions, ip int) (int, int) {
+	return int(code.ReadUint16(ins[ip:])), int(code.ReadUint16(ins[ip+2:]))
+}
+
+func read3(ins code.Instructions, ip int) (int, int, int) {
+	return int(code.ReadUint16(ins[ip:])), int(code.ReadUint16(ins[ip+2:])), int(code.ReadUint16(ins[ip+4:]))
+}
+
+func executeBinaryOperation(op Opcode, left, right object.Object) (object.Object, error) {
+	leftType := left.Type()
+	rightType := right.Type()
+
+	if rightType == object.INTEGER_OBJ && leftType == object.INTEGER_OBJ {
+		leftValue := left.(*object.Integer).Value
+		rightValue := right.(*object.Integer).Value
+		switch op {
+		case OpAdd:
+			return &object.Integer{Value: leftValue + rightValue}, nil
+		case OpSub:
+			return &object.Integer{Value: leftValue - rightValue}, nil
+		case OpMul:
+			return &object.Integer{Value: leftValue * rightValue}, nil
+		case OpDiv:
+			if rightValue == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			return &object.Integer{Value: leftValue / rightValue}, nil
+		}
+		return nil, fmt.Errorf("unknow integer operation: %d", op)
+	}
+
+	if rightType == object.STRING_OBJ && leftType == object.STRING_OBJ {
+		if op != OpAdd {
+			return nil, fmt.Errorf("unknow integer operation: %d", op)
+		}
+		leftValue := left.(*object.String).Value
+		rightValue := right.(*object.String).Value
+		return &object.String{Value: leftValue + rightValue}, nil
+	}
+	return nil, fmt.Errorf("unsoported types for binary operation: %s %s", leftType, rightType)
+}
+
+func executeComparison(op Opcode, left, right object.Object) (object.Object, error) {
+	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
+		leftValue := left.(*object.Integer).Value
+		rightValue := right.(*object.Integer).Value
+		switch op {
+		case OpEqual:
+			return nativeBooleanObject(leftValue == rightValue), nil
+		case OpNotEqual:
+			return nativeBooleanObject(leftValue != rightValue), nil
+		case OpGreaterThan:
+			return nativeBooleanObject(leftValue > rightValue), nil
+		}
+	}
+	if left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ {
+		leftValue := left.(*object.String).Value
+		rightValue := right.(*object.String).Value
+		switch op {
+		case OpEqual:
+			return nativeBooleanObject(leftValue == rightValue), nil
+		case OpNotEqual:
+			return nativeBooleanObject(leftValue != rightValue), nil
+		}
+	}
+
+	switch op {
+	case OpEqual:
+		return nativeBooleanObject(left == right), nil
+	case OpNotEqual:
+		return nativeBooleanObject(left != right), nil
+	}
+	// same operand order as the stack vm reports it
+	return nil, fmt.Errorf("unknow operator: %d (%s %s)", op, right.Type(), left.Type())
+}
+
+func nativeBooleanObject(value bool) *object.Boolean {
+	if value {
+		return True
+	}
+	return False
+}
+
+func isTruthy(obj object.Object) bool {
+	switch obj := obj.(type) {
+	case *object.Boolean:
+		return obj.Value
+
+	case *object.NullValue:
+		return false
+
+	default:
+		return true
+	}
+}
+
+func buildHash(registers []object.Object) (object.Object, error) {
+	pairs := make(map[object.HashKey]object.HashPair)
+
+	for i := 0; i < len(registers); i += 2 {
+		key := registers[i]
+		value := registers[i+1]
+
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unusable as hashkey: %s", key.Type())
+		}
+
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
+	}
+
+	return &object.Hash{Pairs: pairs}, nil
+}
+
+func executeIndexExpression(left, index object.Object) (object.Object, error) {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		array := left.(*object.Array)
+		i := index.(*object.Integer).Value
+		if i < 0 || i > int64(len(array.Elements)-1) {
+			return Null, nil
+		}
+		return array.Elements[i], nil
+
+	case left.Type() == object.HASH_OBJ:
+		hash := left.(*object.Hash)
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return nil, fmt.Errorf("unable to hash key %s", index.Type())
+		}
+		pair, ok := hash.Pairs[key.HashKey()]
+		if !ok {
+			return Null, nil
+		}
+		return pair.Value, nil
+
+	default:
+		return nil, fmt.Errorf("index operation not suported %s", left.Type())
+	}
+}
+
+func callBuiltin(fn *object.Builtin, args []object.Object) (object.Object, error) {
+	result := fn.Fn(args...)
+
+	switch result := result.(type) {
+	case nil:
+		return Null, nil
+
+	case *object.Boolean:
+		return nativeBooleanObject(result.Value), nil
+
+	case *object.Error:
+		// like the vm, a builtin's error stops the program
+		return nil, fmt.Errorf("%s", result.Message)
+
+	default:
+		return result, nil
+	}
+}
@@ -0,0 +1,63 @@
+package regvm
+
+import (
+	"mokey-type/conformance"
+	"mokey-type/object"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	for _, suite := range conformance.Suites {
+		t.Run(suite.Name, func(t *testing.T) {
+			conformance.Run(t, RunProgram, suite.Cases)
+		})
+	}
+}
+
+func TestForLoops(t *testing.T) {
+	tests := []conformance.Case{
+		{Input: "for (let i = 0; i < 3; ++i) { i }; 10", Expected: 10},
+		{Input: "let f = fn(n) { for (let i = 0; i < n; ++i) { i }; n * 2 }; f(3)", Expected: 6},
+		{Input: "let f = fn() { for (let i = 0; i < 5000; ++i) { i }; 1 }; f()", Expected: 1},
+	}
+	conformance.Run(t, RunProgram, tests)
+}
+
+func TestRegisterAllocation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input: "fn(a, b) { a + b }",
+			expected: `0000 OpAdd 2 0 1
+0007 OpReturnValue 2
+`,
+		},
+		{
+			input: "fn(a) { let b = a * 2; b - 1 }",
+			expected: `0000 OpLoadConstant 2 0
+0005 OpMul 1 0 2
+0012 OpLoadConstant 3 1
+0017 OpSub 2 1 3
+0024 OpReturnValue 2
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		comp := NewCompiler()
+		err := comp.Compile(conformance.Parse(tt.input))
+		if err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		constants := comp.Bytecode().Constants
+		fn, ok := constants[len(constants)-1].(*object.CompiledFunction)
+		if !ok {
+			t.Fatalf("last constant is not a function. got=%T", constants[len(constants)-1])
+		}
+		if got := Disassemble(fn.Instructions); got != tt.expected {
+			t.Errorf("wrong instructions for %s.\nwant=%q\n got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
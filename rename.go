@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mokey-type/compiler"
+	"os"
+	"strings"
+)
+
+const renameUsage = "mokey-type rename [-w] file.mk line:column name"
+
+const renameDoc = `Renames the variable at line:column of file.mk to name, its definition
+and every use that refers to it, other variables with the same name stay.
+It refuses when a use would then refer to another variable, because the
+new name is shadowed where it is used or shadows something there.`
+
+// rename renames the variable at line:column and everything that refers to
+// it, leaving other variables with the same name alone.
+func rename(args []string) error {
+	flags := flag.NewFlagSet("rename", flag.ExitOnError)
+	write := flags.Bool("w", false, "write the result to the file instead of stdout")
+	usage(flags, renameUsage, renameDoc)
+	flags.Parse(args)
+
+	if flags.NArg() != 3 {
+		return fmt.Errorf("usage: %s", renameUsage)
+	}
+	path, at, name := flags.Arg(0), flags.Arg(1), flags.Arg(2)
+
+	var line, column int
+	if _, err := fmt.Sscanf(at, "%d:%d", &line, &column); err != nil {
+		return fmt.Errorf("bad position %q, want line:column", at)
+	}
+
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	program, err := parseSource(path, string(source))
+	if err != nil {
+		return err
+	}
+
+	ident := compiler.Resolve(program).At(line, column)
+	if ident == nil {
+		return fmt.Errorf("%s:%d:%d: no variable here", path, line, column)
+	}
+	refs, err := compiler.Rename(program, ident, name)
+	if err != nil {
+		return fmt.Errorf("%s: %s", path, err)
+	}
+
+	lines := strings.SplitAfter(string(source), "\n")
+	// go backwards so earlier columns on a line stay valid
+	for i := len(refs) - 1; i >= 0; i-- {
+		tok := refs[i].Token
+		text := lines[tok.Line-1]
+		lines[tok.Line-1] = text[:tok.Column-1] + name + text[tok.Column-1+len(tok.Literal):]
+	}
+	result := strings.Join(lines, "")
+
+	if *write {
+		return os.WriteFile(path, []byte(result), 0644)
+	}
+	fmt.Print(result)
+	return nil
+}
@@ -0,0 +1,157 @@
+package repl
+
+import (
+	"fmt"
+	"mokey-type/lexer"
+	"mokey-type/parser"
+	"mokey-type/token"
+	"os"
+	"sort"
+	"strings"
+)
+
+type command struct {
+	name  string
+	args  string
+	usage string
+	run   func(s *session, arg string) error
+}
+
+// commands are the inputs starting with a colon, they are handled by the
+// repl instead of being evaluated.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"help", "", "list the commands", help},
+		{"reset", "", "forget every binding and start a fresh session", reset},
+		{"load", "file", "evaluate a file in the session", load},
+		{"ast", "[code]", "print the parsed program, of the last input without code", printAST},
+		{"tokens", "[code]", "print the tokens, of the last input without code", printTokens},
+		{"bytecode", "[code]", "evaluate code and print its bytecode, of the last input without code", printBytecode},
+		{"env", "", "list the globals and their values", printEnv},
+		{"time", "", "toggle printing how long each input takes", toggleTiming},
+	}
+}
+
+// command runs a meta command line like ":load file.mk".
+func (s *session) command(line string) {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(line, ":"), " ")
+	arg = strings.TrimSpace(arg)
+	for _, c := range commands {
+		if c.name == name {
+			if err := c.run(s, arg); err != nil {
+				fmt.Fprintf(s.out, ":%s: %s\n", name, err)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(s.out, "unknown command :%s, try :help\n", name)
+}
+
+func help(s *session, _ string) error {
+	for _, c := range commands {
+		fmt.Fprintf(s.out, "  %-18s %s\n", strings.TrimSpace(":"+c.name+" "+c.args), c.usage)
+	}
+	fmt.Fprintln(s.out, "  input with open braces, brackets or parentheses continues on the next line")
+	return nil
+}
+
+func reset(s *session, _ string) error {
+	engine, err := newEngine(s.engineName)
+	if err != nil {
+		return err
+	}
+	s.engine = engine
+	s.last = ""
+	return nil
+}
+
+func load(s *session, path string) error {
+	if path == "" {
+		return fmt.Errorf("usage: :load file")
+	}
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	s.eval(string(source))
+	return nil
+}
+
+// code returns arg, or the last input when arg is empty.
+func (s *session) code(arg string) (string, error) {
+	if arg != "" {
+		return arg, nil
+	}
+	if s.last == "" {
+		return "", fmt.Errorf("no input yet")
+	}
+	return s.last, nil
+}
+
+func printAST(s *session, arg string) error {
+	input, err := s.code(arg)
+	if err != nil {
+		return err
+	}
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, p.Errors())
+		return nil
+	}
+	for _, statement := range program.Statements {
+		fmt.Fprintf(s.out, "%T %s\n", statement, statement)
+	}
+	return nil
+}
+
+func printTokens(s *session, arg string) error {
+	input, err := s.code(arg)
+	if err != nil {
+		return err
+	}
+	l := lexer.New(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		fmt.Fprintf(s.out, "%d:%d %-8s %q\n", tok.Line, tok.Column, tok.Type, tok.Literal)
+	}
+	return nil
+}
+
+func printBytecode(s *session, arg string) error {
+	if arg != "" {
+		s.eval(arg)
+	} else if s.last == "" {
+		return fmt.Errorf("no input yet")
+	}
+	out, err := s.engine.disassemble()
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(s.out, out)
+	return nil
+}
+
+func printEnv(s *session, _ string) error {
+	bindings := s.engine.bindings()
+	names := []string{}
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(s.out, "%s = %s\n", name, bindings[name].Inspect())
+	}
+	return nil
+}
+
+func toggleTiming(s *session, _ string) error {
+	s.timing = !s.timing
+	if s.timing {
+		fmt.Fprintln(s.out, "timing on")
+	} else {
+		fmt.Fprintln(s.out, "timing off")
+	}
+	return nil
+}
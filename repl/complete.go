@@ -0,0 +1,54 @@
+package repl
+
+import (
+	"mokey-type/token"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// completer completes keywords, builtins and globals, and the meta commands
+// at the start of a line.
+type completer struct {
+	session *session
+}
+
+func (c *completer) candidates(line string) []string {
+	if strings.HasPrefix(line, ":") && !strings.Contains(line, " ") {
+		names := []string{}
+		for _, command := range commands {
+			names = append(names, ":"+command.name)
+		}
+		return names
+	}
+	names := append(token.Keywords(), c.session.engine.names()...)
+	sort.Strings(names)
+	return names
+}
+
+// Do implements readline.AutoCompleter. It returns the rest of every
+// candidate that starts with the word before the cursor, and the length of
+// that word. Without a word there is nothing to complete, a tab indents.
+func (c *completer) Do(line []rune, pos int) ([][]rune, int) {
+	start := pos
+	for start > 0 && (unicode.IsLetter(line[start-1]) || unicode.IsDigit(line[start-1]) || line[start-1] == '_') {
+		start--
+	}
+	if start == 1 && line[0] == ':' {
+		start = 0
+	}
+	word := string(line[start:pos])
+	if word == "" {
+		return nil, 0
+	}
+
+	completions := [][]rune{}
+	seen := map[string]bool{}
+	for _, name := range c.candidates(string(line[:pos])) {
+		if strings.HasPrefix(name, word) && !seen[name] {
+			seen[name] = true
+			completions = append(completions, []rune(name[len(word):]))
+		}
+	}
+	return completions, len([]rune(word))
+}
@@ -0,0 +1,318 @@
+package repl
+
+import (
+	"fmt"
+	"mokey-type/ast"
+	"mokey-type/closure"
+	"mokey-type/compiler"
+	"mokey-type/evaluator"
+	"mokey-type/module"
+	"mokey-type/object"
+	"mokey-type/regvm"
+	"mokey-type/vm"
+	"strings"
+)
+
+// engine keeps the state one backend needs between the lines of a session.
+type engine interface {
+	compile(program *ast.Program) error
+	run() (object.Object, error)
+	// disassemble lists the bytecode of the last program compiled
+	disassemble() (string, error)
+	// bindings returns the value of every global set so far
+	bindings() map[string]object.Object
+	// names lists the builtins and the globals defined so far
+	names() []string
+}
+
+func newEngine(name string) (engine, error) {
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	switch name {
+	case "vm":
+		return &vmEngine{
+			constants:   []object.Object{},
+			globals:     make([]object.Object, vm.GlobalsSize),
+			symbolTable: symbolTable,
+		}, nil
+
+	case "regvm":
+		return &regvmEngine{
+			constants:   []object.Object{},
+			globals:     make([]object.Object, regvm.GlobalsSize),
+			symbolTable: symbolTable,
+		}, nil
+
+	case "closure":
+		return &closureEngine{engine: closure.New()}, nil
+
+	case "eval":
+		return &evalEngine{env: object.NewEnviroment()}, nil
+
+	case "both":
+		vm, err := newEngine("vm")
+		if err != nil {
+			return nil, err
+		}
+		eval, err := newEngine("eval")
+		if err != nil {
+			return nil, err
+		}
+		return &bothEngine{engines: []namedEngine{{"vm", vm}, {"eval", eval}}}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown engine %q, use 'vm', 'regvm', 'closure', 'eval' or 'both'", name)
+	}
+}
+
+type vmEngine struct {
+	constants   []object.Object
+	globals     []object.Object
+	symbolTable *compiler.SymbolTable
+	bytecode    *compiler.Bytecode
+}
+
+func (e *vmEngine) compile(program *ast.Program) error {
+	comp := compiler.NewWithState(e.symbolTable, e.constants)
+	// imports are read again for every input, the modules may have changed
+	comp.EnableImports("", module.NewLoader(module.SearchPath()))
+	err := comp.Compile(program)
+	if err != nil {
+		return err
+	}
+	e.bytecode = comp.Bytecode()
+	e.constants = e.bytecode.Constanst
+	return nil
+}
+
+func (e *vmEngine) run() (object.Object, error) {
+	return vm.Execute(e.bytecode, e.globals)
+}
+
+func (e *vmEngine) disassemble() (string, error) {
+	if e.bytecode == nil {
+		return "", fmt.Errorf("nothing compiled yet")
+	}
+	return e.bytecode.Disassemble(), nil
+}
+
+func (e *vmEngine) bindings() map[string]object.Object {
+	return definedBindings(e.symbolTable, e.globals)
+}
+
+func (e *vmEngine) names() []string {
+	return e.symbolTable.Names()
+}
+
+type regvmEngine struct {
+	constants   []object.Object
+	globals     []object.Object
+	symbolTable *compiler.SymbolTable
+	bytecode    *regvm.Bytecode
+}
+
+func (e *regvmEngine) compile(program *ast.Program) error {
+	comp := regvm.NewCompilerWithState(e.symbolTable, e.constants)
+	err := comp.Compile(program)
+	if err != nil {
+		return err
+	}
+	e.bytecode = comp.Bytecode()
+	e.constants = e.bytecode.Constants
+	return nil
+}
+
+func (e *regvmEngine) run() (object.Object, error) {
+	return regvm.Execute(e.bytecode, e.globals)
+}
+
+func (e *regvmEngine) disassemble() (string, error) {
+	if e.bytecode == nil {
+		return "", fmt.Errorf("nothing compiled yet")
+	}
+	return regvm.Disassemble(e.bytecode.Instructions), nil
+}
+
+func (e *regvmEngine) bindings() map[string]object.Object {
+	return definedBindings(e.symbolTable, e.globals)
+}
+
+func (e *regvmEngine) names() []string {
+	return e.symbolTable.Names()
+}
+
+func definedBindings(symbolTable *compiler.SymbolTable, store []object.Object) map[string]object.Object {
+	globals := map[string]object.Object{}
+	for _, symbol := range symbolTable.Definitions() {
+		if value := store[symbol.Index]; value != nil {
+			globals[symbol.Name] = value
+		}
+	}
+	return globals
+}
+
+type closureEngine struct {
+	engine  *closure.Engine
+	program *closure.Program
+}
+
+func (e *closureEngine) compile(program *ast.Program) error {
+	compiled, err := e.engine.Compile(program)
+	if err != nil {
+		return err
+	}
+	e.program = compiled
+	return nil
+}
+
+func (e *closureEngine) run() (object.Object, error) {
+	return e.program.Run(), nil
+}
+
+func (e *closureEngine) disassemble() (string, error) {
+	return "", fmt.Errorf("the closure engine has no bytecode, use -engine=vm or -engine=regvm")
+}
+
+func (e *closureEngine) bindings() map[string]object.Object {
+	return e.engine.Globals()
+}
+
+func (e *closureEngine) names() []string {
+	names := []string{}
+	for _, b := range object.Builtins {
+		names = append(names, b.Name)
+	}
+	for name := range e.engine.Globals() {
+		names = append(names, name)
+	}
+	return names
+}
+
+type evalEngine struct {
+	env     *object.Enviroment
+	program *ast.Program
+}
+
+func (e *evalEngine) compile(program *ast.Program) error {
+	e.program = program
+	return nil
+}
+
+// run reports the errors the evaluator returns as values like the vms
+// report theirs, so they print and compare the same way.
+func (e *evalEngine) run() (object.Object, error) {
+	// like the vm engines, every input imports the modules again
+	evaluator.EnableImports(e.env, "", module.NewLoader(module.SearchPath()))
+	result := evaluator.Eval(e.program, e.env)
+	if err, ok := result.(*object.Error); ok {
+		return nil, fmt.Errorf("%s", err.Message)
+	}
+	// result is nil after a let, and for nodes the evaluator doesn't know
+	return result, nil
+}
+
+func (e *evalEngine) disassemble() (string, error) {
+	return "", fmt.Errorf("the evaluator has no bytecode, use -engine=vm or -engine=regvm")
+}
+
+func (e *evalEngine) bindings() map[string]object.Object {
+	return e.env.Bindings()
+}
+
+func (e *evalEngine) names() []string {
+	names := []string{}
+	for _, b := range object.Builtins {
+		names = append(names, b.Name)
+	}
+	for name := range e.env.Bindings() {
+		names = append(names, name)
+	}
+	return names
+}
+
+type namedEngine struct {
+	name string
+	engine
+}
+
+// bothEngine runs every input on several engines, the first one is the one
+// whose results are shown. When the others disagree with it divergence
+// describes how, errors are compared by their object.ErrorCategory.
+type bothEngine struct {
+	engines []namedEngine
+	// errors are the compile errors of the last input, they are compared
+	// like runtime errors since the evaluator only finds them at runtime
+	errors     []error
+	divergence string
+	// valued is whether the input ends in an expression, the engines only
+	// agree on the value of those
+	valued bool
+}
+
+func (e *bothEngine) compile(program *ast.Program) error {
+	e.errors = make([]error, len(e.engines))
+	e.valued = false
+	if n := len(program.Statements); n > 0 {
+		_, e.valued = program.Statements[n-1].(*ast.ExpressionStatement)
+	}
+	for i, engine := range e.engines {
+		e.errors[i] = engine.compile(program)
+	}
+	return nil
+}
+
+func (e *bothEngine) run() (object.Object, error) {
+	results := make([]string, len(e.engines))
+	shown := make([]string, len(e.engines))
+	var first object.Object
+	var firstErr error
+	for i, engine := range e.engines {
+		var result object.Object
+		err := e.errors[i]
+		if err == nil {
+			result, err = engine.run()
+		}
+		switch {
+		case err != nil:
+			results[i] = "error: " + object.ErrorCategory(err.Error())
+			shown[i] = "error: " + err.Error()
+		case e.valued && result == nil:
+			results[i] = "no value"
+			shown[i] = results[i]
+		case e.valued:
+			results[i] = object.Canonical(result)
+			shown[i] = result.Inspect()
+		}
+		if i == 0 {
+			first, firstErr = result, err
+		}
+	}
+
+	e.divergence = ""
+	for i := range results[1:] {
+		if results[i+1] != results[0] {
+			var out strings.Builder
+			for j, engine := range e.engines {
+				fmt.Fprintf(&out, "\t%-5s %s\n", engine.name+":", shown[j])
+			}
+			e.divergence = out.String()
+			break
+		}
+	}
+	return first, firstErr
+}
+
+func (e *bothEngine) disassemble() (string, error) {
+	return e.engines[0].disassemble()
+}
+
+func (e *bothEngine) bindings() map[string]object.Object {
+	return e.engines[0].bindings()
+}
+
+func (e *bothEngine) names() []string {
+	return e.engines[0].names()
+}
@@ -5,23 +5,21 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
-	"mokey-type/compiler"
-	"mokey-type/lexer"
-	"mokey-type/object"
-	"mokey-type/parser"
-	"mokey-type/vm"
-
 	"github.com/chzyer/readline"
 )
 
 const (
+	RED    = "\033[31m"
 	GREEN  = "\033[32m"
 	BLUE   = "\033[36m"
 	YELLOW = "\033[33m"
 	RESET  = "\033[0m"
 	PROMPT = GREEN + ">> " + RESET
+	// CONTINUE_PROMPT is shown while braces, brackets or parentheses are open
+	CONTINUE_PROMPT = GREEN + ".. " + RESET
 )
 
 const MONKEY_FACE = YELLOW + `
@@ -34,68 +32,119 @@ const MONKEY_FACE = YELLOW + `
           m  m
 ` + RESET
 
+// USAGE is what -h prints before the flags
+const USAGE = `usage: mokey-type [-vim] [-engine name]
+
+Starts the repl. Input with open braces, brackets or parentheses continues
+on the next line. Lines starting with a colon are meta commands, like
+:load file, :ast, :bytecode and :env, :help lists them all.
+
+Tab completes keywords, builtins and globals. The history is kept in
+mokey-type/history under the user's config dir, Ctrl-C drops the current
+input and Ctrl-D exits.
+
+-engine picks what runs the input: the vm, the register vm, the closure
+compiler or the tree-walking evaluator. -engine=both runs every input on the
+vm and the evaluator and highlights where their results or errors differ.`
+
 func Start(out io.Writer) {
 	vim := flag.Bool("vim", false, "activates vim mode")
+	engineName := flag.String("engine", "vm", "use 'vm', 'regvm', 'closure', 'eval', or 'both' to run every input on the vm and the evaluator and show where they disagree")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "%s\n\n", USAGE)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
-	constants := []object.Object{}
-	globals := make([]object.Object, vm.GlobalsSize)
-	symbolTable := compiler.NewSymbolTable()
-	for i, v := range object.Builtins {
-		symbolTable.DefineBuiltin(i, v.Name)
+	session, err := newSession(out, *engineName)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
-	for {
+	rl, err := readline.NewEx(readlineConfig(session, *vim, readline.DefaultIsTerminal()))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer rl.Close()
 
-		rl, err := readline.New(PROMPT)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
+	// input collects the lines of an input that isn't complete yet
+	input := ""
+	for {
+		if input == "" {
+			rl.SetPrompt(PROMPT)
+		} else {
+			rl.SetPrompt(CONTINUE_PROMPT)
 		}
 
-		rl.SetVimMode(*vim)
-
-		input, err := rl.Readline()
+		line, err := rl.Readline()
+		if err == readline.ErrInterrupt {
+			input = ""
+			continue
+		}
+		if err == io.EOF {
+			return
+		}
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
+			return
 		}
 
-		line := strings.TrimSuffix(input, "\n")
-		if line == "exit" {
-			os.Exit(0)
+		line = strings.TrimSuffix(line, "\n")
+		if input == "" {
+			if line == "exit" {
+				return
+			}
+			if strings.HasPrefix(line, ":") {
+				session.command(line)
+				continue
+			}
 		}
 
-		l := lexer.New(line)
-		p := parser.New(l)
-
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParserErrors(p.Errors())
+		input += line + "\n"
+		if incomplete(input) {
 			continue
 		}
+		session.eval(input)
+		input = ""
+	}
+}
 
-		comp := compiler.NewWithState(symbolTable, constants)
-		err = comp.Compile(program)
-		if err != nil {
-			fmt.Fprintf(out, "!Woops compiling bytecode failed\n error:\n \t%s\n", err)
-			continue
-		}
+// readlineConfig only completes on a terminal, piped input is read as it
+// is, tabs included.
+func readlineConfig(session *session, vim, terminal bool) *readline.Config {
+	config := &readline.Config{
+		Prompt:         PROMPT,
+		HistoryFile:    historyFile(),
+		VimMode:        vim,
+		FuncIsTerminal: func() bool { return terminal },
+	}
+	if terminal {
+		config.AutoComplete = &completer{session: session}
+	}
+	return config
+}
 
-		machine := vm.NewWithGlobalsStore(comp.Bytecode(), globals)
-		err = machine.Run()
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "!Woops executing bytecode failed\n error:\n \t%s\n", err)
-			continue
-		}
-		stackTop := machine.LastPopedStackElement()
-		fmt.Fprintln(os.Stderr, stackTop.Inspect())
+// historyFile is where the history of every session is kept, it is empty,
+// which turns history off, when there is no config dir to keep it in.
+func historyFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	dir = filepath.Join(dir, "mokey-type")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return ""
 	}
+	return filepath.Join(dir, "history")
 }
 
-func printParserErrors(errors []string) {
-	io.WriteString(os.Stderr, MONKEY_FACE)
-	io.WriteString(os.Stderr, "Woops! We ran into some monkey business here!\n")
-	io.WriteString(os.Stderr, " parser errors:\n")
+func printParserErrors(out io.Writer, errors []string) {
+	io.WriteString(out, MONKEY_FACE)
+	io.WriteString(out, "Woops! We ran into some monkey business here!\n")
+	io.WriteString(out, " parser errors:\n")
 	for _, msg := range errors {
-		io.WriteString(os.Stderr, "\t"+msg+"\n")
+		io.WriteString(out, "\t"+msg+"\n")
 	}
 }
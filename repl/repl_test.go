@@ -0,0 +1,250 @@
+package repl
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mokey-type/ast"
+	"mokey-type/object"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/chzyer/readline"
+)
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let a = 1;", false},
+		{"let f = fn(x) {", true},
+		{"let f = fn(x) {\n x + 1\n};", false},
+		{"[1, 2,", true},
+		{"puts(\"(\"", true},
+		{"puts(\"{\")", false},
+		{"let a = 1; // {", false},
+		{"}", false},
+	}
+
+	for _, tt := range tests {
+		if got := incomplete(tt.input); got != tt.expected {
+			t.Errorf("incomplete(%q) wrong. want=%t, got=%t", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	for _, engine := range []string{"vm", "regvm", "closure", "eval", "both"} {
+		var out bytes.Buffer
+		s, err := newSession(&out, engine)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s.eval("let a = 1;\nlet add = fn(x, y) {\n x + y\n};")
+		s.eval("let b = add(a, 2)")
+		out.Reset()
+		s.command(":env")
+		expected := "a = 1\nadd = "
+		if got := out.String(); !strings.HasPrefix(got, expected) || !strings.HasSuffix(got, "b = 3\n") {
+			t.Errorf("%s: :env wrong. got=%q", engine, got)
+		}
+
+		out.Reset()
+		s.command(":reset")
+		s.command(":env")
+		if got := out.String(); got != "" {
+			t.Errorf("%s: :env after :reset wrong. got=%q", engine, got)
+		}
+
+		path := filepath.Join(t.TempDir(), "lib.mk")
+		if err := os.WriteFile(path, []byte("let double = fn(x) {\n\tx * 2\n};\ndouble(21)\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		out.Reset()
+		s.command(":load " + path)
+		s.eval("double(2)")
+		if got := out.String(); got != "42\n4\n" {
+			t.Errorf("%s: :load wrong. got=%q", engine, got)
+		}
+	}
+}
+
+func TestInspectCommands(t *testing.T) {
+	var out bytes.Buffer
+	s, err := newSession(&out, "vm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		line     string
+		expected string
+	}{
+		{":ast", ":ast: no input yet\n"},
+		{":tokens let a", "1:1 LET      \"let\"\n1:5 IDENT    \"a\"\n"},
+		{":ast 1 + 2 * 3", "*ast.ExpressionStatement (1 + (2 * 3))\n"},
+		{":bytecode 1 + 2", "3\n== main ==\n0000 OpConstant 0"},
+		{":ast", "*ast.ExpressionStatement (1 + 2)\n"},
+		{":time", "timing on\n"},
+		{":nope", "unknown command :nope, try :help\n"},
+		{":load", ":load: usage: :load file\n"},
+	}
+
+	for _, tt := range tests {
+		out.Reset()
+		s.command(tt.line)
+		if got := out.String(); !strings.HasPrefix(got, tt.expected) {
+			t.Errorf("%s wrong. want=%q, got=%q", tt.line, tt.expected, got)
+		}
+	}
+
+	out.Reset()
+	s.command(":bytecode")
+	if !strings.Contains(out.String(), "OpAdd") {
+		t.Errorf(":bytecode of the last input wrong. got=%q", out.String())
+	}
+
+	session, _ := newSession(&out, "closure")
+	out.Reset()
+	session.eval("1")
+	session.command(":bytecode")
+	if got := out.String(); !strings.Contains(got, "no bytecode") {
+		t.Errorf(":bytecode on the closure engine wrong. got=%q", got)
+	}
+}
+
+func TestCompleter(t *testing.T) {
+	var out bytes.Buffer
+	s, err := newSession(&out, "vm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.eval("let result = 1; let returned = 2;")
+	c := &completer{session: s}
+
+	tests := []struct {
+		line     string
+		expected []string
+		length   int
+	}{
+		{"re", []string{"place", "st", "sult", "turn", "turned", "verse"}, 2},
+		{"puts(res", []string{"t", "ult"}, 3},
+		{"tr", []string{"im", "imLeft", "imRight", "ue"}, 2},
+		{":lo", []string{"ad"}, 3},
+		{"{\"a\": fi", []string{"ndIndex", "rst"}, 2},
+		{"xyz", []string{}, 3},
+		{"\t", []string{}, 0},
+		{"let x = ", []string{}, 0},
+	}
+
+	for _, tt := range tests {
+		completions, length := c.Do([]rune(tt.line), len([]rune(tt.line)))
+		got := []string{}
+		for _, completion := range completions {
+			got = append(got, string(completion))
+		}
+		if strings.Join(got, ",") != strings.Join(tt.expected, ",") || length != tt.length {
+			t.Errorf("completions of %q wrong. want=%q %d, got=%q %d", tt.line, tt.expected, tt.length, got, length)
+		}
+	}
+}
+
+// TestPipedTabs feeds a tab-indented line to readline the way Start sets
+// it up when stdin isn't a terminal, the tab stays part of the line.
+func TestPipedTabs(t *testing.T) {
+	s, err := newSession(&bytes.Buffer{}, "vm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := readlineConfig(s, false, false)
+	config.HistoryFile = ""
+	config.Stdin = io.NopCloser(strings.NewReader("let x = 1;\n\tx\n"))
+	config.Stdout = &bytes.Buffer{}
+	rl, err := readline.NewEx(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.Close()
+
+	for _, want := range []string{"let x = 1;", "\tx"} {
+		line, err := rl.Readline()
+		if err != nil {
+			t.Fatalf("reading %q failed: %s", want, err)
+		}
+		if line != want {
+			t.Errorf("wrong line. want=%q, got=%q", want, line)
+		}
+	}
+}
+
+func TestBothEngines(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2", "3\n"},
+		{`[1, {"a": fn(x) { x }, "b": 2}]`, ""},
+		{"let a = 1", ""},
+		{"1 + true", ""},
+		{"let f = fn() { g() }; let g = fn() { 1 }; f()", "!engines disagree\n" +
+			"\tvm:   error: undefined variable: g\n" +
+			"\teval: 1\n"},
+		{"for (let i = 0; i < 3; ++i) { i }", ""},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		s, err := newSession(&out, "both")
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.eval(tt.input)
+		got := out.String()
+		if i := strings.Index(got, RED); i >= 0 {
+			got = strings.TrimSuffix(got[i+len(RED):], RESET)
+		} else if tt.expected == "" {
+			got = ""
+		}
+		if got != tt.expected {
+			t.Errorf("wrong output for %q.\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// failingEngine fails every input with err.
+type failingEngine struct {
+	engine
+	err error
+}
+
+func (e failingEngine) compile(program *ast.Program) error { return nil }
+func (e failingEngine) run() (object.Object, error)        { return nil, e.err }
+
+func TestBothEnginesCompareErrorCategories(t *testing.T) {
+	tests := []struct {
+		vm, eval string
+		diverge  bool
+	}{
+		{"unsoported types for binary operation: INTEGER BOOLEAN", "type mismatch: INTEGER + BOOLEAN", false},
+		{"unsoported types for binary operation: BOOLEAN BOOLEAN", "unknown operator: BOOLEAN + BOOLEAN", false},
+		{"unsoported types for binary operation: BOOLEAN BOOLEAN", "type mismatch: INTEGER + BOOLEAN", true},
+		{"calling non-function", "not a function: INTEGER", false},
+		{"calling non-function", "wrong number of arguments: want=1, got=0", true},
+	}
+
+	for _, tt := range tests {
+		both := &bothEngine{engines: []namedEngine{
+			{"vm", failingEngine{err: errors.New(tt.vm)}},
+			{"eval", failingEngine{err: errors.New(tt.eval)}},
+		}}
+		both.compile(&ast.Program{})
+		both.run()
+		if (both.divergence != "") != tt.diverge {
+			t.Errorf("divergence of %q and %q wrong. want=%t, got=%q", tt.vm, tt.eval, tt.diverge, both.divergence)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"mokey-type/lexer"
+	"mokey-type/parser"
+	"mokey-type/token"
+	"time"
+)
+
+// session is what the repl keeps between inputs.
+type session struct {
+	out        io.Writer
+	engineName string
+	engine     engine
+	// last is the last input that was evaluated, the meta commands that
+	// inspect code use it when they are given none
+	last   string
+	timing bool
+}
+
+func newSession(out io.Writer, engineName string) (*session, error) {
+	engine, err := newEngine(engineName)
+	if err != nil {
+		return nil, err
+	}
+	return &session{out: out, engineName: engineName, engine: engine}, nil
+}
+
+// eval parses, compiles and runs one input and prints its value.
+func (s *session) eval(input string) {
+	s.last = input
+	start := time.Now()
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, p.Errors())
+		return
+	}
+
+	err := s.engine.compile(program)
+	if err != nil {
+		fmt.Fprintf(s.out, "!Woops compiling bytecode failed\n error:\n \t%s\n", err)
+		return
+	}
+
+	stackTop, err := s.engine.run()
+	if err != nil {
+		fmt.Fprintf(s.out, "!Woops executing bytecode failed\n error:\n \t%s\n", err)
+	} else if stackTop != nil {
+		fmt.Fprintln(s.out, stackTop.Inspect())
+	}
+	if both, ok := s.engine.(*bothEngine); ok && both.divergence != "" {
+		fmt.Fprint(s.out, RED+"!engines disagree\n"+both.divergence+RESET)
+	}
+	if s.timing {
+		fmt.Fprintf(s.out, "took %s\n", time.Since(start))
+	}
+}
+
+// incomplete reports whether input has braces, brackets or parentheses
+// that are still open, the repl keeps reading lines until they are closed.
+// Strings and comments are skipped by the lexer, so their brackets don't
+// count.
+func incomplete(input string) bool {
+	depth := 0
+	l := lexer.New(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRACKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRACKET:
+			depth--
+		}
+	}
+	return depth > 0
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"mokey-type/compiler"
+	"mokey-type/coverage"
+	"mokey-type/module"
+	"mokey-type/pprof"
+	"mokey-type/vm"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const runUsage = "mokey-type run [-coverprofile file] [-profile file] [-trace] [-trace-json] [-trace-func name] [-trace-steps from:to] file.mkc|file.mk"
+
+const runDoc = `Runs a .mkc file written by mokey-type build, or compiles and runs a
+source file. Runtime errors are reported at their line and column.
+
+import "lib/math" runs lib/math.mk once and gives a hash of its top-level
+lets, except the ones starting with _. Paths are relative to the importing
+file, the ones that don't start with ./ or ../ are also looked up in the
+directories of MOKEYPATH. Import cycles are reported before anything runs.
+
+-profile counts the calls of every function and the runs of every opcode
+and samples the stack of the vm every millisecond. The file is in the
+pprof format, go tool pprof -http=: out.pprof shows the flame graph and
+-sample_index=calls the calls.
+
+-trace writes every executed instruction to stderr with its step, the
+depth of its frame, its function and line, its ip, opcode and operands and
+the top of the stack after it. -trace-func keeps only the steps of a
+function and -trace-steps a window of steps, the first instruction run is
+step 1. Both imply -trace like -trace-json does.`
+
+// run executes a .mkc file, or compiles and executes a source file when the
+// input does not start with the .mkc magic number.
+func run(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	coverprofile := flags.String("coverprofile", "", "write a coverage profile of the run to this file, only for source files")
+	profile := flags.String("profile", "", "write a pprof profile of the run to this file")
+	trace := flags.Bool("trace", false, "write every executed instruction to stderr")
+	traceJSON := flags.Bool("trace-json", false, "write the trace as JSON lines, implies -trace")
+	traceFunc := flags.String("trace-func", "", "only trace the instructions of the functions with this name, main is the program")
+	traceSteps := flags.String("trace-steps", "", "only trace the steps `from:to`, counted from the first instruction run, either can be left out")
+	usage(flags, runUsage, runDoc)
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: %s", runUsage)
+	}
+	path := flags.Arg(0)
+
+	var bytecode *compiler.Bytecode
+	var err error
+	if *coverprofile != "" {
+		bytecode, err = compileCovered(path)
+	} else {
+		bytecode, err = loadBytecode(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = bytecode.Verify(vm.StackSize)
+	if err != nil {
+		return fmt.Errorf("%s: invalid bytecode: %s", path, err)
+	}
+
+	machine := vm.New(bytecode)
+	var profiler *vm.Profiler
+	if *profile != "" {
+		profiler = vm.NewProfiler(time.Millisecond)
+		machine.SetProfiler(profiler)
+	}
+	if *trace || *traceJSON || *traceFunc != "" || *traceSteps != "" {
+		stderr := bufio.NewWriter(os.Stderr)
+		defer stderr.Flush()
+		tracer := vm.NewTracer(stderr)
+		tracer.JSON = *traceJSON
+		tracer.Function = *traceFunc
+		tracer.From, tracer.To, err = parseRange(*traceSteps)
+		if err != nil {
+			return err
+		}
+		machine.SetTracer(tracer)
+	}
+	err = machine.Run()
+	if profiler != nil {
+		if err := writePprof(*profile, profiler.Profile(path)); err != nil {
+			return err
+		}
+	}
+	if *coverprofile != "" {
+		cover := &coverage.Profile{}
+		cover.Add(path, bytecode.Counters, machine.Hits())
+		if err := writeProfile(*coverprofile, cover); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		if pos, ok := machine.Position(); ok {
+			return fmt.Errorf("%s:%d:%d: executing bytecode failed: %s", sourceFile(path, machine), pos.Line, pos.Column, err)
+		}
+		return fmt.Errorf("%s: executing bytecode failed: %s", path, err)
+	}
+	return nil
+}
+
+// sourceFile is the file the vm stopped in, the module it is in or the
+// program at path.
+func sourceFile(path string, machine *vm.VM) string {
+	if file := machine.File(); file != "" {
+		return file
+	}
+	return path
+}
+
+// parseRange parses the from:to of -trace-steps, a missing end is 0.
+func parseRange(steps string) (int, int, error) {
+	if steps == "" {
+		return 0, 0, nil
+	}
+	from, to, ok := strings.Cut(steps, ":")
+	bounds := []int{0, 0}
+	for i, bound := range []string{from, to} {
+		if bound == "" {
+			continue
+		}
+		n, err := strconv.Atoi(bound)
+		if err != nil || n < 1 {
+			ok = false
+			break
+		}
+		bounds[i] = n
+	}
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid -trace-steps %q, want from:to", steps)
+	}
+	return bounds[0], bounds[1], nil
+}
+
+func writePprof(path string, profile *pprof.Profile) error {
+	var buf bytes.Buffer
+	if err := profile.Write(&buf); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// compileCovered compiles a source file with coverage counters.
+func compileCovered(path string) (*compiler.Bytecode, error) {
+	program, err := parseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	comp := compiler.New()
+	comp.EnableCoverage()
+	comp.EnableImports(path, module.NewLoader(module.SearchPath()))
+	err = comp.Compile(program)
+	if err != nil {
+		return nil, fmt.Errorf("%s: compiling bytecode failed: %s", path, err)
+	}
+	return comp.Bytecode(), nil
+}
+
+func loadBytecode(path string) (*compiler.Bytecode, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(content, compiler.Magic) {
+		return compileSource(path, string(content))
+	}
+
+	bytecode, err := compiler.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return bytecode, nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		source   string
+		expected string
+	}{
+		{"let x = 1;\nputs(x / 0);", "2:6: executing bytecode failed: division by zero"},
+		{"let f = fn() {\n  f()\n};\nf();", "2:3: executing bytecode failed: Stack Overflow"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(dir, "main.mk")
+		if err := os.WriteFile(path, []byte(tt.source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		err := run([]string{path})
+		if err == nil || err.Error() != path+":"+tt.expected {
+			t.Errorf("wrong error for %q. want=%q, got=%v", tt.source, path+":"+tt.expected, err)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"mokey-type/ast"
+	"mokey-type/compiler"
+	"mokey-type/coverage"
+	"mokey-type/module"
+	"mokey-type/object"
+	"mokey-type/token"
+	"mokey-type/vm"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const testDoc = `Runs the tests of the *_test.mk files in paths, the current directory
+when there are none. A test is a top-level let whose name starts with test
+and whose value is a function without parameters, each one runs in a fresh
+vm after the rest of its file.
+
+A test fails when it has a runtime error, the assert builtins report one:
+  assert(cond, message?)                fails when cond is false
+  assertEqual(actual, expected, message?)
+                                        compares arrays and hashes element
+                                        by element
+  assertError(fn, substring?)           calls fn and fails when it doesn't,
+                                        it returns the message
+
+Every failure is reported with its position and time, test exits with 1
+when one fails.`
+
+// testFiles runs the tests in *_test.mk files, testDoc says what a test is.
+func testFiles(args []string) error {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	run := flags.String("run", "", "only run the tests whose name matches this regexp")
+	verbose := flags.Bool("v", false, "list every test and what it printed, not only the failures")
+	coverprofile := flags.String("coverprofile", "", "write a coverage profile of the tests to this file")
+	usage(flags, "mokey-type test [-run regexp] [-v] [-coverprofile file] [paths]", testDoc)
+	flags.Parse(args)
+
+	filter, err := regexp.Compile(*run)
+	if err != nil {
+		return err
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := findTestFiles(paths)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("test: no *_test.mk files in %s", strings.Join(paths, " "))
+	}
+
+	var cover *coverage.Profile
+	if *coverprofile != "" {
+		cover = &coverage.Profile{}
+	}
+	passed, failed := runTests(os.Stdout, files, filter, *verbose, cover)
+	if cover != nil {
+		if err := writeProfile(*coverprofile, cover); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("test: %d of %d failed", failed, passed+failed)
+	}
+	return nil
+}
+
+// findTestFiles returns the files named in paths and the *_test.mk files in
+// the directories, recursively.
+func findTestFiles(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() && strings.HasSuffix(path, "_test.mk") {
+				files = append(files, path)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// testCase is a test function of a file, or a let that looks like one but
+// can't be run, then reason says why.
+type testCase struct {
+	name   string
+	token  token.Token
+	reason string
+}
+
+func findTests(program *ast.Program) []testCase {
+	tests := []testCase{}
+	for _, s := range program.Statements {
+		let, ok := s.(*ast.LetStatement)
+		if !ok || !strings.HasPrefix(let.Name.Value, "test") {
+			continue
+		}
+		fn, ok := let.Value.(*ast.FunctionLiteral)
+		if !ok {
+			continue
+		}
+		test := testCase{name: let.Name.Value, token: let.Name.Token}
+		if len(fn.Parameters) != 0 {
+			test.reason = "test functions take no arguments"
+		}
+		tests = append(tests, test)
+	}
+	return tests
+}
+
+// runTests prints the outcome of every test in files to w, like go test
+// does, and counts them. The hits of the tests are added to cover unless it
+// is nil.
+func runTests(w io.Writer, files []string, filter *regexp.Regexp, verbose bool, cover *coverage.Profile) (passed, failed int) {
+	for _, path := range files {
+		start := time.Now()
+		program, err := parseFile(path)
+		if err != nil {
+			fmt.Fprintf(w, "FAIL\t%s\n\t%s\n", path, strings.ReplaceAll(err.Error(), "\n", "\n\t"))
+			failed++
+			continue
+		}
+		p, f := runFileTests(w, path, program, filter, verbose, cover)
+		passed, failed = passed+p, failed+f
+
+		elapsed := time.Since(start).Round(time.Microsecond)
+		summary := ""
+		if cover != nil && p+f > 0 {
+			summary = "\t" + cover.Summary(path).String()
+		}
+		switch {
+		case f > 0:
+			fmt.Fprintf(w, "FAIL\t%s\t%d passed, %d failed (%s)%s\n", path, p, f, elapsed, summary)
+		case p == 0:
+			fmt.Fprintf(w, "?   \t%s\t[no tests]\n", path)
+		default:
+			fmt.Fprintf(w, "ok  \t%s\t%d passed (%s)%s\n", path, p, elapsed, summary)
+		}
+	}
+	return passed, failed
+}
+
+func runFileTests(w io.Writer, path string, program *ast.Program, filter *regexp.Regexp, verbose bool, cover *coverage.Profile) (passed, failed int) {
+	for _, test := range findTests(program) {
+		if !filter.MatchString(test.name) {
+			continue
+		}
+		if verbose {
+			fmt.Fprintf(w, "=== RUN   %s\n", test.name)
+		}
+		start := time.Now()
+		output, err := runTest(path, program, test, cover)
+		elapsed := time.Since(start).Round(time.Microsecond)
+
+		at := fmt.Sprintf("%s:%d:%d", path, test.token.Line, test.token.Column)
+		if err != nil {
+			failed++
+			fmt.Fprintf(w, "--- FAIL: %s %s (%s)\n    %s\n", test.name, at, elapsed, err)
+		} else {
+			passed++
+			if !verbose {
+				continue
+			}
+			fmt.Fprintf(w, "--- PASS: %s %s (%s)\n", test.name, at, elapsed)
+		}
+		for _, line := range strings.SplitAfter(output, "\n") {
+			if line != "" {
+				fmt.Fprintf(w, "    %s", line)
+			}
+		}
+		if output != "" && !strings.HasSuffix(output, "\n") {
+			fmt.Fprintln(w)
+		}
+	}
+	return passed, failed
+}
+
+// runTest compiles the file with a call to the test at the end and runs it,
+// it returns what the test printed and the error that stopped it, with the
+// position it happened at.
+func runTest(path string, program *ast.Program, test testCase, cover *coverage.Profile) (output string, err error) {
+	if test.reason != "" {
+		return "", fmt.Errorf("%s:%d:%d: %s", path, test.token.Line, test.token.Column, test.reason)
+	}
+
+	call := &ast.ExpressionStatement{Expression: &ast.CallExpression{
+		Token:    token.Token{Type: token.LPAREN, Literal: "("},
+		Function: &ast.Identifier{Token: token.Token{Type: token.IDENT, Literal: test.name}, Value: test.name},
+	}}
+	statements := append(append([]ast.Statement{}, program.Statements...), call)
+
+	comp := compiler.New()
+	if cover != nil {
+		comp.EnableCoverage()
+	}
+	comp.EnableImports(path, module.NewLoader(module.SearchPath()))
+	if err := comp.Compile(&ast.Program{Statements: statements}); err != nil {
+		if ce, ok := err.(*compiler.Error); ok {
+			return "", fmt.Errorf("%s:%d:%d: %s", path, ce.Token.Line, ce.Token.Column, err)
+		}
+		return "", fmt.Errorf("%s: %s", path, err)
+	}
+
+	var stdout bytes.Buffer
+	defer func(previous io.Writer) {
+		object.Stdout = previous
+		output = stdout.String()
+	}(object.Stdout)
+	object.Stdout = &stdout
+
+	bytecode := comp.Bytecode()
+	machine := vm.New(bytecode)
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s: panic: %v", path, r)
+		}
+		if cover != nil {
+			// what ran before a failure counts too
+			cover.Add(path, bytecode.Counters, machine.Hits())
+		}
+	}()
+	if err := machine.Run(); err != nil {
+		if pos, ok := machine.Position(); ok {
+			return "", fmt.Errorf("%s:%d:%d: %s", sourceFile(path, machine), pos.Line, pos.Column, err)
+		}
+		return "", fmt.Errorf("%s: %s", path, err)
+	}
+	return "", nil
+}
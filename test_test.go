@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"mokey-type/coverage"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const mathTests = `let add = fn(a, b) { a + b };
+
+let testAdd = fn() {
+  assertEqual(add(1, 2), 3);
+  assertEqual([add(1, 1)], [2], "in an array");
+};
+
+let testFails = fn() {
+  puts("before");
+  assertEqual(add(2, 2), 5)
+};
+
+let testErrors = fn() {
+  let message = assertError(fn() { add(1, true) }, "BOOLEAN");
+  assert(contains(message, "INTEGER"))
+};
+
+let testArgs = fn(x) { x };
+let helper = fn() { 1 };
+`
+
+func TestRunTests(t *testing.T) {
+	dir := t.TempDir()
+	math := filepath.Join(dir, "math_test.mk")
+	empty := filepath.Join(dir, "sub", "empty_test.mk")
+	broken := filepath.Join(dir, "sub", "broken_test.mk")
+	files := map[string]string{
+		math:                             mathTests,
+		empty:                            "let x = 1;",
+		broken:                           "let = ;",
+		filepath.Join(dir, "helpers.mk"): "let testIgnored = fn() { assert(false) };",
+	}
+	for path, source := range files {
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, []byte(source), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := findTestFiles([]string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{math, broken, empty}; strings.Join(found, " ") != strings.Join(want, " ") {
+		t.Fatalf("wrong test files.\nwant=%q\n got=%q", want, found)
+	}
+
+	var out bytes.Buffer
+	passed, failed := runTests(&out, found, regexp.MustCompile(""), false, nil)
+	if passed != 2 || failed != 3 {
+		t.Errorf("wrong counts. want 2 passed and 3 failed, got %d and %d\n%s", passed, failed, out.String())
+	}
+	for _, want := range []string{
+		"--- FAIL: testFails " + math + ":8:5 (",
+		"    " + math + ":10:3: assertEqual failed: got 4, want 5\n    before\n",
+		math + ":18:5: test functions take no arguments",
+		"FAIL\t" + math + "\t2 passed, 2 failed (",
+		"FAIL\t" + broken + "\n\t" + broken + ": parser errors:",
+		"?   \t" + empty + "\t[no tests]",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output is missing %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "testAdd") {
+		t.Errorf("passing tests are only listed with -v:\n%s", out.String())
+	}
+
+	out.Reset()
+	passed, failed = runTests(&out, []string{math}, regexp.MustCompile("Add|Errors"), true, nil)
+	if passed != 2 || failed != 0 {
+		t.Errorf("wrong counts with -run. want 2 passed, got %d and %d failed\n%s", passed, failed, out.String())
+	}
+	if !strings.Contains(out.String(), "=== RUN   testAdd\n--- PASS: testAdd "+math+":3:5 (") {
+		t.Errorf("-v should list passing tests:\n%s", out.String())
+	}
+
+	out.Reset()
+	cover := &coverage.Profile{}
+	runTests(&out, []string{math}, regexp.MustCompile("Add"), false, cover)
+	if !strings.Contains(out.String(), "\tcoverage: 56.2% of statements\n") {
+		t.Errorf("the file's coverage is missing:\n%s", out.String())
+	}
+	if summary := cover.Summary(math); summary.Statements != 16 || summary.CoveredStatements != 9 {
+		t.Errorf("wrong coverage of testAdd %+v", summary)
+	}
+}
@@ -0,0 +1,14 @@
+// integer arithmetic, precedence and comparisons
+// stdout: 16
+// stdout: 26
+// stdout: 3
+// stdout: 7
+// stdout: 40
+// result: [true, false, true, true]
+let a = 10;
+let b = 3;
+puts(a + b * 2);
+puts((a + b) * 2);
+puts(a / b, a - b);
+puts(-a + 50);
+[a > b, a < b, a == 10, !(a != 10)]
@@ -0,0 +1,18 @@
+// array literals, indexing and the array builtins
+// stdout: 1
+// stdout: 4
+// stdout: 3
+// stdout: 1
+// stdout: 4
+// stdout: 4
+// stdout: [2, 3, 4]
+// stdout: [1, 2, 3, 4]
+// stdout: [1, 2, 3, 4, 5]
+// result: [[5, 4, 3, 2, 1], "a-b", [1, 2, 3, 4, 9], null]
+let xs = [1, 2, 3, 4];
+puts(xs[0], xs[3], xs[1 + 1]);
+puts(first(xs), last(xs), len(xs));
+puts(rest(xs));
+let ys = push(xs, 5);
+puts(xs, ys);
+[reverse(ys), join(["a", "b"], "-"), merge(xs, [9]), xs[10]]
@@ -0,0 +1,15 @@
+// typeOf and the string and hash builtins
+// stdout: INTEGER
+// stdout: STRING
+// stdout: ARRAY
+// stdout: HASH
+// stdout: BOOLEAN
+// stdout: true
+// stdout: mokey
+// stdout: x
+// stdout: x
+// result: 1
+puts(typeOf(1), typeOf("a"), typeOf([]), typeOf({}), typeOf(true));
+puts(contains("mokey", "key"), toLower("MoKey"));
+puts(trimLeft("--x", "-"), trimRight("x--", "-"));
+findIndex([3, 4, 5], 4)
@@ -0,0 +1,13 @@
+// functions that close over the variables of the function that made them
+// stdout: 3
+// stdout: 11
+// result: [101, 102, 103]
+let adder = fn(x) { fn(y) { x + y } };
+let addTwo = adder(2);
+let addTen = adder(10);
+puts(addTwo(1), addTen(1));
+let counter = fn(start) {
+  let step = fn(n) { start + n };
+  [step(1), step(2), step(3)]
+};
+counter(100)
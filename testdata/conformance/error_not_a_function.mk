@@ -0,0 +1,4 @@
+// calling something that isn't a function
+// error: calling non-function
+let x = 5;
+x(1)
@@ -0,0 +1,7 @@
+// adding an integer and a boolean stops the program, what was printed
+// before stays
+// stdout: before
+// error: unsoported types for binary operation: INTEGER BOOLEAN
+puts("before");
+let x = 1 + true;
+puts("after");
@@ -0,0 +1,4 @@
+// calling a function with the wrong number of arguments
+// error: wrong number of arguments: want=2, got=1
+let add = fn(a, b) { a + b };
+add(1)
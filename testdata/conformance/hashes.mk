@@ -0,0 +1,11 @@
+// hash literals with every kind of key
+// stdout: 1
+// stdout: two
+// stdout: [3]
+// stdout: null
+// result: [1, "two", 1]
+let h = {"one": 1, 2: "two", true: [3]};
+puts(h["one"], h[2], h[true]);
+puts(h["missing"]);
+let key = "o" + "ne";
+[h[key], h[1 + 1], {"nested": {"a": 1}}["nested"]["a"]]
@@ -0,0 +1,20 @@
+// functions passed to and returned from functions
+// stdout: [2, 4, 6]
+// result: 20
+let map = fn(xs, f) {
+  let iter = fn(xs, acc) {
+    if (len(xs) == 0) { return acc };
+    iter(rest(xs), push(acc, f(first(xs))))
+  };
+  iter(xs, [])
+};
+let reduce = fn(xs, initial, f) {
+  let iter = fn(xs, acc) {
+    if (len(xs) == 0) { return acc };
+    iter(rest(xs), f(acc, first(xs)))
+  };
+  iter(xs, initial)
+};
+let double = fn(x) { x * 2 };
+puts(map([1, 2, 3], double));
+reduce(map([1, 2, 3, 4], double), 0, fn(acc, x) { acc + x })
@@ -0,0 +1,17 @@
+// for loops, early returns from inside a loop
+// stdout: 0
+// stdout: 1
+// stdout: 2
+// result: [2, -1]
+let collect = fn(n) {
+  for (let i = 0; i < n; ++i) { puts(i) };
+  n
+};
+let find = fn(xs, target) {
+  for (let i = 0; i < len(xs); ++i) {
+    if (xs[i] == target) { return i }
+  };
+  -1
+};
+collect(3);
+[find([5, 6, 7], 7), find([5, 6, 7], 8)]
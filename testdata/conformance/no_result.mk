@@ -0,0 +1,4 @@
+// a program that ends in a let has output but no result
+// stdout: only output
+puts("only output");
+let x = 1;
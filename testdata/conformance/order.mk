@@ -0,0 +1,15 @@
+// operands, arguments and elements are evaluated left to right
+// stdout: 1
+// stdout: 2
+// stdout: 3
+// stdout: 4
+// stdout: 5
+// stdout: 6
+// stdout: 7
+// stdout: 8
+// stdout: 9
+// stdout: 10
+// result: [true, false, -1, [7, 8], [9, 10]]
+let trace = fn(x) { puts(x); x };
+let pair = fn(a, b) { [a, b] };
+[trace(1) < trace(2), trace(3) > trace(4), trace(5) - trace(6), pair(trace(7), trace(8)), [trace(9), trace(10)]]
@@ -0,0 +1,12 @@
+// recursive functions
+// stdout: 610
+// stdout: 3628800
+// result: 6765
+let fibonacci = fn(n) {
+  if (n < 2) { return n };
+  fibonacci(n - 1) + fibonacci(n - 2)
+};
+let factorial = fn(n) { if (n == 0) { 1 } else { n * factorial(n - 1) } };
+puts(fibonacci(15));
+puts(factorial(10));
+fibonacci(20)
@@ -0,0 +1,12 @@
+// string concatenation, comparison and the string builtins
+// stdout: hello world
+// stdout: 5
+// stdout: WORLD
+// stdout: spaced
+// result: [true, true, ["a", "b", "c"], "bonono"]
+let greeting = "hello";
+let name = "world";
+puts(greeting + " " + name);
+puts(len(greeting));
+puts(toUpper(name), trim("  spaced  ", " "));
+[greeting == "hello", greeting != name, split("a,b,c", ","), replace("banana", "a", "o")]
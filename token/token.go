@@ -1,15 +1,21 @@
 package token
 
+import "sort"
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
+	// Line and Column are 1-based, the column counts bytes
+	Line   int
+	Column int
 }
 
 const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
+	COMMENT = "COMMENT"
 	// Identifiers
 	IDENT = "IDENT"
 	// literals
@@ -31,6 +37,7 @@ const (
 	LT_EQ     = "<="
 	INCREMENT = "++"
 	DECREMENT = "--"
+	ARROW     = "->"
 
 	// Delimiters
 	SEMICOLON = ";"
@@ -53,6 +60,7 @@ const (
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
 	FOR      = "FOR"
+	IMPORT   = "IMPORT"
 )
 
 func NewToken(tokenType TokenType, ch byte) Token {
@@ -68,6 +76,16 @@ var keywords = map[string]TokenType{
 	"else":   ELSE,
 	"return": RETURN,
 	"for":    FOR,
+	"import": IMPORT,
+}
+
+func Keywords() []string {
+	names := []string{}
+	for name := range keywords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 func LookupIdent(ident string) TokenType {
@@ -0,0 +1,197 @@
+package types
+
+import (
+	"fmt"
+	"mokey-type/object"
+)
+
+func arity(args []Type, want ...int) error {
+	for _, w := range want {
+		if len(args) == w {
+			return nil
+		}
+	}
+	return fmt.Errorf("wrong number of arguments. got=%d, want=%d", len(args), want[len(want)-1])
+}
+
+func notSupported(name string, t Type) error {
+	return fmt.Errorf("argument to `%s` not supported, got %s", name, t)
+}
+
+// element returns the element type of an array, any for any.
+func element(t Type) (Type, bool) {
+	switch t := t.(type) {
+	case *Array:
+		return t.Element, true
+	case Basic:
+		return Any, t == Any || t == never
+	}
+	return nil, false
+}
+
+// signature checks builtins that take fixed types.
+func signature(name string, ret Type, params ...Type) func([]Type) (Type, error) {
+	return func(args []Type) (Type, error) {
+		if err := arity(args, len(params)); err != nil {
+			return nil, err
+		}
+		for i, arg := range args {
+			if !Consistent(arg, params[i]) {
+				return nil, fmt.Errorf("argument to `%s` must be %s, got %s", name, params[i], arg)
+			}
+		}
+		return ret, nil
+	}
+}
+
+// array checks builtins that take an array followed by more values of its
+// element type.
+func array(name string, ret func(element Type, array Type) Type, more int) func([]Type) (Type, error) {
+	return func(args []Type) (Type, error) {
+		if err := arity(args, 1+more); err != nil {
+			return nil, err
+		}
+		elem, ok := element(args[0])
+		if !ok {
+			return nil, fmt.Errorf("argument to `%s` must be an array, got %s", name, args[0])
+		}
+		for _, arg := range args[1:] {
+			if !Consistent(arg, elem) {
+				return nil, fmt.Errorf("argument to `%s` must be %s, got %s", name, elem, arg)
+			}
+		}
+		return ret(elem, args[0]), nil
+	}
+}
+
+func elementOf(element Type, _ Type) Type { return element }
+func same(_ Type, array Type) Type        { return array }
+
+var builtins = map[string]func([]Type) (Type, error){
+	"puts": func(args []Type) (Type, error) {
+		return Null, nil
+	},
+	"typeOf": signature("typeOf", String, Any),
+	"len": func(args []Type) (Type, error) {
+		if err := arity(args, 1); err != nil {
+			return nil, err
+		}
+		if _, ok := element(args[0]); !ok && !Consistent(args[0], String) {
+			return nil, notSupported("len", args[0])
+		}
+		return Int, nil
+	},
+	"first": array("first", elementOf, 0),
+	"last":  array("last", elementOf, 0),
+	"rest":  array("rest", same, 0),
+	"push":  array("push", same, 1),
+	"pop":   array("pop", same, 0),
+	"reverse": func(args []Type) (Type, error) {
+		if err := arity(args, 1); err != nil {
+			return nil, err
+		}
+		if _, ok := element(args[0]); !ok && !Consistent(args[0], String) {
+			return nil, notSupported("reverse", args[0])
+		}
+		return args[0], nil
+	},
+	"join": func(args []Type) (Type, error) {
+		if err := arity(args, 2, 3); err != nil {
+			return nil, err
+		}
+		if len(args) == 3 {
+			return signature("join", String, String, String, String)(args)
+		}
+		if _, ok := element(args[0]); !ok {
+			return nil, notSupported("join", args[0])
+		}
+		if !Consistent(args[1], String) {
+			return nil, fmt.Errorf("argument to `join` must be string, got %s", args[1])
+		}
+		return String, nil
+	},
+	"split":     signature("split", &Array{Element: String}, String, String),
+	"replace":   signature("replace", String, String, String, String),
+	"toLower":   signature("toLower", String, String),
+	"toUpper":   signature("toUpper", String, String),
+	"trim":      signature("trim", String, String, String),
+	"trimLeft":  signature("trimLeft", String, String, String),
+	"trimRight": signature("trimRight", String, String, String),
+	"contains": func(args []Type) (Type, error) {
+		if err := arity(args, 2); err != nil {
+			return nil, err
+		}
+		if elem, ok := element(args[0]); ok && args[0] != Any {
+			if !Consistent(args[1], elem) {
+				return nil, fmt.Errorf("argument to `contains` must be %s, got %s", elem, args[1])
+			}
+			return Bool, nil
+		}
+		if !Consistent(args[0], String) {
+			return nil, notSupported("contains", args[0])
+		}
+		return Bool, nil
+	},
+	"merge": func(args []Type) (Type, error) {
+		if err := arity(args, 2); err != nil {
+			return nil, err
+		}
+		a, ok := element(args[0])
+		if !ok {
+			return nil, fmt.Errorf("argument to `merge` must be an array, got %s", args[0])
+		}
+		b, ok := element(args[1])
+		if !ok {
+			return nil, fmt.Errorf("argument to `merge` must be an array, got %s", args[1])
+		}
+		return &Array{Element: join(a, b)}, nil
+	},
+	"findIndex": array("findIndex", func(Type, Type) Type { return Int }, 1),
+	"assert": func(args []Type) (Type, error) {
+		if err := arity(args, 1, 2); err != nil {
+			return nil, err
+		}
+		return message("assert", args, 1)
+	},
+	"assertEqual": func(args []Type) (Type, error) {
+		if err := arity(args, 2, 3); err != nil {
+			return nil, err
+		}
+		return message("assertEqual", args, 2)
+	},
+	"assertError": func(args []Type) (Type, error) {
+		if err := arity(args, 1, 2); err != nil {
+			return nil, err
+		}
+		if fn, ok := args[0].(*Function); ok && len(fn.Parameters) != 0 {
+			return nil, fmt.Errorf("argument to `assertError` must be a function without parameters, got %s", fn)
+		} else if !ok && args[0] != Any {
+			return nil, fmt.Errorf("argument to `assertError` must be a function, got %s", args[0])
+		}
+		if _, err := message("assertError", args, 1); err != nil {
+			return nil, err
+		}
+		return String, nil
+	},
+}
+
+// message checks the optional message the assert builtins take at i.
+func message(name string, args []Type, i int) (Type, error) {
+	if len(args) > i && !Consistent(args[i], String) {
+		return nil, fmt.Errorf("argument to `%s` must be string, got %s", name, args[i])
+	}
+	return Null, nil
+}
+
+// builtinTypes gives every name in object.Builtins its type.
+func builtinTypes() map[string]Type {
+	types := map[string]Type{}
+	for _, b := range object.Builtins {
+		if check, ok := builtins[b.Name]; ok {
+			types[b.Name] = &Builtin{Name: b.Name, check: check}
+		} else {
+			types[b.Name] = Any
+		}
+	}
+	return types
+}
@@ -0,0 +1,342 @@
+package types
+
+import (
+	"fmt"
+	"mokey-type/ast"
+	"mokey-type/token"
+)
+
+// Error is a type error and the token it was found at.
+type Error struct {
+	Message string
+	Token   token.Token
+}
+
+func (e Error) Error() string { return e.Message }
+
+type scope struct {
+	names map[string]Type
+	outer *scope
+}
+
+func (s *scope) lookup(name string) (Type, bool) {
+	for ; s != nil; s = s.outer {
+		if t, ok := s.names[name]; ok {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+type checker struct {
+	scope  *scope
+	errors []Error
+	// returns collects the types returned by the function being checked,
+	// nil at the top level
+	returns *[]Type
+}
+
+// Check type checks program and returns every error it finds.
+func Check(program *ast.Program) []Error {
+	c := &checker{scope: &scope{names: builtinTypes()}}
+	c.scope = &scope{names: map[string]Type{}, outer: c.scope}
+	c.statements(program.Statements)
+	return c.errors
+}
+
+func (c *checker) errorf(tok token.Token, format string, a ...interface{}) {
+	c.errors = append(c.errors, Error{Message: fmt.Sprintf(format, a...), Token: tok})
+}
+
+// annotation converts a, reporting unknown types as errors and using any
+// for them.
+func (c *checker) annotation(a *ast.TypeAnnotation) Type {
+	if a == nil {
+		return Any
+	}
+	t, err := FromAnnotation(a)
+	if err != nil {
+		c.errorf(a.Token, "%s", err)
+		return Any
+	}
+	return t
+}
+
+// statements returns the type of the value statements produce, the value
+// of the last one when it is an expression.
+func (c *checker) statements(statements []ast.Statement) Type {
+	var result Type = Null
+	for _, s := range statements {
+		result = Null
+		switch s := s.(type) {
+		case *ast.LetStatement:
+			c.let(s)
+		case *ast.ReturnStatement:
+			t := c.expression(s.ReturnValue)
+			if c.returns != nil {
+				*c.returns = append(*c.returns, t)
+			}
+			result = never
+		case *ast.ExpressionStatement:
+			result = c.expression(s.Expression)
+		}
+		if result == never {
+			// the rest of the block never runs
+			break
+		}
+	}
+	return result
+}
+
+func (c *checker) let(s *ast.LetStatement) {
+	if s.Name == nil {
+		return
+	}
+	// like the compiler, the name is defined before its value so functions
+	// can call themselves
+	declared := c.annotation(s.Type)
+	if s.Type == nil {
+		if fn, ok := s.Value.(*ast.FunctionLiteral); ok && fn != nil {
+			declared = c.signature(fn)
+		}
+	}
+	c.scope.names[s.Name.Value] = declared
+
+	t := c.expression(s.Value)
+	if s.Type != nil {
+		if !Consistent(t, declared) {
+			c.errorf(ast.Start(s.Value), "cannot use %s as %s in let %s", t, declared, s.Name.Value)
+		}
+		return
+	}
+	c.scope.names[s.Name.Value] = t
+}
+
+// signature is the type fn has from its annotations alone.
+func (c *checker) signature(fn *ast.FunctionLiteral) *Function {
+	signature := &Function{Parameters: []Type{}, Return: Any}
+	for i := range fn.Parameters {
+		var annotation *ast.TypeAnnotation
+		if i < len(fn.ParameterTypes) {
+			annotation = fn.ParameterTypes[i]
+		}
+		signature.Parameters = append(signature.Parameters, c.annotation(annotation))
+	}
+	if fn.ReturnType != nil {
+		signature.Return = c.annotation(fn.ReturnType)
+	}
+	return signature
+}
+
+func (c *checker) expression(e ast.Expression) Type {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.StringLiteral:
+		return String
+	case *ast.Boolean:
+		return Bool
+
+	case *ast.Identifier:
+		t, ok := c.scope.lookup(e.Value)
+		if !ok {
+			c.errorf(e.Token, "undefined variable: %s", e.Value)
+			return Any
+		}
+		return t
+
+	case *ast.PrefixExpression:
+		right := c.expression(e.Right)
+		if e.Operator == "!" {
+			return Bool
+		}
+		if !Consistent(right, Int) {
+			c.errorf(e.Token, "operator %s not defined for %s", e.Operator, right)
+		}
+		return Int
+
+	case *ast.InfixExpression:
+		return c.infix(e)
+
+	case *ast.ArrayLiteral:
+		var element Type = never
+		for _, el := range e.Elements {
+			element = join(element, c.expression(el))
+		}
+		if element == never {
+			element = Any
+		}
+		return &Array{Element: element}
+
+	case *ast.HashLiteral:
+		var key, value Type = never, never
+		for _, k := range e.OrderedKeys() {
+			kt := c.expression(k)
+			if !hashable(kt) {
+				c.errorf(ast.Start(k), "unusable as hash key: %s", kt)
+			}
+			key = join(key, kt)
+			value = join(value, c.expression(e.Pairs[k]))
+		}
+		if key == never {
+			key, value = Any, Any
+		}
+		return &Hash{Key: key, Value: value}
+
+	case *ast.IndexExpression:
+		return c.index(e)
+
+	case *ast.CallExpression:
+		return c.call(e)
+
+	case *ast.FunctionLiteral:
+		return c.function(e)
+
+	case *ast.IfExpression:
+		c.expression(e.Condition)
+		t := c.block(e.Consequence)
+		if e.Alternative == nil {
+			return join(t, Null)
+		}
+		return join(t, c.block(e.Alternative))
+
+	case *ast.ForLoop:
+		c.let(&e.Declaration)
+		c.expression(e.Condition)
+		c.block(e.Body)
+		c.expression(e.Consequence)
+		return Null
+	}
+	return Any
+}
+
+func (c *checker) block(b *ast.BlockStatement) Type {
+	if b == nil {
+		return Null
+	}
+	return c.statements(b.Statements)
+}
+
+func (c *checker) infix(e *ast.InfixExpression) Type {
+	left := c.expression(e.Left)
+	right := c.expression(e.Right)
+
+	switch e.Operator {
+	case "==", "!=":
+		return Bool
+	case "+":
+		switch {
+		case left == Any && right == Any:
+			return Any
+		case Consistent(left, Int) && Consistent(right, Int):
+			return Int
+		case Consistent(left, String) && Consistent(right, String):
+			return String
+		}
+	case "-", "*", "/":
+		if Consistent(left, Int) && Consistent(right, Int) {
+			return Int
+		}
+	case "<", ">":
+		if Consistent(left, Int) && Consistent(right, Int) {
+			return Bool
+		}
+	default:
+		return Any
+	}
+	c.errorf(e.Token, "operator %s not defined for %s and %s", e.Operator, left, right)
+	return Any
+}
+
+func (c *checker) index(e *ast.IndexExpression) Type {
+	left := c.expression(e.Left)
+	index := c.expression(e.Index)
+
+	switch left := left.(type) {
+	case *Array:
+		if !Consistent(index, Int) {
+			c.errorf(ast.Start(e.Index), "array index must be int, got %s", index)
+		}
+		return left.Element
+	case *Hash:
+		if !Consistent(index, left.Key) {
+			c.errorf(ast.Start(e.Index), "cannot use %s as %s key", index, left.Key)
+		}
+		return left.Value
+	}
+	if left != Any && left != never {
+		c.errorf(e.Token, "cannot index %s", left)
+	}
+	return Any
+}
+
+func (c *checker) call(e *ast.CallExpression) Type {
+	callee := c.expression(e.Function)
+	args := []Type{}
+	for _, a := range e.Arguments {
+		args = append(args, c.expression(a))
+	}
+
+	switch callee := callee.(type) {
+	case *Function:
+		if len(args) != len(callee.Parameters) {
+			c.errorf(e.Token, "wrong number of arguments: want=%d, got=%d", len(callee.Parameters), len(args))
+			return callee.Return
+		}
+		for i, arg := range args {
+			if !Consistent(arg, callee.Parameters[i]) {
+				c.errorf(ast.Start(e.Arguments[i]), "cannot use %s as %s in argument %d", arg, callee.Parameters[i], i+1)
+			}
+		}
+		return callee.Return
+	case *Builtin:
+		t, err := callee.check(args)
+		if err != nil {
+			c.errorf(ast.Start(e.Function), "%s", err)
+			return Any
+		}
+		return t
+	}
+	if callee != Any && callee != never {
+		c.errorf(e.Token, "cannot call %s", callee)
+	}
+	return Any
+}
+
+func (c *checker) function(fn *ast.FunctionLiteral) Type {
+	signature := c.signature(fn)
+
+	outer, outerReturns := c.scope, c.returns
+	c.scope = &scope{names: map[string]Type{}, outer: outer}
+	returns := []Type{}
+	c.returns = &returns
+	defer func() { c.scope, c.returns = outer, outerReturns }()
+
+	if fn.Name != "" {
+		c.scope.names[fn.Name] = signature
+	}
+	for i, param := range fn.Parameters {
+		c.scope.names[param.Value] = signature.Parameters[i]
+	}
+
+	result := c.block(fn.Body)
+	if fn.ReturnType != nil {
+		for _, t := range returns {
+			if !Consistent(t, signature.Return) {
+				c.errorf(fn.ReturnType.Token, "cannot return %s from a function returning %s", t, signature.Return)
+			}
+		}
+		if !Consistent(result, signature.Return) {
+			c.errorf(fn.ReturnType.Token, "cannot return %s from a function returning %s", result, signature.Return)
+		}
+		return signature
+	}
+
+	for _, t := range returns {
+		result = join(result, t)
+	}
+	if result == never {
+		result = Null
+	}
+	return &Function{Parameters: signature.Parameters, Return: result}
+}
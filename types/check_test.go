@@ -0,0 +1,147 @@
+package types
+
+import (
+	"fmt"
+	"mokey-type/conformance"
+	"mokey-type/lexer"
+	"mokey-type/object"
+	"mokey-type/parser"
+	"testing"
+)
+
+func check(t *testing.T, input string) []string {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	errors := []string{}
+	for _, err := range Check(program) {
+		errors = append(errors, fmt.Sprintf("%d:%d: %s", err.Token.Line, err.Token.Column, err))
+	}
+	return errors
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"let x: int = 5; let y: string = x", []string{
+			"1:33: cannot use int as string in let y",
+		}},
+		{"len(5)", []string{
+			"1:1: argument to `len` not supported, got int",
+		}},
+		{`let f = fn(a: string, b: [int]) -> bool { len(a) > first(b) }; f("a", [1]); f(1, ["b"])`, []string{
+			"1:79: cannot use int as string in argument 1",
+			"1:82: cannot use [string] as [int] in argument 2",
+		}},
+		{"let f = fn(a: int) -> string { if (a > 1) { return a } else { \"b\" } }", []string{
+			"1:23: cannot return int from a function returning string",
+		}},
+		{"let f = fn(a) { a + 1 }; f(1, 2)", []string{
+			"1:27: wrong number of arguments: want=1, got=2",
+		}},
+		{`1 + "a"; -"a"; "a" < "b"`, []string{
+			"1:3: operator + not defined for int and string",
+			"1:10: operator - not defined for string",
+			"1:20: operator < not defined for string and string",
+		}},
+		{`let h = {"a": 1}; h[1]; [1, 2]["a"]; 5[0]; 5()`, []string{
+			"1:21: cannot use int as string key",
+			"1:32: array index must be int, got string",
+			"1:39: cannot index int",
+			"1:45: cannot call int",
+		}},
+		{"let a: [foo] = [1]; let h: {[int]: int} = {}; {[1]: 2}", []string{
+			"1:8: unknown type foo",
+			"1:28: unusable as hash key: [int]",
+			"1:48: unusable as hash key: [int]",
+		}},
+		{"let a: [int] = push([1], 2); let b: int = first(a); push(a, \"x\")", []string{
+			"1:53: argument to `push` must be int, got string",
+		}},
+		{"x; let fib = fn(n: int) -> int { if (n < 2) { return n }; fib(n - 1) + fib(n - 2) }; fib(10)", []string{
+			"1:1: undefined variable: x",
+		}},
+		{"let f = fn(g: fn(int) -> int) { g(1) }; f(fn(x: int) -> int { x }); f(fn(x: string) { x })", []string{
+			"1:71: cannot use fn(string) -> string as fn(int) -> int in argument 1",
+		}},
+		// unannotated values are any, so this only fails at runtime
+		{"let f = fn(a) { len(a) }; f(5); let g: int = f(\"s\")", nil},
+		{"for (let i: int = 0; i < 10; ++i) { puts(i) }; let s: string = toUpper(\"a\")", nil},
+	}
+
+	for _, tt := range tests {
+		errors := check(t, tt.input)
+		if len(errors) != len(tt.expected) {
+			t.Errorf("wrong errors for %q.\nwant=%q\ngot=%q", tt.input, tt.expected, errors)
+			continue
+		}
+		for i, err := range errors {
+			if err != tt.expected[i] {
+				t.Errorf("wrong error for %q. want=%q, got=%q", tt.input, tt.expected[i], err)
+			}
+		}
+	}
+}
+
+func TestInference(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 + 2", "int"},
+		{`"a" + "b"`, "string"},
+		{"[1, 2]", "[int]"},
+		{`[1, "a"]`, "[any]"},
+		{"[]", "[any]"},
+		{`{"a": [true]}`, "{string: [bool]}"},
+		{"fn(a: int) { a * 2 }", "fn(int) -> int"},
+		{"fn(a, b) { if (a) { return b } ; 1 }", "fn(any, any) -> any"},
+		{"fn(a: int) { if (a > 0) { return 1 } else { return 2 } }", "fn(int) -> int"},
+		{"fn() { }", "fn() -> null"},
+		{"if (true) { 1 }", "any"},
+		{"let f = fn(a: string) -> [string] { split(a, \",\") }; f(\"a\")[0]", "string"},
+	}
+
+	for _, tt := range tests {
+		p := parser.New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		c := &checker{scope: &scope{names: builtinTypes()}}
+		got := c.statements(program.Statements)
+		if len(c.errors) != 0 {
+			t.Errorf("errors for %q: %v", tt.input, c.errors)
+		}
+		if got.String() != tt.expected {
+			t.Errorf("wrong type for %q. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// failing reports whether a conformance case is expected to fail at
+// runtime, those are the cases the checker should catch.
+func failing(expected interface{}) bool {
+	switch expected.(type) {
+	case conformance.RuntimeError, *object.Error:
+		return true
+	}
+	return false
+}
+
+func TestConformanceInputs(t *testing.T) {
+	for _, suite := range conformance.Suites {
+		for _, c := range suite.Cases {
+			p := parser.New(lexer.New(c.Input))
+			program := p.ParseProgram()
+			if len(p.Errors()) != 0 || failing(c.Expected) {
+				continue
+			}
+			for _, err := range Check(program) {
+				t.Errorf("%s: %q: %d:%d: %s", suite.Name, c.Input, err.Token.Line, err.Token.Column, err)
+			}
+		}
+	}
+}
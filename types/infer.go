@@ -0,0 +1,470 @@
+package types
+
+import (
+	"fmt"
+	"mokey-type/ast"
+	"mokey-type/compiler"
+	"mokey-type/token"
+)
+
+// Binding is a top-level let and the type inferred for it.
+type Binding struct {
+	Name *ast.Identifier
+	Type Type
+}
+
+// Inference is the result of Infer.
+type Inference struct {
+	Bindings []Binding
+	Errors   []Error
+}
+
+type inferer struct {
+	resolved *compiler.Index
+	// env holds the type of every declaration, keyed by the identifier
+	// that declared it
+	env    map[*ast.Identifier]Type
+	level  int
+	next   int
+	errors []Error
+	// returns is the return type of the function being inferred, nil at the
+	// top level
+	returns Type
+}
+
+// Infer infers the types of a program without relying on annotations, in
+// the style of Hindley-Milner: every let is generalized, so a function like
+// fn(f, x) { f(x) } gets the generic type fn(fn(a) -> b, a) -> b and can be
+// used at different types. Identifiers are bound with compiler.Resolve, so
+// closures see the variables the compiler captures for them. Annotations,
+// where there are any, are taken into account with any as a fresh variable.
+//
+// Unlike Check, values are not allowed to mix types: [1, "a"] is an error.
+func Infer(program *ast.Program) *Inference {
+	c := &inferer{
+		resolved: compiler.Resolve(program),
+		env:      map[*ast.Identifier]Type{},
+	}
+	c.statements(program.Statements)
+
+	inference := &Inference{Bindings: []Binding{}, Errors: c.errors}
+	for _, s := range program.Statements {
+		if let, ok := s.(*ast.LetStatement); ok && let.Name != nil {
+			inference.Bindings = append(inference.Bindings, Binding{Name: let.Name, Type: c.env[let.Name]})
+		}
+	}
+	return inference
+}
+
+func (c *inferer) errorf(tok token.Token, format string, a ...interface{}) {
+	c.errors = append(c.errors, Error{Message: fmt.Sprintf(format, a...), Token: tok})
+}
+
+// expect unifies the type of a value with the type it is used as.
+func (c *inferer) expect(got, want Type, tok token.Token) {
+	p := newPrinter()
+	g := p.print(got)
+	var w string
+	if v, ok := prune(want).(*variable); ok && v.kinds != 0 {
+		// a builtin like len that takes one of a few kinds of value
+		w = v.kinds.String()
+	} else {
+		w = p.print(want)
+	}
+	if !c.unify(got, want) {
+		c.errorf(tok, "cannot use %s as %s%s", g, w, p.where())
+	}
+}
+
+// annotation converts a written type, any becomes a fresh variable.
+func (c *inferer) annotation(a *ast.TypeAnnotation) Type {
+	t, err := FromAnnotation(a)
+	if err != nil {
+		c.errorf(a.Token, "%s", err)
+		return c.fresh(0)
+	}
+	var fill func(t Type) Type
+	fill = func(t Type) Type {
+		switch t := t.(type) {
+		case *Array:
+			return &Array{Element: fill(t.Element)}
+		case *Hash:
+			return &Hash{Key: fill(t.Key), Value: fill(t.Value)}
+		case *Function:
+			fn := &Function{Parameters: []Type{}, Return: fill(t.Return)}
+			for _, p := range t.Parameters {
+				fn.Parameters = append(fn.Parameters, fill(p))
+			}
+			return fn
+		}
+		if t == Any {
+			return c.fresh(0)
+		}
+		return t
+	}
+	return fill(t)
+}
+
+// statements returns the type of the last statement, a return makes a
+// fresh variable since the block never produces a value.
+func (c *inferer) statements(statements []ast.Statement) Type {
+	var result Type = Null
+	for _, s := range statements {
+		result = Null
+		switch s := s.(type) {
+		case *ast.LetStatement:
+			c.let(s)
+		case *ast.ReturnStatement:
+			t := c.infer(s.ReturnValue)
+			if c.returns != nil {
+				c.expect(t, c.returns, ast.Start(s.ReturnValue))
+			}
+			result = c.fresh(0)
+		case *ast.ExpressionStatement:
+			result = c.infer(s.Expression)
+		}
+	}
+	return result
+}
+
+func (c *inferer) block(b *ast.BlockStatement) Type {
+	if b == nil {
+		return Null
+	}
+	return c.statements(b.Statements)
+}
+
+// end is where a mismatch with the value of b is reported.
+func end(b *ast.BlockStatement) token.Token {
+	if len(b.Statements) == 0 {
+		return b.Token
+	}
+	return ast.Start(b.Statements[len(b.Statements)-1])
+}
+
+func (c *inferer) let(s *ast.LetStatement) {
+	if s.Name == nil {
+		return
+	}
+	// the name is defined before the value, a function calls itself
+	// monomorphically
+	c.level++
+	v := c.fresh(0)
+	c.env[s.Name] = v
+	t := c.infer(s.Value)
+	if s.Type != nil {
+		annotation := c.annotation(s.Type)
+		c.expect(t, annotation, ast.Start(s.Value))
+		t = annotation
+	}
+	c.expect(t, v, ast.Start(s.Value))
+	c.level--
+	c.generalize(v)
+}
+
+func (c *inferer) infer(e ast.Expression) Type {
+	switch e := e.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.StringLiteral:
+		return String
+	case *ast.Boolean:
+		return Bool
+
+	case *ast.Identifier:
+		if symbol, ok := c.resolved.Symbol(e); ok && symbol.Scope == compiler.BuiltinScope {
+			// a builtin passed around as a value takes as few arguments as
+			// it can, calls are checked with the arguments they have
+			if signature, ok := builtinSignatures[e.Value]; ok {
+				for n := 1; n <= 3; n++ {
+					if fn := signature(c, n); fn != nil {
+						return fn
+					}
+				}
+			}
+			return c.fresh(0)
+		}
+		decl, ok := c.resolved.Definition(e)
+		if !ok {
+			c.errorf(e.Token, "undefined variable: %s", e.Value)
+			return c.fresh(0)
+		}
+		t, ok := c.env[decl]
+		if !ok {
+			return c.fresh(0)
+		}
+		return c.instantiate(t)
+
+	case *ast.PrefixExpression:
+		right := c.infer(e.Right)
+		if e.Operator == "!" {
+			return Bool
+		}
+		c.expect(right, Int, ast.Start(e.Right))
+		return Int
+
+	case *ast.InfixExpression:
+		return c.infix(e)
+
+	case *ast.ArrayLiteral:
+		element := c.fresh(0)
+		for _, el := range e.Elements {
+			c.expect(c.infer(el), element, ast.Start(el))
+		}
+		return &Array{Element: element}
+
+	case *ast.HashLiteral:
+		key, value := c.fresh(hashKeys), c.fresh(0)
+		for _, k := range e.OrderedKeys() {
+			c.expect(c.infer(k), key, ast.Start(k))
+			c.expect(c.infer(e.Pairs[k]), value, ast.Start(e.Pairs[k]))
+		}
+		return &Hash{Key: key, Value: value}
+
+	case *ast.IndexExpression:
+		return c.index(e)
+
+	case *ast.CallExpression:
+		return c.call(e)
+
+	case *ast.FunctionLiteral:
+		return c.function(e)
+
+	case *ast.IfExpression:
+		c.infer(e.Condition)
+		consequence := c.block(e.Consequence)
+		if e.Alternative == nil {
+			// the value is null when the condition is false, which is
+			// only a mistake when it is used
+			return Null
+		}
+		c.expect(c.block(e.Alternative), consequence, end(e.Alternative))
+		return consequence
+
+	case *ast.ForLoop:
+		c.let(&e.Declaration)
+		c.infer(e.Condition)
+		c.block(e.Body)
+		c.infer(e.Consequence)
+		return Null
+	}
+	return c.fresh(0)
+}
+
+func (c *inferer) infix(e *ast.InfixExpression) Type {
+	left := c.infer(e.Left)
+	right := c.infer(e.Right)
+
+	switch e.Operator {
+	case "+":
+		c.expect(right, left, ast.Start(e.Right))
+		c.expect(left, c.fresh(addable), e.Token)
+		return left
+	case "-", "*", "/":
+		c.expect(left, Int, ast.Start(e.Left))
+		c.expect(right, Int, ast.Start(e.Right))
+		return Int
+	case "<", ">":
+		c.expect(left, Int, ast.Start(e.Left))
+		c.expect(right, Int, ast.Start(e.Right))
+		return Bool
+	case "==", "!=":
+		c.expect(right, left, ast.Start(e.Right))
+		return Bool
+	}
+	return c.fresh(0)
+}
+
+// index infers left[index]. When the type of left is not known yet it is
+// taken to be an array, unless the index is a string or a bool.
+func (c *inferer) index(e *ast.IndexExpression) Type {
+	left := c.infer(e.Left)
+	index := c.infer(e.Index)
+
+	if hash, ok := prune(left).(*Hash); ok {
+		c.expect(index, hash.Key, ast.Start(e.Index))
+		return hash.Value
+	}
+	value := c.fresh(0)
+	switch prune(index) {
+	case String, Bool:
+		c.expect(left, &Hash{Key: index, Value: value}, ast.Start(e.Left))
+	default:
+		c.expect(index, Int, ast.Start(e.Index))
+		c.expect(left, &Array{Element: value}, ast.Start(e.Left))
+	}
+	return value
+}
+
+func (c *inferer) call(e *ast.CallExpression) Type {
+	args := []Type{}
+	for _, a := range e.Arguments {
+		args = append(args, c.infer(a))
+	}
+
+	var fn *Function
+	if ident, ok := e.Function.(*ast.Identifier); ok {
+		if symbol, ok := c.resolved.Symbol(ident); ok && symbol.Scope == compiler.BuiltinScope {
+			signature, ok := builtinSignatures[ident.Value]
+			if !ok {
+				return c.fresh(0)
+			}
+			if fn = signature(c, len(args)); fn == nil {
+				c.errorf(ident.Token, "wrong number of arguments to `%s`, got=%d", ident.Value, len(args))
+				return c.fresh(0)
+			}
+		}
+	}
+	if fn == nil {
+		callee := c.infer(e.Function)
+		known, ok := prune(callee).(*Function)
+		if !ok {
+			ret := c.fresh(0)
+			c.expect(callee, &Function{Parameters: args, Return: ret}, ast.Start(e.Function))
+			return ret
+		}
+		fn = known
+	}
+
+	if len(args) != len(fn.Parameters) {
+		c.errorf(e.Token, "wrong number of arguments: want=%d, got=%d", len(fn.Parameters), len(args))
+		return fn.Return
+	}
+	for i, arg := range args {
+		c.expect(arg, fn.Parameters[i], ast.Start(e.Arguments[i]))
+	}
+	return fn.Return
+}
+
+func (c *inferer) function(fn *ast.FunctionLiteral) Type {
+	signature := &Function{Parameters: []Type{}, Return: c.fresh(0)}
+	for i, param := range fn.Parameters {
+		var t Type = c.fresh(0)
+		if i < len(fn.ParameterTypes) && fn.ParameterTypes[i] != nil {
+			t = c.annotation(fn.ParameterTypes[i])
+		}
+		c.env[param] = t
+		signature.Parameters = append(signature.Parameters, t)
+	}
+	if fn.ReturnType != nil {
+		signature.Return = c.annotation(fn.ReturnType)
+	}
+
+	outer := c.returns
+	c.returns = signature.Return
+	defer func() { c.returns = outer }()
+
+	if fn.Body != nil {
+		c.expect(c.block(fn.Body), signature.Return, end(fn.Body))
+	} else {
+		c.expect(Null, signature.Return, fn.Token)
+	}
+	return signature
+}
+
+// builtinSignatures give the type of a builtin called with n arguments, or
+// nil when it can't be called with that many.
+var builtinSignatures = map[string]func(c *inferer, n int) *Function{
+	"puts": func(c *inferer, n int) *Function {
+		params := []Type{}
+		for i := 0; i < n; i++ {
+			params = append(params, c.fresh(0))
+		}
+		return &Function{Parameters: params, Return: Null}
+	},
+	"typeOf": func(c *inferer, n int) *Function {
+		return takes(n, String, c.fresh(0))
+	},
+	"len": func(c *inferer, n int) *Function {
+		return takes(n, Int, c.fresh(sized))
+	},
+	"first": func(c *inferer, n int) *Function {
+		a := c.fresh(0)
+		return takes(n, a, &Array{Element: a})
+	},
+	"last": func(c *inferer, n int) *Function {
+		a := c.fresh(0)
+		return takes(n, a, &Array{Element: a})
+	},
+	"rest": func(c *inferer, n int) *Function {
+		a := &Array{Element: c.fresh(0)}
+		return takes(n, a, a)
+	},
+	"push": func(c *inferer, n int) *Function {
+		a := c.fresh(0)
+		return takes(n, &Array{Element: a}, &Array{Element: a}, a)
+	},
+	"pop": func(c *inferer, n int) *Function {
+		a := &Array{Element: c.fresh(0)}
+		return takes(n, a, a)
+	},
+	"reverse": func(c *inferer, n int) *Function {
+		a := c.fresh(sized)
+		return takes(n, a, a)
+	},
+	"join": func(c *inferer, n int) *Function {
+		if n == 3 {
+			return takes(n, String, String, String, String)
+		}
+		return takes(n, String, &Array{Element: c.fresh(0)}, String)
+	},
+	"split": func(c *inferer, n int) *Function {
+		return takes(n, &Array{Element: String}, String, String)
+	},
+	"replace": func(c *inferer, n int) *Function {
+		return takes(n, String, String, String, String)
+	},
+	"toLower": func(c *inferer, n int) *Function {
+		return takes(n, String, String)
+	},
+	"toUpper": func(c *inferer, n int) *Function {
+		return takes(n, String, String)
+	},
+	"trim": func(c *inferer, n int) *Function {
+		return takes(n, String, String, String)
+	},
+	"trimLeft": func(c *inferer, n int) *Function {
+		return takes(n, String, String, String)
+	},
+	"trimRight": func(c *inferer, n int) *Function {
+		return takes(n, String, String, String)
+	},
+	"contains": func(c *inferer, n int) *Function {
+		return takes(n, Bool, c.fresh(sized), c.fresh(0))
+	},
+	"merge": func(c *inferer, n int) *Function {
+		a := &Array{Element: c.fresh(0)}
+		return takes(n, a, a, a)
+	},
+	"findIndex": func(c *inferer, n int) *Function {
+		a := c.fresh(0)
+		return takes(n, Int, &Array{Element: a}, a)
+	},
+	"assert": func(c *inferer, n int) *Function {
+		if n == 2 {
+			return takes(n, Null, c.fresh(0), String)
+		}
+		return takes(n, Null, c.fresh(0))
+	},
+	"assertEqual": func(c *inferer, n int) *Function {
+		a := c.fresh(0)
+		if n == 3 {
+			return takes(n, Null, a, a, String)
+		}
+		return takes(n, Null, a, a)
+	},
+	"assertError": func(c *inferer, n int) *Function {
+		fn := &Function{Return: c.fresh(0)}
+		if n == 2 {
+			return takes(n, String, fn, String)
+		}
+		return takes(n, String, fn)
+	},
+}
+
+func takes(n int, ret Type, params ...Type) *Function {
+	if n != len(params) {
+		return nil
+	}
+	return &Function{Parameters: params, Return: ret}
+}
@@ -0,0 +1,111 @@
+package types
+
+import (
+	"fmt"
+	"mokey-type/lexer"
+	"mokey-type/parser"
+	"testing"
+)
+
+func infer(t *testing.T, input string) *Inference {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return Infer(program)
+}
+
+func TestInferSignatures(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{`let id = fn(x) { x }; let a = id(1); let b = id("s")`, []string{
+			"id: fn(a) -> a",
+			"a: int",
+			"b: string",
+		}},
+		{"let apply = fn(f, x) { f(x) }", []string{"apply: fn(fn(a) -> b, a) -> b"}},
+		{"let compose = fn(f, g) { fn(x) { f(g(x)) } }", []string{
+			"compose: fn(fn(a) -> b, fn(c) -> a) -> fn(c) -> b",
+		}},
+		{"let add = fn(a, b) { a + b }", []string{"add: fn(a, a) -> a where a: int | string"}},
+		{"let fib = fn(n) { if (n < 2) { return n }; fib(n - 1) + fib(n - 2) }", []string{"fib: fn(int) -> int"}},
+		{`
+let map = fn(arr, f) {
+	let iter = fn(arr, acc) {
+		if (len(arr) == 0) { acc } else { iter(rest(arr), push(acc, f(first(arr)))) }
+	};
+	iter(arr, [])
+};
+let lengths = map(["a", "bc"], len);`, []string{
+			"map: fn([a], fn(a) -> b) -> [b]",
+			"lengths: [int]",
+		}},
+		// x is captured by the inner closure, it stays monomorphic inside
+		// makeAdder and is generalized with it
+		{"let makeAdder = fn(x) { fn(y) { x + y } }; let addTwo = makeAdder(2)", []string{
+			"makeAdder: fn(a) -> fn(a) -> a where a: int | string",
+			"addTwo: fn(int) -> int",
+		}},
+		{`let h = {"a": [1]}; let e = []; let v = h["a"][0]`, []string{
+			"h: {string: [int]}",
+			"e: [a]",
+			"v: int",
+		}},
+		{"let f = fn(a: any, b) -> [string] { split(a, b) }", []string{"f: fn(string, string) -> [string]"}},
+	}
+
+	for _, tt := range tests {
+		inference := infer(t, tt.input)
+		if len(inference.Errors) != 0 {
+			t.Errorf("errors for %q: %v", tt.input, inference.Errors)
+		}
+		got := []string{}
+		for _, b := range inference.Bindings {
+			got = append(got, b.Name.Value+": "+Signature(b.Type))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+			t.Errorf("wrong signatures for %q.\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestInferErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		// parameters are not generalized
+		{`fn(f) { f(1); f("a") }`, []string{"1:17: cannot use string as int"}},
+		{`len(5); [1, "a"]; true + false`, []string{
+			"1:5: cannot use int as string | array",
+			"1:13: cannot use string as int",
+			"1:24: cannot use bool as int | string",
+		}},
+		{`let h = {"a": 1}; h[1]; x; fn(a, b) { a }(1); push([1])`, []string{
+			"1:21: cannot use int as string",
+			"1:25: undefined variable: x",
+			"1:42: wrong number of arguments: want=2, got=1",
+			"1:47: wrong number of arguments to `push`, got=1",
+		}},
+		{"let f = fn(x) { x(x) }", []string{"1:17: cannot use a as fn(a) -> b"}},
+		{"let f = fn(n) { if (n > 0) { return n }; \"none\" }", []string{"1:42: cannot use string as int"}},
+		{"let f = fn(a: int) -> string { a }; let g: [string] = [1]", []string{
+			"1:32: cannot use int as string",
+			"1:55: cannot use [int] as [string]",
+		}},
+	}
+
+	for _, tt := range tests {
+		got := []string{}
+		for _, err := range infer(t, tt.input).Errors {
+			got = append(got, fmt.Sprintf("%d:%d: %s", err.Token.Line, err.Token.Column, err))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+			t.Errorf("wrong errors for %q.\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
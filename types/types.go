@@ -0,0 +1,171 @@
+// Package types checks programs against their optional type annotations.
+// What is not annotated is inferred where the checker can and is any where
+// it can't, and any is accepted wherever a type is expected, so code without
+// annotations checks like it runs.
+package types
+
+import (
+	"fmt"
+	"mokey-type/ast"
+	"mokey-type/token"
+	"strings"
+)
+
+type Type interface {
+	String() string
+}
+
+type Basic string
+
+func (b Basic) String() string { return string(b) }
+
+const (
+	Int    Basic = "int"
+	String Basic = "string"
+	Bool   Basic = "bool"
+	Null   Basic = "null"
+	Any    Basic = "any"
+	// never is the type of a block that always returns, it joins with
+	// anything
+	never Basic = "never"
+)
+
+type Array struct {
+	Element Type
+}
+
+func (a *Array) String() string { return "[" + a.Element.String() + "]" }
+
+type Hash struct {
+	Key   Type
+	Value Type
+}
+
+func (h *Hash) String() string { return "{" + h.Key.String() + ": " + h.Value.String() + "}" }
+
+type Function struct {
+	Parameters []Type
+	Return     Type
+}
+
+func (f *Function) String() string {
+	params := []string{}
+	for _, p := range f.Parameters {
+		params = append(params, p.String())
+	}
+	return "fn(" + strings.Join(params, ", ") + ") -> " + f.Return.String()
+}
+
+// Builtin is one of object.Builtins, they check their own arguments since
+// most of them take more than one kind of value.
+type Builtin struct {
+	Name  string
+	check func(args []Type) (Type, error)
+}
+
+func (b *Builtin) String() string { return "builtin " + b.Name }
+
+// Equal reports whether a and b are the same type.
+func Equal(a, b Type) bool {
+	return a.String() == b.String()
+}
+
+// Consistent reports whether a value of type a can be used where b is
+// expected. any is consistent with every type, in both directions.
+func Consistent(a, b Type) bool {
+	if a == Any || b == Any || a == never || b == never {
+		return true
+	}
+	switch a := a.(type) {
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && Consistent(a.Element, b.Element)
+	case *Hash:
+		b, ok := b.(*Hash)
+		return ok && Consistent(a.Key, b.Key) && Consistent(a.Value, b.Value)
+	case *Function:
+		b, ok := b.(*Function)
+		if !ok || len(a.Parameters) != len(b.Parameters) {
+			return false
+		}
+		for i := range a.Parameters {
+			if !Consistent(a.Parameters[i], b.Parameters[i]) {
+				return false
+			}
+		}
+		return Consistent(a.Return, b.Return)
+	}
+	return Equal(a, b)
+}
+
+// join is the type of a value that is either a or b.
+func join(a, b Type) Type {
+	switch {
+	case a == never:
+		return b
+	case b == never:
+		return a
+	case Equal(a, b):
+		return a
+	}
+	return Any
+}
+
+// FromAnnotation turns a written type into a Type.
+func FromAnnotation(annotation *ast.TypeAnnotation) (Type, error) {
+	switch annotation.Token.Type {
+	case token.LBRACKET:
+		element, err := FromAnnotation(annotation.Element)
+		if err != nil {
+			return nil, err
+		}
+		return &Array{Element: element}, nil
+
+	case token.LBRACE:
+		key, err := FromAnnotation(annotation.Key)
+		if err != nil {
+			return nil, err
+		}
+		if !hashable(key) {
+			return nil, fmt.Errorf("unusable as hash key: %s", key)
+		}
+		value, err := FromAnnotation(annotation.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &Hash{Key: key, Value: value}, nil
+
+	case token.FUNCTION:
+		fn := &Function{Parameters: []Type{}, Return: Any}
+		for _, p := range annotation.Parameters {
+			param, err := FromAnnotation(p)
+			if err != nil {
+				return nil, err
+			}
+			fn.Parameters = append(fn.Parameters, param)
+		}
+		if annotation.Return != nil {
+			ret, err := FromAnnotation(annotation.Return)
+			if err != nil {
+				return nil, err
+			}
+			fn.Return = ret
+		}
+		return fn, nil
+	}
+
+	switch t := Basic(annotation.Name); t {
+	case Int, String, Bool, Null, Any:
+		return t, nil
+	}
+	return nil, fmt.Errorf("unknown type %s", annotation.Name)
+}
+
+// hashable are the types the vm accepts as hash keys.
+func hashable(t Type) bool {
+	switch t {
+	case Int, String, Bool, Any, never:
+		return true
+	}
+	return false
+}
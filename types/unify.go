@@ -0,0 +1,314 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// kinds restricts what a type variable can stand for, for the operators and
+// builtins that take more than one kind of value. The zero value allows
+// anything.
+type kinds uint8
+
+const (
+	intKind kinds = 1 << iota
+	stringKind
+	boolKind
+	arrayKind
+)
+
+var (
+	addable  = intKind | stringKind
+	sized    = stringKind | arrayKind
+	hashKeys = intKind | stringKind | boolKind
+)
+
+func (k kinds) String() string {
+	names := []string{}
+	for _, kind := range []struct {
+		kinds
+		name string
+	}{{intKind, "int"}, {stringKind, "string"}, {boolKind, "bool"}, {arrayKind, "array"}} {
+		if k&kind.kinds != 0 {
+			names = append(names, kind.name)
+		}
+	}
+	return strings.Join(names, " | ")
+}
+
+func (k kinds) and(other kinds) kinds {
+	switch {
+	case k == 0:
+		return other
+	case other == 0:
+		return k
+	}
+	return k & other
+}
+
+// kindOf returns the kind of a type that is not a variable, zero when it is
+// none of them.
+func kindOf(t Type) kinds {
+	switch t {
+	case Int:
+		return intKind
+	case String:
+		return stringKind
+	case Bool:
+		return boolKind
+	}
+	if _, ok := t.(*Array); ok {
+		return arrayKind
+	}
+	return 0
+}
+
+// generic is the level of variables that were generalized, every use of
+// the binding they belong to gets its own copy of them.
+const generic = math.MaxInt32
+
+// variable is a type that is not known yet. Its level is how many lets deep
+// it was made, a let only generalizes the variables made inside it, which
+// keeps parameters and captured variables of enclosing functions
+// monomorphic.
+type variable struct {
+	id       int
+	level    int
+	kinds    kinds
+	instance Type
+}
+
+func (v *variable) String() string { return Signature(v) }
+
+// prune follows bound variables to the type they stand for.
+func prune(t Type) Type {
+	for {
+		v, ok := t.(*variable)
+		if !ok || v.instance == nil {
+			return t
+		}
+		t = v.instance
+	}
+}
+
+func (c *inferer) fresh(k kinds) *variable {
+	c.next++
+	return &variable{id: c.next, level: c.level, kinds: k}
+}
+
+// unify makes a and b the same type, it reports whether they could be.
+func (c *inferer) unify(a, b Type) bool {
+	a, b = prune(a), prune(b)
+	if v, ok := a.(*variable); ok {
+		return c.bind(v, b)
+	}
+	if v, ok := b.(*variable); ok {
+		return c.bind(v, a)
+	}
+
+	switch a := a.(type) {
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && c.unify(a.Element, b.Element)
+	case *Hash:
+		b, ok := b.(*Hash)
+		return ok && c.unify(a.Key, b.Key) && c.unify(a.Value, b.Value)
+	case *Function:
+		b, ok := b.(*Function)
+		if !ok || len(a.Parameters) != len(b.Parameters) {
+			return false
+		}
+		for i := range a.Parameters {
+			if !c.unify(a.Parameters[i], b.Parameters[i]) {
+				return false
+			}
+		}
+		return c.unify(a.Return, b.Return)
+	}
+	return Equal(a, b)
+}
+
+func (c *inferer) bind(v *variable, t Type) bool {
+	if other, ok := t.(*variable); ok {
+		if other == v {
+			return true
+		}
+		k := v.kinds.and(other.kinds)
+		if k == 0 && v.kinds|other.kinds != 0 {
+			return false
+		}
+		other.kinds = k
+		if v.level < other.level {
+			other.level = v.level
+		}
+		v.instance = other
+		c.settle(other)
+		return true
+	}
+
+	if c.occurs(v, t) {
+		return false
+	}
+	if v.kinds != 0 && v.kinds&kindOf(t) == 0 {
+		return false
+	}
+	v.instance = t
+	return true
+}
+
+// settle binds a variable that can only be one kind of type to that type.
+func (c *inferer) settle(v *variable) {
+	switch v.kinds {
+	case intKind:
+		v.instance = Int
+	case stringKind:
+		v.instance = String
+	case boolKind:
+		v.instance = Bool
+	case arrayKind:
+		element := c.fresh(0)
+		element.level = v.level
+		v.instance = &Array{Element: element}
+	}
+}
+
+// occurs reports whether v is part of t, binding v would make an infinite
+// type. It also lowers the level of the variables in t to the level of v,
+// they are now as old as v is.
+func (c *inferer) occurs(v *variable, t Type) bool {
+	switch t := prune(t).(type) {
+	case *variable:
+		if t == v {
+			return true
+		}
+		if t.level > v.level {
+			t.level = v.level
+		}
+	case *Array:
+		return c.occurs(v, t.Element)
+	case *Hash:
+		return c.occurs(v, t.Key) || c.occurs(v, t.Value)
+	case *Function:
+		for _, p := range t.Parameters {
+			if c.occurs(v, p) {
+				return true
+			}
+		}
+		return c.occurs(v, t.Return)
+	}
+	return false
+}
+
+// generalize marks the variables of t made at a deeper level than the
+// current one as generic.
+func (c *inferer) generalize(t Type) {
+	switch t := prune(t).(type) {
+	case *variable:
+		if t.level > c.level {
+			t.level = generic
+		}
+	case *Array:
+		c.generalize(t.Element)
+	case *Hash:
+		c.generalize(t.Key)
+		c.generalize(t.Value)
+	case *Function:
+		for _, p := range t.Parameters {
+			c.generalize(p)
+		}
+		c.generalize(t.Return)
+	}
+}
+
+// instantiate copies t with fresh variables for its generic ones.
+func (c *inferer) instantiate(t Type) Type {
+	copies := map[*variable]*variable{}
+	var copy func(t Type) Type
+	copy = func(t Type) Type {
+		switch t := prune(t).(type) {
+		case *variable:
+			if t.level != generic {
+				return t
+			}
+			if _, ok := copies[t]; !ok {
+				copies[t] = c.fresh(t.kinds)
+			}
+			return copies[t]
+		case *Array:
+			return &Array{Element: copy(t.Element)}
+		case *Hash:
+			return &Hash{Key: copy(t.Key), Value: copy(t.Value)}
+		case *Function:
+			fn := &Function{Parameters: []Type{}, Return: copy(t.Return)}
+			for _, p := range t.Parameters {
+				fn.Parameters = append(fn.Parameters, copy(p))
+			}
+			return fn
+		default:
+			return t
+		}
+	}
+	return copy(t)
+}
+
+// printer names the variables of the types it prints a, b, c and so on,
+// in the order it meets them.
+type printer struct {
+	names map[*variable]string
+	order []*variable
+}
+
+func newPrinter() *printer {
+	return &printer{names: map[*variable]string{}}
+}
+
+func (p *printer) print(t Type) string {
+	switch t := prune(t).(type) {
+	case *variable:
+		if _, ok := p.names[t]; !ok {
+			name := fmt.Sprintf("t%d", len(p.order))
+			if len(p.order) < 26 {
+				name = string(rune('a' + len(p.order)))
+			}
+			p.names[t] = name
+			p.order = append(p.order, t)
+		}
+		return p.names[t]
+	case *Array:
+		return "[" + p.print(t.Element) + "]"
+	case *Hash:
+		return "{" + p.print(t.Key) + ": " + p.print(t.Value) + "}"
+	case *Function:
+		params := []string{}
+		for _, param := range t.Parameters {
+			params = append(params, p.print(param))
+		}
+		return "fn(" + strings.Join(params, ", ") + ") -> " + p.print(t.Return)
+	default:
+		return t.String()
+	}
+}
+
+// where lists what the restricted variables printed so far can stand for.
+func (p *printer) where() string {
+	restrictions := []string{}
+	for _, v := range p.order {
+		if v.kinds != 0 {
+			restrictions = append(restrictions, p.names[v]+": "+v.kinds.String())
+		}
+	}
+	if len(restrictions) == 0 {
+		return ""
+	}
+	return " where " + strings.Join(restrictions, ", ")
+}
+
+// Signature prints an inferred type with its variables named a, b, c and
+// so on, followed by what the restricted ones can stand for, like
+// "fn(a, a) -> a where a: int | string".
+func Signature(t Type) string {
+	p := newPrinter()
+	s := p.print(t)
+	return s + p.where()
+}
@@ -0,0 +1,88 @@
+package vm
+
+import (
+	"fmt"
+	"mokey-type/code"
+	"mokey-type/object"
+)
+
+// SetHook makes the vm call hook before every instruction, Position,
+// Statement and Backtrace tell where the vm is. An error from the hook
+// stops Run with it.
+func (vm *VM) SetHook(hook func(vm *VM) error) {
+	vm.hook = hook
+}
+
+// Depth is the number of frames, the main program's is 1.
+func (vm *VM) Depth() int {
+	return vm.framesIndex
+}
+
+// Statement reports whether the vm is at the first instruction of a
+// statement.
+func (vm *VM) Statement() bool {
+	frame := vm.currentFrame()
+	pos, ok := frame.cl.Fn.SourceMap.Lookup(frame.ip - 1)
+	return ok && pos.Statement && pos.Offset == frame.ip-1
+}
+
+// Globals returns the globals store of the vm.
+func (vm *VM) Globals() []object.Object {
+	return vm.globals
+}
+
+// StackFrame is a frame as debuggers see it.
+type StackFrame struct {
+	// Name is the name the function was bound to, main for the program
+	// itself or where an anonymous function starts
+	Name    string
+	Closure *object.Closure
+	// Position is where the frame is, the call for the callers, it is the
+	// zero Position when the source map doesn't know
+	Position code.Position
+	// Locals are the values of the locals by index, nil for the ones that
+	// were not set yet
+	Locals []object.Object
+}
+
+// Backtrace returns the frames, innermost first.
+func (vm *VM) Backtrace() []StackFrame {
+	program := vm.frames[0].cl.Fn
+	frames := []StackFrame{}
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		fn := frame.cl.Fn
+		pos, _ := fn.SourceMap.Lookup(frame.ip - 1)
+		locals := make([]object.Object, fn.NumLocals)
+		copy(locals, vm.stack[frame.basePointer:frame.basePointer+fn.NumLocals])
+		frames = append(frames, StackFrame{
+			Name:     functionName(fn, program),
+			Closure:  frame.cl,
+			Position: pos,
+			Locals:   locals,
+		})
+	}
+	return frames
+}
+
+// functionName is how fn shows up in profiles and backtraces.
+func functionName(fn, program *object.CompiledFunction) string {
+	switch {
+	case fn == program:
+		return "main"
+	case fn.Name != "":
+		return fn.Name
+	default:
+		return fmt.Sprintf("fn@%d", startLine(fn))
+	}
+}
+
+// startLine is the line of the first instruction of fn that has one.
+func startLine(fn *object.CompiledFunction) int {
+	for _, pos := range fn.SourceMap {
+		if pos.Line > 0 {
+			return pos.Line
+		}
+	}
+	return 0
+}
@@ -0,0 +1,221 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"mokey-type/code"
+	"mokey-type/object"
+	"mokey-type/pprof"
+	"sort"
+	"strings"
+	"time"
+)
+
+// checkEvery is how many instructions run between two looks at the clock,
+// reading it on every instruction would be most of the profile.
+const checkEvery = 64
+
+// Stats is how often an opcode ran or a function was called, and how much
+// of the sampled time was spent in it, not counting the functions it called.
+type Stats struct {
+	Count int
+	Time  time.Duration
+}
+
+// location is a function of a stack and the line it is at.
+type location struct {
+	Fn   *object.CompiledFunction
+	Line int
+}
+
+// sample is a stack, innermost frame first, and the time and number of
+// samples taken while the vm was in it running op.
+type sample struct {
+	stack []location
+	op    code.Opcode
+	count int
+	time  time.Duration
+}
+
+// Profiler records where a vm spends its time, give it to the vm with
+// SetProfiler before Run. Every instruction and every call of a compiled
+// function is counted, the time is sampled: at least every interval the
+// stack of frames is recorded with the time since the previous sample.
+type Profiler struct {
+	Opcodes   [256]Stats
+	Functions map[*object.CompiledFunction]*Stats
+
+	program   *object.CompiledFunction
+	interval  time.Duration
+	countdown int
+	start     time.Time
+	last      time.Time
+	samples   map[string]*sample
+	order     []string
+}
+
+func NewProfiler(interval time.Duration) *Profiler {
+	return &Profiler{
+		Functions: map[*object.CompiledFunction]*Stats{},
+		interval:  interval,
+		samples:   map[string]*sample{},
+	}
+}
+
+// SetProfiler makes the vm report to p, the main program counts as one
+// call.
+func (vm *VM) SetProfiler(p *Profiler) {
+	vm.profiler = p
+	p.program = vm.frames[0].cl.Fn
+	p.start = time.Now()
+	p.last = p.start
+	p.countdown = checkEvery
+	p.call(p.program)
+}
+
+func (p *Profiler) function(fn *object.CompiledFunction) *Stats {
+	stats, ok := p.Functions[fn]
+	if !ok {
+		stats = &Stats{}
+		p.Functions[fn] = stats
+	}
+	return stats
+}
+
+func (p *Profiler) call(fn *object.CompiledFunction) {
+	p.function(fn).Count++
+}
+
+// instruction is called before the vm runs op, the ip of the current frame
+// already points past it.
+func (p *Profiler) instruction(vm *VM, op code.Opcode) {
+	p.Opcodes[op].Count++
+	p.countdown--
+	if p.countdown > 0 {
+		return
+	}
+	p.countdown = checkEvery
+	now := time.Now()
+	elapsed := now.Sub(p.last)
+	if elapsed < p.interval {
+		return
+	}
+	p.last = now
+	p.sample(vm, op, elapsed)
+}
+
+func (p *Profiler) sample(vm *VM, op code.Opcode, elapsed time.Duration) {
+	stack := make([]location, 0, vm.framesIndex)
+	var key strings.Builder
+	for i := vm.framesIndex - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		// a caller's ip is past its call, the call is just before it
+		pos, _ := frame.cl.Fn.SourceMap.Lookup(frame.ip - 1)
+		stack = append(stack, location{Fn: frame.cl.Fn, Line: pos.Line})
+		fmt.Fprintf(&key, "%p:%d;", frame.cl.Fn, pos.Line)
+	}
+	fmt.Fprintf(&key, "%d", op)
+
+	s, ok := p.samples[key.String()]
+	if !ok {
+		s = &sample{stack: stack, op: op}
+		p.samples[key.String()] = s
+		p.order = append(p.order, key.String())
+	}
+	s.count++
+	s.time += elapsed
+	p.Opcodes[op].Time += elapsed
+	p.function(stack[0].Fn).Time += elapsed
+}
+
+func (p *Profiler) name(fn *object.CompiledFunction) string {
+	return functionName(fn, p.program)
+}
+
+// Profile converts what p recorded to a pprof profile of the file at path.
+// It has the calls of every function, each with the function alone as its
+// stack, and the samples with their full stack and the opcode that ran as
+// a label.
+func (p *Profiler) Profile(path string) *pprof.Profile {
+	function := func(fn *object.CompiledFunction) pprof.Function {
+		return pprof.Function{Name: p.name(fn), File: path, StartLine: startLine(fn)}
+	}
+	profile := &pprof.Profile{
+		SampleTypes: []pprof.ValueType{{Type: "calls", Unit: "count"}, {Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		PeriodType:  pprof.ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:      int64(p.interval),
+		Time:        p.start,
+		Duration:    p.last.Sub(p.start),
+	}
+
+	for _, fn := range p.functions() {
+		f := function(fn)
+		profile.Samples = append(profile.Samples, pprof.Sample{
+			Stack:  []pprof.Frame{{Function: f, Line: f.StartLine}},
+			Values: []int64{int64(p.Functions[fn].Count), 0, 0},
+		})
+	}
+	for _, key := range p.order {
+		s := p.samples[key]
+		stack := []pprof.Frame{}
+		for _, l := range s.stack {
+			stack = append(stack, pprof.Frame{Function: function(l.Fn), Line: l.Line})
+		}
+		profile.Samples = append(profile.Samples, pprof.Sample{
+			Stack:  stack,
+			Values: []int64{0, int64(s.count), int64(s.time)},
+			Labels: map[string]string{"opcode": opcodeName(s.op)},
+		})
+	}
+	return profile
+}
+
+// functions returns the functions that were called, most called first.
+func (p *Profiler) functions() []*object.CompiledFunction {
+	fns := []*object.CompiledFunction{}
+	for fn := range p.Functions {
+		fns = append(fns, fn)
+	}
+	sort.SliceStable(fns, func(i, j int) bool {
+		a, b := p.Functions[fns[i]], p.Functions[fns[j]]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Time != b.Time {
+			return a.Time > b.Time
+		}
+		return p.name(fns[i]) < p.name(fns[j])
+	})
+	return fns
+}
+
+func opcodeName(op code.Opcode) string {
+	def, err := code.Lookup(byte(op))
+	if err != nil {
+		return fmt.Sprint(op)
+	}
+	return def.Name
+}
+
+// Report prints the functions by calls and the opcodes by how often they
+// ran, with the time sampled in each.
+func (p *Profiler) Report(w io.Writer) {
+	fmt.Fprintf(w, "%12s %12s  %s\n", "calls", "time", "function")
+	for _, fn := range p.functions() {
+		stats := p.Functions[fn]
+		fmt.Fprintf(w, "%12d %12s  %s\n", stats.Count, stats.Time.Round(time.Microsecond), p.name(fn))
+	}
+
+	ops := []code.Opcode{}
+	for op, stats := range p.Opcodes {
+		if stats.Count > 0 {
+			ops = append(ops, code.Opcode(op))
+		}
+	}
+	sort.SliceStable(ops, func(i, j int) bool { return p.Opcodes[ops[i]].Count > p.Opcodes[ops[j]].Count })
+	fmt.Fprintf(w, "\n%12s %12s  %s\n", "count", "time", "opcode")
+	for _, op := range ops {
+		stats := p.Opcodes[op]
+		fmt.Fprintf(w, "%12d %12s  %s\n", stats.Count, stats.Time.Round(time.Microsecond), opcodeName(op))
+	}
+}
@@ -0,0 +1,95 @@
+package vm
+
+import (
+	"bytes"
+	"mokey-type/code"
+	"mokey-type/compiler"
+	"mokey-type/conformance"
+	"strings"
+	"testing"
+)
+
+func TestProfiler(t *testing.T) {
+	input := `let double = fn(x) { x * 2 };
+let fib = fn(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+let apply = fn(f) { f(fib(10)) };
+apply(double);
+apply(fn(x) {
+  x
+});
+`
+	comp := compiler.New()
+	if err := comp.Compile(conformance.Parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	machine := New(comp.Bytecode())
+	// sample at every look at the clock
+	profiler := NewProfiler(0)
+	machine.SetProfiler(profiler)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	calls := map[string]int{}
+	total := 0
+	for fn, stats := range profiler.Functions {
+		calls[profiler.name(fn)] = stats.Count
+		total += stats.Count
+	}
+	expected := map[string]int{"main": 1, "double": 1, "fn@6": 1, "apply": 2, "fib": 354}
+	for name, count := range expected {
+		if calls[name] != count {
+			t.Errorf("wrong calls of %s. want=%d, got=%d", name, count, calls[name])
+		}
+	}
+	if len(calls) != len(expected) {
+		t.Errorf("wrong functions %v", calls)
+	}
+	// every call but the one of main is an OpCall
+	if got := profiler.Opcodes[code.OpCall].Count; got != total-1 {
+		t.Errorf("wrong count of OpCall. want=%d, got=%d", total-1, got)
+	}
+
+	if len(profiler.samples) == 0 {
+		t.Fatal("no samples")
+	}
+	sampled := 0
+	for _, s := range profiler.samples {
+		sampled += s.count
+		names := []string{}
+		for _, l := range s.stack {
+			names = append(names, profiler.name(l.Fn))
+		}
+		stack := strings.Join(names, " ")
+		if !strings.HasSuffix(stack, "main") {
+			t.Errorf("the outermost frame of %q is not main", stack)
+		}
+		if strings.Contains(stack, "fib") && !strings.HasSuffix(stack, "fib apply main") {
+			t.Errorf("fib is only called by itself and apply, got %q", stack)
+		}
+	}
+	instructions := 0
+	for _, stats := range profiler.Opcodes {
+		instructions += stats.Count
+	}
+	if sampled != instructions/checkEvery {
+		t.Errorf("wrong number of samples. want=%d, got=%d", instructions/checkEvery, sampled)
+	}
+
+	profile := profiler.Profile("fib.mk")
+	if len(profile.Samples) != len(expected)+len(profiler.samples) {
+		t.Errorf("wrong number of pprof samples %d", len(profile.Samples))
+	}
+	first := profile.Samples[0]
+	if first.Stack[0].Function.Name != "fib" || first.Stack[0].Function.File != "fib.mk" || first.Values[0] != 354 {
+		t.Errorf("the most called function should come first, got %+v", first)
+	}
+
+	var buf bytes.Buffer
+	profiler.Report(&buf)
+	for _, want := range []string{"         354 ", "  fib\n", "  OpCall\n"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("report is missing %q:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mokey-type/code"
+	"strings"
+)
+
+// traceEntry is an executed instruction, it is written once the
+// instruction ran so Stack is the stack after it.
+type traceEntry struct {
+	Step     int    `json:"step"`
+	Depth    int    `json:"depth"`
+	Function string `json:"function"`
+	Line     int    `json:"line,omitempty"`
+	IP       int    `json:"ip"`
+	Op       string `json:"op"`
+	Operands []int  `json:"operands"`
+	// Stack are the top values of the stack, the top last
+	Stack []string `json:"stack"`
+	Error string   `json:"error,omitempty"`
+
+	skip bool
+}
+
+// Tracer writes every instruction a vm executes with where it is and the
+// top of the stack after it, give it to the vm with SetTracer before Run.
+// An instruction is written when it ends, so what a builtin runs in the vm
+// comes before the call of the builtin, the steps keep the order they
+// started in.
+type Tracer struct {
+	// JSON writes an object per line instead of text
+	JSON bool
+	// Function only traces the instructions of the functions with this
+	// name, as Backtrace names them
+	Function string
+	// From and To only trace the steps from From to To, the first
+	// instruction is step 1 and To 0 means until the end
+	From, To int
+	// Stack is how many values of the top of the stack are shown
+	Stack int
+
+	w    io.Writer
+	step int
+	// pending are the instructions that started and did not end yet, the
+	// ones that call back into the vm are under the ones they run
+	pending []traceEntry
+}
+
+func NewTracer(w io.Writer) *Tracer {
+	return &Tracer{w: w, Stack: 3}
+}
+
+// SetTracer makes the vm write what it executes to t.
+func (vm *VM) SetTracer(t *Tracer) {
+	vm.tracer = t
+}
+
+// begin is called before the instruction at ip of the current frame runs.
+func (t *Tracer) begin(vm *VM, ip int, op code.Opcode) {
+	t.step++
+	frame := vm.currentFrame()
+	name := functionName(frame.cl.Fn, vm.frames[0].cl.Fn)
+	if t.step < t.From || (t.To > 0 && t.step > t.To) || (t.Function != "" && name != t.Function) {
+		t.pending = append(t.pending, traceEntry{skip: true})
+		return
+	}
+
+	entry := traceEntry{Step: t.step, Depth: vm.framesIndex, Function: name, IP: ip, Operands: []int{}}
+	if pos, ok := frame.cl.Fn.SourceMap.Lookup(ip); ok {
+		entry.Line = pos.Line
+	}
+	ins := frame.Instructions()
+	def, err := code.Lookup(byte(op))
+	if err != nil {
+		entry.Op = fmt.Sprintf("%d", op)
+	} else {
+		entry.Op = def.Name
+		entry.Operands, _ = code.ReadOperands(def, ins[ip+1:])
+	}
+	t.pending = append(t.pending, entry)
+}
+
+// end writes the instruction that began last.
+func (t *Tracer) end(vm *VM) {
+	entry := t.pending[len(t.pending)-1]
+	t.pending = t.pending[:len(t.pending)-1]
+	if !entry.skip {
+		t.write(vm, entry)
+	}
+}
+
+// fail writes the instruction that failed with err, the ones it was
+// called from did not end either and are dropped down to the first
+// pending ones.
+func (t *Tracer) fail(vm *VM, err error, pending int) {
+	if len(t.pending) > pending {
+		entry := t.pending[len(t.pending)-1]
+		if !entry.skip {
+			entry.Error = err.Error()
+			t.write(vm, entry)
+		}
+	}
+	t.pending = t.pending[:pending]
+}
+
+func (t *Tracer) write(vm *VM, entry traceEntry) {
+	entry.Stack = []string{}
+	for i := max(vm.sp-t.Stack, 0); i < vm.sp; i++ {
+		value := "<nil>"
+		if vm.stack[i] != nil {
+			value = vm.stack[i].Inspect()
+		}
+		entry.Stack = append(entry.Stack, value)
+	}
+
+	if t.JSON {
+		line, _ := json.Marshal(entry)
+		t.w.Write(append(line, '\n'))
+		return
+	}
+
+	instruction := entry.Op
+	for _, operand := range entry.Operands {
+		instruction += fmt.Sprintf(" %d", operand)
+	}
+	location := entry.Function
+	if entry.Line > 0 {
+		location += fmt.Sprintf(":%d", entry.Line)
+	}
+	stack := strings.Join(entry.Stack, ", ")
+	if vm.sp > len(entry.Stack) {
+		stack = strings.TrimSuffix("..., "+stack, ", ")
+	}
+	fmt.Fprintf(t.w, "%6d %3d %-12s %04d %-20s [%s]", entry.Step, entry.Depth, location, entry.IP, instruction, stack)
+	if entry.Error != "" {
+		fmt.Fprintf(t.w, " error: %s", entry.Error)
+	}
+	fmt.Fprintln(t.w)
+}
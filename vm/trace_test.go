@@ -0,0 +1,120 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mokey-type/compiler"
+	"mokey-type/conformance"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func trace(t *testing.T, input string, setup func(*Tracer)) (string, error) {
+	t.Helper()
+	comp := compiler.New()
+	if err := comp.Compile(conformance.Parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+	var out bytes.Buffer
+	tracer := NewTracer(&out)
+	setup(tracer)
+	machine := New(comp.Bytecode())
+	machine.SetTracer(tracer)
+	err := machine.Run()
+	return out.String(), err
+}
+
+func traceEntries(t *testing.T, out string) []traceEntry {
+	t.Helper()
+	entries := []traceEntry{}
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		var entry traceEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid line %q: %s", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+const traced = "let add = fn(a, b) { a + b };\nadd(1, 2) * 10;"
+
+func TestTrace(t *testing.T) {
+	got, err := trace(t, traced, func(tracer *Tracer) { tracer.From = 7 })
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	expected := `     7   2 add:1        0000 OpGetLocal 0         [..., 1, 2, 1]
+     8   2 add:1        0002 OpGetLocal 1         [..., 2, 1, 2]
+     9   2 add:1        0004 OpAdd                [..., 1, 2, 3]
+    10   2 add:1        0005 OpReturnValue        [3]
+    11   1 main:2       0018 OpConstant 3         [3, 10]
+    12   1 main:2       0021 OpMul                [30]
+    13   1 main:2       0022 OpPop                []
+`
+	if got != expected {
+		t.Errorf("wrong trace.\nwant=\n%s\n got=\n%s", expected, got)
+	}
+}
+
+func TestTraceFilters(t *testing.T) {
+	got, err := trace(t, traced, func(tracer *Tracer) {
+		tracer.JSON = true
+		tracer.Function = "add"
+		tracer.To = 8
+		tracer.Stack = 1
+	})
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	expected := []traceEntry{
+		{Step: 7, Depth: 2, Function: "add", Line: 1, IP: 0, Op: "OpGetLocal", Operands: []int{0}, Stack: []string{"1"}},
+		{Step: 8, Depth: 2, Function: "add", Line: 1, IP: 2, Op: "OpGetLocal", Operands: []int{1}, Stack: []string{"2"}},
+	}
+	if entries := traceEntries(t, got); !reflect.DeepEqual(entries, expected) {
+		t.Errorf("wrong trace.\nwant=%+v\n got=%+v", expected, entries)
+	}
+}
+
+func TestTraceErrors(t *testing.T) {
+	// the failure inside assertError is traced and the program goes on, the
+	// one of f ends it
+	input := `assertError(fn() { 1 + true }, "unsoported types for binary operation: INTEGER BOOLEAN");
+let f = fn(x) { x + true };
+f(1);`
+	got, err := trace(t, input, func(tracer *Tracer) { tracer.JSON = true })
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	lines := []string{}
+	for _, entry := range traceEntries(t, got) {
+		line := fmt.Sprintf("%d %s %s", entry.Step, entry.Function, entry.Op)
+		if entry.Error != "" {
+			line += " error"
+		}
+		lines = append(lines, line)
+	}
+	expected := []string{
+		"1 main OpGetBuiltin",
+		"2 main OpClosure",
+		"3 main OpConstant",
+		"5 fn@1 OpConstant",
+		"6 fn@1 OpTrue",
+		"7 fn@1 OpAdd error",
+		"4 main OpCall",
+		"8 main OpPop",
+		"9 main OpClosure",
+		"10 main OpSetGlobal",
+		"11 main OpGetGlobal",
+		"12 main OpConstant",
+		"13 main OpCall",
+		"14 f OpGetLocal",
+		"15 f OpTrue",
+		"16 f OpAdd error",
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("wrong trace.\nwant=%q\n got=%q", expected, lines)
+	}
+}
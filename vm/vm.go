@@ -2,6 +2,7 @@ package vm
 
 import (
 	"fmt"
+	"mokey-type/ast"
 	"mokey-type/code"
 	"mokey-type/compiler"
 	"mokey-type/object"
@@ -25,10 +26,20 @@ type VM struct {
 
 	frames      []*Frame
 	framesIndex int
+
+	// hits counts how often each coverage counter of the bytecode ran
+	hits []int
+	// modules are the exports of the modules that ran, by the constant
+	// index of their function
+	modules map[int]object.Object
+
+	profiler *Profiler
+	hook     func(vm *VM) error
+	tracer   *Tracer
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, SourceMap: bytecode.SourceMap}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 	frames := make([]*Frame, MaxFrames)
@@ -43,11 +54,13 @@ func New(bytecode *compiler.Bytecode) *VM {
 
 		frames:      frames,
 		framesIndex: 1,
+
+		hits: make([]int, len(bytecode.Counters)),
 	}
 }
 
 func NewWithGlobalsStore(bytecode *compiler.Bytecode, globals []object.Object) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, SourceMap: bytecode.SourceMap}
 	mainClosure := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClosure, 0)
 
@@ -63,7 +76,36 @@ func NewWithGlobalsStore(bytecode *compiler.Bytecode, globals []object.Object) *
 
 		frames:      frames,
 		framesIndex: 1,
+
+		hits: make([]int, len(bytecode.Counters)),
+	}
+}
+
+// Execute runs bytecode on a new vm with globals as its globals store and
+// returns the value of the last expression statement.
+func Execute(bytecode *compiler.Bytecode, globals []object.Object) (object.Object, error) {
+	machine := NewWithGlobalsStore(bytecode, globals)
+	err := machine.Run()
+	if err != nil {
+		return nil, err
+	}
+	return machine.LastPopedStackElement(), nil
+}
+
+// RunProgram compiles program without imports and executes it with fresh
+// globals, the way every engine runs a whole program for comparison.
+func RunProgram(program *ast.Program) (object.Object, error) {
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		return nil, err
 	}
+	return Execute(comp.Bytecode(), make([]object.Object, GlobalsSize))
+}
+
+// Hits returns how often each of bytecode.Counters ran, by index.
+func (vm *VM) Hits() []int {
+	return vm.hits
 }
 
 func (vm *VM) LastPopedStackElement() object.Object {
@@ -71,15 +113,36 @@ func (vm *VM) LastPopedStackElement() object.Object {
 }
 
 func (vm *VM) Run() error {
+	err := vm.run(0)
+	if err != nil && vm.tracer != nil {
+		vm.tracer.fail(vm, err, 0)
+	}
+	return err
+}
+
+// run executes instructions until the frame at depth returns, the main frame
+// never does, it ends with its instructions.
+func (vm *VM) run(depth int) error {
 	var ip int
 	var op code.Opcode
 	var ins code.Instructions
 
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions()) {
+	for vm.framesIndex > depth && vm.currentFrame().ip < len(vm.currentFrame().Instructions()) {
 		vm.currentFrame().ip++
 		ip = vm.currentFrame().ip
 		ins = vm.currentFrame().Instructions()
 		op = code.Opcode(ins[ip-1])
+		if vm.profiler != nil {
+			vm.profiler.instruction(vm, op)
+		}
+		if vm.hook != nil {
+			if err := vm.hook(vm); err != nil {
+				return err
+			}
+		}
+		if vm.tracer != nil {
+			vm.tracer.begin(vm, ip-1, op)
+		}
 
 		switch op {
 		case code.OpConstant:
@@ -110,7 +173,7 @@ func (vm *VM) Run() error {
 				return err
 			}
 
-		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
+		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan:
 			err := vm.executeComparison(op)
 			if err != nil {
 				return err
@@ -119,12 +182,12 @@ func (vm *VM) Run() error {
 		case code.OpBang:
 			err := vm.executeBangOperator()
 			if err != nil {
-				return nil
+				return err
 			}
 		case code.OpMinus:
 			err := vm.executeMinusOperator()
 			if err != nil {
-				return nil
+				return err
 			}
 
 		case code.OpJump:
@@ -280,6 +343,19 @@ func (vm *VM) Run() error {
 				return err
 			}
 
+		case code.OpCoverage:
+			counter := code.ReadUint16(ins[ip:])
+			vm.currentFrame().ip += 2
+			vm.hits[counter]++
+
+		case code.OpImport:
+			constIndex := int(code.ReadUint16(ins[ip:]))
+			vm.currentFrame().ip += 2
+			err := vm.importModule(constIndex)
+			if err != nil {
+				return err
+			}
+
 		case code.OpLoadInt:
 			num := int(code.ReadUint32(ins[ip:]))
 			vm.currentFrame().ip += 4
@@ -288,11 +364,26 @@ func (vm *VM) Run() error {
 				return err
 			}
 		}
-
+		if vm.tracer != nil {
+			vm.tracer.end(vm)
+		}
 	}
 	return nil
 }
 
+// File returns the module the innermost frame is in, empty in the program
+// itself.
+func (vm *VM) File() string {
+	return vm.currentFrame().cl.Fn.File
+}
+
+// Position returns where in the source the innermost frame is, after Run
+// failed it is the instruction that failed.
+func (vm *VM) Position() (code.Position, bool) {
+	frame := vm.currentFrame()
+	return frame.cl.Fn.SourceMap.Lookup(frame.ip - 1)
+}
+
 func (vm *VM) push(ob object.Object) error {
 	if vm.sp >= StackSize {
 		return fmt.Errorf("Stack Overflow")
@@ -341,6 +432,9 @@ func (vm *VM) executeIntegerBinaryOperation(op code.Opcode, left, right object.O
 		result = leftValue * rightValue
 
 	case code.OpDiv:
+		if rightValue == 0 {
+			return fmt.Errorf("division by zero")
+		}
 		result = leftValue / rightValue
 	default:
 		return fmt.Errorf("unknow integer operation: %d", op)
@@ -367,6 +461,9 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 	if left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ {
 		return vm.executeIntegerComparison(op, left, right)
 	}
+	if left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ {
+		return vm.executeStringComparison(op, left, right)
+	}
 
 	var result bool
 	switch op {
@@ -394,6 +491,8 @@ func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object
 
 	case code.OpGreaterThan:
 		result = rightValue > leftValue
+	case code.OpLessThan:
+		result = rightValue < leftValue
 	default:
 		return fmt.Errorf("unknown operator %d", op)
 	}
@@ -401,6 +500,22 @@ func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object
 	return vm.push(nativeBooleanObject(result))
 }
 
+// executeStringComparison compares strings by value, every string built at
+// run time is a new object.
+func (vm *VM) executeStringComparison(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch op {
+	case code.OpEqual:
+		return vm.push(nativeBooleanObject(leftValue == rightValue))
+	case code.OpNotEqual:
+		return vm.push(nativeBooleanObject(leftValue != rightValue))
+	default:
+		return fmt.Errorf("unknow operator: %d (%s %s)", op, left.Type(), right.Type())
+	}
+}
+
 func (vm *VM) executeBangOperator() error {
 	operand := vm.pop()
 
@@ -526,9 +641,13 @@ func (vm *VM) currentFrame() *Frame {
 	return vm.frames[vm.framesIndex-1]
 }
 
-func (vm *VM) pushFrame(frame *Frame) {
+func (vm *VM) pushFrame(frame *Frame) error {
+	if vm.framesIndex >= MaxFrames {
+		return fmt.Errorf("Stack Overflow")
+	}
 	vm.frames[vm.framesIndex] = frame
 	vm.framesIndex++
+	return nil
 }
 
 func (vm *VM) popFrame() *Frame {
@@ -543,7 +662,20 @@ func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
 	}
 
 	frame := NewFrame(cl, vm.sp-numArgs)
-	vm.pushFrame(frame)
+	if frame.basePointer+cl.Fn.NumLocals >= StackSize {
+		return fmt.Errorf("Stack Overflow")
+	}
+	err := vm.pushFrame(frame)
+	if err != nil {
+		return err
+	}
+	if vm.profiler != nil {
+		vm.profiler.call(cl.Fn)
+	}
+	if vm.hook != nil {
+		// debuggers tell the locals that were not set yet by nil
+		clear(vm.stack[vm.sp:min(frame.basePointer+cl.Fn.NumLocals, StackSize)])
+	}
 	vm.sp = frame.basePointer + cl.Fn.NumLocals
 	return nil
 }
@@ -562,9 +694,15 @@ func (vm *VM) executeCall(numArg int) error {
 	}
 }
 
+// callBuiltin stops the vm with the message of an *object.Error the builtin
+// returns instead of pushing it, like the evaluator stops at it, so
+// len(1) + 1 fails in len and not in the addition and the assert builtins
+// end a test.
 func (vm *VM) callBuiltin(fn *object.Builtin, numArg int) error {
 	args := vm.stack[vm.sp-numArg : vm.sp]
-	result := fn.Fn(args...)
+	result := fn.Call(vm.apply, args...)
+	// the builtin and its arguments are replaced by the result
+	vm.sp = vm.sp - numArg - 1
 
 	if result != nil {
 		switch result := result.(type) {
@@ -575,6 +713,9 @@ func (vm *VM) callBuiltin(fn *object.Builtin, numArg int) error {
 			}
 			return vm.push(False)
 
+		case *object.Error:
+			return fmt.Errorf("%s", result.Message)
+
 		default:
 			return vm.push(result)
 
@@ -584,6 +725,69 @@ func (vm *VM) callBuiltin(fn *object.Builtin, numArg int) error {
 	}
 }
 
+// apply calls fn from a builtin, it runs on the stack above the builtin's
+// arguments and leaves the vm as it found it, even when fn fails.
+func (vm *VM) apply(fn object.Object, args ...object.Object) object.Object {
+	sp, depth := vm.sp, vm.framesIndex
+	defer func() {
+		vm.sp, vm.framesIndex = sp, depth
+	}()
+	pending := 0
+	if vm.tracer != nil {
+		pending = len(vm.tracer.pending)
+	}
+
+	err := vm.push(fn)
+	for _, arg := range args {
+		if err == nil {
+			err = vm.push(arg)
+		}
+	}
+	if err == nil {
+		err = vm.executeCall(len(args))
+	}
+	if err == nil {
+		err = vm.run(depth)
+	}
+	if err != nil {
+		if vm.tracer != nil {
+			vm.tracer.fail(vm, err, pending)
+		}
+		return object.NewError("%s", err)
+	}
+	return vm.pop()
+}
+
+// importModule pushes the exports of the module, its function runs in
+// the vm the first time. When it fails the frames are left as they are so
+// Position tells where.
+func (vm *VM) importModule(constIndex int) error {
+	exports, ok := vm.modules[constIndex]
+	if !ok {
+		fn, ok := vm.constant[constIndex].(*object.CompiledFunction)
+		if !ok {
+			return fmt.Errorf("not a module: %+v", vm.constant[constIndex])
+		}
+		depth := vm.framesIndex
+		err := vm.push(&object.Closure{Fn: fn})
+		if err == nil {
+			err = vm.executeCall(0)
+		}
+		if err == nil {
+			err = vm.run(depth)
+		}
+		if err != nil {
+			return err
+		}
+		exports = vm.pop()
+		if vm.modules == nil {
+			vm.modules = map[int]object.Object{}
+		}
+		vm.modules[constIndex] = exports
+	}
+	return vm.push(exports)
+}
+
 func (vm *VM) pushClosure(constIndex, numFree int) error {
 	constant := vm.constant[constIndex]
 
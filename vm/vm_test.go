@@ -1,747 +1,201 @@
 package vm
 
 import (
-	"fmt"
+	"bytes"
 	"mokey-type/ast"
 	"mokey-type/compiler"
-	"mokey-type/lexer"
+	"mokey-type/conformance"
+	"mokey-type/module"
 	"mokey-type/object"
-	"mokey-type/parser"
+	"path/filepath"
 	"testing"
 )
 
-type vmTestCase struct {
-	input    string
-	expected interface{}
-}
-
-func parse(input string) *ast.Program {
-	l := lexer.New(input)
-	p := parser.New(l)
-	return p.ParseProgram()
-}
-
-func testIntegerObject(expected int64, actual object.Object) error {
-	result, ok := actual.(*object.Integer)
-	if !ok {
-		return fmt.Errorf("object is not Integer. got=%T (%+v)", actual, actual)
+// runEncodedVm runs the bytecode after a round trip through the .mkc format
+// and the verifier, like a program loaded from disk.
+func runEncodedVm(program *ast.Program) (object.Object, error) {
+	comp := compiler.New()
+	err := comp.Compile(program)
+	if err != nil {
+		return nil, err
 	}
-	if result.Value != expected {
-		return fmt.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+	var buf bytes.Buffer
+	err = comp.Bytecode().Encode(&buf)
+	if err != nil {
+		return nil, err
 	}
-	return nil
-}
-
-func testStringObject(expected string, actual object.Object) error {
-	result, ok := actual.(*object.String)
-	if !ok {
-		return fmt.Errorf("object is not Integer. got=%T (%+v)", actual, actual)
+	bytecode, err := compiler.Decode(&buf)
+	if err != nil {
+		return nil, err
 	}
-	if result.Value != expected {
-		return fmt.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+	err = bytecode.Verify(StackSize)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return Execute(bytecode, make([]object.Object, GlobalsSize))
 }
 
-func runVmTests(t *testing.T, tests []vmTestCase) {
+func runVmTests(t *testing.T, tests []conformance.Case) {
 	t.Helper()
-	for _, tt := range tests {
-		program := parse(tt.input)
-		comp := compiler.New()
-		err := comp.Compile(program)
-		if err != nil {
-			t.Fatalf("compiler error: %s", err)
-		}
-		vm := New(comp.Bytecode())
-		err = vm.Run()
-		if err != nil {
-			t.Fatalf("vm error: %s", err)
-		}
-		stackElem := vm.LastPopedStackElement()
-		testExpectedObjectWithInput(t, tt.expected, stackElem, tt.input)
-	}
-}
-
-func testBooleanObject(expected bool, actual object.Object) error {
-	result, ok := actual.(*object.Boolean)
-	if !ok {
-		return fmt.Errorf("object is not boolean got=%T (%+v)", actual, actual)
-	}
-
-	if result.Value != expected {
-		return fmt.Errorf("object has wrong value got=%t want=%t", result.Value, expected)
-	}
-	return nil
-}
-
-func testExpectedObject(t *testing.T, expected interface{}, actual object.Object) {
-	t.Helper()
-	switch expected := expected.(type) {
-	case int:
-		err := testIntegerObject(int64(expected), actual)
-		if err != nil {
-			t.Fatalf("testIntegerObject failed: %s", err)
-		}
-
-	case bool:
-		err := testBooleanObject(bool(expected), actual)
-		if err != nil {
-			t.Errorf("testBooleanObject failed: %s", err)
-		}
-
-	case string:
-		err := testStringObject(string(expected), actual)
-		if err != nil {
-			t.Errorf("testBooleanObject failed: %s", err)
-		}
-	}
-}
-
-func testExpectedObjectWithInput(t *testing.T, expected interface{}, actual object.Object, input string) {
-	t.Helper()
-	switch expected := expected.(type) {
-	case int:
-		err := testIntegerObject(int64(expected), actual)
-		if err != nil {
-			t.Fatalf("testIntegerObject failed: input=%s %s", input, err)
-		}
-
-	case bool:
-		err := testBooleanObject(bool(expected), actual)
-		if err != nil {
-			t.Errorf("testBooleanObject failed: input=%s %s", input, err)
-		}
-
-	case *object.NullValue:
-		if actual != Null {
-			t.Errorf("object is not Null: input=%s %T (%+v)", input, actual, actual)
-		}
-
-	case string:
-		err := testStringObject(string(expected), actual)
-		if err != nil {
-			t.Errorf("testBooleanObject failed: input=%s %s", input, err)
-		}
-
-	case []int:
-		array, ok := actual.(*object.Array)
-		if !ok {
-			t.Errorf("object not Array: input=%s %T (%+v)", input, actual, actual)
-			return
-		}
-		if len(array.Elements) != len(expected) {
-			t.Errorf("wrong num of elements.input=%s want=%d, got=%d",
-				input, len(expected), len(array.Elements))
-			return
-		}
-		for i, expectedElem := range expected {
-			err := testIntegerObject(int64(expectedElem), array.Elements[i])
-			if err != nil {
-				t.Errorf("testIntegerObject failed: input=%s %s", input, err)
-			}
-		}
-
-	case map[object.HashKey]int64:
-		hash, ok := actual.(*object.Hash)
-		if !ok {
-			t.Errorf("object is not Hash. input=%s got=%T (%+v)", input, actual, actual)
-			return
-		}
-		if len(hash.Pairs) != len(expected) {
-			t.Errorf("hash has wrong number of Pairs. input=%s want=%d, got=%d",
-				input, len(expected), len(hash.Pairs))
-			return
-		}
-		for expectedKey, expectedValue := range expected {
-			pair, ok := hash.Pairs[expectedKey]
-			if !ok {
-				t.Errorf("no pair for given key in Pairs, input=%s", input)
-			}
-			err := testIntegerObject(expectedValue, pair.Value)
-			if err != nil {
-				t.Errorf("testIntegerObject failed: input=%s %s", input, err)
-			}
-		}
-
-	case *object.Error:
-		errObj, ok := actual.(*object.Error)
-		if !ok {
-			t.Errorf("object is not Error: input=%s %T (%+v)", input, actual, actual)
-			return
-		}
-		if errObj.Message != expected.Message {
-			t.Errorf("wrong error message. input=%s expected=%q, got=%q", input, expected.Message, errObj.Message)
-		}
-
-	}
+	conformance.Run(t, RunProgram, tests)
 }
 
 func TestIntegerArithmetic(t *testing.T) {
-	tests := []vmTestCase{
-		{"1", 1},
-		{"2", 2},
-		{"1 + 2", 3},
-		{"1 - 2", -1},
-		{"1 * 2", 2},
-		{"4 / 2", 2},
-		{"50 / 2 * 2 + 10 - 5", 55},
-		{"5 + 5 + 5 + 5 - 10", 10},
-		{"2 * 2 * 2 * 2 * 2", 32},
-		{"5 * 2 + 10", 20},
-		{"5 + 2 * 10", 25},
-		{"5 * (2 + 10)", 60},
-		{"-5", -5},
-		{"-10", -10},
-		{"-50 + 100 + -50", 0},
-		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
-		{"++1", 2},
-		{"--2", 1},
-	}
-	runVmTests(t, tests)
+	runVmTests(t, conformance.IntegerArithmetic)
 }
 
 func TestBooleanExpressions(t *testing.T) {
-	tests := []vmTestCase{
-		{"true", true},
-		{"false", false},
-		{"1 < 2", true},
-		{"1 > 2", false},
-		{"1 < 1", false},
-		{"1 > 1", false},
-		{"1 == 1", true},
-		{"1 != 1", false},
-		{"1 == 2", false},
-		{"1 != 2", true},
-		{"true == true", true},
-		{"false == false", true},
-		{"true == false", false},
-		{"true != false", true},
-		{"false != true", true},
-		{"(1 < 2) == true", true},
-		{"(1 < 2) == false", false},
-		{"(1 > 2) == true", false},
-		{"(1 > 2) == false", true},
-		{"!true", false},
-		{"!false", true},
-		{"!5", false},
-		{"!!true", true},
-		{"!!false", false},
-		{"!!5", true},
-		{"!(if (false) { 5; })", true},
-	}
-	runVmTests(t, tests)
+	runVmTests(t, conformance.BooleanExpressions)
 }
 
 func TestConditionals(t *testing.T) {
-	tests := []vmTestCase{
-		{"if (true) { 10 }", 10},
-		{"if (true) { 10 } else { 20 }", 10},
-		{"if (false) { 10 } else { 20 } ", 20},
-		{"if (1) { 10 }", 10},
-		{"if (1 < 2) { 10 }", 10},
-		{"if (1 < 2) { 10 } else { 20 }", 10},
-		{"if (1 > 2) { 10 } else { 20 }", 20},
-		{"if (1 > 2) { 10 }", Null},
-		{"if (false) { 10 }", Null},
-		{"if ((if (false) { 10 })) { 10 } else { 20 }", 20},
-	}
-	runVmTests(t, tests)
+	runVmTests(t, conformance.Conditionals)
 }
 
 func TestGlobalLetStatements(t *testing.T) {
-	tests := []vmTestCase{
-		{"let one = 1; one", 1},
-		{"let one = 1; let two = 2; one + two", 3},
-		{"let one = 1; let two = one + one; one + two", 3},
-	}
-	runVmTests(t, tests)
+	runVmTests(t, conformance.GlobalLetStatements)
 }
 
 func TestStringExpresions(t *testing.T) {
-	tests := []vmTestCase{
-		{`"monkey"`, "monkey"},
-		{`"mon" + "key"`, "monkey"},
-		{`"mon" + "key" + "banana"`, "monkeybanana"},
-	}
-	runVmTests(t, tests)
+	runVmTests(t, conformance.StringExpressions)
 }
 
 func TestArrayLiterals(t *testing.T) {
-	tests := []vmTestCase{
-		{"[]", []int{}},
-		{"[1, 2, 3]", []int{1, 2, 3}},
-		{"[1 + 2, 3 * 4, 5 + 6]", []int{3, 12, 11}},
-	}
-	runVmTests(t, tests)
+	runVmTests(t, conformance.ArrayLiterals)
 }
 
 func TestHashLiterals(t *testing.T) {
-	tests := []vmTestCase{
-		{
-			"{}", map[object.HashKey]int64{},
-		},
-		{
-			"{1: 2, 2: 3}",
-			map[object.HashKey]int64{
-				(&object.Integer{Value: 1}).HashKey(): 2,
-				(&object.Integer{Value: 2}).HashKey(): 3,
-			},
-		},
-		{
-			"{1 + 1: 2 * 2, 3 + 3: 4 * 4}",
-			map[object.HashKey]int64{
-				(&object.Integer{Value: 2}).HashKey(): 4,
-				(&object.Integer{Value: 6}).HashKey(): 16,
-			},
-		},
-	}
-	runVmTests(t, tests)
+	runVmTests(t, conformance.HashLiterals)
 }
 
 func TestIndexExpressions(t *testing.T) {
-	tests := []vmTestCase{
-		{"[1, 2, 3][1]", 2},
-		{"[1, 2, 3][0 + 2]", 3},
-		{"[[1, 1, 1]][0][0]", 1},
-		{"[][0]", Null},
-		{"[1, 2, 3][99]", Null},
-		{"[1][-1]", Null},
-		{"{1: 1, 2: 2}[1]", 1},
-		{"{1: 1, 2: 2}[2]", 2},
-		{"{1: 1}[0]", Null},
-		{"{}[0]", Null},
-	}
-	runVmTests(t, tests)
+	runVmTests(t, conformance.IndexExpressions)
 }
 
 func TestCallingFunctionsWithoutArguments(t *testing.T) {
-	tests := []vmTestCase{
-		{
-			input: `
-			let fivePlusTen = fn() { 5 + 10; };
-			fivePlusTen();
-			`,
-			expected: 15,
-		},
-		{
-			input: `
-			let one = fn() { 1; };
-			let two = fn() { 2; };
-			one() + two()
-			`,
-			expected: 3,
-		},
-		{
-			input: `
-			let a = fn() { 1 };
-			let b = fn() { a() + 1 };
-			let c = fn() { b() + 1 };
-			c();
-			`,
-			expected: 3,
-		},
-	}
-	runVmTests(t, tests)
+	runVmTests(t, conformance.CallingFunctionsWithoutArguments)
 }
 
 func TestFunctionsWithReturnStatement(t *testing.T) {
-	tests := []vmTestCase{
-		{
-			input: `
-			let earlyExit = fn() { return 99; 100; };
-			earlyExit();
-			`,
-			expected: 99,
-		},
-		{
-			input: `
-			let earlyExit = fn() { return 99; return 100; };
-			earlyExit();
-			`,
-			expected: 99,
-		},
-	}
-	runVmTests(t, tests)
+	runVmTests(t, conformance.FunctionsWithReturnStatement)
 }
 
 func TestFunctionsWithoutReturnValue(t *testing.T) {
-	tests := []vmTestCase{
-		{
-			input: `
-				let noReturn = fn() { };
-				noReturn();
-			`,
-			expected: Null,
-		},
-		{
-			input: `
-			let noReturn = fn() { };
-			let noReturnTwo = fn() { noReturn(); };
-			noReturn();
-			noReturnTwo();
-			`,
-			expected: Null,
-		},
-	}
-	runVmTests(t, tests)
+	runVmTests(t, conformance.FunctionsWithoutReturnValue)
 }
 
 func TestFirstClassFunctions(t *testing.T) {
-	tests := []vmTestCase{
-		{
-			input: `
-			let returnsOne = fn() { 1; };
-			let returnsOneReturner = fn() { returnsOne; };
-			returnsOneReturner()();
-			`,
-			expected: 1,
-		},
-	}
-	runVmTests(t, tests)
+	runVmTests(t, conformance.FirstClassFunctions)
 }
 
 func TestCallingFunctionsWithBindings(t *testing.T) {
-	tests := []vmTestCase{
-		{
-			input: `
-			let one = fn() { let one = 1; one };
-			one();
-			`,
-			expected: 1,
-		},
-		{
-			input: `
-			let oneAndTwo = fn() { let one = 1; let two = 2; one + two; };
-			oneAndTwo();
-			`,
-			expected: 3,
-		},
-		{
-			input: `
-			let oneAndTwo = fn() { let one = 1; let two = 2; one + two; };
-			let threeAndFour = fn() { let three = 3; let four = 4; three + four; };
-			oneAndTwo() + threeAndFour();
-			`,
-			expected: 10,
-		},
-		{
-			input: `
-			let firstFoobar = fn() { let foobar = 50; foobar; };
-			let secondFoobar = fn() { let foobar = 100; foobar; };
-			firstFoobar() + secondFoobar();
-			`,
-			expected: 150,
-		},
-		{
-			input: `
-			let globalSeed = 50;
-			let minusOne = fn() {
-			let num = 1;
-			globalSeed - num;
-			}
-			let minusTwo = fn() {
-			let num = 2;
-			globalSeed - num;
-			}
-			minusOne() + minusTwo();
-			`,
-			expected: 97,
-		},
-	}
-	runVmTests(t, tests)
+	runVmTests(t, conformance.CallingFunctionsWithBindings)
 }
 
 func TestCallingFunctionsWithArgumentsAndBindings(t *testing.T) {
-	tests := []vmTestCase{
-		{
-			input: `
-			let identity = fn(a) { a; };
-			identity(4);
-			`,
-			expected: 4,
-		},
-		{
-			input: `
-			let sum = fn(a, b) { a + b; };
-			sum(1, 2);
-			`,
-			expected: 3,
-		},
-		{
-			input: `
-			let sum = fn(a, b) {
-			let c = a + b;
-			c;
-			};
-			sum(1, 2);
-			`,
-			expected: 3,
-		},
-		{
-			input: `
-			let sum = fn(a, b) {
-			let c = a + b;
-			c;
-			};
-			sum(1, 2) + sum(3, 4);`,
-			expected: 10,
-		},
-		{
-			input: `
-			let sum = fn(a, b) {
-			let c = a + b;
-			c;
-			};
-			let outer = fn() {
-			sum(1, 2) + sum(3, 4);
-			};
-			outer();
-			`,
-			expected: 10,
-		},
-		{
-			input: `
-			let globalNum = 10;
-			let sum = fn(a, b) {
-				let c = a + b;
-				c + globalNum;
-			};
-			let outer = fn() {
-				sum(1, 2) + sum(3, 4) + globalNum;
-			};
-			outer() + globalNum;
-			`,
-			expected: 50,
-		},
-	}
-	runVmTests(t, tests)
+	runVmTests(t, conformance.CallingFunctionsWithArgumentsAndBindings)
 }
+
 func TestCallingFunctionsWithWrongArguments(t *testing.T) {
-	tests := []vmTestCase{
-		{
-			input:    `fn() { 1; }(1);`,
-			expected: `wrong number of arguments: want=0, got=1`,
-		},
-		{
-			input:    `fn(a) { a; }();`,
-			expected: `wrong number of arguments: want=1, got=0`,
-		},
-		{
-			input:    `fn(a, b) { a + b; }(1);`,
-			expected: `wrong number of arguments: want=2, got=1`,
-		},
-	}
-	for _, tt := range tests {
-		program := parse(tt.input)
-		comp := compiler.New()
-		err := comp.Compile(program)
-		if err != nil {
-			t.Fatalf("compiler error: %s", err)
-		}
-		vm := New(comp.Bytecode())
-		err = vm.Run()
-		if err == nil {
-			t.Fatalf("expected VM error but resulted in none.")
-		}
-		if err.Error() != tt.expected {
-			t.Fatalf("wrong VM error: want=%q, got=%q", tt.expected, err)
-		}
-	}
+	runVmTests(t, conformance.CallingFunctionsWithWrongArguments)
 }
 
 func TestBuiltinFunctions(t *testing.T) {
-	tests := []vmTestCase{
-		{`len("")`, 0},
-		{`len("four")`, 4},
-		{`len("hello world")`, 11},
-		{
-			`len(1)`,
-			&object.Error{
-				Message: "argument to `len` not supported, got INTEGER",
-			},
-		},
-		{`len("one", "two")`,
-			&object.Error{
-				Message: "wrong number of arguments. got=2, want=1",
-			},
-		},
-		{`len([1, 2, 3])`, 3},
-		{`len([])`, 0},
-		{`puts("hello", "world!")`, Null},
-		{`first([1, 2, 3])`, 1},
-		{`first([])`, Null},
-		{`first(1)`,
-			&object.Error{
-				Message: "argument to `first` must be ARRAY, got INTEGER",
-			},
-		},
-		{`last([1, 2, 3])`, 3},
-		{`last([])`, Null},
-		{`last(1)`,
-			&object.Error{
-				Message: "argument to `last` must be ARRAY, got INTEGER",
-			},
-		},
-		{`rest([1, 2, 3])`, []int{2, 3}},
-		{`rest([])`, Null},
-		{`push([], 1)`, []int{1}},
-		{`push(1, 1)`,
-			&object.Error{
-				Message: "argument to `push` must be ARRAY, got INTEGER",
-			},
-		},
-	}
-	runVmTests(t, tests)
+	runVmTests(t, conformance.BuiltinFunctions)
 }
 
 func TestClosures(t *testing.T) {
-	tests := []vmTestCase{
-		{
-			input: `
-			let newClosure = fn(a) {
-				fn() { a; };
-			};
-			let closure = newClosure(99);
-			closure();
-			`,
-			expected: 99,
-		},
-		{
-			input: `
-			let newAdder = fn(a, b) {
-				fn(c) { a + b + c };
-			};
-			let adder = newAdder(1, 2);
-			adder(8);
-			`,
-			expected: 11,
-		},
-		{
-			input: `
-			let newAdder = fn(a, b) {
-				let c = a + b;
-				fn(d) { c + d };
-			};
-			let adder = newAdder(1, 2);
-			adder(8);
-			`,
-			expected: 11,
-		},
-		{
-			input: `
-			let newAdderOuter = fn(a, b) {
-				let c = a + b;
-				fn(d) {
-					let e = d + c;
-					fn(f) { e + f; };
-				};
-			};
-			let newAdderInner = newAdderOuter(1, 2)
-			let adder = newAdderInner(3);
-			adder(8);
-			`,
-			expected: 14,
-		},
-		{
-			input: `
-			let a = 1;
-			let newAdderOuter = fn(b) {
-				fn(c) {
-					fn(d) { a + b + c + d };
-				};
-			};
-			let newAdderInner = newAdderOuter(2)
-			let adder = newAdderInner(3);
-			adder(8);
-			`,
-			expected: 14,
-		},
-		{
-			input: `
-			let newClosure = fn(a, b) {
-				let one = fn() { a; };
-				let two = fn() { b; };
-				fn() { one() + two(); };
-			};
-			let closure = newClosure(9, 90);
-			closure();
-			`,
-			expected: 99,
-		},
-	}
-	runVmTests(t, tests)
+	runVmTests(t, conformance.Closures)
 }
 
 func TestRecursiveFunctions(t *testing.T) {
-	tests := []vmTestCase{
-		{
-			input: `
-			let countDown = fn(x) {
-				if (x == 0) {
-					return 0;
-				} else {
-					countDown(x - 1);
-				}
-			};
-			countDown(1);
-			`,
-			expected: 0,
-		},
-		{
-			input: `
-			let countDown = fn(x) {
-				if (x == 0) {
-					return 0;
-				} else {
-					countDown(x - 1);
-				}
-			};
-			let wrapper = fn() {
-				countDown(1);
-			};
-			wrapper();
-			`,
-			expected: 0,
-		},
-		{
-			input: `
-			let wrapper = fn() {
-				let countDown = fn(x) {
-					if (x == 0) {
-						return 0;
-					} else {
-						countDown(x - 1);
-					}
-				};
-				countDown(1);
-			};
-			wrapper();
-			`,
-			expected: 0,
-		},
-	}
-	runVmTests(t, tests)
+	runVmTests(t, conformance.RecursiveFunctions)
 }
 
 func TestRecursiveFibonacci(t *testing.T) {
-	tests := []vmTestCase{
-		{
-			input: `
-			let fibonacci = fn(x) {
-				if (x == 0) {
-					return 0;
-				} else {
-					if (x == 1) {
-						return 1;
-					} else {
-						fibonacci(x - 1) + fibonacci(x - 2);
-					}
-				}
-			};
-			fibonacci(8);
-			`,
-			expected: 21,
-		},
+	runVmTests(t, conformance.RecursiveFibonacci)
+}
+
+func TestAssertErrors(t *testing.T) {
+	runVmTests(t, conformance.AssertErrors)
+}
+
+func TestEncodedBytecode(t *testing.T) {
+	for _, suite := range conformance.Suites {
+		t.Run(suite.Name, func(t *testing.T) {
+			conformance.Run(t, runEncodedVm, suite.Cases)
+		})
+	}
+}
+
+func TestForLoops(t *testing.T) {
+	tests := []conformance.Case{
+		{Input: "for (let i = 0; i < 3; ++i) { i }; 10", Expected: 10},
+		{Input: "let f = fn(n) { for (let i = 0; i < n; ++i) { i }; n * 2 }; f(3)", Expected: 6},
+		{Input: "let f = fn() { for (let i = 0; i < 5000; ++i) { i } }; f()", Expected: conformance.Null},
 	}
 	runVmTests(t, tests)
 }
+
+func runVmModule(file string, program *ast.Program) (object.Object, error) {
+	comp := compiler.New()
+	comp.EnableImports(file, module.NewLoader(nil))
+	err := comp.Compile(program)
+	if err != nil {
+		return nil, err
+	}
+	return Execute(comp.Bytecode(), make([]object.Object, GlobalsSize))
+}
+
+func TestImports(t *testing.T) {
+	conformance.RunModules(t, runVmModule, conformance.Modules)
+}
+
+func TestImportErrors(t *testing.T) {
+	dir := conformance.WriteModules(t, map[string]string{
+		"puts.mk":  `let x = puts("loaded");`,
+		"bad.mk":   "let f = fn(x) {\n  x + true\n};\nlet y = f(1);",
+		"scope.mk": `let f = fn() { secret };`,
+	})
+	file := filepath.Join(dir, "main.mk")
+
+	// a module runs once however many times it is imported
+	var out bytes.Buffer
+	stdout := object.Stdout
+	object.Stdout = &out
+	defer func() { object.Stdout = stdout }()
+	_, err := runVmModule(file, conformance.Parse(`import "puts"; let f = fn() { import "puts" }; f(); f();`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "loaded\n" {
+		t.Errorf("module ran more than once. got=%q", out.String())
+	}
+
+	comp := compiler.New()
+	comp.EnableImports(file, module.NewLoader(nil))
+	err = comp.Compile(conformance.Parse("let secret = 1;\nimport \"bad\";"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := New(comp.Bytecode())
+	err = machine.Run()
+	if err == nil || err.Error() != "unsoported types for binary operation: INTEGER BOOLEAN" {
+		t.Fatalf("wrong error. got=%v", err)
+	}
+	pos, ok := machine.Position()
+	if machine.File() != filepath.Join(dir, "bad.mk") || !ok || pos.Line != 2 || pos.Column != 3 {
+		t.Errorf("wrong position. got=%s %+v", machine.File(), pos)
+	}
+
+	_, err = runVmModule(file, conformance.Parse(`let secret = 1; import "scope"`))
+	expected := filepath.Join(dir, "scope.mk") + ":1:16: undefined variable: secret"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%v", expected, err)
+	}
+
+	_, err = RunProgram(conformance.Parse(`import "puts"`))
+	if err == nil || err.Error() != "imports are not enabled" {
+		t.Errorf("wrong error. got=%v", err)
+	}
+}